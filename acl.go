@@ -0,0 +1,89 @@
+package ups
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ACL is a network access control list for requests, checked before the
+// request body is read.  Requests that are not allowed get a 403
+// response.
+type ACL struct {
+	// Allow, if not empty, lists the networks of the clients that are
+	// allowed.
+	Allow []netip.Prefix
+
+	// Deny lists the networks of the clients that are denied, even if
+	// they are in Allow.
+	Deny []netip.Prefix
+
+	// TrustedProxies lists the networks of the proxies whose
+	// X-Forwarded-For headers are used to determine the client address.
+	TrustedProxies []netip.Prefix
+}
+
+// NewACL creates an ACL from lists of CIDRs.  Addresses without prefix
+// lengths are treated as single addresses.
+func NewACL(allow, deny, trustedProxies []string) (*ACL, error) {
+	acl := &ACL{}
+	var err error
+	if acl.Allow, err = parsePrefixes(allow); err != nil {
+		return nil, err
+	}
+	if acl.Deny, err = parsePrefixes(deny); err != nil {
+		return nil, err
+	}
+	if acl.TrustedProxies, err = parsePrefixes(trustedProxies); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+func parsePrefixes(cidrs []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			addr, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Allowed reports whether the client of the request is allowed.  The
+// client address is the one resolved by the ClientIPResolver of the
+// Config, if any, and otherwise, it is resolved using the X-Forwarded-For
+// header of the TrustedProxies.
+func (acl *ACL) Allowed(r *http.Request) bool {
+	addr, ok := ClientIP(r.Context())
+	if !ok {
+		res := &ClientIPResolver{TrustedProxies: acl.TrustedProxies, Headers: []string{"X-Forwarded-For"}}
+		addr, ok = res.ClientIP(r)
+	}
+	if !ok {
+		return false
+	}
+	if containsAddr(acl.Deny, addr) {
+		return false
+	}
+	return len(acl.Allow) == 0 || containsAddr(acl.Allow, addr)
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
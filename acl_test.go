@@ -0,0 +1,55 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestACL(t *testing.T) {
+	acl, err := NewACL([]string{"10.0.0.0/8", "192.0.2.1"}, []string{"10.1.0.0/16"}, []string{"172.16.0.0/12"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig
+	config.ACL = acl
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+
+	for _, test := range []struct {
+		remoteAddr string
+		forwarded  []string
+		code       int
+	}{
+		{"10.2.3.4:1234", nil, http.StatusOK},
+		{"192.0.2.1:1234", nil, http.StatusOK},
+		{"192.0.2.2:1234", nil, http.StatusForbidden},
+		{"10.1.2.3:1234", nil, http.StatusForbidden},
+		{"10.2.3.4:1234", []string{"192.0.2.2"}, http.StatusOK},
+		{"172.16.0.1:1234", []string{"10.2.3.4"}, http.StatusOK},
+		{"172.16.0.1:1234", []string{"10.2.3.4, 172.16.0.2"}, http.StatusOK},
+		{"172.16.0.1:1234", []string{"10.2.3.4", "10.1.2.3"}, http.StatusForbidden},
+		{"172.16.0.1:1234", []string{"garbage"}, http.StatusForbidden},
+		{"172.16.0.1:1234", nil, http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = test.remoteAddr
+		for _, forwarded := range test.forwarded {
+			req.Header.Add("X-Forwarded-For", forwarded)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != test.code {
+			t.Errorf("%s %v: response code: expected: %d, got: %d", test.remoteAddr, test.forwarded, test.code, resp.Code)
+		}
+	}
+
+	if _, err := NewACL([]string{"bad"}, nil, nil); err == nil {
+		t.Errorf("expected error for bad CIDR")
+	}
+}
@@ -0,0 +1,95 @@
+package aip
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/qpliu/ups/upspb"
+)
+
+func TestParseFilter(t *testing.T) {
+	for _, test := range []struct {
+		filter   string
+		expected string
+	}{
+		{`a = 1`, `a = 1`},
+		{`a.b.c != "x y"`, `a.b.c != "x y"`},
+		{`a > -30 AND b <= 2.5e-3`, `(a > -30 AND b <= 2.5e-3)`},
+		{`a b OR c`, `(a AND (b OR c))`},
+		{`NOT a = 1 AND -b:c`, `(NOT a = 1 AND NOT b : c)`},
+		{`(a = 1 OR b = 2) c = 'it\'s'`, `((a = 1 OR b = 2) AND c = "it's")`},
+		{`regex(name, "^a") = true`, `regex(name, "^a") = true`},
+		{`labels.env:*`, `labels.env : *`},
+		{`create_time > "2012-04-21T11:30:00-04:00"`, `create_time > "2012-04-21T11:30:00-04:00"`},
+		{`prod`, `prod`},
+	} {
+		e, err := ParseFilter(test.filter)
+		if err != nil {
+			t.Errorf("%s: %v", test.filter, err)
+		} else if e.String() != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.filter, test.expected, e.String())
+		}
+	}
+	for _, filter := range []string{`a =`, `(a = 1`, `a = 1)`, `AND`, `"unterminated`, `a = 1 OR`} {
+		if _, err := ParseFilter(filter); err == nil {
+			t.Errorf("%s: expected error", filter)
+		}
+	}
+	for _, filter := range []string{strings.Repeat("(", 100000) + "a", "a = " + strings.Repeat("f(", 100000)} {
+		if _, err := ParseFilter(filter); err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+			t.Errorf("%.10s: expected depth error, got %v", filter, err)
+		}
+	}
+	if _, err := ParseFilter(strings.Repeat("(", 64) + "a" + strings.Repeat(")", 64)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if e, err := ParseFilter("  "); e != nil || err != nil {
+		t.Errorf("expected empty filter, got %v %v", e, err)
+	}
+}
+
+func TestParseOrderBy(t *testing.T) {
+	orderBy, err := ParseOrderBy("foo desc, bar.baz,qux asc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []OrderBy{{"foo", true}, {"bar.baz", false}, {"qux", false}}
+	if !reflect.DeepEqual(orderBy, expected) {
+		t.Errorf("expected %v, got %v", expected, orderBy)
+	}
+	for _, orderBy := range []string{"foo sideways", "foo,,bar", "foo bar baz", "a-b"} {
+		if _, err := ParseOrderBy(orderBy); err == nil {
+			t.Errorf("%s: expected error", orderBy)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	md := proto.MessageReflect(&upspb.Operation{}).Descriptor()
+	for filter, valid := range map[string]bool{
+		`name = "a" AND done = true`: true,
+		`error.code = 5`:             true,
+		`error.codes = 5`:            false,
+		`name.first = "a"`:           false,
+		`unknown = 1`:                false,
+	} {
+		e, err := ParseFilter(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ValidateFilter(e, md); (err == nil) != valid {
+			t.Errorf("%s: unexpected validation %v", filter, err)
+		}
+	}
+	orderBy, _ := ParseOrderBy("error.message desc")
+	if err := ValidateOrderBy(orderBy, md); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	orderBy, _ = ParseOrderBy("error.unknown")
+	if err := ValidateOrderBy(orderBy, md); err == nil {
+		t.Errorf("expected error")
+	}
+}
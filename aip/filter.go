@@ -0,0 +1,458 @@
+// Package aip parses the filter and order_by fields of list requests, as
+// described by https://google.aip.dev/160 and https://google.aip.dev/132,
+// into syntax trees that handlers can translate to queries.
+package aip
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr is a node of a parsed filter: an *And, *Or, *Not, *Comparison,
+// *Function, *Member, or *String.
+type Expr interface {
+	String() string
+	expr()
+}
+
+// And is a conjunction, from AND or from a sequence of terms.
+type And struct {
+	Exprs []Expr
+}
+
+// Or is a disjunction.
+type Or struct {
+	Exprs []Expr
+}
+
+// Not is a negation, from NOT or from a - prefix.
+type Not struct {
+	Expr Expr
+}
+
+// Comparison is a restriction, where Op is one of =, !=, <, <=, >, >=,
+// or : for the has operator.
+type Comparison struct {
+	Left  Expr
+	Op    string
+	Right Expr
+}
+
+// Function is a function call, such as regex(name, "^a").
+type Function struct {
+	Name []string
+	Args []Expr
+}
+
+// Member is an unquoted name or value, which may be a path with fields
+// separated by dots, such as a.b.c, or a number, such as 2.5.  A
+// Member that is not in a Comparison is a global restriction.
+type Member struct {
+	Path []string
+}
+
+// String is a quoted string.
+type String struct {
+	Value string
+}
+
+func (*And) expr()        {}
+func (*Or) expr()         {}
+func (*Not) expr()        {}
+func (*Comparison) expr() {}
+func (*Function) expr()   {}
+func (*Member) expr()     {}
+func (*String) expr()     {}
+
+func (e *And) String() string {
+	return "(" + joinExprs(e.Exprs, " AND ") + ")"
+}
+
+func (e *Or) String() string {
+	return "(" + joinExprs(e.Exprs, " OR ") + ")"
+}
+
+func (e *Not) String() string {
+	return "NOT " + e.Expr.String()
+}
+
+func (e *Comparison) String() string {
+	return e.Left.String() + " " + e.Op + " " + e.Right.String()
+}
+
+func (e *Function) String() string {
+	return strings.Join(e.Name, ".") + "(" + joinExprs(e.Args, ", ") + ")"
+}
+
+func (e *Member) String() string {
+	return strings.Join(e.Path, ".")
+}
+
+func (e *String) String() string {
+	return strconv.Quote(e.Value)
+}
+
+func joinExprs(exprs []Expr, sep string) string {
+	s := make([]string, len(exprs))
+	for i, e := range exprs {
+		s[i] = e.String()
+	}
+	return strings.Join(s, sep)
+}
+
+// ParseFilter parses a filter.  It returns nil for an empty filter.
+func ParseFilter(filter string) (Expr, error) {
+	p := &filterParser{src: filter}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokEOF {
+		return nil, nil
+	}
+	e, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.unexpected()
+	}
+	return e, nil
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokText
+	tokString
+	tokPunct
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+
+	// space is true if the token is preceded by whitespace.
+	space bool
+}
+
+// maxFilterDepth is the maximum nesting depth of composite expressions
+// and function arguments in filters.
+const maxFilterDepth = 64
+
+type filterParser struct {
+	src   string
+	pos   int
+	tok   token
+	depth int
+}
+
+func (p *filterParser) expression() (Expr, error) {
+	var exprs []Expr
+	for {
+		e, err := p.sequence()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+		if !p.keyword("AND") {
+			break
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	return and(exprs), nil
+}
+
+func and(exprs []Expr) Expr {
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+	var flat []Expr
+	for _, e := range exprs {
+		if a, ok := e.(*And); ok {
+			flat = append(flat, a.Exprs...)
+		} else {
+			flat = append(flat, e)
+		}
+	}
+	return &And{Exprs: flat}
+}
+
+func (p *filterParser) sequence() (Expr, error) {
+	var exprs []Expr
+	for {
+		e, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+		if p.tok.kind == tokEOF || p.keyword("AND") || p.punct(")") {
+			break
+		}
+	}
+	return and(exprs), nil
+}
+
+func (p *filterParser) factor() (Expr, error) {
+	var exprs []Expr
+	for {
+		e, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, e)
+		if !p.keyword("OR") {
+			break
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return &Or{Exprs: exprs}, nil
+}
+
+func (p *filterParser) term() (Expr, error) {
+	if p.keyword("NOT") || p.punct("-") {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		e, err := p.simple()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Expr: e}, nil
+	}
+	return p.simple()
+}
+
+func (p *filterParser) simple() (Expr, error) {
+	if p.punct("(") {
+		return p.composite()
+	}
+	left, err := p.comparable()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokPunct || !isComparator(p.tok.text) {
+		return left, nil
+	}
+	op := p.tok.text
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var right Expr
+	if p.punct("(") {
+		right, err = p.composite()
+	} else {
+		right, err = p.comparable()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Comparison{Left: left, Op: op, Right: right}, nil
+}
+
+func (p *filterParser) composite() (Expr, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	e, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if !p.punct(")") {
+		return nil, p.unexpected()
+	}
+	return e, p.next()
+}
+
+func (p *filterParser) comparable() (Expr, error) {
+	switch p.tok.kind {
+	case tokString:
+		s, err := unquote(p.tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("aip: invalid string at %d", p.tok.pos)
+		}
+		return &String{Value: s}, p.next()
+	case tokText:
+	default:
+		return nil, p.unexpected()
+	}
+	if isKeyword(p.tok.text) {
+		return nil, p.unexpected()
+	}
+	path := []string{p.tok.text}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	for p.punct(".") && !p.tok.space {
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok.space || (p.tok.kind != tokText && p.tok.kind != tokString) {
+			return nil, p.unexpected()
+		}
+		field := p.tok.text
+		if p.tok.kind == tokString {
+			s, err := unquote(field)
+			if err != nil {
+				return nil, fmt.Errorf("aip: invalid string at %d", p.tok.pos)
+			}
+			field = s
+		}
+		path = append(path, field)
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+	}
+	if !p.punct("(") || p.tok.space {
+		return &Member{Path: path}, nil
+	}
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	f := &Function{Name: path}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	for !p.punct(")") {
+		if len(f.Args) > 0 {
+			if !p.punct(",") {
+				return nil, p.unexpected()
+			}
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		var arg Expr
+		var err error
+		if p.punct("(") {
+			arg, err = p.composite()
+		} else {
+			arg, err = p.comparable()
+		}
+		if err != nil {
+			return nil, err
+		}
+		f.Args = append(f.Args, arg)
+	}
+	return f, p.next()
+}
+
+func (p *filterParser) enter() error {
+	if p.depth >= maxFilterDepth {
+		return fmt.Errorf("aip: filter nested too deeply at %d", p.tok.pos)
+	}
+	p.depth++
+	return nil
+}
+
+func (p *filterParser) leave() {
+	p.depth--
+}
+
+func (p *filterParser) keyword(k string) bool {
+	return p.tok.kind == tokText && p.tok.text == k
+}
+
+func (p *filterParser) punct(s string) bool {
+	return p.tok.kind == tokPunct && p.tok.text == s
+}
+
+func (p *filterParser) unexpected() error {
+	if p.tok.kind == tokEOF {
+		return errors.New("aip: unexpected end of filter")
+	}
+	return fmt.Errorf("aip: unexpected %q at %d", p.tok.text, p.tok.pos)
+}
+
+func isKeyword(s string) bool {
+	return s == "AND" || s == "OR" || s == "NOT"
+}
+
+func isComparator(s string) bool {
+	switch s {
+	case "=", "!=", "<", "<=", ">", ">=", ":":
+		return true
+	}
+	return false
+}
+
+func unquote(s string) (string, error) {
+	if strings.HasPrefix(s, "'") {
+		s = `"` + strings.ReplaceAll(strings.ReplaceAll(s[1:len(s)-1], `\'`, "'"), `"`, `\"`) + `"`
+	}
+	return strconv.Unquote(s)
+}
+
+func (p *filterParser) next() error {
+	start := p.pos
+	for p.pos < len(p.src) && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+	p.tok = token{pos: p.pos, space: p.pos > start || start == 0}
+	if p.pos >= len(p.src) {
+		p.tok.kind = tokEOF
+		return nil
+	}
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "<=") || strings.HasPrefix(p.src[p.pos:], ">=") || strings.HasPrefix(p.src[p.pos:], "!="):
+		p.tok.kind, p.tok.text = tokPunct, p.src[p.pos:p.pos+2]
+		p.pos += 2
+	case c == '-' && p.pos+1 < len(p.src) && p.src[p.pos+1] >= '0' && p.src[p.pos+1] <= '9':
+		p.scanText()
+	case strings.IndexByte("()<>=:.,-", c) >= 0:
+		p.tok.kind, p.tok.text = tokPunct, p.src[p.pos:p.pos+1]
+		p.pos++
+	case c == '"' || c == '\'':
+		end := p.pos + 1
+		for end < len(p.src) && p.src[end] != c {
+			if p.src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.src) {
+			return fmt.Errorf("aip: unterminated string at %d", p.pos)
+		}
+		p.tok.kind, p.tok.text = tokString, p.src[p.pos:end+1]
+		p.pos = end + 1
+	default:
+		p.scanText()
+	}
+	return nil
+}
+
+// scanText scans text, including numbers with decimal points and
+// exponents as a single token.
+func (p *filterParser) scanText() {
+	start := p.pos
+	number := p.src[p.pos] == '-' || (p.src[p.pos] >= '0' && p.src[p.pos] <= '9')
+	p.pos++
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if number && (c == '.' || ((c == '-' || c == '+') && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E'))) {
+			p.pos++
+			continue
+		}
+		if strings.IndexByte(" \t\r\n()<>=:.,!\"'", c) >= 0 {
+			break
+		}
+		p.pos++
+	}
+	p.tok.kind, p.tok.text = tokText, p.src[start:p.pos]
+}
@@ -0,0 +1,59 @@
+package aip
+
+import (
+	"errors"
+	"strings"
+)
+
+// OrderBy is a field of an order_by, such as "create_time desc".
+type OrderBy struct {
+	// Path is the path of the field, with the names separated by dots.
+	Path string
+
+	Desc bool
+}
+
+// ParseOrderBy parses an order_by, which is a comma separated list of
+// fields, each optionally followed by asc or desc.  It returns nil for
+// an empty order_by.
+func ParseOrderBy(orderBy string) ([]OrderBy, error) {
+	if strings.TrimSpace(orderBy) == "" {
+		return nil, nil
+	}
+	var result []OrderBy
+	for _, item := range strings.Split(orderBy, ",") {
+		fields := strings.Fields(item)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, errors.New("aip: invalid order_by: " + orderBy)
+		}
+		o := OrderBy{Path: fields[0]}
+		if len(fields) == 2 {
+			switch fields[1] {
+			case "asc":
+			case "desc":
+				o.Desc = true
+			default:
+				return nil, errors.New("aip: invalid order_by direction: " + fields[1])
+			}
+		}
+		for _, name := range strings.Split(o.Path, ".") {
+			if !isFieldName(name) {
+				return nil, errors.New("aip: invalid order_by field: " + o.Path)
+			}
+		}
+		result = append(result, o)
+	}
+	return result, nil
+}
+
+func isFieldName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
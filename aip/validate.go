@@ -0,0 +1,76 @@
+package aip
+
+import (
+	"errors"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ValidateFilter checks that the left sides of the comparisons of the
+// filter are the paths of fields of the message, by proto name or JSON
+// name, so that handlers only get filters on known fields.
+func ValidateFilter(e Expr, md protoreflect.MessageDescriptor) error {
+	switch e := e.(type) {
+	case nil:
+		return nil
+	case *And:
+		return validateExprs(e.Exprs, md)
+	case *Or:
+		return validateExprs(e.Exprs, md)
+	case *Not:
+		return ValidateFilter(e.Expr, md)
+	case *Comparison:
+		if m, ok := e.Left.(*Member); ok {
+			return validatePath(m.Path, md)
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+func validateExprs(exprs []Expr, md protoreflect.MessageDescriptor) error {
+	for _, e := range exprs {
+		if err := ValidateFilter(e, md); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateOrderBy checks that the fields of the order_by are the paths
+// of fields of the message.
+func ValidateOrderBy(orderBy []OrderBy, md protoreflect.MessageDescriptor) error {
+	for _, o := range orderBy {
+		if err := validatePath(strings.Split(o.Path, "."), md); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validatePath(path []string, md protoreflect.MessageDescriptor) error {
+	for i, name := range path {
+		if md == nil {
+			// Paths into maps are keys.
+			return nil
+		}
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			fd = md.Fields().ByJSONName(name)
+		}
+		if fd == nil {
+			return errors.New("aip: unknown field: " + strings.Join(path[:i+1], "."))
+		}
+		if fd.IsMap() {
+			md = nil
+		} else {
+			md = fd.Message()
+			if md == nil && i < len(path)-1 {
+				return errors.New("aip: unknown field: " + strings.Join(path[:i+2], "."))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package ups
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// AnyResolver resolves the type URLs of google.protobuf.Any fields to
+// the message types that are allowed to be embedded, so that requests
+// and responses embedding other types are rejected instead of failing to
+// unmarshal or exposing arbitrary types.
+type AnyResolver struct {
+	types map[protoreflect.FullName]protoreflect.MessageType
+}
+
+var errAnyType = errors.New("ups: google.protobuf.Any type not allowed")
+
+// NewAnyResolver creates an AnyResolver allowing the types of the
+// messages.
+func NewAnyResolver(msgs ...proto.Message) *AnyResolver {
+	r := &AnyResolver{types: map[protoreflect.FullName]protoreflect.MessageType{}}
+	for _, msg := range msgs {
+		mt := proto.MessageReflect(msg).Type()
+		r.types[mt.Descriptor().FullName()] = mt
+	}
+	return r
+}
+
+func (r *AnyResolver) messageType(typeURL string) (protoreflect.MessageType, bool) {
+	name := typeURL
+	if i := strings.LastIndexByte(typeURL, '/'); i >= 0 {
+		name = typeURL[i+1:]
+	}
+	mt, ok := r.types[protoreflect.FullName(name)]
+	return mt, ok
+}
+
+// Resolve returns a new message of the type of the type URL, implementing
+// jsonpb.AnyResolver.
+func (r *AnyResolver) Resolve(typeURL string) (proto.Message, error) {
+	mt, ok := r.messageType(typeURL)
+	if !ok {
+		return nil, errAnyType
+	}
+	return proto.MessageV1(mt.New().Interface()), nil
+}
+
+// check returns an error if m or its nested messages have Any fields
+// embedding types that are not allowed.
+func (r *AnyResolver) check(m protoreflect.Message) error {
+	if any, ok := m.Interface().(*anypb.Any); ok {
+		if _, ok := r.messageType(any.GetTypeUrl()); !ok && any.GetTypeUrl() != "" {
+			return errAnyType
+		}
+	}
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					err = r.check(v.Message())
+					return err == nil
+				})
+			}
+		case fd.Message() == nil:
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				err = r.check(list.Get(i).Message())
+			}
+		default:
+			err = r.check(v.Message())
+		}
+		return err == nil
+	})
+	return err
+}
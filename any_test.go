@@ -0,0 +1,49 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/qpliu/ups/testingups"
+	"github.com/qpliu/ups/upspb"
+)
+
+func TestAnyResolver(t *testing.T) {
+	config := DefaultConfig
+	config.AnyResolver = NewAnyResolver(&testingups.HelloResponse{})
+	handler := UPSWithConfig(func(req *upspb.Operation) *upspb.Operation {
+		return &upspb.Operation{Name: req.Name, Response: req.Response}
+	}, config)
+
+	call := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/op", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", contentType)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := call("application/json", []byte(`{"name":"op","response":{"@type":"type.googleapis.com/HelloResponse","text":"Hello"}}`))
+	if expected := `{"name":"op","response":{"@type":"type.googleapis.com/HelloResponse","text":"Hello"}}`; resp.Code != http.StatusOK || resp.Body.String() != expected {
+		t.Errorf("unexpected response %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := call("application/json", []byte(`{"name":"op","response":{"@type":"type.googleapis.com/HelloRequest","name":"World"}}`)); resp.Code != http.StatusInternalServerError {
+		t.Errorf("expected disallowed JSON Any to be rejected, got %d", resp.Code)
+	}
+
+	allowed, _ := anypb.New(proto.MessageV2(&testingups.HelloResponse{Text: "Hello"}))
+	disallowed, _ := anypb.New(proto.MessageV2(&testingups.HelloRequest{Name: "World"}))
+	body, _ := proto.Marshal(&upspb.Operation{Name: "op", Response: allowed})
+	if resp := call("application/octet-stream", body); resp.Code != http.StatusOK {
+		t.Errorf("unexpected status %d", resp.Code)
+	}
+	body, _ = proto.Marshal(&upspb.Operation{Name: "op", Response: disallowed})
+	if resp := call("application/octet-stream", body); resp.Code != http.StatusInternalServerError {
+		t.Errorf("expected disallowed Any to be rejected, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,164 @@
+package ups
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	"github.com/qpliu/ups/upspb"
+)
+
+// AsyncResult can be returned as the error of a handler, with a nil
+// message, for a long-running operation, making the response 202 with
+// the Location of the operation, and the upspb.Operation as the body.
+// An AsyncResult is created by Operations.Start.
+type AsyncResult struct {
+	Operation *upspb.Operation
+	Location  string
+}
+
+func (result *AsyncResult) Error() string {
+	return "ups: operation " + result.Operation.Name + " started"
+}
+
+func (result *AsyncResult) StatusCode() int {
+	return http.StatusAccepted
+}
+
+// Operations runs long-running operations and keeps their results for
+// polling with the Handler.
+type Operations struct {
+	// Retention is how long the results of completed operations are
+	// kept.  If zero, they are kept until removed with Delete.
+	Retention time.Duration
+
+	prefix string
+
+	mu         sync.Mutex
+	operations map[string]*upspb.Operation
+}
+
+// NewOperations creates Operations whose Handler is registered at the
+// path prefix, such as "/operations/".
+func NewOperations(prefix string) *Operations {
+	return &Operations{prefix: prefix, operations: map[string]*upspb.Operation{}}
+}
+
+// Start runs f in a new goroutine, with a context that is not canceled
+// when the request completes, and returns an AsyncResult to be returned
+// by the handler.  If the error returned by f implements StatusCoder, it
+// provides the code of the error of the operation.
+//
+// A panic in f fails the operation with code 500.  If the name of the
+// operation cannot be generated, f is not run, and the operation of the
+// AsyncResult is done with the error, without a Location.
+//
+// Request messages are reused after the handler returns, so f must not
+// refer to the request message of the handler.
+func (o *Operations) Start(ctx context.Context, f func(context.Context) (proto.Message, error)) *AsyncResult {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return &AsyncResult{
+			Operation: &upspb.Operation{
+				Done:  true,
+				Error: &upspb.OperationError{Code: http.StatusInternalServerError, Message: err.Error()},
+			},
+		}
+	}
+	name := hex.EncodeToString(b[:])
+
+	o.mu.Lock()
+	o.operations[name] = &upspb.Operation{Name: name}
+	o.mu.Unlock()
+
+	go func() {
+		op := &upspb.Operation{Name: name, Done: true}
+		if resp, err := o.run(ctx, f); err != nil {
+			op.Error = &upspb.OperationError{Code: http.StatusInternalServerError, Message: err.Error()}
+			if sc, ok := err.(StatusCoder); ok {
+				op.Error.Code = int32(sc.StatusCode())
+			}
+		} else if any, err := ptypes.MarshalAny(resp); err != nil {
+			op.Error = &upspb.OperationError{Code: http.StatusInternalServerError, Message: err.Error()}
+		} else {
+			op.Response = any
+		}
+
+		o.mu.Lock()
+		o.operations[name] = op
+		o.mu.Unlock()
+		if o.Retention > 0 {
+			time.AfterFunc(o.Retention, func() {
+				o.Delete(name)
+			})
+		}
+	}()
+
+	return &AsyncResult{
+		Operation: &upspb.Operation{Name: name},
+		Location:  path.Join(o.prefix, name),
+	}
+}
+
+// run calls f, recovering from panics.
+func (o *Operations) run(ctx context.Context, f func(context.Context) (proto.Message, error)) (resp proto.Message, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			resp, err = nil, fmt.Errorf("ups: operation panicked: %v", p)
+		}
+	}()
+	return f(context.WithoutCancel(ctx))
+}
+
+// Get returns the operation.
+func (o *Operations) Get(name string) (*upspb.Operation, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	op, ok := o.operations[name]
+	return op, ok
+}
+
+// Delete removes the operation.
+func (o *Operations) Delete(name string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.operations, name)
+}
+
+// Handler returns the handler that reports the status and result of
+// operations, taking an upspb.GetOperationRequest and returning an
+// upspb.Operation, using the config with AllowGET, so that the Location
+// of an operation can be polled with GET.  Unknown operations get 404
+// responses.
+func (o *Operations) Handler(config Config) http.Handler {
+	config.AllowGET = true
+	return UPSWithConfig(func(r *http.Request, req *upspb.GetOperationRequest) (*upspb.Operation, error) {
+		name := req.Name
+		if name == "" {
+			name = strings.TrimPrefix(r.URL.Path, o.prefix)
+		}
+		if op, ok := o.Get(name); ok {
+			return op, nil
+		}
+		return nil, operationNotFound{}
+	}, config)
+}
+
+type operationNotFound struct{}
+
+func (operationNotFound) Error() string {
+	return "ups: operation not found"
+}
+
+func (operationNotFound) StatusCode() int {
+	return http.StatusNotFound
+}
@@ -0,0 +1,103 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+
+	"github.com/qpliu/ups/testingups"
+	"github.com/qpliu/ups/upspb"
+)
+
+func TestOperations(t *testing.T) {
+	operations := NewOperations("/operations/")
+	finish := make(chan struct{})
+	handler := UPS(func(ctx context.Context, req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		name := req.Name
+		return nil, operations.Start(ctx, func(ctx context.Context) (proto.Message, error) {
+			<-finish
+			if name == "panic" {
+				panic("oops")
+			}
+			if name == "" {
+				return nil, testError(http.StatusBadRequest)
+			}
+			return &testingups.HelloResponse{Text: "Hello, " + name + "!"}, nil
+		})
+	})
+	poll := operations.Handler(DefaultConfig)
+
+	start := func(body string) (string, *upspb.Operation) {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != http.StatusAccepted {
+			t.Fatalf("response code: expected: %d, got: %d", http.StatusAccepted, resp.Code)
+		}
+		op := &upspb.Operation{}
+		if err := jsonpb.Unmarshal(resp.Body, op); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Header().Get("Location"), op
+	}
+	get := func(location string) (int, *upspb.Operation) {
+		resp := httptest.NewRecorder()
+		poll.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, location, nil))
+		op := &upspb.Operation{}
+		if resp.Code == http.StatusOK {
+			if err := jsonpb.Unmarshal(resp.Body, op); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.Code, op
+	}
+	wait := func(location string) *upspb.Operation {
+		for {
+			if code, op := get(location); code != http.StatusOK || op.Done {
+				return op
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	location, op := start(`{"name":"World"}`)
+	if op.Name == "" || op.Done || location != "/operations/"+op.Name {
+		t.Errorf("unexpected operation: %s %v", location, op)
+	}
+	if code, op := get(location); code != http.StatusOK || op.Done {
+		t.Errorf("unexpected operation before done: %d %v", code, op)
+	}
+	errLocation, _ := start(`{}`)
+	panicLocation, _ := start(`{"name":"panic"}`)
+	close(finish)
+
+	op = wait(location)
+	resp := &testingups.HelloResponse{}
+	if err := ptypes.UnmarshalAny(op.Response, resp); err != nil {
+		t.Fatal(err)
+	} else if resp.Text != "Hello, World!" || op.Error != nil {
+		t.Errorf("unexpected operation: %v", op)
+	}
+
+	op = wait(errLocation)
+	if op.Error == nil || op.Error.Code != http.StatusBadRequest || op.Response != nil {
+		t.Errorf("unexpected operation: %v", op)
+	}
+
+	if op := wait(panicLocation); op.Error == nil || op.Error.Code != http.StatusInternalServerError || op.Error.Message != "ups: operation panicked: oops" {
+		t.Errorf("unexpected operation: %v", op)
+	}
+
+	operations.Delete(op.Name)
+	if code, _ := get(errLocation); code != http.StatusNotFound {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusNotFound, code)
+	}
+}
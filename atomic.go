@@ -0,0 +1,84 @@
+package ups
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// AtomicHandler is an http.Handler that delegates to an underlying
+// handler that can be swapped at runtime, for example to switch
+// implementations based on configuration without restarting the server.
+type AtomicHandler struct {
+	current atomic.Pointer[atomicGeneration]
+}
+
+type atomicGeneration struct {
+	handler  http.Handler
+	mu       sync.Mutex
+	inFlight int
+	retired  bool
+	drained  chan struct{}
+}
+
+// NewAtomicHandler creates an AtomicHandler delegating to handler.
+func NewAtomicHandler(handler http.Handler) *AtomicHandler {
+	a := &AtomicHandler{}
+	a.current.Store(newAtomicGeneration(handler))
+	return a
+}
+
+func newAtomicGeneration(handler http.Handler) *atomicGeneration {
+	return &atomicGeneration{handler: handler, drained: make(chan struct{})}
+}
+
+func (a *AtomicHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for {
+		g := a.current.Load()
+		g.mu.Lock()
+		if g.retired {
+			g.mu.Unlock()
+			continue
+		}
+		g.inFlight++
+		g.mu.Unlock()
+
+		defer func() {
+			g.mu.Lock()
+			g.inFlight--
+			if g.retired && g.inFlight == 0 {
+				close(g.drained)
+			}
+			g.mu.Unlock()
+		}()
+		g.handler.ServeHTTP(w, r)
+		return
+	}
+}
+
+// Handler returns the current underlying handler.
+func (a *AtomicHandler) Handler() http.Handler {
+	return a.current.Load().handler
+}
+
+// Swap makes handler the underlying handler for new requests, then waits
+// for the requests in flight to the previous handler to complete.  Swap
+// returns the previous handler, and the context's error if the context
+// is done before the previous handler is drained.
+func (a *AtomicHandler) Swap(ctx context.Context, handler http.Handler) (http.Handler, error) {
+	old := a.current.Swap(newAtomicGeneration(handler))
+	old.mu.Lock()
+	old.retired = true
+	if old.inFlight == 0 {
+		close(old.drained)
+	}
+	old.mu.Unlock()
+
+	select {
+	case <-old.drained:
+		return old.handler, nil
+	case <-ctx.Done():
+		return old.handler, ctx.Err()
+	}
+}
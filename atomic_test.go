@@ -0,0 +1,67 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestAtomicHandler(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	first := UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		if req.Name == "Slow" {
+			close(started)
+			<-release
+		}
+		return &testingups.HelloResponse{Text: "First, " + req.Name + "!"}
+	})
+	second := UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Second, " + req.Name + "!"}
+	})
+	handler := NewAtomicHandler(first)
+
+	call := func(name string) string {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp.Body.String()
+	}
+
+	if body := call("World"); body != `{"text":"First, World!"}` {
+		t.Errorf("unexpected response: %s", body)
+	}
+
+	slow := make(chan string)
+	go func() {
+		slow <- call("Slow")
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := handler.Swap(ctx, second); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded while draining, got: %v", err)
+	}
+	if body := call("World"); body != `{"text":"Second, World!"}` {
+		t.Errorf("unexpected response: %s", body)
+	}
+
+	close(release)
+	if body := <-slow; body != `{"text":"First, Slow!"}` {
+		t.Errorf("unexpected response: %s", body)
+	}
+
+	if old, err := handler.Swap(context.Background(), first); err != nil || old != second {
+		t.Errorf("unexpected swap result: %v, %v", old, err)
+	}
+	if handler.Handler() != first {
+		t.Errorf("unexpected current handler")
+	}
+}
@@ -0,0 +1,116 @@
+package ups
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Authorization is what an Authorizer decides on.
+type Authorization struct {
+	// Principal is the authenticated principal, or nil.
+	Principal *Principal
+
+	// RequiredScopes and RequiredRoles are declared by the Config of
+	// the handler.
+	RequiredScopes []string
+	RequiredRoles  []string
+
+	// Request is the decoded request message.
+	Request proto.Message
+}
+
+// Authorizer decides whether requests are authorized.  Authorize is
+// called after the request message is decoded and before the handler is
+// called.  If Authorize returns an error, the response is 403 HTTP status
+// unless the error implements StatusCoder, with a JSON body describing
+// the error.
+type Authorizer interface {
+	Authorize(ctx context.Context, a *Authorization) error
+}
+
+// AuthorizerFunc is an Authorizer implemented by a func.
+type AuthorizerFunc func(ctx context.Context, a *Authorization) error
+
+func (f AuthorizerFunc) Authorize(ctx context.Context, a *Authorization) error {
+	return f(ctx, a)
+}
+
+// AuthorizationError is returned by ScopeAuthorizer when the principal
+// is missing scopes or roles.
+type AuthorizationError struct {
+	MissingScopes []string
+	MissingRoles  []string
+}
+
+func (err *AuthorizationError) Error() string {
+	var missing []string
+	missing = append(missing, err.MissingScopes...)
+	missing = append(missing, err.MissingRoles...)
+	if len(missing) == 0 {
+		return "ups: permission denied"
+	}
+	return "ups: permission denied: missing " + strings.Join(missing, ", ")
+}
+
+// ScopeAuthorizer is an Authorizer that requires the principal to have
+// all of the required scopes and roles.
+var ScopeAuthorizer Authorizer = AuthorizerFunc(func(ctx context.Context, a *Authorization) error {
+	err := &AuthorizationError{}
+	if a.Principal == nil {
+		err.MissingScopes = a.RequiredScopes
+		err.MissingRoles = a.RequiredRoles
+		return err
+	}
+	for _, scope := range a.RequiredScopes {
+		if !a.Principal.HasScope(scope) {
+			err.MissingScopes = append(err.MissingScopes, scope)
+		}
+	}
+	for _, role := range a.RequiredRoles {
+		if !a.Principal.HasRole(role) {
+			err.MissingRoles = append(err.MissingRoles, role)
+		}
+	}
+	if len(err.MissingScopes) > 0 || len(err.MissingRoles) > 0 {
+		return err
+	}
+	return nil
+})
+
+// authorize returns the status code and JSON error body if the request
+// is not authorized.
+func (ups *upsHandler) authorize(ctx context.Context, req proto.Message) (int, []byte) {
+	principal, _ := AuthenticatedPrincipal(ctx)
+	err := ups.config.Authorizer.Authorize(ctx, &Authorization{
+		Principal:      principal,
+		RequiredScopes: ups.config.RequiredScopes,
+		RequiredRoles:  ups.config.RequiredRoles,
+		Request:        req,
+	})
+	if err == nil {
+		return http.StatusOK, nil
+	}
+	statusCode := http.StatusForbidden
+	if coder, ok := err.(StatusCoder); ok {
+		statusCode = coder.StatusCode()
+	}
+	body := struct {
+		Error         string   `json:"error"`
+		Message       string   `json:"message"`
+		MissingScopes []string `json:"missing_scopes,omitempty"`
+		MissingRoles  []string `json:"missing_roles,omitempty"`
+	}{
+		Error:   "permission_denied",
+		Message: err.Error(),
+	}
+	if authErr, ok := err.(*AuthorizationError); ok {
+		body.MissingScopes = authErr.MissingScopes
+		body.MissingRoles = authErr.MissingRoles
+	}
+	b, _ := json.Marshal(body)
+	return statusCode, b
+}
@@ -0,0 +1,76 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestAuthorizer(t *testing.T) {
+	call := func(handler http.Handler, principal *Principal, name string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if principal != nil {
+			req = req.WithContext(WithValue(req.Context(), PrincipalKey, principal))
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+	hello := func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}
+
+	config := DefaultConfig
+	config.Authorizer = ScopeAuthorizer
+	config.RequiredScopes = []string{"read"}
+	config.RequiredRoles = []string{"admin"}
+	handler := UPSWithConfig(hello, config)
+
+	if resp := call(handler, &Principal{Scopes: []string{"read"}, Roles: []string{"admin"}}, "World"); resp.Code != http.StatusOK {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusOK, resp.Code)
+	}
+	resp := call(handler, &Principal{Scopes: []string{"read"}}, "World")
+	if resp.Code != http.StatusForbidden {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusForbidden, resp.Code)
+	}
+	if resp.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected JSON error, got: %s", resp.Header().Get("Content-Type"))
+	}
+	bodyExpected := `{"error":"permission_denied","message":"ups: permission denied: missing admin","missing_roles":["admin"]}`
+	if resp.Body.String() != bodyExpected {
+		t.Errorf("response body, expected: %s, got: %s", bodyExpected, resp.Body.String())
+	}
+	if resp := call(handler, nil, "World"); resp.Code != http.StatusForbidden {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusForbidden, resp.Code)
+	}
+
+	config.Authorizer = AuthorizerFunc(func(ctx context.Context, a *Authorization) error {
+		switch a.Request.(*testingups.HelloRequest).Name {
+		case "Forbidden":
+			return errors.New("forbidden name")
+		case "Teapot":
+			return testError(http.StatusTeapot)
+		}
+		return nil
+	})
+	handler = UPSWithConfig(hello, config)
+	for _, test := range []struct {
+		name string
+		code int
+	}{
+		{"World", http.StatusOK},
+		{"Forbidden", http.StatusForbidden},
+		{"Teapot", http.StatusTeapot},
+	} {
+		if resp := call(handler, nil, test.name); resp.Code != test.code {
+			t.Errorf("%s: response code: expected: %d, got: %d", test.name, test.code, resp.Code)
+		}
+	}
+
+}
@@ -0,0 +1,45 @@
+package ups
+
+import (
+	"crypto/tls"
+	"slices"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// NewAutocertManager creates an autocert.Manager that accepts the terms of
+// service of the CA and obtains certificates for the hosts, which are
+// stored in the cache, such as an autocert.DirCache.
+func NewAutocertManager(cache autocert.Cache, hosts ...string) *autocert.Manager {
+	return &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		Cache:      cache,
+		HostPolicy: autocert.HostWhitelist(hosts...),
+	}
+}
+
+// ConfigureAutocert configures the TLSConfig of the Server to obtain and
+// renew certificates with the Manager, with the tls-alpn-01 challenge.
+// Any other settings of an existing TLSConfig are kept.  The Server is
+// then started with ListenAndServeTLS or ServeTLS with empty certFile and
+// keyFile.
+//
+// For the http-01 challenge, m.HTTPHandler must also be served on port
+// 80.
+func (s *Server) ConfigureAutocert(m *autocert.Manager) {
+	config := m.TLSConfig()
+	if s.TLSConfig != nil {
+		c := s.TLSConfig.Clone()
+		c.GetCertificate = config.GetCertificate
+		for _, proto := range config.NextProtos {
+			if !slices.Contains(c.NextProtos, proto) {
+				c.NextProtos = append(c.NextProtos, proto)
+			}
+		}
+		config = c
+	}
+	if config.MinVersion < tls.VersionTLS12 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	s.TLSConfig = config
+}
@@ -0,0 +1,28 @@
+package ups
+
+import (
+	"crypto/tls"
+	"slices"
+	"testing"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func TestConfigureAutocert(t *testing.T) {
+	server := &Server{}
+	server.TLSConfig = &tls.Config{NextProtos: []string{"http/1.1"}}
+	server.ConfigureAutocert(NewAutocertManager(autocert.DirCache(t.TempDir()), "example.com"))
+	if server.TLSConfig.GetCertificate == nil {
+		t.Errorf("expected GetCertificate")
+	}
+	if !slices.Contains(server.TLSConfig.NextProtos, "http/1.1") || !slices.Contains(server.TLSConfig.NextProtos, acme.ALPNProto) {
+		t.Errorf("unexpected NextProtos: %v", server.TLSConfig.NextProtos)
+	}
+	if server.TLSConfig.MinVersion != tls.VersionTLS12 {
+		t.Errorf("unexpected MinVersion: %x", server.TLSConfig.MinVersion)
+	}
+	if _, err := server.TLSConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.org"}); err == nil {
+		t.Errorf("expected error for host not in policy")
+	}
+}
@@ -0,0 +1,237 @@
+package ups
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EndpointResolver provides the URLs of the replicas of an upstream ups
+// endpoint.
+type EndpointResolver interface {
+	Endpoints(context.Context) ([]string, error)
+}
+
+// StaticEndpoints is an EndpointResolver with a fixed list of URLs.
+type StaticEndpoints []string
+
+func (e StaticEndpoints) Endpoints(context.Context) ([]string, error) {
+	return e, nil
+}
+
+// SRVEndpoints is an EndpointResolver that looks up DNS SRV records,
+// as in net.LookupSRV, making URLs of the targets with the Scheme, such
+// as "http", and the Path.
+type SRVEndpoints struct {
+	Service string
+	Proto   string
+	Name    string
+
+	Scheme string
+	Path   string
+}
+
+func (e *SRVEndpoints) Endpoints(ctx context.Context) ([]string, error) {
+	_, addrs, err := net.DefaultResolver.LookupSRV(ctx, e.Service, e.Proto, e.Name)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		host := addr.Target
+		if len(host) > 0 && host[len(host)-1] == '.' {
+			host = host[:len(host)-1]
+		}
+		endpoints = append(endpoints, e.Scheme+"://"+net.JoinHostPort(host, strconv.Itoa(int(addr.Port)))+e.Path)
+	}
+	return endpoints, nil
+}
+
+// BalancePolicy selects the endpoints of a Balancer.
+type BalancePolicy int
+
+const (
+	// RoundRobin selects the endpoints in turn.
+	RoundRobin BalancePolicy = iota
+
+	// LeastPending selects the endpoint with the fewest requests in
+	// progress.
+	LeastPending
+)
+
+// Balancer balances the requests of a Proxy across the replicas of the
+// upstream endpoint, ejecting replicas that fail.
+type Balancer struct {
+	Resolver EndpointResolver
+	Policy   BalancePolicy
+
+	// RefreshInterval is how often the endpoints are resolved.  If
+	// zero, they are resolved every 30 seconds.
+	RefreshInterval time.Duration
+
+	// EjectAfter, if not zero, is the number of consecutive failures
+	// after which an endpoint is ejected for EjectFor, unless all the
+	// endpoints are ejected.  Failures are transport errors and 502,
+	// 503, and 504 responses.
+	EjectAfter int
+	EjectFor   time.Duration
+
+	mu        sync.Mutex
+	resolved  time.Time
+	resolving chan struct{}
+	err       error
+	endpoints []string
+	states    map[string]*endpointState
+	next      int
+}
+
+type endpointState struct {
+	pending      int
+	failures     int
+	ejectedUntil time.Time
+}
+
+var errNoEndpoints = errors.New("ups: no upstream endpoints")
+
+// balancerRetryInterval is how often a Balancer without endpoints retries
+// failed resolutions.
+const balancerRetryInterval = time.Second
+
+// NewBalancer creates a round-robin Balancer of the endpoints that
+// ejects endpoints for 30 seconds after 5 consecutive failures.
+func NewBalancer(resolver EndpointResolver) *Balancer {
+	return &Balancer{
+		Resolver:   resolver,
+		EjectAfter: 5,
+		EjectFor:   30 * time.Second,
+	}
+}
+
+// pick selects an endpoint, returning the func to call with the outcome
+// of the request.
+func (b *Balancer) pick(ctx context.Context) (string, func(failed bool), error) {
+	if err := b.resolve(ctx); err != nil {
+		return "", nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.endpoints) == 0 {
+		return "", nil, errNoEndpoints
+	}
+	now := time.Now()
+	index := -1
+	var state *endpointState
+	for _, ejected := range []bool{false, true} {
+		for i := range b.endpoints {
+			j := (b.next + i) % len(b.endpoints)
+			s := b.states[b.endpoints[j]]
+			if !ejected && now.Before(s.ejectedUntil) {
+				continue
+			}
+			if state == nil || (b.Policy == LeastPending && s.pending < state.pending) {
+				index, state = j, s
+				if b.Policy == RoundRobin {
+					break
+				}
+			}
+		}
+		if state != nil {
+			break
+		}
+	}
+	endpoint := b.endpoints[index]
+	b.next = (index + 1) % len(b.endpoints)
+	state.pending++
+	return endpoint, func(failed bool) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		state.pending--
+		if !failed {
+			state.failures = 0
+			return
+		}
+		state.failures++
+		if b.EjectAfter > 0 && state.failures >= b.EjectAfter {
+			state.failures = 0
+			state.ejectedUntil = time.Now().Add(b.EjectFor)
+		}
+	}, nil
+}
+
+// resolve refreshes the endpoints if they are older than the
+// RefreshInterval, keeping the previous endpoints if resolution fails.
+// Failures without previous endpoints are retried after
+// balancerRetryInterval.  Concurrent refreshes wait for the one in
+// progress, or use the previous endpoints.
+func (b *Balancer) resolve(ctx context.Context) error {
+	interval := b.RefreshInterval
+	if interval == 0 {
+		interval = 30 * time.Second
+	}
+	b.mu.Lock()
+	if b.endpoints == nil && interval > balancerRetryInterval {
+		interval = balancerRetryInterval
+	}
+	if !b.resolved.IsZero() && time.Since(b.resolved) < interval {
+		err := b.err
+		b.mu.Unlock()
+		return err
+	}
+	if resolving := b.resolving; resolving != nil {
+		if b.endpoints != nil {
+			b.mu.Unlock()
+			return nil
+		}
+		b.mu.Unlock()
+		select {
+		case <-resolving:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.endpoints == nil && b.err == nil {
+			return errNoEndpoints
+		}
+		return b.err
+	}
+	resolving := make(chan struct{})
+	b.resolving = resolving
+	b.mu.Unlock()
+
+	endpoints, err := b.Resolver.Endpoints(ctx)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	defer close(resolving)
+	b.resolving = nil
+	if err != nil {
+		// Failures from the context of the request are not the
+		// failures of the resolver.
+		if ctx.Err() == nil {
+			b.resolved = time.Now()
+			if b.endpoints == nil {
+				b.err = err
+			}
+		}
+		if b.endpoints != nil {
+			return nil
+		}
+		return err
+	}
+	states := map[string]*endpointState{}
+	for _, e := range endpoints {
+		if s, ok := b.states[e]; ok {
+			states[e] = s
+		} else {
+			states[e] = &endpointState{}
+		}
+	}
+	b.endpoints = endpoints
+	b.states = states
+	b.resolved = time.Now()
+	b.err = nil
+	return nil
+}
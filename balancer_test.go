@@ -0,0 +1,161 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestBalancer(t *testing.T) {
+	counts := map[string]int{}
+	upstream := func(name string, statusCode int) *httptest.Server {
+		return httptest.NewServer(UPS(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+			counts[name]++
+			if statusCode != http.StatusOK {
+				return nil, testError(statusCode)
+			}
+			return &testingups.HelloResponse{Text: name}, nil
+		}))
+	}
+	a := upstream("a", http.StatusOK)
+	defer a.Close()
+	b := upstream("b", http.StatusOK)
+	defer b.Close()
+	failing := upstream("failing", http.StatusServiceUnavailable)
+	defer failing.Close()
+
+	proxy := NewProxy("")
+	proxy.Balancer = NewBalancer(StaticEndpoints{a.URL, b.URL, failing.URL})
+	proxy.Balancer.EjectAfter = 1
+	proxy.Balancer.EjectFor = time.Minute
+	proxy.Retries = 2
+	for i := 0; i < 9; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		proxy.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Errorf("unexpected status %d", resp.Code)
+		}
+	}
+	if counts["failing"] != 1 || counts["a"]+counts["b"] != 9 || counts["a"] < 4 || counts["b"] < 4 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+}
+
+func TestBalancerLeastPending(t *testing.T) {
+	balancer := &Balancer{Resolver: StaticEndpoints{"a", "b", "c"}, Policy: LeastPending}
+	var dones []func(bool)
+	seen := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		endpoint, done, err := balancer.pick(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		seen[endpoint] = true
+		dones = append(dones, done)
+	}
+	if len(seen) != 3 {
+		t.Errorf("expected all endpoints to be picked, got %v", seen)
+	}
+	dones[1](false)
+	if endpoint, _, _ := balancer.pick(context.Background()); endpoint != "b" {
+		t.Errorf("expected least pending endpoint, got %s", endpoint)
+	}
+
+	if _, _, err := (&Balancer{Resolver: StaticEndpoints{}}).pick(context.Background()); err == nil {
+		t.Errorf("expected error without endpoints")
+	}
+}
+
+type testResolver struct {
+	mu        sync.Mutex
+	calls     int
+	endpoints []string
+	err       error
+	release   chan struct{}
+}
+
+func (r *testResolver) Endpoints(ctx context.Context) ([]string, error) {
+	r.mu.Lock()
+	r.calls++
+	release := r.release
+	r.mu.Unlock()
+	if release != nil {
+		<-release
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.endpoints, r.err
+}
+
+func TestBalancerResolve(t *testing.T) {
+	resolver := &testResolver{err: errors.New("unavailable"), release: make(chan struct{})}
+	balancer := &Balancer{Resolver: resolver, RefreshInterval: time.Hour}
+
+	// Concurrent picks share a refresh.
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := balancer.pick(context.Background())
+			errs <- err
+		}()
+	}
+	for {
+		resolver.mu.Lock()
+		calls := resolver.calls
+		resolver.mu.Unlock()
+		if calls > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(resolver.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err == nil || err.Error() != "unavailable" {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+
+	// Failures are retried after balancerRetryInterval, not on every
+	// pick.
+	if _, _, err := balancer.pick(context.Background()); err == nil || resolver.calls != 1 {
+		t.Errorf("unexpected error %v after %d calls", err, resolver.calls)
+	}
+	balancer.mu.Lock()
+	balancer.resolved = time.Now().Add(-balancerRetryInterval)
+	balancer.mu.Unlock()
+	resolver.mu.Lock()
+	resolver.endpoints, resolver.err = []string{"a"}, nil
+	resolver.mu.Unlock()
+	if endpoint, _, err := balancer.pick(context.Background()); endpoint != "a" || err != nil || resolver.calls != 2 {
+		t.Errorf("unexpected endpoint %s %v after %d calls", endpoint, err, resolver.calls)
+	}
+
+	// Failures with previous endpoints keep them until the next
+	// RefreshInterval.
+	balancer.mu.Lock()
+	balancer.resolved = time.Now().Add(-time.Hour)
+	balancer.mu.Unlock()
+	resolver.mu.Lock()
+	resolver.endpoints, resolver.err = nil, errors.New("unavailable")
+	resolver.mu.Unlock()
+	for i := 0; i < 2; i++ {
+		if endpoint, _, err := balancer.pick(context.Background()); endpoint != "a" || err != nil || resolver.calls != 3 {
+			t.Errorf("unexpected endpoint %s %v after %d calls", endpoint, err, resolver.calls)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package ups
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// formField returns the field with the JSON name or proto name.
+func formField(fields protoreflect.FieldDescriptors, name string) protoreflect.FieldDescriptor {
+	if fd := fields.ByJSONName(name); fd != nil {
+		return fd
+	}
+	return fields.ByName(protoreflect.Name(name))
+}
+
+// checkHeaderFields panics if a field of the HeaderFields is not a field
+// of msg that can be set from form values.
+func checkHeaderFields(headerFields map[string]string, desc protoreflect.MessageDescriptor) {
+	for _, name := range headerFields {
+		fd := formField(desc.Fields(), name)
+		if fd == nil || fd.IsMap() || fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+			panic("ups: invalid header field: " + name)
+		}
+	}
+}
+
+// bindHeaders sets the fields of msg from the request headers mapped to
+// them by the HeaderFields, for fields that are not already set.
+func bindHeaders(header http.Header, headerFields map[string]string, msg proto.Message) error {
+	m := proto.MessageReflect(msg)
+	fields := m.Descriptor().Fields()
+	for key, name := range headerFields {
+		vals := header.Values(key)
+		if len(vals) == 0 {
+			continue
+		}
+		fd := formField(fields, name)
+		if fd == nil {
+			return errors.New("ups: unknown header field: " + name)
+		}
+		if m.Has(fd) {
+			continue
+		}
+		if fd.IsList() {
+			list := m.Mutable(fd).List()
+			for _, val := range vals {
+				v, err := parseFormValue(fd, val)
+				if err != nil {
+					return err
+				}
+				list.Append(v)
+			}
+		} else if v, err := parseFormValue(fd, vals[0]); err != nil {
+			return err
+		} else {
+			m.Set(fd, v)
+		}
+	}
+	return nil
+}
+
+// patternWildcards returns the names of the wildcards of a ServeMux
+// pattern, such as "user_id" and "order_id" of
+// "/users/{user_id}/orders/{order_id}".
+func patternWildcards(pattern string) []string {
+	var names []string
+	for {
+		i := strings.IndexByte(pattern, '{')
+		if i < 0 {
+			return names
+		}
+		pattern = pattern[i+1:]
+		j := strings.IndexByte(pattern, '}')
+		if j < 0 {
+			return names
+		}
+		if name := strings.TrimSuffix(pattern[:j], "..."); name != "" && name != "$" {
+			names = append(names, name)
+		}
+		pattern = pattern[j+1:]
+	}
+}
+
+// bindPath sets the scalar and enum fields of msg named by the wildcards
+// of the ServeMux pattern of the request to the matched path segments,
+// for fields that are not already set.
+func bindPath(r *http.Request, msg proto.Message) error {
+	names := patternWildcards(r.Pattern)
+	if len(names) == 0 {
+		return nil
+	}
+	m := proto.MessageReflect(msg)
+	fields := m.Descriptor().Fields()
+	for _, name := range names {
+		fd := formField(fields, name)
+		if fd == nil || fd.IsList() || fd.IsMap() || fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind || m.Has(fd) {
+			continue
+		}
+		if v, err := parseFormValue(fd, r.PathValue(name)); err != nil {
+			return err
+		} else {
+			m.Set(fd, v)
+		}
+	}
+	return nil
+}
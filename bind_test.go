@@ -0,0 +1,79 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestHeaderFields(t *testing.T) {
+	config := DefaultConfig
+	config.HeaderFields = map[string]string{"X-Name": "name"}
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+
+	for _, test := range []struct {
+		body, header, expected string
+	}{
+		{`{}`, "Header", `{"text":"Hello, Header!"}`},
+		{`{"name":"Body"}`, "Header", `{"text":"Hello, Body!"}`},
+		{`{}`, "", `{"text":"Hello, !"}`},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		if test.header != "" {
+			req.Header.Set("X-Name", test.header)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Body.String() != test.expected {
+			t.Errorf("response body, expected: %s, got: %s", test.expected, resp.Body.String())
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic for unknown field")
+		}
+	}()
+	config.HeaderFields = map[string]string{"X-Name": "nom"}
+	UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return nil
+	}, config)
+}
+
+func TestPatternWildcards(t *testing.T) {
+	names := patternWildcards("POST /users/{user_id}/orders/{order_id}/{path...}/{$}")
+	if len(names) != 3 || names[0] != "user_id" || names[1] != "order_id" || names[2] != "path" {
+		t.Errorf("unexpected names: %v", names)
+	}
+	if names := patternWildcards("/hello"); len(names) != 0 {
+		t.Errorf("unexpected names: %v", names)
+	}
+}
+
+func TestPathFields(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/hello/{name}", UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}))
+
+	for _, test := range []struct {
+		path, body, expected string
+	}{
+		{"/hello/Path", `{}`, `{"text":"Hello, Path!"}`},
+		{"/hello/Path", `{"name":"Body"}`, `{"text":"Hello, Body!"}`},
+	} {
+		req := httptest.NewRequest(http.MethodPost, test.path, bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		mux.ServeHTTP(resp, req)
+		if resp.Body.String() != test.expected {
+			t.Errorf("response body, expected: %s, got: %s", test.expected, resp.Body.String())
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package ups
+
+import (
+	"bytes"
+	"sync"
+)
+
+const (
+	// maxRequestBufferPresize caps the preallocation of request
+	// buffers, so that requests cannot allocate memory by claiming
+	// large Content-Lengths.
+	maxRequestBufferPresize = 1 << 20
+
+	// maxPooledRequestBuffer is the largest buffer that is reused, so
+	// that occasional large requests do not pin memory.
+	maxPooledRequestBuffer = 4 << 20
+)
+
+var requestBufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// newRequestBuffer returns a buffer from the pool for reading a request
+// body of the Content-Length, if known, without growing.
+func newRequestBuffer(contentLength int64) *bytes.Buffer {
+	buf := requestBufferPool.Get().(*bytes.Buffer)
+	if contentLength > 0 {
+		buf.Grow(int(min(contentLength, maxRequestBufferPresize)) + bytes.MinRead)
+	}
+	return buf
+}
+
+// releaseRequestBuffer returns the buffer to the pool once nothing
+// refers to its bytes.
+func releaseRequestBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledRequestBuffer {
+		return
+	}
+	buf.Reset()
+	requestBufferPool.Put(buf)
+}
@@ -0,0 +1,24 @@
+package ups
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRequestBuffer(t *testing.T) {
+	buf := newRequestBuffer(1000)
+	if buf.Cap() < 1000+bytes.MinRead {
+		t.Errorf("buffer not presized: %d", buf.Cap())
+	}
+	body := bytes.Repeat([]byte("x"), 1000)
+	if _, err := buf.ReadFrom(bytes.NewReader(body)); err != nil || !bytes.Equal(buf.Bytes(), body) {
+		t.Errorf("unexpected read %v", err)
+	}
+	releaseRequestBuffer(buf)
+
+	buf = newRequestBuffer(1 << 40)
+	if buf.Cap() > 2*maxRequestBufferPresize {
+		t.Errorf("buffer presized beyond limit: %d", buf.Cap())
+	}
+	releaseRequestBuffer(buf)
+}
@@ -0,0 +1,64 @@
+package ups
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CachePolicy sets the caching headers of successful responses, for
+// responses that can be cached by CDNs and browsers.
+type CachePolicy struct {
+	// CacheControl is the Cache-Control header, such as
+	// "public, max-age=60".
+	CacheControl string
+
+	// Expires, if not zero, sets the Expires header to the time of the
+	// response plus Expires.
+	Expires time.Duration
+
+	// Vary are the request headers listed in the Vary header.
+	Vary []string
+}
+
+func (policy *CachePolicy) setHeaders(header http.Header) {
+	if policy.CacheControl != "" {
+		header.Set("Cache-Control", policy.CacheControl)
+	}
+	if policy.Expires != 0 {
+		header.Set("Expires", time.Now().Add(policy.Expires).UTC().Format(http.TimeFormat))
+	}
+	for _, vary := range policy.Vary {
+		if !hasVary(header, vary) {
+			header.Add("Vary", vary)
+		}
+	}
+}
+
+// hasVary returns true if the request header is already listed in the
+// Vary header, as from Exporters or VersionHandlers.
+func hasVary(header http.Header, name string) bool {
+	for _, value := range header.Values("Vary") {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetCachePolicy overrides the CachePolicy of the Config for the
+// response of the request of the context, or disables caching headers if
+// policy is nil.  It returns false if the context is not from a ups
+// handler.
+func SetCachePolicy(ctx context.Context, policy *CachePolicy) bool {
+	state := responseStateFromContext(ctx)
+	if state == nil {
+		return false
+	}
+	state.cache = policy
+	state.cacheSet = true
+	return true
+}
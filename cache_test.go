@@ -0,0 +1,61 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestCachePolicy(t *testing.T) {
+	config := DefaultConfig
+	config.Cache = &CachePolicy{CacheControl: "public, max-age=60", Expires: time.Minute, Vary: []string{"Accept", "Accept-Language"}}
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		switch req.Name {
+		case "private":
+			SetCachePolicy(ctx, &CachePolicy{CacheControl: "private, no-store"})
+		case "none":
+			SetCachePolicy(ctx, nil)
+		case "error":
+			return nil, testError(http.StatusBadRequest)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+	}, config)
+	call := func(name string) http.Header {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp.Header()
+	}
+
+	header := call("World")
+	if header.Get("Cache-Control") != "public, max-age=60" || strings.Join(header.Values("Vary"), ", ") != "Accept, Accept-Language" {
+		t.Errorf("unexpected headers: %v", header)
+	}
+	if expires, err := http.ParseTime(header.Get("Expires")); err != nil {
+		t.Errorf("unexpected Expires: %v", err)
+	} else if d := time.Until(expires); d < 58*time.Second || d > time.Minute {
+		t.Errorf("unexpected Expires: %s", expires)
+	}
+
+	header = call("private")
+	if header.Get("Cache-Control") != "private, no-store" || header.Get("Vary") != "" || header.Get("Expires") != "" {
+		t.Errorf("unexpected headers: %v", header)
+	}
+	for _, name := range []string{"none", "error"} {
+		header = call(name)
+		if header.Get("Cache-Control") != "" || header.Get("Vary") != "" || header.Get("Expires") != "" {
+			t.Errorf("%s: unexpected headers: %v", name, header)
+		}
+	}
+
+	if SetCachePolicy(context.Background(), nil) {
+		t.Errorf("expected false without request")
+	}
+}
@@ -0,0 +1,79 @@
+package ups
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+// MessageCatalog localizes the bodies of error responses by the
+// Accept-Language of requests.  The messages are keyed by the body
+// provided by Config.ErrorResponse, or by the status text, such as
+// "Not Found", if there is no ErrorResponse, so that the messages of
+// ErrorResponse are the messages of the default locale.
+type MessageCatalog struct {
+	mu       sync.RWMutex
+	locales  []language.Tag
+	messages []map[string]string
+	matcher  language.Matcher
+}
+
+// NewMessageCatalog creates a MessageCatalog with the default locale,
+// such as "en", which is used when no locale of the catalog matches the
+// Accept-Language of a request.
+func NewMessageCatalog(defaultLocale string) *MessageCatalog {
+	c := &MessageCatalog{}
+	c.locale(language.Make(defaultLocale))
+	return c
+}
+
+func (c *MessageCatalog) locale(tag language.Tag) int {
+	for i, t := range c.locales {
+		if t == tag {
+			return i
+		}
+	}
+	c.locales = append(c.locales, tag)
+	c.messages = append(c.messages, map[string]string{})
+	c.matcher = language.NewMatcher(c.locales)
+	return len(c.locales) - 1
+}
+
+// Set sets the message of the locale for the key.
+func (c *MessageCatalog) Set(locale, key, message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages[c.locale(language.Make(locale))][key] = message
+}
+
+// Message returns the message for the key in the locale best matching
+// the Accept-Language, falling back to the default locale and then to
+// the key, and the locale of the message.
+func (c *MessageCatalog) Message(acceptLanguage, key string) (string, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	tags, _, _ := language.ParseAcceptLanguage(acceptLanguage)
+	_, i, _ := c.matcher.Match(tags...)
+	if message, ok := c.messages[i][key]; ok {
+		return message, c.locales[i].String()
+	}
+	if message, ok := c.messages[0][key]; ok {
+		return message, c.locales[0].String()
+	}
+	return key, c.locales[0].String()
+}
+
+// localize returns the localized error body for the request of the
+// context, and its locale.
+func (c *MessageCatalog) localize(ctx context.Context, statusCode int, body string, errorResponse bool) (string, string) {
+	if !errorResponse {
+		body = http.StatusText(statusCode)
+	}
+	acceptLanguage := ""
+	if state := responseStateFromContext(ctx); state != nil {
+		acceptLanguage = state.request.Header.Get("Accept-Language")
+	}
+	return c.Message(acceptLanguage, body)
+}
@@ -0,0 +1,49 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestMessageCatalog(t *testing.T) {
+	catalog := NewMessageCatalog("en")
+	catalog.Set("en", "Not Found", "No such greeting")
+	catalog.Set("fr", "Not Found", "Salutation introuvable")
+	catalog.Set("de", "Not Found", "Gruß nicht gefunden")
+	config := DefaultConfig
+	config.Catalog = catalog
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		return nil, testError(http.StatusNotFound)
+	}, config)
+
+	for _, test := range []struct {
+		acceptLanguage string
+		expected       string
+		locale         string
+	}{
+		{"", "No such greeting", "en"},
+		{"fr-CA, en;q=0.5", "Salutation introuvable", "fr"},
+		{"de-DE", "Gruß nicht gefunden", "de"},
+		{"ja", "No such greeting", "en"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Language", test.acceptLanguage)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != http.StatusNotFound || resp.Body.String() != test.expected+"\n" {
+			t.Errorf("%s: unexpected response %d %s", test.acceptLanguage, resp.Code, resp.Body.String())
+		}
+		if locale := resp.Header().Get("Content-Language"); locale != test.locale {
+			t.Errorf("%s: expected locale %s, got %s", test.acceptLanguage, test.locale, locale)
+		}
+	}
+
+	if message, locale := catalog.Message("fr", "Bad Request"); message != "Bad Request" || locale != "en" {
+		t.Errorf("unexpected fallback %s %s", message, locale)
+	}
+}
@@ -0,0 +1,47 @@
+// Package cbor provides a ups.Codec for CBOR, mapping messages to CBOR maps
+// keyed by the JSON names of the fields.
+package cbor
+
+import (
+	"github.com/fxamacker/cbor/v2"
+	"github.com/golang/protobuf/proto"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/internal/protomap"
+)
+
+// ContentType is the Content-Type for which Register registers the Codec.
+const ContentType = "application/cbor"
+
+var encMode, _ = cbor.EncOptions{Sort: cbor.SortCanonical}.EncMode()
+
+// Codec is a ups.Codec for CBOR.
+type Codec struct{}
+
+// Marshal encodes msg as a CBOR map keyed by the JSON names of its
+// populated fields.
+func (Codec) Marshal(msg proto.Message) ([]byte, error) {
+	return encMode.Marshal(protomap.ToMap(proto.MessageReflect(msg)))
+}
+
+// Unmarshal decodes a CBOR map keyed by the JSON names or proto names of
+// the fields into msg.
+func (Codec) Unmarshal(data []byte, msg proto.Message) error {
+	var v interface{}
+	if err := cbor.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return protomap.FromMap(v, proto.MessageReflect(msg))
+}
+
+// Register returns a copy of config with the Codec registered for
+// application/cbor.
+func Register(config ups.Config) ups.Config {
+	codecs := map[string]ups.Codec{}
+	for contentType, codec := range config.Codecs {
+		codecs[contentType] = codec
+	}
+	codecs[ContentType] = Codec{}
+	config.Codecs = codecs
+	return config
+}
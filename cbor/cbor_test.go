@@ -0,0 +1,47 @@
+package cbor
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestCBOR(t *testing.T) {
+	config := Register(ups.DefaultConfig)
+	handler := ups.UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+
+	reqBody, err := cbor.Marshal(map[string]string{"name": "World"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBuffer(reqBody))
+	req.Header.Set("Content-Type", ContentType)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusOK, resp.Code)
+	}
+	respContentType := resp.Header().Get("Content-Type")
+	if respContentType != ContentType {
+		t.Errorf("response Content-Type, expected: %s, got: %s", ContentType, respContentType)
+	}
+	var respBody map[string]string
+	if err := cbor.Unmarshal(resp.Body.Bytes(), &respBody); err != nil {
+		t.Fatal(err)
+	}
+	if respBody["text"] != "Hello, World!" {
+		t.Errorf("response text, expected: Hello, World!, got: %s", respBody["text"])
+	}
+
+	if _, ok := ups.DefaultConfig.Codecs[ContentType]; ok {
+		t.Errorf("Register modified DefaultConfig")
+	}
+}
@@ -0,0 +1,169 @@
+package ups
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClientCache caches the responses of upstream ups endpoints for Proxy,
+// honoring the Cache-Control, Expires, and ETag headers of the
+// responses, so that stale responses with ETags are revalidated with
+// If-None-Match requests.  Responses with Cache-Control: private are
+// not cached, as the cache is shared by the callers.  The cache key is the request body along with
+// the URL, Content-Type, and forwarded headers.
+type ClientCache struct {
+	// TTL, if not zero, caches all successful responses for TTL,
+	// ignoring the caching headers.
+	TTL time.Duration
+
+	// MaxEntries, if not zero, limits the number of cached responses.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[clientCacheKey]*clientCacheEntry
+}
+
+type clientCacheKey [sha256.Size]byte
+
+type clientCacheEntry struct {
+	header  http.Header
+	body    []byte
+	etag    string
+	expires time.Time
+}
+
+// NewClientCache creates a ClientCache honoring the caching headers of
+// responses, with at most maxEntries responses, or no limit if
+// maxEntries is zero.
+func NewClientCache(maxEntries int) *ClientCache {
+	return &ClientCache{MaxEntries: maxEntries}
+}
+
+func (c *ClientCache) key(method, url, contentType string, header http.Header, headers []string, body []byte) clientCacheKey {
+	h := sha256.New()
+	write := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	write(method)
+	write(url)
+	write(contentType)
+	for _, key := range headers {
+		write(key)
+		for _, val := range header.Values(key) {
+			write(val)
+		}
+	}
+	h.Write(body)
+	var key clientCacheKey
+	h.Sum(key[:0])
+	return key
+}
+
+// get returns the cached response and whether it is fresh.  The header
+// of the entry is shared, and must be cloned by callers.
+func (c *ClientCache) get(key clientCacheKey) (*clientCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().Before(entry.expires) {
+		return entry, true
+	}
+	if entry.etag == "" {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry, false
+}
+
+// put caches a successful response, if allowed by its headers.
+func (c *ClientCache) put(key clientCacheKey, header http.Header, body []byte) {
+	expires, ok := c.expires(header)
+	etag := header.Get("ETag")
+	if !ok || (etag == "" && !time.Now().Before(expires)) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[clientCacheKey]*clientCacheEntry{}
+	}
+	if _, ok := c.entries[key]; !ok && c.MaxEntries > 0 && len(c.entries) >= c.MaxEntries {
+		c.evict()
+	}
+	c.entries[key] = &clientCacheEntry{header: header.Clone(), body: body, etag: etag, expires: expires}
+}
+
+// revalidated extends the freshness of a cached response after a 304
+// response with the header.
+func (c *ClientCache) revalidated(entry *clientCacheEntry, header http.Header) {
+	expires, ok := c.expires(header)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.expires = expires
+}
+
+// evict removes the expired entries, or an arbitrary entry if none
+// have expired.
+func (c *ClientCache) evict() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) < c.MaxEntries {
+		return
+	}
+	for key := range c.entries {
+		delete(c.entries, key)
+		return
+	}
+}
+
+// expires returns the time the response with the header expires, and
+// false if it must not be cached.
+func (c *ClientCache) expires(header http.Header) (time.Time, bool) {
+	now := time.Now()
+	if c.TTL > 0 {
+		return now.Add(c.TTL), true
+	}
+	if strings.Contains(header.Get("Vary"), "*") {
+		return time.Time{}, false
+	}
+	maxAge := -1
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-store", "private":
+			return time.Time{}, false
+		case "no-cache":
+			return now, true
+		case "max-age":
+			if n, err := strconv.Atoi(value); err == nil && maxAge < 0 {
+				maxAge = n
+			}
+		case "s-maxage":
+			if n, err := strconv.Atoi(value); err == nil {
+				maxAge = n
+			}
+		}
+	}
+	if maxAge >= 0 {
+		return now.Add(time.Duration(maxAge) * time.Second), true
+	}
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		return expires, true
+	}
+	return now, header.Get("ETag") != ""
+}
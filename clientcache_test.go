@@ -0,0 +1,97 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestClientCache(t *testing.T) {
+	var calls, notModified int32
+	config := DefaultConfig
+	config.Cache = &CachePolicy{CacheControl: "max-age=60"}
+	cached := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		atomic.AddInt32(&calls, 1)
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+	config.Cache = &CachePolicy{CacheControl: "private, max-age=60"}
+	private := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		atomic.AddInt32(&calls, 1)
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+	uncached := UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		atomic.AddInt32(&calls, 1)
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	})
+	revalidated := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"text":"Hello"}`))
+	})
+
+	call := func(proxy *Proxy, name string) string {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		proxy.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Errorf("unexpected status %d", resp.Code)
+		}
+		return resp.Body.String()
+	}
+
+	for _, test := range []struct {
+		name        string
+		handler     http.Handler
+		ttl         time.Duration
+		calls       int32
+		notModified int32
+	}{
+		{"max-age", cached, 0, 2, 0},
+		{"uncached", uncached, 0, 3, 0},
+		{"ttl", uncached, time.Minute, 2, 0},
+		{"private", private, 0, 3, 0},
+		{"private-ttl", private, time.Minute, 2, 0},
+		{"etag", revalidated, 0, 3, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			calls, notModified = 0, 0
+			upstream := httptest.NewServer(test.handler)
+			defer upstream.Close()
+			proxy := NewProxy(upstream.URL)
+			proxy.Cache = NewClientCache(10)
+			proxy.Cache.TTL = test.ttl
+			first := call(proxy, "World")
+			if second := call(proxy, "World"); second != first {
+				t.Errorf("unexpected cached response %s, expected %s", second, first)
+			}
+			call(proxy, "Everyone")
+			if calls != test.calls || notModified != test.notModified {
+				t.Errorf("unexpected upstream calls %d %d", calls, notModified)
+			}
+		})
+	}
+}
+
+func TestClientCacheHeader(t *testing.T) {
+	c := NewClientCache(0)
+	header := http.Header{"Cache-Control": {"max-age=60"}, "X-Test": {"a"}}
+	c.put(clientCacheKey{}, header, nil)
+	header.Set("X-Test", "b")
+	entry, fresh := c.get(clientCacheKey{})
+	if !fresh || entry.header.Get("X-Test") != "a" {
+		t.Errorf("unexpected cached header: %v", entry)
+	}
+}
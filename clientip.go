@@ -0,0 +1,124 @@
+package ups
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPResolver resolves the addresses of clients from the headers set
+// by trusted proxies.
+type ClientIPResolver struct {
+	// TrustedProxies lists the networks of the proxies whose headers
+	// are used to determine the client address.
+	TrustedProxies []netip.Prefix
+
+	// Headers lists the headers that are consulted, in order, when the
+	// remote address is a trusted proxy.  The supported headers are
+	// Forwarded, X-Forwarded-For, and X-Real-IP.  If empty, all of them
+	// are consulted, in that order.
+	Headers []string
+}
+
+// NewClientIPResolver creates a ClientIPResolver trusting the proxies in
+// the CIDRs.  Addresses without prefix lengths are treated as single
+// addresses.
+func NewClientIPResolver(trustedProxies ...string) (*ClientIPResolver, error) {
+	prefixes, err := parsePrefixes(trustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &ClientIPResolver{TrustedProxies: prefixes}, nil
+}
+
+var defaultClientIPHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Real-IP"}
+
+// ClientIP returns the address of the client of the request, which is
+// the remote address unless it is a trusted proxy, in which case it is
+// the last address in the first of the Headers present that is not a
+// trusted proxy.
+func (res *ClientIPResolver) ClientIP(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	addr = addr.Unmap()
+	if !containsAddr(res.TrustedProxies, addr) {
+		return addr, true
+	}
+
+	headers := res.Headers
+	if len(headers) == 0 {
+		headers = defaultClientIPHeaders
+	}
+	for _, header := range headers {
+		values := r.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+		var hops []string
+		switch http.CanonicalHeaderKey(header) {
+		case "Forwarded":
+			hops = forwardedFor(values)
+		case "X-Real-Ip":
+			hops = values[len(values)-1:]
+		default:
+			hops = strings.Split(strings.Join(values, ","), ",")
+		}
+		for i := len(hops) - 1; i >= 0; i-- {
+			a, ok := parseHop(hops[i])
+			if !ok {
+				return netip.Addr{}, false
+			}
+			addr = a
+			if !containsAddr(res.TrustedProxies, addr) {
+				break
+			}
+		}
+		return addr, true
+	}
+	return addr, true
+}
+
+// forwardedFor returns the for parameters of the elements of RFC 7239
+// Forwarded headers.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				if k, v, ok := strings.Cut(strings.TrimSpace(pair), "="); ok && strings.EqualFold(k, "for") {
+					hop = v
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+func parseHop(hop string) (netip.Addr, bool) {
+	hop = strings.Trim(strings.TrimSpace(hop), `"`)
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	hop = strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]")
+	if addr, err := netip.ParseAddr(hop); err == nil {
+		return addr.Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+// ClientIP returns the client address resolved by the ClientIPResolver
+// of the Config for the request of the context.
+func ClientIP(ctx context.Context) (netip.Addr, bool) {
+	addr, ok := Value(ctx, clientIPContextKey)
+	return addr, ok
+}
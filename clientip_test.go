@@ -0,0 +1,64 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestClientIP(t *testing.T) {
+	res, err := NewClientIPResolver("10.0.0.0/8", "2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		remoteAddr string
+		header     map[string]string
+		expected   string
+	}{
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		{"192.0.2.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "192.0.2.1"},
+		{"10.0.0.1:1234", nil, "10.0.0.1"},
+		{"10.0.0.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1, 198.51.100.2, 10.0.0.2"}, "198.51.100.2"},
+		{"10.0.0.1:1234", map[string]string{"X-Real-IP": "198.51.100.3"}, "198.51.100.3"},
+		{"10.0.0.1:1234", map[string]string{"Forwarded": `for=198.51.100.4;proto=https, for="[2001:db8::1]:4711"`}, "198.51.100.4"},
+		{"10.0.0.1:1234", map[string]string{"Forwarded": "for=198.51.100.5", "X-Forwarded-For": "198.51.100.6"}, "198.51.100.5"},
+		{"[2001:db8::2]:1234", map[string]string{"X-Forwarded-For": "2001:db9::1"}, "2001:db9::1"},
+		{"10.0.0.1:1234", map[string]string{"Forwarded": "for=unknown"}, ""},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", nil)
+		req.RemoteAddr = test.remoteAddr
+		for key, val := range test.header {
+			req.Header.Set(key, val)
+		}
+		addr, ok := res.ClientIP(req)
+		if test.expected == "" {
+			if ok {
+				t.Errorf("%s %v: expected failure, got: %s", test.remoteAddr, test.header, addr)
+			}
+		} else if !ok || addr.String() != test.expected {
+			t.Errorf("%s %v: expected: %s, got: %s", test.remoteAddr, test.header, test.expected, addr)
+		}
+	}
+
+	config := DefaultConfig
+	config.ClientIP = res
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) *testingups.HelloResponse {
+		addr, _ := ClientIP(ctx)
+		return &testingups.HelloResponse{Text: "Hello, " + addr.String() + "!"}
+	}, config)
+	req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	req.RemoteAddr = "10.0.0.1:1234"
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if respBody := resp.Body.String(); respBody != `{"text":"Hello, 198.51.100.1!"}` {
+		t.Errorf("unexpected response body: %s", respBody)
+	}
+}
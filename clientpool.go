@@ -0,0 +1,167 @@
+package ups
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ClientOptions configure the http.Client of a ClientPool, such as for
+// Proxy, so that callers need not construct http.Transports.  Zero
+// values use the defaults of http.DefaultTransport.
+type ClientOptions struct {
+	// MaxIdleConnsPerHost is the number of idle connections kept for
+	// each host.  MaxConnsPerHost, if not zero, limits the connections
+	// to each host, with requests waiting for connections.
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+
+	// IdleConnTimeout is how long idle connections are kept.
+	IdleConnTimeout time.Duration
+
+	// DialTimeout is the timeout for establishing connections, and
+	// KeepAlive is the TCP keep-alive period.
+	DialTimeout time.Duration
+	KeepAlive   time.Duration
+
+	// TLSConfig, if not nil, is used for TLS connections, and
+	// TLSHandshakeTimeout is the timeout for TLS handshakes.
+	TLSConfig           *tls.Config
+	TLSHandshakeTimeout time.Duration
+
+	// DisableHTTP2 disables HTTP/2 over TLS.  H2C enables HTTP/2
+	// without TLS, with prior knowledge, for servers with H2C enabled,
+	// and disables HTTP/1, so requests to http:// URLs are HTTP/2-only.
+	DisableHTTP2 bool
+	H2C          bool
+
+	// Timeout, if not zero, limits the time of each request, including
+	// reading the response body.
+	Timeout time.Duration
+}
+
+// ClientPoolStats are the metrics of the connections of a ClientPool.
+type ClientPoolStats struct {
+	// Dials is the number of connections established, and OpenConns is
+	// the number of them that are open.
+	Dials     int64
+	OpenConns int64
+
+	// Requests is the number of requests sent, and ReusedConns is the
+	// number of them that were sent on previously used connections.
+	Requests    int64
+	ReusedConns int64
+}
+
+// ClientPool is an http.Client with a transport configured by
+// ClientOptions that collects ClientPoolStats.
+type ClientPool struct {
+	Client    *http.Client
+	Transport *http.Transport
+
+	dials    atomic.Int64
+	closes   atomic.Int64
+	requests atomic.Int64
+	reused   atomic.Int64
+}
+
+// NewClientPool creates a ClientPool configured by the options.
+func NewClientPool(opts ClientOptions) *ClientPool {
+	p := &ClientPool{}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if opts.DialTimeout != 0 {
+		dialer.Timeout = opts.DialTimeout
+	}
+	if opts.KeepAlive != 0 {
+		dialer.KeepAlive = opts.KeepAlive
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		p.dials.Add(1)
+		return &clientPoolConn{Conn: conn, pool: p}, nil
+	}
+	if opts.MaxIdleConnsPerHost != 0 {
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+		if transport.MaxIdleConns < opts.MaxIdleConnsPerHost {
+			// The total would otherwise limit the idle connections
+			// per host.
+			transport.MaxIdleConns = 0
+		}
+	}
+	transport.MaxConnsPerHost = opts.MaxConnsPerHost
+	if opts.IdleConnTimeout != 0 {
+		transport.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	if opts.TLSConfig != nil {
+		transport.TLSClientConfig = opts.TLSConfig
+	}
+	if opts.TLSHandshakeTimeout != 0 {
+		transport.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+	}
+	protocols := &http.Protocols{}
+	protocols.SetHTTP1(!opts.H2C)
+	protocols.SetHTTP2(!opts.DisableHTTP2)
+	protocols.SetUnencryptedHTTP2(opts.H2C)
+	transport.Protocols = protocols
+	p.Transport = transport
+	p.Client = &http.Client{
+		Transport: &clientPoolTransport{pool: p},
+		Timeout:   opts.Timeout,
+	}
+	return p
+}
+
+// Stats returns the metrics of the connections of the pool.
+func (p *ClientPool) Stats() ClientPoolStats {
+	dials := p.dials.Load()
+	return ClientPoolStats{
+		Dials:       dials,
+		OpenConns:   dials - p.closes.Load(),
+		Requests:    p.requests.Load(),
+		ReusedConns: p.reused.Load(),
+	}
+}
+
+// CloseIdleConnections closes the idle connections of the pool.
+func (p *ClientPool) CloseIdleConnections() {
+	p.Transport.CloseIdleConnections()
+}
+
+type clientPoolTransport struct {
+	pool *ClientPool
+}
+
+func (t *clientPoolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.pool.requests.Add(1)
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				t.pool.reused.Add(1)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return t.pool.Transport.RoundTrip(req)
+}
+
+type clientPoolConn struct {
+	net.Conn
+	pool *ClientPool
+	once sync.Once
+}
+
+func (c *clientPoolConn) Close() error {
+	c.once.Do(func() {
+		c.pool.closes.Add(1)
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,59 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestClientPool(t *testing.T) {
+	upstream := httptest.NewServer(UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}))
+	defer upstream.Close()
+
+	pool := NewClientPool(ClientOptions{MaxIdleConnsPerHost: 4, DialTimeout: time.Second, Timeout: 10 * time.Second})
+	proxy := NewProxy(upstream.URL)
+	proxy.Client = pool.Client
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		proxy.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Errorf("unexpected status %d", resp.Code)
+		}
+	}
+	if stats := pool.Stats(); stats != (ClientPoolStats{Dials: 1, OpenConns: 1, Requests: 3, ReusedConns: 2}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	pool.CloseIdleConnections()
+	if stats := pool.Stats(); stats.OpenConns != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestClientPoolH2C(t *testing.T) {
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	upstream.Config.Protocols = &http.Protocols{}
+	upstream.Config.Protocols.SetHTTP1(true)
+	upstream.Config.Protocols.SetUnencryptedHTTP2(true)
+	upstream.Start()
+	defer upstream.Close()
+
+	pool := NewClientPool(ClientOptions{H2C: true})
+	resp, err := pool.Client.Get(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("unexpected protocol: %s", resp.Proto)
+	}
+}
@@ -0,0 +1,309 @@
+// Command ups calls ups services for debugging and scripting.
+//
+// Usage:
+//
+//	ups [flags] URL
+//	ups -mock address -proto files [flags]
+//
+// The request is read as JSON from stdin and the decoded response is
+// written as JSON to stdout.
+//
+// The request and response messages are described either by .proto files
+// given with -proto, in which case -request and -response give the full
+// names of the messages, or by the ups reflection endpoint given with
+// -reflection, in which case they are looked up by the path of the URL.
+//
+// With -mock, the methods of the services of the .proto files are
+// served at /<full service name>/<method name> with the example
+// responses given with -examples, or with fake responses.
+//
+// The flags are:
+//
+//	-proto files
+//		Comma-separated .proto files describing the messages.
+//	-I paths
+//		Comma-separated import paths for the .proto files.
+//	-request name
+//		Full name of the request message, with -proto.
+//	-response name
+//		Full name of the response message, with -proto.
+//	-reflection URL
+//		URL of the ups reflection endpoint.
+//	-json
+//		Send the request as JSON instead of protobuf.
+//	-mock address
+//		Serve the services of the .proto files at the address.
+//	-examples file
+//		JSON file of the example responses of -mock, by full method
+//		name, such as {"example.HelloService.Hello": {"text": "Hello"}}.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/upspb"
+	"github.com/qpliu/ups/upstest"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, http.DefaultClient); err != nil {
+		fmt.Fprintln(os.Stderr, "ups:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer, client *http.Client) error {
+	flags := flag.NewFlagSet("ups", flag.ContinueOnError)
+	protoFiles := flags.String("proto", "", "comma-separated .proto files describing the messages")
+	importPaths := flags.String("I", "", "comma-separated import paths for the .proto files")
+	requestName := flags.String("request", "", "full name of the request message, with -proto")
+	responseName := flags.String("response", "", "full name of the response message, with -proto")
+	reflectionURL := flags.String("reflection", "", "URL of the ups reflection endpoint")
+	sendJSON := flags.Bool("json", false, "send the request as JSON instead of protobuf")
+	mockAddr := flags.String("mock", "", "serve the services of the .proto files at the address")
+	examples := flags.String("examples", "", "JSON file of the example responses of -mock, by full method name")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *mockAddr != "" {
+		if *protoFiles == "" || flags.NArg() != 0 {
+			return errors.New("usage: ups -mock address -proto files [flags]")
+		}
+		files, err := compileFiles(strings.Split(*protoFiles, ","), splitList(*importPaths))
+		if err != nil {
+			return err
+		}
+		server, err := mockServer(files, *examples)
+		if err != nil {
+			return err
+		}
+		return http.ListenAndServe(*mockAddr, server)
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: ups [flags] URL")
+	}
+	target := flags.Arg(0)
+
+	var reqDesc, respDesc protoreflect.MessageDescriptor
+	switch {
+	case *protoFiles != "" && *reflectionURL != "":
+		return errors.New("only one of -proto and -reflection may be given")
+	case *protoFiles != "":
+		files, err := compileFiles(strings.Split(*protoFiles, ","), splitList(*importPaths))
+		if err != nil {
+			return err
+		}
+		if reqDesc, err = findMessage(files, *requestName); err != nil {
+			return err
+		}
+		if respDesc, err = findMessage(files, *responseName); err != nil {
+			return err
+		}
+	case *reflectionURL != "":
+		var err error
+		if reqDesc, respDesc, err = lookupRoute(client, *reflectionURL, target); err != nil {
+			return err
+		}
+	default:
+		return errors.New("one of -proto or -reflection must be given")
+	}
+
+	reqJSON, err := io.ReadAll(stdin)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(reqJSON)) == 0 {
+		reqJSON = []byte("{}")
+	}
+	req := dynamicpb.NewMessage(reqDesc)
+	if err := protojson.Unmarshal(reqJSON, req); err != nil {
+		return err
+	}
+
+	var body []byte
+	contentType := "application/octet-stream"
+	if *sendJSON {
+		contentType = "application/json"
+		body, err = protojson.Marshal(req)
+	} else {
+		body, err = proto.Marshal(req)
+	}
+	if err != nil {
+		return err
+	}
+
+	resp := dynamicpb.NewMessage(respDesc)
+	if err := call(client, target, contentType, body, resp); err != nil {
+		return err
+	}
+	out, err := protojson.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, string(out))
+	return err
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func compileFiles(files, importPaths []string) (*protoregistry.Files, error) {
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: importPaths}),
+	}
+	results, err := compiler.Compile(context.Background(), files...)
+	if err != nil {
+		return nil, err
+	}
+	registry := &protoregistry.Files{}
+	var register func(protoreflect.FileDescriptor) error
+	register = func(fd protoreflect.FileDescriptor) error {
+		if _, err := registry.FindFileByPath(fd.Path()); err == nil {
+			return nil
+		}
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			if err := register(imports.Get(i).FileDescriptor); err != nil {
+				return err
+			}
+		}
+		return registry.RegisterFile(fd)
+	}
+	for _, fd := range results {
+		if err := register(fd); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+func findMessage(files *protoregistry.Files, name string) (protoreflect.MessageDescriptor, error) {
+	if name == "" {
+		return nil, errors.New("-request and -response must be given with -proto")
+	}
+	d, err := files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s: not a message", name)
+	}
+	return md, nil
+}
+
+// mockServer creates a StaticServer of the services of the files, with
+// the example responses of the examples file, if not empty.
+func mockServer(files *protoregistry.Files, examples string) (*upstest.StaticServer, error) {
+	var services []protoreflect.ServiceDescriptor
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for i := 0; i < fd.Services().Len(); i++ {
+			services = append(services, fd.Services().Get(i))
+		}
+		return true
+	})
+	if len(services) == 0 {
+		return nil, errors.New("no services in -proto files")
+	}
+	server := upstest.NewStaticServer(ups.DefaultConfig, services...)
+	server.Random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	if examples == "" {
+		return server, nil
+	}
+	data, err := os.ReadFile(examples)
+	if err != nil {
+		return nil, err
+	}
+	var responses map[string]json.RawMessage
+	if err := json.Unmarshal(data, &responses); err != nil {
+		return nil, fmt.Errorf("%s: %w", examples, err)
+	}
+	for method, resp := range responses {
+		if d, err := files.FindDescriptorByName(protoreflect.FullName(method)); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", examples, method, err)
+		} else if _, ok := d.(protoreflect.MethodDescriptor); !ok {
+			return nil, fmt.Errorf("%s: %s: not a method", examples, method)
+		}
+		if err := server.ExampleJSON(method, resp); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", examples, method, err)
+		}
+	}
+	return server, nil
+}
+
+func lookupRoute(client *http.Client, reflectionURL, target string) (protoreflect.MessageDescriptor, protoreflect.MessageDescriptor, error) {
+	var reflection upspb.ReflectionResponse
+	if err := call(client, reflectionURL, "application/octet-stream", nil, &reflection); err != nil {
+		return nil, nil, err
+	}
+	files, err := protodesc.NewFiles(reflection.GetFileDescriptorSet())
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, route := range reflection.GetRoutes() {
+		if route.GetPath() != u.Path {
+			continue
+		}
+		if route.GetResponseType() == "" {
+			return nil, nil, fmt.Errorf("%s: response type not known", u.Path)
+		}
+		reqDesc, err := findMessage(files, route.GetRequestType())
+		if err != nil {
+			return nil, nil, err
+		}
+		respDesc, err := findMessage(files, route.GetResponseType())
+		if err != nil {
+			return nil, nil, err
+		}
+		return reqDesc, respDesc, nil
+	}
+	return nil, nil, fmt.Errorf("%s: route not found", u.Path)
+}
+
+func call(client *http.Client, target, contentType string, body []byte, resp proto.Message) error {
+	httpResp, err := client.Post(target, contentType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	respBody, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s %s", target, httpResp.Status, bytes.TrimSpace(respBody))
+	}
+	if strings.HasPrefix(httpResp.Header.Get("Content-Type"), "application/json") {
+		return protojson.Unmarshal(respBody, resp)
+	}
+	return proto.Unmarshal(respBody, resp)
+}
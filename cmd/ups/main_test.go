@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestRun(t *testing.T) {
+	hello := ups.UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/hello", hello)
+	mux.Handle("/reflection", ups.ReflectionHandler(map[string]http.Handler{"/hello": hello}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	protoFile := filepath.Join("..", "..", "testingups", "testingups.proto")
+	if _, err := os.Stat(protoFile); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"-reflection", server.URL + "/reflection", server.URL + "/hello"},
+		{"-reflection", server.URL + "/reflection", "-json", server.URL + "/hello"},
+		{"-proto", "testingups.proto", "-I", filepath.Dir(protoFile), "-request", "HelloRequest", "-response", "HelloResponse", server.URL + "/hello"},
+	} {
+		var stdout bytes.Buffer
+		if err := run(args, strings.NewReader(`{"name":"World"}`), &stdout, server.Client()); err != nil {
+			t.Errorf("%v: %v", args, err)
+			continue
+		}
+		if !strings.Contains(stdout.String(), `"Hello, World!"`) {
+			t.Errorf("%v: unexpected output: %s", args, stdout.String())
+		}
+	}
+
+	if err := run([]string{"-reflection", server.URL + "/reflection", server.URL + "/missing"}, strings.NewReader(`{}`), &bytes.Buffer{}, server.Client()); err == nil {
+		t.Errorf("expected error for missing route")
+	}
+}
+
+func TestMockServer(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hello.proto"), []byte(`syntax = "proto3";
+package example;
+message HelloRequest { string name = 1; }
+message HelloResponse { string text = 1; }
+service HelloService {
+    rpc Hello(HelloRequest) returns (HelloResponse);
+    rpc Goodbye(HelloRequest) returns (HelloResponse);
+}
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	examples := filepath.Join(dir, "examples.json")
+	if err := os.WriteFile(examples, []byte(`{"example.HelloService.Hello": {"text": "Hello, World!"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := compileFiles([]string{"hello.proto"}, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := mockServer(files, examples)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for path, expected := range map[string]string{
+		"/example.HelloService/Hello":   `"Hello, World!"`,
+		"/example.HelloService/Goodbye": `"text`,
+	} {
+		var stdout bytes.Buffer
+		args := []string{"-proto", "hello.proto", "-I", dir, "-request", "example.HelloRequest", "-response", "example.HelloResponse", server.URL + path}
+		if err := run(args, strings.NewReader(`{}`), &stdout, server.Client()); err != nil {
+			t.Errorf("%s: %v", path, err)
+		} else if !strings.Contains(stdout.String(), expected) {
+			t.Errorf("%s: unexpected output: %s", path, stdout.String())
+		}
+	}
+
+	if err := os.WriteFile(examples, []byte(`{"example.HelloService.Missing": {}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mockServer(files, examples); err == nil {
+		t.Errorf("expected unknown method error")
+	}
+}
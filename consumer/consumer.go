@@ -0,0 +1,169 @@
+// Package consumer dispatches messages from queues, such as Kafka topics,
+// through ups handlers, so that the handler code of a service can also be
+// used for asynchronous processing.
+package consumer
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/qpliu/ups"
+)
+
+// Message is a message from a Source.  The Value is the request body,
+// and the Content-Type header gives its format, as with requests, with
+// protobuf being the default.
+type Message struct {
+	Key     []byte
+	Value   []byte
+	Headers http.Header
+
+	// Attempts is the number of times the message was dispatched,
+	// which is set for messages sent to the DeadLetter Sink.
+	Attempts int
+
+	// source is the message of the Source implementation.
+	source interface{}
+}
+
+// Source is a queue of messages.
+type Source interface {
+	// Fetch waits for the next message.
+	Fetch(ctx context.Context) (*Message, error)
+
+	// Commit marks the message as processed.
+	Commit(ctx context.Context, msg *Message) error
+}
+
+// Sink sends messages to a queue.
+type Sink interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Runner fetches messages from the Source and dispatches each of them,
+// in order, as a POST request to the Handler, which is usually created
+// with ups.UPS, then commits it.
+//
+// Messages with 2xx responses are processed.  Messages with 408, 429,
+// or 5xx responses are retried, and are sent to the DeadLetter Sink,
+// if any, when the retries are exhausted.  Messages with other
+// responses, such as 400 responses from handlers rejecting them, are
+// sent to the DeadLetter Sink without being retried.
+type Runner struct {
+	Source  Source
+	Handler http.Handler
+
+	// Path is the path of the dispatched requests, such as the route
+	// of the handler.  If empty, it is "/".
+	Path string
+
+	// Retries is the number of times a message is retried.
+	Retries int
+
+	// RetryDelay is the delay before the first retry, which doubles
+	// for each subsequent retry.
+	RetryDelay time.Duration
+
+	// DeadLetter, if not nil, is sent the messages that fail, with the
+	// Ups-Status header set to the status of the last attempt.
+	DeadLetter Sink
+
+	LogError func(context.Context, string, error)
+}
+
+// NewRunner creates a Runner for the source and handler.
+func NewRunner(source Source, handler http.Handler) *Runner {
+	return &Runner{Source: source, Handler: handler}
+}
+
+// Run processes messages until the context is done or the Source fails,
+// returning the error.
+func (r *Runner) Run(ctx context.Context) error {
+	for {
+		msg, err := r.Source.Fetch(ctx)
+		if err != nil {
+			return err
+		}
+		if err := r.process(ctx, msg); err != nil {
+			return err
+		}
+		if err := r.Source.Commit(ctx, msg); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Runner) process(ctx context.Context, msg *Message) error {
+	delay := r.RetryDelay
+	var statusCode int
+	for attempt := 0; ; attempt++ {
+		statusCode = r.dispatch(ctx, msg)
+		if statusCode >= 200 && statusCode < 300 {
+			return nil
+		}
+		if !retryable(statusCode) || attempt >= r.Retries {
+			msg.Attempts = attempt + 1
+			break
+		}
+		if delay > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-t.C:
+			}
+			delay *= 2
+		}
+	}
+	r.logError(ctx, "consumer.dispatch", &StatusError{Status: statusCode})
+	if r.DeadLetter == nil {
+		return nil
+	}
+	dead := *msg
+	dead.Headers = msg.Headers.Clone()
+	if dead.Headers == nil {
+		dead.Headers = http.Header{}
+	}
+	dead.Headers.Set("Ups-Status", strconv.Itoa(statusCode))
+	if err := r.DeadLetter.Send(ctx, &dead); err != nil {
+		r.logError(ctx, "Sink.Send", err)
+		return err
+	}
+	return nil
+}
+
+func retryable(statusCode int) bool {
+	return statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+func (r *Runner) dispatch(ctx context.Context, msg *Message) int {
+	resp := ups.Invoke(ctx, r.Handler, &ups.TransportRequest{
+		Route:  r.Path,
+		Header: msg.Headers,
+		Body:   msg.Value,
+		Source: msg,
+	})
+	return resp.StatusCode
+}
+
+func (r *Runner) logError(ctx context.Context, tag string, err error) {
+	if r.LogError != nil {
+		r.LogError(ctx, tag, err)
+	}
+}
+
+// StatusError is logged for messages that fail.
+type StatusError struct {
+	Status int
+}
+
+func (err *StatusError) Error() string {
+	return "consumer: status " + strconv.Itoa(err.Status)
+}
+
+func (err *StatusError) StatusCode() int {
+	return err.Status
+}
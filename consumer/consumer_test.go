@@ -0,0 +1,102 @@
+package consumer
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/testingups"
+)
+
+type testError int
+
+func (err testError) Error() string {
+	return strconv.Itoa(int(err))
+}
+
+func (err testError) StatusCode() int {
+	return int(err)
+}
+
+type testSource struct {
+	messages  []*Message
+	committed int
+}
+
+func (s *testSource) Fetch(ctx context.Context) (*Message, error) {
+	if len(s.messages) == 0 {
+		return nil, context.Canceled
+	}
+	msg := s.messages[0]
+	s.messages = s.messages[1:]
+	return msg, nil
+}
+
+func (s *testSource) Commit(ctx context.Context, msg *Message) error {
+	s.committed++
+	return nil
+}
+
+type testSink []*Message
+
+func (s *testSink) Send(ctx context.Context, msg *Message) error {
+	*s = append(*s, msg)
+	return nil
+}
+
+func TestRunner(t *testing.T) {
+	calls := map[string]int{}
+	handler := ups.UPSWithConfig(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		calls[req.Name]++
+		switch req.Name {
+		case "unavailable":
+			return nil, testError(http.StatusServiceUnavailable)
+		case "invalid":
+			return nil, testError(http.StatusBadRequest)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+	}, ups.Config{JSONMarshaler: ups.DefaultConfig.JSONMarshaler})
+
+	message := func(name string) *Message {
+		b, err := proto.Marshal(&testingups.HelloRequest{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &Message{Value: b}
+	}
+	source := &testSource{messages: []*Message{
+		message("World"),
+		message("unavailable"),
+		message("invalid"),
+		{Value: []byte(`{"name":"JSON"}`), Headers: http.Header{"Content-Type": {"application/json"}}},
+	}}
+	sink := &testSink{}
+	runner := NewRunner(source, handler)
+	runner.Retries = 2
+	runner.DeadLetter = sink
+	if err := runner.Run(context.Background()); err != context.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if source.committed != 4 {
+		t.Errorf("expected 4 commits, got %d", source.committed)
+	}
+	for name, expected := range map[string]int{"World": 1, "unavailable": 3, "invalid": 1, "JSON": 1} {
+		if calls[name] != expected {
+			t.Errorf("%s: expected %d calls, got %d", name, expected, calls[name])
+		}
+	}
+	if len(*sink) != 2 {
+		t.Fatalf("expected 2 dead letters, got %d", len(*sink))
+	}
+	if msg := (*sink)[0]; msg.Attempts != 3 || msg.Headers.Get("Ups-Status") != "503" {
+		t.Errorf("unexpected dead letter: %d %v", msg.Attempts, msg.Headers)
+	}
+	if msg := (*sink)[1]; msg.Attempts != 1 || msg.Headers.Get("Ups-Status") != "400" {
+		t.Errorf("unexpected dead letter: %d %v", msg.Attempts, msg.Headers)
+	}
+}
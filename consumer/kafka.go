@@ -0,0 +1,78 @@
+package consumer
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaSource is a Source reading from a Kafka topic with a consumer
+// group, so that messages are committed to the group.
+type KafkaSource struct {
+	Reader *kafka.Reader
+}
+
+// NewKafkaSource creates a KafkaSource reading the topic as a member of
+// the consumer group.
+func NewKafkaSource(brokers []string, groupID, topic string) *KafkaSource {
+	return &KafkaSource{Reader: kafka.NewReader(kafka.ReaderConfig{
+		Brokers: brokers,
+		GroupID: groupID,
+		Topic:   topic,
+	})}
+}
+
+func (s *KafkaSource) Fetch(ctx context.Context) (*Message, error) {
+	m, err := s.Reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	msg := &Message{Key: m.Key, Value: m.Value, Headers: http.Header{}, source: m}
+	for _, h := range m.Headers {
+		msg.Headers.Add(h.Key, string(h.Value))
+	}
+	return msg, nil
+}
+
+func (s *KafkaSource) Commit(ctx context.Context, msg *Message) error {
+	m, ok := msg.source.(kafka.Message)
+	if !ok {
+		return nil
+	}
+	return s.Reader.CommitMessages(ctx, m)
+}
+
+// Close closes the Reader.
+func (s *KafkaSource) Close() error {
+	return s.Reader.Close()
+}
+
+// KafkaSink is a Sink writing to a Kafka topic, such as a dead letter
+// topic.
+type KafkaSink struct {
+	Writer *kafka.Writer
+}
+
+// NewKafkaSink creates a KafkaSink writing to the topic.
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+	return &KafkaSink{Writer: &kafka.Writer{
+		Addr:  kafka.TCP(brokers...),
+		Topic: topic,
+	}}
+}
+
+func (s *KafkaSink) Send(ctx context.Context, msg *Message) error {
+	m := kafka.Message{Key: msg.Key, Value: msg.Value}
+	for key, values := range msg.Headers {
+		for _, value := range values {
+			m.Headers = append(m.Headers, kafka.Header{Key: key, Value: []byte(value)})
+		}
+	}
+	return s.Writer.WriteMessages(ctx, m)
+}
+
+// Close closes the Writer.
+func (s *KafkaSink) Close() error {
+	return s.Writer.Close()
+}
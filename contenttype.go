@@ -0,0 +1,75 @@
+package ups
+
+import (
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// ContentTypeMode selects how request Content-Types are matched.
+type ContentTypeMode int
+
+const (
+	// ContentTypeDefault matches the media type of the Content-Type,
+	// ignoring parameters, and rejects requests without a Content-Type.
+	ContentTypeDefault ContentTypeMode = iota
+
+	// ContentTypeStrict also requires that the Content-Type be exactly
+	// the media type, in lower case, without parameters.
+	ContentTypeStrict
+
+	// ContentTypePermissive treats requests without a Content-Type as
+	// protobuf, and accepts application/protobuf and vendor types with
+	// +json and +protobuf suffixes, such as application/vnd.foo+json.
+	ContentTypePermissive
+)
+
+// permissiveMediaType maps the media types accepted by
+// ContentTypePermissive to the built-in media types.
+func permissiveMediaType(mediaType string) string {
+	switch {
+	case mediaType == "application/protobuf":
+		return "application/x-protobuf"
+	case !strings.HasPrefix(mediaType, "application/"):
+		return mediaType
+	case strings.HasSuffix(mediaType, "+json"):
+		return "application/json"
+	case strings.HasSuffix(mediaType, "+protobuf"), strings.HasSuffix(mediaType, "+x-protobuf"), strings.HasSuffix(mediaType, "+proto"):
+		return "application/x-protobuf"
+	default:
+		return mediaType
+	}
+}
+
+// sniffJSON reports whether the body looks like a JSON object.  The
+// protobuf encoding of a proto3 message never starts with '{', which
+// would be the start of group 15.  Leading whitespace is not skipped, as
+// '\n' and ' ' are common first bytes of protobuf encodings.
+func sniffJSON(body []byte) bool {
+	return len(body) > 0 && body[0] == '{'
+}
+
+// charsetDecoder returns the decoder for the charset of a JSON request,
+// which is nil for UTF-8, or false if the charset is not accepted.
+func (ups *upsHandler) charsetDecoder(charset string) (*encoding.Decoder, bool) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8":
+		return nil, true
+	}
+	if !ups.config.JSONCharsets {
+		return nil, false
+	}
+	enc, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, false
+	}
+	return enc.NewDecoder(), true
+}
+
+func (ups *upsHandler) jsonContentType() string {
+	if ups.config.JSONResponseCharset {
+		return "application/json; charset=utf-8"
+	}
+	return "application/json"
+}
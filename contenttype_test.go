@@ -0,0 +1,129 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestContentTypeMode(t *testing.T) {
+	protobufReq := string([]byte{0x0a, 5, 'W', 'o', 'r', 'l', 'd'})
+	protobufResp := string([]byte{0x0a, 13, 'H', 'e', 'l', 'l', 'o', ',', ' ', 'W', 'o', 'r', 'l', 'd', '!'})
+	jsonReq := `{"name":"World"}`
+	jsonResp := `{"text":"Hello, World!"}`
+
+	for _, test := range []struct {
+		name        string
+		mode        ContentTypeMode
+		sniff       bool
+		contentType string
+		body        string
+		statusCode  int
+		resp        string
+	}{
+		{"default missing", ContentTypeDefault, false, "", protobufReq, http.StatusUnsupportedMediaType, ""},
+		{"default params", ContentTypeDefault, false, "application/json; charset=utf-8", jsonReq, http.StatusOK, jsonResp},
+		{"default vendor", ContentTypeDefault, false, "application/vnd.hello+json", jsonReq, http.StatusUnsupportedMediaType, ""},
+		{"strict", ContentTypeStrict, false, "application/json", jsonReq, http.StatusOK, jsonResp},
+		{"strict params", ContentTypeStrict, false, "application/json; charset=utf-8", jsonReq, http.StatusUnsupportedMediaType, ""},
+		{"strict case", ContentTypeStrict, false, "Application/JSON", jsonReq, http.StatusUnsupportedMediaType, ""},
+		{"permissive missing", ContentTypePermissive, false, "", protobufReq, http.StatusOK, protobufResp},
+		{"permissive missing json", ContentTypePermissive, false, "", jsonReq, http.StatusInternalServerError, ""},
+		{"permissive sniff json", ContentTypePermissive, true, "", jsonReq, http.StatusOK, jsonResp},
+		{"permissive sniff protobuf", ContentTypePermissive, true, "", protobufReq, http.StatusOK, protobufResp},
+		{"permissive vendor json", ContentTypePermissive, false, "application/vnd.hello+json", jsonReq, http.StatusOK, jsonResp},
+		{"permissive vendor protobuf", ContentTypePermissive, false, "application/vnd.hello+protobuf", protobufReq, http.StatusOK, protobufResp},
+		{"permissive application/protobuf", ContentTypePermissive, false, "application/protobuf", protobufReq, http.StatusOK, protobufResp},
+		{"permissive unknown", ContentTypePermissive, false, "image/png", protobufReq, http.StatusUnsupportedMediaType, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig
+			config.LogError = nil
+			config.ContentTypeMode = test.mode
+			config.SniffContentType = test.sniff
+			handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+				return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+			}, config)
+			req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(test.body))
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+			if resp.Code != test.statusCode {
+				t.Errorf("response code: expected: %d, got: %d", test.statusCode, resp.Code)
+			} else if test.statusCode == http.StatusOK && resp.Body.String() != test.resp {
+				t.Errorf("response body, expected: %q, got: %q", test.resp, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestProtobufContentType(t *testing.T) {
+	for _, test := range []struct {
+		contentType string
+		parameter   bool
+		expected    string
+	}{
+		{"", false, "application/octet-stream"},
+		{"application/x-protobuf", false, "application/x-protobuf"},
+		{"application/protobuf", true, "application/protobuf; proto=HelloResponse"},
+	} {
+		config := DefaultConfig
+		config.ProtobufContentType = test.contentType
+		config.ProtobufTypeParameter = test.parameter
+		handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+			return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+		}, config)
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBuffer([]byte{0x0a, 5, 'W', 'o', 'r', 'l', 'd'}))
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if contentType := resp.Header().Get("Content-Type"); contentType != test.expected {
+			t.Errorf("response Content-Type: expected: %s, got: %s", test.expected, contentType)
+		}
+	}
+}
+
+func TestJSONCharset(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		charsets    bool
+		respCharset bool
+		contentType string
+		body        []byte
+		statusCode  int
+		respType    string
+	}{
+		{"utf-8", false, false, "application/json; charset=UTF-8", []byte(`{"name":"Wörld"}`), http.StatusOK, "application/json"},
+		{"latin1 rejected", false, false, "application/json; charset=iso-8859-1", []byte("{\"name\":\"W\xf6rld\"}"), http.StatusUnsupportedMediaType, ""},
+		{"latin1 transcoded", true, true, "application/json; charset=iso-8859-1", []byte("{\"name\":\"W\xf6rld\"}"), http.StatusOK, "application/json; charset=utf-8"},
+		{"unknown charset", true, false, "application/json; charset=x-unknown", []byte(`{"name":"World"}`), http.StatusUnsupportedMediaType, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig
+			config.JSONCharsets = test.charsets
+			config.JSONResponseCharset = test.respCharset
+			handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+				return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+			}, config)
+			req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBuffer(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+			if resp.Code != test.statusCode {
+				t.Errorf("response code: expected: %d, got: %d", test.statusCode, resp.Code)
+			} else if test.statusCode == http.StatusOK {
+				if resp.Body.String() != `{"text":"Hello, Wörld!"}` {
+					t.Errorf("unexpected response body: %s", resp.Body.String())
+				}
+				if contentType := resp.Header().Get("Content-Type"); contentType != test.respType {
+					t.Errorf("response Content-Type: expected: %s, got: %s", test.respType, contentType)
+				}
+			}
+		})
+	}
+}
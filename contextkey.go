@@ -0,0 +1,67 @@
+package ups
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+)
+
+// ContextKey is a key of context values of type T.  Keys are distinct
+// by identity, so that keys of different packages cannot collide, even
+// with the same name.
+type ContextKey[T any] struct {
+	name string
+}
+
+// NewContextKey creates a ContextKey.  The name is for debugging.
+func NewContextKey[T any](name string) *ContextKey[T] {
+	return &ContextKey[T]{name: name}
+}
+
+func (key *ContextKey[T]) String() string {
+	return "ups context key " + key.name
+}
+
+// WithValue returns a copy of the context with the value of the key.
+func WithValue[T any](ctx context.Context, key *ContextKey[T], value T) context.Context {
+	return context.WithValue(ctx, key, value)
+}
+
+// Value returns the value of the key in the context, and false if the
+// context has no value for the key.
+func Value[T any](ctx context.Context, key *ContextKey[T]) (T, bool) {
+	value, ok := ctx.Value(key).(T)
+	return value, ok
+}
+
+// The keys of the values set by the handlers created by this package.
+var (
+	// RequestIDKey is the X-Request-Id header of the request, if any.
+	RequestIDKey = NewContextKey[string]("request ID")
+
+	// RouteKey is the route of the request, which is the Config.Route,
+	// or the pattern or the path of the request.
+	RouteKey = NewContextKey[string]("route")
+
+	// PrincipalKey is the principal of authenticated requests, as with
+	// AuthenticatedPrincipal.
+	PrincipalKey = NewContextKey[*Principal]("principal")
+
+	// TenantKey is the tenant of requests, as with TenantFromContext.
+	TenantKey = NewContextKey[*Tenant]("tenant")
+)
+
+var (
+	clientIPContextKey       = NewContextKey[netip.Addr]("client IP")
+	peerContextKey           = NewContextKey[*PeerIdentity]("peer")
+	summaryContextKey        = NewContextKey[*RequestSummary]("summary")
+	sampleContextKey         = NewContextKey[*logSample]("log sample")
+	responseContextKey       = NewContextKey[*responseState]("response")
+	rawRequestContextKey     = NewContextKey[*RawRequest]("raw request")
+	requestInfoContextKey    = NewContextKey[*RequestMetadata]("request info")
+	panicContextKey          = NewContextKey[*PanicInfo]("panic")
+	degradedContextKey       = NewContextKey[bool]("degraded")
+	featureFlagsContextKey   = NewContextKey[FeatureFlags]("feature flags")
+	loggerContextKey         = NewContextKey[*slog.Logger]("logger")
+	methodOverrideContextKey = NewContextKey[string]("method override")
+)
@@ -0,0 +1,38 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestContextKey(t *testing.T) {
+	a, b := NewContextKey[string]("name"), NewContextKey[string]("name")
+	ctx := WithValue(context.Background(), a, "a")
+	if v, ok := Value(ctx, a); !ok || v != "a" {
+		t.Errorf("unexpected value: %q %v", v, ok)
+	}
+	if v, ok := Value(ctx, b); ok || v != "" {
+		t.Errorf("unexpected value of distinct key: %q %v", v, ok)
+	}
+
+	config := DefaultConfig
+	config.Route = "hello"
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) *testingups.HelloResponse {
+		route, _ := Value(ctx, RouteKey)
+		requestID, _ := Value(ctx, RequestIDKey)
+		return &testingups.HelloResponse{Text: route + " " + requestID}
+	}, config)
+	r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Request-Id", "abc")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, r)
+	if resp.Body.String() != `{"text":"hello abc"}` {
+		t.Errorf("unexpected response: %s", resp.Body.String())
+	}
+}
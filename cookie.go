@@ -0,0 +1,38 @@
+package ups
+
+import (
+	"context"
+	"net/http"
+)
+
+// Cookie returns the named cookie of the request of the context, for
+// handlers that do not take the *http.Request.
+func Cookie(ctx context.Context, name string) (*http.Cookie, bool) {
+	state := responseStateFromContext(ctx)
+	if state == nil {
+		return nil, false
+	}
+	cookie, err := state.request.Cookie(name)
+	return cookie, err == nil
+}
+
+// Cookies returns the cookies of the request of the context.
+func Cookies(ctx context.Context) []*http.Cookie {
+	state := responseStateFromContext(ctx)
+	if state == nil {
+		return nil
+	}
+	return state.request.Cookies()
+}
+
+// SetCookie adds a Set-Cookie header to the response of the request of
+// the context, including error responses.  It returns false if the
+// context is not from a ups handler.
+func SetCookie(ctx context.Context, cookie *http.Cookie) bool {
+	state := responseStateFromContext(ctx)
+	if state == nil {
+		return false
+	}
+	state.cookies = append(state.cookies, cookie)
+	return true
+}
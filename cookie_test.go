@@ -0,0 +1,51 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestCookies(t *testing.T) {
+	handler := UPS(func(ctx context.Context, req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		session, ok := Cookie(ctx, "session")
+		if !ok {
+			SetCookie(ctx, &http.Cookie{Name: "session", Value: "new", HttpOnly: true})
+			return nil, testError(http.StatusUnauthorized)
+		}
+		SetCookie(ctx, &http.Cookie{Name: "seen", Value: session.Value})
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "! " + string(rune('0'+len(Cookies(ctx))))}, nil
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusUnauthorized {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusUnauthorized, resp.Code)
+	}
+	if setCookie := resp.Header().Get("Set-Cookie"); setCookie != "session=new; HttpOnly" {
+		t.Errorf("unexpected Set-Cookie: %s", setCookie)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	req.AddCookie(&http.Cookie{Name: "other", Value: "x"})
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK || resp.Body.String() != `{"text":"Hello, World! 2"}` {
+		t.Errorf("unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+	if setCookie := resp.Header().Get("Set-Cookie"); setCookie != "seen=abc" {
+		t.Errorf("unexpected Set-Cookie: %s", setCookie)
+	}
+
+	if _, ok := Cookie(context.Background(), "session"); ok || SetCookie(context.Background(), &http.Cookie{Name: "x"}) {
+		t.Errorf("expected false without request")
+	}
+}
@@ -0,0 +1,80 @@
+package ups
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CSRF configures cross-site request forgery defenses for requests from
+// browsers authenticated with cookies.  Requests without cookies are not
+// checked.  Requests failing the checks get a 403 response.
+type CSRF struct {
+	// AllowedOrigins lists the origins, such as https://example.com,
+	// allowed to make requests.  If empty, only the origin of the Host
+	// of the request is allowed.  The origin is taken from the Origin
+	// header, or if absent, the Referer header.
+	AllowedOrigins []string
+
+	// RequireOrigin, if true, rejects requests that have neither an
+	// Origin nor a Referer header.
+	RequireOrigin bool
+
+	// CookieName and HeaderName, if not empty, enable double-submit
+	// token verification, requiring the header to be equal to the
+	// cookie.
+	CookieName string
+	HeaderName string
+}
+
+// Check reports whether the request passes the checks.
+func (csrf *CSRF) Check(r *http.Request) bool {
+	if r.Header.Get("Cookie") == "" {
+		return true
+	}
+	if origin := requestOrigin(r); origin != "" {
+		if !csrf.allowedOrigin(r, origin) {
+			return false
+		}
+	} else if csrf.RequireOrigin {
+		return false
+	}
+	if csrf.CookieName != "" && csrf.HeaderName != "" {
+		cookie, err := r.Cookie(csrf.CookieName)
+		if err != nil || cookie.Value == "" {
+			return false
+		}
+		token := r.Header.Get(csrf.HeaderName)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) != 1 {
+			return false
+		}
+	}
+	return true
+}
+
+func requestOrigin(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return origin
+	}
+	if referer := r.Header.Get("Referer"); referer != "" {
+		if u, err := url.Parse(referer); err == nil && u.Scheme != "" && u.Host != "" {
+			return u.Scheme + "://" + u.Host
+		}
+		return "null"
+	}
+	return ""
+}
+
+func (csrf *CSRF) allowedOrigin(r *http.Request, origin string) bool {
+	if len(csrf.AllowedOrigins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+	for _, allowed := range csrf.AllowedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
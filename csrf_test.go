@@ -0,0 +1,52 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestCSRF(t *testing.T) {
+	hello := func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}
+	originConfig := DefaultConfig
+	originConfig.CSRF = &CSRF{RequireOrigin: true}
+	originHandler := UPSWithConfig(hello, originConfig)
+
+	tokenConfig := DefaultConfig
+	tokenConfig.CSRF = &CSRF{AllowedOrigins: []string{"https://app.example.com"}, CookieName: "csrf", HeaderName: "X-CSRF-Token"}
+	tokenHandler := UPSWithConfig(hello, tokenConfig)
+
+	for _, test := range []struct {
+		handler http.Handler
+		header  map[string]string
+		code    int
+	}{
+		{originHandler, nil, http.StatusOK},
+		{originHandler, map[string]string{"Cookie": "session=1"}, http.StatusForbidden},
+		{originHandler, map[string]string{"Cookie": "session=1", "Origin": "http://example.com"}, http.StatusOK},
+		{originHandler, map[string]string{"Cookie": "session=1", "Origin": "http://evil.com"}, http.StatusForbidden},
+		{originHandler, map[string]string{"Cookie": "session=1", "Referer": "http://example.com/page"}, http.StatusOK},
+		{originHandler, map[string]string{"Cookie": "session=1", "Referer": "http://evil.com/page"}, http.StatusForbidden},
+		{tokenHandler, map[string]string{"Cookie": "csrf=abc", "X-CSRF-Token": "abc"}, http.StatusOK},
+		{tokenHandler, map[string]string{"Cookie": "csrf=abc", "X-CSRF-Token": "abd"}, http.StatusForbidden},
+		{tokenHandler, map[string]string{"Cookie": "session=1", "X-CSRF-Token": ""}, http.StatusForbidden},
+		{tokenHandler, map[string]string{"Cookie": "csrf=abc", "X-CSRF-Token": "abc", "Origin": "https://app.example.com"}, http.StatusOK},
+		{tokenHandler, map[string]string{"Cookie": "csrf=abc", "X-CSRF-Token": "abc", "Origin": "http://example.com"}, http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/hello", bytes.NewBufferString(`{"name":"World"}`))
+		req.Header.Set("Content-Type", "application/json")
+		for key, val := range test.header {
+			req.Header.Set(key, val)
+		}
+		resp := httptest.NewRecorder()
+		test.handler.ServeHTTP(resp, req)
+		if resp.Code != test.code {
+			t.Errorf("%v: response code: expected: %d, got: %d", test.header, test.code, resp.Code)
+		}
+	}
+}
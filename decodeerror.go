@@ -0,0 +1,149 @@
+package ups
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// decodeErrorPosition matches the positions in the errors of the JSON
+// and text format unmarshallers.
+var decodeErrorPosition = regexp.MustCompile(`\(line (\d+):(\d+)\)`)
+
+// decodeErrorBody returns the JSON body of the response to a request
+// that cannot be unmarshalled, with Config.DecodeErrorDetails, or nil.
+func (ups *upsHandler) decodeErrorBody(err error, req []byte, reqFormat format) []byte {
+	if !ups.config.DecodeErrorDetails {
+		return nil
+	}
+	if reqFormat == jsonFormat && ups.requestDescriptor != nil {
+		// The errors of jsonpb do not have positions, unlike those of
+		// protojson.
+		opts := protojson.UnmarshalOptions{DiscardUnknown: ups.config.JSONUnmarshaler != nil && ups.config.JSONUnmarshaler.AllowUnknownFields}
+		if jsonErr := opts.Unmarshal(req, dynamicpb.NewMessage(ups.requestDescriptor)); jsonErr != nil {
+			err = jsonErr
+		}
+	}
+	body := struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+		Line    int    `json:"line,omitempty"`
+		Column  int    `json:"column,omitempty"`
+		Offset  *int   `json:"offset,omitempty"`
+		Field   string `json:"field,omitempty"`
+	}{
+		Error:   "invalid_request",
+		Message: err.Error(),
+	}
+	if m := decodeErrorPosition.FindStringSubmatch(body.Message); m != nil {
+		body.Line, _ = strconv.Atoi(m[1])
+		body.Column, _ = strconv.Atoi(m[2])
+		offset := lineOffset(req, body.Line, body.Column)
+		body.Offset = &offset
+		if reqFormat == jsonFormat {
+			body.Field = jsonFieldPath(req, offset)
+		}
+	}
+	b, _ := json.Marshal(body)
+	return b
+}
+
+// lineOffset returns the byte offset of the 1-based line and column.
+func lineOffset(data []byte, line, column int) int {
+	offset := 0
+	for ; line > 1; line-- {
+		i := bytes.IndexByte(data[offset:], '\n')
+		if i < 0 {
+			return len(data)
+		}
+		offset += i + 1
+	}
+	return min(offset+column-1, len(data))
+}
+
+// jsonFieldPath returns the path, such as "items[2].name", of the value
+// or key at the offset of the JSON.
+func jsonFieldPath(data []byte, offset int) string {
+	type frame struct {
+		object    bool
+		key       string
+		expectKey bool
+		index     int
+	}
+	var stack []*frame
+	beginValue := func() {
+		if n := len(stack); n > 0 && !stack[n-1].object {
+			stack[n-1].index++
+		}
+	}
+	endValue := func() {
+		if n := len(stack); n > 0 && stack[n-1].object {
+			stack[n-1].expectKey = true
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	next := func() bool {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			beginValue()
+			stack = append(stack, &frame{object: tok == json.Delim('{'), expectKey: true, index: -1})
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			endValue()
+		default:
+			if n := len(stack); n > 0 && stack[n-1].object && stack[n-1].expectKey {
+				stack[n-1].key, _ = tok.(string)
+				stack[n-1].expectKey = false
+			} else {
+				beginValue()
+				endValue()
+			}
+		}
+		return true
+	}
+	// The start of the next token follows the whitespace and separators
+	// after the input offset.
+	start := func() int {
+		i := int(dec.InputOffset())
+		for i < len(data) && strings.IndexByte(" \t\r\n,:", data[i]) >= 0 {
+			i++
+		}
+		return i
+	}
+	for start() < offset && next() {
+	}
+	// The offset is at the start of the offending key or value, which
+	// is included if it is a key.
+	if n := len(stack); n > 0 && stack[n-1].object && stack[n-1].expectKey {
+		next()
+	}
+
+	var path strings.Builder
+	for i, f := range stack {
+		switch {
+		case f.object && !f.expectKey:
+			if path.Len() > 0 {
+				path.WriteByte('.')
+			}
+			path.WriteString(f.key)
+		case !f.object:
+			index := f.index
+			if i == len(stack)-1 {
+				// The offending element has not begun.
+				index++
+			}
+			path.WriteString("[" + strconv.Itoa(max(index, 0)) + "]")
+		}
+	}
+	return path.String()
+}
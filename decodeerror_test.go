@@ -0,0 +1,59 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestDecodeErrorDetails(t *testing.T) {
+	config := DefaultConfig
+	config.LogError = nil
+	config.DecodeErrorDetails = true
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello " + req.Name}
+	}, config)
+
+	for _, test := range []struct {
+		contentType string
+		body        string
+		expected    []string
+	}{
+		{"application/json", "{\n  \"name\": 1\n}", []string{`"error":"invalid_request"`, `"line":2`, `"column":11`, `"offset":12`, `"field":"name"`}},
+		{"application/json", `{"nme":"World"}`, []string{`"line":1`, `"column":2`, `"field":"nme"`}},
+		{"application/octet-stream", "\x0a\x05Wor", []string{`"error":"invalid_request"`, `"message":"`}},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, r)
+		if resp.Code != http.StatusInternalServerError || resp.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%q: unexpected response: %d %v", test.body, resp.Code, resp.Header())
+		}
+		for _, s := range test.expected {
+			if !strings.Contains(resp.Body.String(), s) {
+				t.Errorf("%q: expected %s in %s", test.body, s, resp.Body.String())
+			}
+		}
+	}
+}
+
+func TestJSONFieldPath(t *testing.T) {
+	data := `{"a": {"b": [1, {"c": true}]}, "d": [1, 2, null]}`
+	for _, test := range []struct {
+		at       string
+		expected string
+	}{
+		{`true`, "a.b[1].c"},
+		{`null`, "d[2]"},
+		{`"d"`, "d"},
+	} {
+		if path := jsonFieldPath([]byte(data), strings.Index(data, test.at)); path != test.expected {
+			t.Errorf("%s: unexpected path: %s", test.at, path)
+		}
+	}
+}
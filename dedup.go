@@ -0,0 +1,108 @@
+package ups
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Deduplicator detects duplicate requests, with the same nonce header
+// and the same body, within a sliding window.  Duplicates of requests
+// that succeeded get the original response, and duplicates of requests
+// that are still in progress get 409 responses.  Requests without the
+// nonce header, and requests that failed, are not deduplicated.
+//
+// A Deduplicator is lighter-weight than idempotency keys, for clients
+// that retry requests without waiting for responses.
+type Deduplicator struct {
+	// Header is the nonce header.
+	Header string
+
+	window time.Duration
+
+	mu      sync.Mutex
+	entries map[dedupKey]*dedupEntry
+	expiry  []dedupExpiry
+}
+
+type dedupKey [sha256.Size]byte
+
+type dedupEntry struct {
+	expiry      time.Time
+	done        bool
+	contentType string
+	body        []byte
+}
+
+type dedupExpiry struct {
+	key dedupKey
+	at  time.Time
+}
+
+// NewDeduplicator creates a Deduplicator with the X-Request-Nonce header
+// that remembers requests for the window.
+func NewDeduplicator(window time.Duration) *Deduplicator {
+	return &Deduplicator{
+		Header:  "X-Request-Nonce",
+		window:  window,
+		entries: map[dedupKey]*dedupEntry{},
+	}
+}
+
+// key returns the key of the request, or false if it has no nonce.
+func (d *Deduplicator) key(r *http.Request, route string, body []byte) (dedupKey, bool) {
+	nonce := r.Header.Get(d.Header)
+	if nonce == "" {
+		return dedupKey{}, false
+	}
+	h := sha256.New()
+	for _, s := range []string{nonce, route, r.Header.Get("Content-Type")} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	var key dedupKey
+	h.Sum(key[:0])
+	return key, true
+}
+
+// begin returns false if the request is not a duplicate, and the entry
+// of the original request otherwise.
+func (d *Deduplicator) begin(key dedupKey) (dedupEntry, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for len(d.expiry) > 0 && now.After(d.expiry[0].at) {
+		e := d.expiry[0]
+		d.expiry = d.expiry[1:]
+		if entry, ok := d.entries[e.key]; ok && entry.expiry == e.at {
+			delete(d.entries, e.key)
+		}
+	}
+	if entry, ok := d.entries[key]; ok {
+		return *entry, true
+	}
+	at := now.Add(d.window)
+	d.entries[key] = &dedupEntry{expiry: at}
+	d.expiry = append(d.expiry, dedupExpiry{key: key, at: at})
+	return dedupEntry{}, false
+}
+
+// end records the response of the original request if it succeeded,
+// and forgets the request otherwise.
+func (d *Deduplicator) end(key dedupKey, statusCode int, contentType string, body []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry, ok := d.entries[key]
+	if !ok {
+		return
+	}
+	if statusCode != http.StatusOK {
+		delete(d.entries, key)
+		return
+	}
+	entry.done = true
+	entry.contentType = contentType
+	entry.body = body
+}
@@ -0,0 +1,75 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestDeduplicator(t *testing.T) {
+	calls := 0
+	block := make(chan struct{})
+	blocked := make(chan struct{})
+	config := DefaultConfig
+	config.Dedup = NewDeduplicator(50 * time.Millisecond)
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		calls++
+		switch req.Name {
+		case "slow":
+			close(blocked)
+			<-block
+		case "fail":
+			return nil, testError(http.StatusServiceUnavailable)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+	}, config)
+	call := func(name, nonce string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if nonce != "" {
+			req.Header.Set("X-Request-Nonce", nonce)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	for i, nonce := range []string{"a", "a", "b", "", ""} {
+		if resp := call("World", nonce); resp.Code != http.StatusOK || resp.Body.String() != `{"text":"Hello, World!"}` || resp.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%d: unexpected response: %d %s", i, resp.Code, resp.Body.String())
+		}
+	}
+	if calls != 4 {
+		t.Errorf("expected 4 calls, got: %d", calls)
+	}
+
+	calls = 0
+	call("fail", "c")
+	call("fail", "c")
+	if calls != 2 {
+		t.Errorf("expected failed requests to be retried, got %d calls", calls)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		call("slow", "d")
+		close(done)
+	}()
+	<-blocked
+	if resp := call("slow", "d"); resp.Code != http.StatusConflict {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusConflict, resp.Code)
+	}
+	close(block)
+	<-done
+
+	calls = 0
+	time.Sleep(60 * time.Millisecond)
+	call("World", "a")
+	if calls != 1 {
+		t.Errorf("expected request after window to be handled, got %d calls", calls)
+	}
+}
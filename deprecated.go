@@ -0,0 +1,52 @@
+package ups
+
+import (
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// deprecatedFields appends the paths of the populated fields of m, and
+// of its nested messages, that are marked deprecated, such as
+// "options.old_name", in the order of the declarations of the fields.
+// Each path is appended once.
+func deprecatedFields(m protoreflect.Message, prefix string, fields []string) []string {
+	fds := m.Descriptor().Fields()
+	for i := 0; i < fds.Len(); i++ {
+		fd := fds.Get(i)
+		if !m.Has(fd) {
+			continue
+		}
+		v := m.Get(fd)
+		path := prefix + string(fd.Name())
+		if opts, ok := fd.Options().(*descriptorpb.FieldOptions); ok && opts.GetDeprecated() {
+			fields = appendPath(fields, path)
+		}
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+					fields = deprecatedFields(v.Message(), path+".", fields)
+					return true
+				})
+			}
+		case fd.Message() == nil:
+		case fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len(); i++ {
+				fields = deprecatedFields(list.Get(i).Message(), path+".", fields)
+			}
+		default:
+			fields = deprecatedFields(v.Message(), path+".", fields)
+		}
+	}
+	return fields
+}
+
+func appendPath(fields []string, path string) []string {
+	for _, f := range fields {
+		if f == path {
+			return fields
+		}
+	}
+	return append(fields, path)
+}
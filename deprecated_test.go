@@ -0,0 +1,81 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestDeprecatedFields(t *testing.T) {
+	deprecated := &descriptorpb.FieldOptions{Deprecated: proto.Bool(true)}
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("deprecated.proto"),
+		Package: proto.String("deprecated"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Request"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("name"), JsonName: proto.String("name"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("old_name"), JsonName: proto.String("oldName"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Options: deprecated},
+				{Name: proto.String("items"), JsonName: proto.String("items"), Number: proto.Int32(3), Type: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(), TypeName: proto.String(".deprecated.Item")},
+			},
+		}, {
+			Name: proto.String("Item"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("count"), JsonName: proto.String("count"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Options: deprecated},
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logged []string
+	var caller string
+	config := DefaultConfig
+	config.LogDeprecatedFields = func(ctx context.Context, c string, fields []string) {
+		caller, logged = c, fields
+	}
+	handler := UPSDynamicWithConfig(func(req *dynamicpb.Message) *testingups.HelloResponse {
+		return &testingups.HelloResponse{}
+	}, fd.Messages().ByName("Request"), config)
+
+	for _, test := range []struct {
+		body     string
+		expected []string
+	}{
+		{`{"name":"World"}`, nil},
+		{`{"oldName":"World","items":[{"count":1},{"count":2}]}`, []string{"old_name", "items.count"}},
+	} {
+		logged = nil
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "192.0.2.1:1234"
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Errorf("unexpected status %d", resp.Code)
+		}
+		if !reflect.DeepEqual(logged, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.body, test.expected, logged)
+		}
+		if test.expected != nil && caller != "192.0.2.1:1234" {
+			t.Errorf("unexpected caller %s", caller)
+		}
+		if warnings := resp.Header().Values("Warning"); len(warnings) != len(test.expected) {
+			t.Errorf("%s: unexpected warnings %v", test.body, warnings)
+		} else if len(warnings) > 0 && warnings[0] != `299 - "Deprecated field: old_name"` {
+			t.Errorf("%s: unexpected warning %s", test.body, warnings[0])
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package ups
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Deprecation marks the handler of a Config as deprecated, adding the
+// Deprecation, Sunset, and Link headers to its responses and counting
+// the requests from each caller, to drive the migration of clients.
+type Deprecation struct {
+	// Date is the time the handler was deprecated.  If zero, the
+	// Deprecation header is "true".
+	Date time.Time
+
+	// Sunset, if not zero, is the time the handler will be removed.
+	Sunset time.Time
+
+	// Link, if not empty, is the URL of the documentation of the
+	// deprecation, such as a migration guide.
+	Link string
+
+	// Log, if not nil, is called for each request with the caller.
+	Log func(ctx context.Context, caller string)
+
+	mu      sync.Mutex
+	callers map[string]int64
+}
+
+func (d *Deprecation) setHeaders(header http.Header) {
+	if d.Date.IsZero() {
+		header.Set("Deprecation", "true")
+	} else {
+		header.Set("Deprecation", "@"+strconv.FormatInt(d.Date.Unix(), 10))
+	}
+	if !d.Sunset.IsZero() {
+		header.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if d.Link != "" {
+		header.Add("Link", "<"+d.Link+">; rel=\"deprecation\"")
+	}
+}
+
+// record counts the request of the caller.
+func (d *Deprecation) record(ctx context.Context, r *http.Request) {
+	caller := callerOf(ctx, r)
+	d.mu.Lock()
+	if d.callers == nil {
+		d.callers = map[string]int64{}
+	}
+	d.callers[caller]++
+	d.mu.Unlock()
+	if d.Log != nil {
+		d.Log(ctx, caller)
+	}
+}
+
+// Callers returns the number of requests from each caller.
+func (d *Deprecation) Callers() map[string]int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	callers := make(map[string]int64, len(d.callers))
+	for caller, n := range d.callers {
+		callers[caller] = n
+	}
+	return callers
+}
+
+// callerOf identifies the caller of a request by the subject of the
+// AuthenticatedPrincipal, or else by the client address.
+func callerOf(ctx context.Context, r *http.Request) string {
+	if principal, ok := AuthenticatedPrincipal(ctx); ok {
+		return principal.Subject
+	} else if addr, ok := ClientIP(ctx); ok {
+		return addr.String()
+	}
+	return r.RemoteAddr
+}
@@ -0,0 +1,62 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestDeprecation(t *testing.T) {
+	var logged []string
+	deprecation := &Deprecation{
+		Date:   time.Unix(1700000000, 0),
+		Sunset: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		Link:   "https://example.com/migrate",
+		Log: func(ctx context.Context, caller string) {
+			logged = append(logged, caller)
+		},
+	}
+	var summary *RequestSummary
+	config := DefaultConfig
+	config.Deprecation = deprecation
+	config.LogSummary = func(ctx context.Context, s *RequestSummary) {
+		summary = s
+	}
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+
+	for _, addr := range []string{"192.0.2.1:1234", "192.0.2.1:1234", "192.0.2.2:1234"} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = addr
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Errorf("unexpected status %d", resp.Code)
+		}
+		for key, expected := range map[string]string{
+			"Deprecation": "@1700000000",
+			"Sunset":      "Tue, 01 Jan 2030 00:00:00 GMT",
+			"Link":        `<https://example.com/migrate>; rel="deprecation"`,
+		} {
+			if val := resp.Header().Get(key); val != expected {
+				t.Errorf("%s: expected %s, got %s", key, expected, val)
+			}
+		}
+	}
+	if callers := deprecation.Callers(); len(callers) != 2 || callers["192.0.2.1:1234"] != 2 || callers["192.0.2.2:1234"] != 1 {
+		t.Errorf("unexpected callers: %v", callers)
+	}
+	if len(logged) != 3 {
+		t.Errorf("unexpected log: %v", logged)
+	}
+	if summary == nil || !summary.Deprecated {
+		t.Errorf("expected deprecated summary")
+	}
+}
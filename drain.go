@@ -0,0 +1,138 @@
+package ups
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Drainer coordinates draining for deploys without dropped requests.
+// When draining starts, the HealthHandler starts failing so that load
+// balancers stop routing new requests, then after the grace period, new
+// requests to handlers wrapped by Handler get 503 responses, and draining
+// completes when the in-flight requests complete, or after the maximum
+// wait.
+//
+// Draining is started by Drain, by a request to the DrainHandler, or by
+// Server.Shutdown if the Drainer is the Drainer of the Server.
+type Drainer struct {
+	gracePeriod time.Duration
+	maxWait     time.Duration
+
+	once     sync.Once
+	draining chan struct{}
+	drained  chan struct{}
+
+	mu        sync.Mutex
+	rejecting bool
+	inFlight  sync.WaitGroup
+}
+
+// NewDrainer creates a Drainer that rejects new requests gracePeriod
+// after draining starts and waits at most maxWait for in-flight requests
+// after that, or without limit if maxWait is zero.
+func NewDrainer(gracePeriod, maxWait time.Duration) *Drainer {
+	return &Drainer{
+		gracePeriod: gracePeriod,
+		maxWait:     maxWait,
+		draining:    make(chan struct{}),
+		drained:     make(chan struct{}),
+	}
+}
+
+// Draining reports whether draining has started.
+func (d *Drainer) Draining() bool {
+	select {
+	case <-d.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// Drain starts draining, if it has not already started, and waits until
+// draining completes or the context is done.
+func (d *Drainer) Drain(ctx context.Context) error {
+	d.once.Do(func() {
+		close(d.draining)
+		go d.drain()
+	})
+	select {
+	case <-d.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (d *Drainer) drain() {
+	defer close(d.drained)
+	time.Sleep(d.gracePeriod)
+
+	d.mu.Lock()
+	d.rejecting = true
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.inFlight.Wait()
+		close(done)
+	}()
+	var timeout <-chan time.Time
+	if d.maxWait > 0 {
+		timer := time.NewTimer(d.maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-done:
+	case <-timeout:
+	}
+}
+
+// Handler tracks the in-flight requests of the handler, and responds to
+// requests with 503 once the grace period after draining starts has
+// passed.
+func (d *Drainer) Handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		if d.rejecting {
+			d.mu.Unlock()
+			w.Header().Set("Connection", "close")
+			http.Error(w, "", http.StatusServiceUnavailable)
+			return
+		}
+		d.inFlight.Add(1)
+		d.mu.Unlock()
+		defer d.inFlight.Done()
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// HealthHandler responds with 200 until draining starts, and with 503
+// after.
+func (d *Drainer) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d.Draining() {
+			http.Error(w, "draining", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// DrainHandler starts draining on POST requests, responding with 202
+// without waiting for draining to complete.  It should be registered only
+// on an admin endpoint.
+func (d *Drainer) DrainHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		go d.Drain(context.Background())
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
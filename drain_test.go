@@ -0,0 +1,87 @@
+package ups
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDrainer(t *testing.T) {
+	drainer := NewDrainer(20*time.Millisecond, time.Second)
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	handler := drainer.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+	}))
+	health := drainer.HealthHandler()
+
+	status := func(h http.Handler, method string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "/", nil))
+		return w.Code
+	}
+
+	if code := status(health, http.MethodGet); code != http.StatusOK {
+		t.Errorf("health: expected: %d, got: %d", http.StatusOK, code)
+	}
+
+	inFlight := make(chan int)
+	go func() {
+		inFlight <- status(handler, http.MethodPost)
+	}()
+	<-started
+
+	if code := status(drainer.DrainHandler(), http.MethodGet); code != http.StatusMethodNotAllowed {
+		t.Errorf("drain: expected: %d, got: %d", http.StatusMethodNotAllowed, code)
+	}
+	if code := status(drainer.DrainHandler(), http.MethodPost); code != http.StatusAccepted {
+		t.Errorf("drain: expected: %d, got: %d", http.StatusAccepted, code)
+	}
+	for !drainer.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+	if code := status(health, http.MethodGet); code != http.StatusServiceUnavailable {
+		t.Errorf("health: expected: %d, got: %d", http.StatusServiceUnavailable, code)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+	if code := status(handler, http.MethodPost); code != http.StatusServiceUnavailable {
+		t.Errorf("after grace period: expected: %d, got: %d", http.StatusServiceUnavailable, code)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := drainer.Drain(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded with request in flight, got: %v", err)
+	}
+
+	close(finish)
+	if code := <-inFlight; code != http.StatusOK {
+		t.Errorf("in flight: expected: %d, got: %d", http.StatusOK, code)
+	}
+	if err := drainer.Drain(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDrainerMaxWait(t *testing.T) {
+	drainer := NewDrainer(0, 10*time.Millisecond)
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	defer close(finish)
+	handler := drainer.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+	}))
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := drainer.Drain(ctx); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package ups
+
+import (
+	"net/http"
+	"reflect"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var dynamicMessageType = reflect.TypeOf((*dynamicpb.Message)(nil))
+
+// UPSDynamic takes a func and a message descriptor and creates an
+// http.Handler using the DefaultConfig.
+//
+// The func must be as for UPS, except that its proto.Message argument
+// must be a *dynamicpb.Message, which will be unmarshalled from the
+// request body as a message described by the descriptor.  This allows
+// handlers for messages that are only known at runtime.
+//
+// UPSDynamic will panic if the argument is not a valid func.
+func UPSDynamic(handler interface{}, desc protoreflect.MessageDescriptor) http.Handler {
+	return UPSDynamicWithConfig(handler, desc, DefaultConfig)
+}
+
+// UPSDynamicWithConfig takes a func and a message descriptor and creates
+// an http.Handler using the provided Config.
+//
+// The func must be as for UPS, except that its proto.Message argument
+// must be a *dynamicpb.Message, which will be unmarshalled from the
+// request body as a message described by the descriptor.
+//
+// UPSDynamicWithConfig will panic if the argument is not a valid func.
+func UPSDynamicWithConfig(handler interface{}, desc protoreflect.MessageDescriptor, config Config) http.Handler {
+	ty := reflect.TypeOf(handler)
+	if ty == nil || ty.Kind() != reflect.Func || ty.NumIn() == 0 || ty.In(ty.NumIn()-1) != dynamicMessageType {
+		panic("ups: invalid handler dynamic message parameter type")
+	}
+
+	ups := UPSWithParameterAndConfig(handler, nil, config).(*upsHandler)
+	ups.requestDescriptor = desc
+	msgType := dynamicpb.NewMessageType(desc)
+	ups.requestObjectPool.New = func() interface{} {
+		return reflect.ValueOf(msgType.New().Interface())
+	}
+	return ups
+}
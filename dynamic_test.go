@@ -0,0 +1,38 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestDynamic(t *testing.T) {
+	desc := proto.MessageReflect(&testingups.HelloRequest{}).Descriptor()
+	name := desc.Fields().ByName("name")
+
+	handler := UPSDynamic(func(ctx context.Context, req *dynamicpb.Message) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Dynamic, " + req.Get(name).String() + "!"}
+	}, desc)
+
+	for _, body := range []string{`{"name":"World"}`, `{"name":"Again"}`} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Errorf("response code: expected: %d, got: %d", http.StatusOK, resp.Code)
+		}
+		respBody := resp.Body.String()
+		respBodyExpected := `{"text":"Dynamic, ` + body[9:14] + `!"}`
+		if respBody != respBodyExpected {
+			t.Errorf("response body, expected: %s, got: %s", respBodyExpected, respBody)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package ups
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// EnumOptions relaxes the JSON handling of enums, for clients that are
+// older than their enums, such as after enum values are renamed.
+type EnumOptions struct {
+	// CaseInsensitive, if true, matches the names of enum values in
+	// JSON requests case-insensitively.
+	CaseInsensitive bool
+
+	// UnknownAsDefault, if true, unmarshals unknown names of enum
+	// values in JSON requests as 0.  Otherwise, requests with unknown
+	// names are rejected.
+	UnknownAsDefault bool
+
+	// AsInts, if true, marshals enums in JSON responses as numbers
+	// instead of names.
+	AsInts bool
+}
+
+// rewrite returns the JSON request with the names of enum values
+// replaced by their canonical names, or by 0.
+func (opts *EnumOptions) rewrite(req []byte, md protoreflect.MessageDescriptor) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(req))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	if !opts.rewriteMessage(v, md) {
+		return req, nil
+	}
+	return json.Marshal(v)
+}
+
+// rewriteMessage rewrites the enum values of the JSON object of a
+// message, reporting whether any were rewritten.
+func (opts *EnumOptions) rewriteMessage(v interface{}, md protoreflect.MessageDescriptor) bool {
+	obj, ok := v.(map[string]interface{})
+	if !ok || md.ParentFile().Package() == "google.protobuf" {
+		return false
+	}
+	changed := false
+	for key, val := range obj {
+		fd := md.Fields().ByJSONName(key)
+		if fd == nil {
+			fd = md.Fields().ByName(protoreflect.Name(key))
+		}
+		if fd == nil {
+			continue
+		}
+		if fd.IsMap() {
+			fd = fd.MapValue()
+			if m, ok := val.(map[string]interface{}); ok {
+				for k, elt := range m {
+					if rewritten, ok := opts.rewriteValue(elt, fd); ok {
+						m[k] = rewritten
+						changed = true
+					}
+				}
+			}
+		} else if list, ok := val.([]interface{}); ok && fd.IsList() {
+			for i, elt := range list {
+				if rewritten, ok := opts.rewriteValue(elt, fd); ok {
+					list[i] = rewritten
+					changed = true
+				}
+			}
+		} else if rewritten, ok := opts.rewriteValue(val, fd); ok {
+			obj[key] = rewritten
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (opts *EnumOptions) rewriteValue(v interface{}, fd protoreflect.FieldDescriptor) (interface{}, bool) {
+	switch {
+	case fd.Message() != nil:
+		return v, opts.rewriteMessage(v, fd.Message())
+	case fd.Enum() == nil:
+		return v, false
+	}
+	name, ok := v.(string)
+	if !ok || fd.Enum().FullName() == "google.protobuf.NullValue" {
+		return v, false
+	}
+	values := fd.Enum().Values()
+	if values.ByName(protoreflect.Name(name)) != nil {
+		return v, false
+	}
+	if opts.CaseInsensitive {
+		for i := 0; i < values.Len(); i++ {
+			if strings.EqualFold(string(values.Get(i).Name()), name) {
+				return string(values.Get(i).Name()), true
+			}
+		}
+	}
+	if opts.UnknownAsDefault {
+		return 0, true
+	}
+	return v, false
+}
@@ -0,0 +1,70 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestEnumOptions(t *testing.T) {
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("enum.proto"),
+		Package: proto.String("enum"),
+		Syntax:  proto.String("proto3"),
+		EnumType: []*descriptorpb.EnumDescriptorProto{{
+			Name: proto.String("Color"),
+			Value: []*descriptorpb.EnumValueDescriptorProto{
+				{Name: proto.String("COLOR_UNSPECIFIED"), Number: proto.Int32(0)},
+				{Name: proto.String("RED"), Number: proto.Int32(1)},
+				{Name: proto.String("BLUE"), Number: proto.Int32(2)},
+			},
+		}},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Paint"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("color"), JsonName: proto.String("color"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum(), TypeName: proto.String(".enum.Color"), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("colors"), JsonName: proto.String("colors"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_ENUM.Enum(), TypeName: proto.String(".enum.Color"), Label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()},
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := func(req *dynamicpb.Message) *dynamicpb.Message {
+		return req
+	}
+
+	for _, test := range []struct {
+		enums      *EnumOptions
+		body       string
+		statusCode int
+		expected   string
+	}{
+		{nil, `{"color":"RED","colors":[2]}`, http.StatusOK, `{"color":"RED","colors":["BLUE"]}`},
+		{nil, `{"color":"red"}`, http.StatusInternalServerError, "\n"},
+		{&EnumOptions{CaseInsensitive: true}, `{"color":"red","colors":["Blue"]}`, http.StatusOK, `{"color":"RED","colors":["BLUE"]}`},
+		{&EnumOptions{CaseInsensitive: true}, `{"color":"GREEN"}`, http.StatusInternalServerError, "\n"},
+		{&EnumOptions{UnknownAsDefault: true}, `{"color":"GREEN","colors":["RED","PURPLE"]}`, http.StatusOK, `{"colors":["RED","COLOR_UNSPECIFIED"]}`},
+		{&EnumOptions{AsInts: true}, `{"color":"BLUE"}`, http.StatusOK, `{"color":2}`},
+	} {
+		config := DefaultConfig
+		config.Enums = test.enums
+		handler := UPSDynamicWithConfig(echo, fd.Messages().ByName("Paint"), config)
+		req := httptest.NewRequest(http.MethodPost, "/paint", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != test.statusCode || resp.Body.String() != test.expected {
+			t.Errorf("%v %s: unexpected response %d %s", test.enums, test.body, resp.Code, resp.Body.String())
+		}
+	}
+	if DefaultConfig.JSONMarshaler.EnumsAsInts {
+		t.Errorf("DefaultConfig was modified")
+	}
+}
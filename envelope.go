@@ -0,0 +1,57 @@
+package ups
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Envelope wraps JSON responses in objects of the form
+// {"status":200,"error":null,"data":{...}}, for clients that require
+// envelopes.  The data is the response message, and the error is the
+// error body, which is the JSON of the Config.ErrorMessage, if any, or
+// else a string.  Responses that are not JSON, such as protobuf
+// responses, are not wrapped.
+type Envelope struct {
+	// StatusKey, ErrorKey, and DataKey are the keys of the members of
+	// the envelope.  If empty, they are "status", "error", and "data".
+	StatusKey string
+	ErrorKey  string
+	DataKey   string
+
+	// AlwaysOK, if true, makes the HTTP status of all wrapped responses
+	// 200, with the status of the response only in the envelope.
+	AlwaysOK bool
+}
+
+// wrap returns the envelope with the raw JSON error and data, either of
+// which may be nil.
+func (e *Envelope) wrap(statusCode int, errorValue, data []byte) []byte {
+	key := func(k, def string) []byte {
+		if k == "" {
+			k = def
+		}
+		b, _ := json.Marshal(k)
+		return b
+	}
+	value := func(v []byte) []byte {
+		if v == nil {
+			return []byte("null")
+		}
+		return v
+	}
+	b := make([]byte, 0, len(errorValue)+len(data)+48)
+	b = append(b, '{')
+	b = append(b, key(e.StatusKey, "status")...)
+	b = append(b, ':')
+	b = strconv.AppendInt(b, int64(statusCode), 10)
+	b = append(b, ',')
+	b = append(b, key(e.ErrorKey, "error")...)
+	b = append(b, ':')
+	b = append(b, value(errorValue)...)
+	b = append(b, ',')
+	b = append(b, key(e.DataKey, "data")...)
+	b = append(b, ':')
+	b = append(b, value(data)...)
+	b = append(b, '}')
+	return b
+}
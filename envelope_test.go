@@ -0,0 +1,57 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestEnvelope(t *testing.T) {
+	hello := func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if req.Name == "" {
+			return nil, testError(http.StatusNotFound)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+	}
+	for _, test := range []struct {
+		envelope   Envelope
+		body       string
+		statusCode int
+		expected   string
+	}{
+		{Envelope{}, `{"name":"World"}`, http.StatusOK, `{"status":200,"error":null,"data":{"text":"Hello, World!"}}`},
+		{Envelope{}, `{}`, http.StatusNotFound, `{"status":404,"error":"Not Found","data":null}`},
+		{Envelope{StatusKey: "code", ErrorKey: "message", DataKey: "result", AlwaysOK: true}, `{}`, http.StatusOK, `{"code":404,"message":"Not Found","result":null}`},
+	} {
+		config := DefaultConfig
+		config.Envelope = &test.envelope
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		UPSWithConfig(hello, config).ServeHTTP(resp, req)
+		if resp.Code != test.statusCode || resp.Body.String() != test.expected {
+			t.Errorf("%s: unexpected response %d %s", test.body, resp.Code, resp.Body.String())
+		}
+		if contentType := resp.Header().Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("%s: unexpected Content-Type %s", test.body, contentType)
+		}
+	}
+
+	// Protobuf responses are not wrapped.
+	config := DefaultConfig
+	config.Envelope = &Envelope{}
+	body, _ := proto.Marshal(&testingups.HelloRequest{Name: "World"})
+	req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp := httptest.NewRecorder()
+	UPSWithConfig(hello, config).ServeHTTP(resp, req)
+	var msg testingups.HelloResponse
+	if err := proto.Unmarshal(resp.Body.Bytes(), &msg); err != nil || msg.Text != "Hello, World!" {
+		t.Errorf("unexpected protobuf response %v %v", &msg, err)
+	}
+}
@@ -0,0 +1,180 @@
+package ups
+
+import (
+	"context"
+	"crypto/sha256"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errorBudgetBuckets is the number of buckets of the rolling window.
+const errorBudgetBuckets = 10
+
+// ErrorBudget tracks the rate of 5xx responses of each route over a
+// rolling window.  When the error rate of a route exceeds the budget,
+// the route is degraded until the rate falls within the budget.
+// Handlers of degraded routes can shed optional work, using Degraded,
+// and failed requests of degraded routes can get the last successful
+// response to the same request.  An ErrorBudget may be shared by the
+// Configs of multiple handlers.
+type ErrorBudget struct {
+	// Budget is the fraction of requests, such as 0.05, that may fail.
+	Budget float64
+
+	// Window is the duration over which the error rate is computed.
+	// If zero, it is one minute.
+	Window time.Duration
+
+	// MinRequests is the number of requests in the window before a
+	// route can be degraded.
+	MinRequests int
+
+	// Fallback, if not zero, is the number of successful responses of
+	// each route that are retained for failed requests of degraded
+	// routes.  The retained responses are keyed by the request body,
+	// Content-Type and Accept, and by the authenticated principal and
+	// tenant, so they are only served to the same caller.
+	Fallback int
+
+	mu     sync.Mutex
+	routes map[string]*errorBudgetRoute
+}
+
+type errorBudgetKey [sha256.Size]byte
+
+type errorBudgetRoute struct {
+	buckets  [errorBudgetBuckets]errorBudgetBucket
+	fallback map[errorBudgetKey]*errorBudgetResponse
+}
+
+type errorBudgetBucket struct {
+	start    time.Time
+	requests int
+	errors   int
+}
+
+type errorBudgetResponse struct {
+	contentType string
+	body        []byte
+}
+
+// NewErrorBudget creates an ErrorBudget that degrades routes when more
+// than the fraction of at least 100 requests in a minute fail.
+func NewErrorBudget(budget float64) *ErrorBudget {
+	return &ErrorBudget{
+		Budget:      budget,
+		MinRequests: 100,
+	}
+}
+
+// Degraded returns true if the route of the request of the context has
+// exceeded its ErrorBudget.
+func Degraded(ctx context.Context) bool {
+	degraded, _ := Value(ctx, degradedContextKey)
+	return degraded
+}
+
+func (b *ErrorBudget) window() time.Duration {
+	if b.Window == 0 {
+		return time.Minute
+	}
+	return b.Window
+}
+
+// route returns the state of the route.  b.mu must be held.
+func (b *ErrorBudget) route(name string) *errorBudgetRoute {
+	if b.routes == nil {
+		b.routes = map[string]*errorBudgetRoute{}
+	}
+	route, ok := b.routes[name]
+	if !ok {
+		route = &errorBudgetRoute{}
+		b.routes[name] = route
+	}
+	return route
+}
+
+// degraded returns true if the error rate of the route exceeds the
+// budget.
+func (b *ErrorBudget) degraded(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	route, ok := b.routes[name]
+	if !ok {
+		return false
+	}
+	since := time.Now().Add(-b.window())
+	requests, errors := 0, 0
+	for _, bucket := range route.buckets {
+		if bucket.start.After(since) {
+			requests += bucket.requests
+			errors += bucket.errors
+		}
+	}
+	return requests > 0 && requests >= b.MinRequests && float64(errors) > b.Budget*float64(requests)
+}
+
+// key returns the key of the retained responses of the request, which
+// includes the principal and the tenant of the request, so that
+// responses are not served to other callers, and the Accept header.
+func (b *ErrorBudget) key(ctx context.Context, r *http.Request, body []byte) errorBudgetKey {
+	var subject, tenant string
+	if principal, ok := AuthenticatedPrincipal(ctx); ok {
+		subject = principal.Subject
+	}
+	if t, ok := TenantFromContext(ctx); ok {
+		tenant = t.ID
+	}
+	h := sha256.New()
+	for _, s := range []string{subject, tenant, r.Header.Get("Content-Type"), r.Header.Get("Accept")} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	var key errorBudgetKey
+	h.Sum(key[:0])
+	return key
+}
+
+// record counts a response of the route, retaining it if it succeeded.
+func (b *ErrorBudget) record(name string, statusCode int, key *errorBudgetKey, contentType string, body []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	route := b.route(name)
+	now := time.Now()
+	width := b.window() / errorBudgetBuckets
+	bucket := &route.buckets[now.UnixNano()/int64(width)%errorBudgetBuckets]
+	if now.Sub(bucket.start) >= width {
+		*bucket = errorBudgetBucket{start: now.Truncate(width)}
+	}
+	bucket.requests++
+	if statusCode >= 500 {
+		bucket.errors++
+	}
+	if key == nil || b.Fallback <= 0 || statusCode != http.StatusOK {
+		return
+	}
+	if route.fallback == nil {
+		route.fallback = map[errorBudgetKey]*errorBudgetResponse{}
+	}
+	if _, ok := route.fallback[*key]; !ok && len(route.fallback) >= b.Fallback {
+		for k := range route.fallback {
+			delete(route.fallback, k)
+			break
+		}
+	}
+	route.fallback[*key] = &errorBudgetResponse{contentType: contentType, body: body}
+}
+
+// fallback returns the retained response of the request, if any.
+func (b *ErrorBudget) fallback(name string, key errorBudgetKey) (*errorBudgetResponse, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	route, ok := b.routes[name]
+	if !ok {
+		return nil, false
+	}
+	resp, ok := route.fallback[key]
+	return resp, ok
+}
@@ -0,0 +1,92 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestErrorBudget(t *testing.T) {
+	failing := false
+	var degraded []bool
+	config := DefaultConfig
+	config.LogError = nil
+	config.ErrorBudget = &ErrorBudget{Budget: 0.5, MinRequests: 4, Fallback: 10}
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		degraded = append(degraded, Degraded(ctx))
+		if failing {
+			return nil, testError(http.StatusServiceUnavailable)
+		}
+		return &testingups.HelloResponse{Text: "Hello " + req.Name}, nil
+	}, config)
+	serve := func(name string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		r.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, r)
+		return resp
+	}
+
+	serve("World")
+	failing = true
+	for _, name := range []string{"a", "b", "c"} {
+		if resp := serve(name); resp.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: unexpected status: %d", name, resp.Code)
+		}
+	}
+	resp := serve("World")
+	if resp.Code != http.StatusOK || resp.Body.String() != `{"text":"Hello World"}` || resp.Header().Get("Warning") == "" {
+		t.Errorf("unexpected fallback response: %d %s %v", resp.Code, resp.Body.String(), resp.Header())
+	}
+	if resp := serve("d"); resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status: %d", resp.Code)
+	}
+	expected := []bool{false, false, false, false, true, true}
+	if len(degraded) != len(expected) {
+		t.Fatalf("unexpected degraded: %v", degraded)
+	}
+	for i := range expected {
+		if degraded[i] != expected[i] {
+			t.Errorf("unexpected degraded: %v", degraded)
+			break
+		}
+	}
+}
+
+func TestErrorBudgetFallbackPrincipal(t *testing.T) {
+	failing := false
+	config := DefaultConfig
+	config.LogError = nil
+	config.ErrorBudget = &ErrorBudget{Budget: 0.5, MinRequests: 4, Fallback: 10}
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if failing {
+			return nil, testError(http.StatusServiceUnavailable)
+		}
+		principal, _ := AuthenticatedPrincipal(ctx)
+		return &testingups.HelloResponse{Text: "Hello " + principal.Subject}, nil
+	}, config)
+	serve := func(subject, name string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		r.Header.Set("Content-Type", "application/json")
+		r = r.WithContext(WithValue(r.Context(), PrincipalKey, &Principal{Subject: subject}))
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, r)
+		return resp
+	}
+
+	serve("alice", "World")
+	failing = true
+	for _, name := range []string{"a", "b", "c"} {
+		serve("alice", name)
+	}
+	if resp := serve("bob", "World"); resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected response for other principal: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := serve("alice", "World"); resp.Code != http.StatusOK || resp.Body.String() != `{"text":"Hello alice"}` {
+		t.Errorf("unexpected fallback response: %d %s", resp.Code, resp.Body.String())
+	}
+}
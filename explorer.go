@@ -0,0 +1,127 @@
+package ups
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// explorerRoute is a route of the explorer page.
+type explorerRoute struct {
+	Path     string `json:"path"`
+	Request  string `json:"request"`
+	Response string `json:"response"`
+	Example  string `json:"example"`
+}
+
+// ExplorerHandler creates an http.Handler that serves an HTML page for
+// crafting JSON requests to the routes and sending them from a browser,
+// for development.  Each route starts with a request with all of its
+// fields.
+//
+// The routes map paths to handlers.  Handlers that were not created by
+// this package are ignored.
+func ExplorerHandler(routes map[string]http.Handler) http.Handler {
+	var explorerRoutes []explorerRoute
+	paths := make([]string, 0, len(routes))
+	for path := range routes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		ups, ok := routes[path].(*upsHandler)
+		if !ok {
+			continue
+		}
+		route := explorerRoute{Path: path, Example: "{}"}
+		if ups.requestDescriptor != nil {
+			route.Request = string(ups.requestDescriptor.FullName())
+			// protojson output is deliberately unstable, so it is
+			// reformatted.
+			b, err := protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}.Marshal(dynamicpb.NewMessage(ups.requestDescriptor))
+			var buf bytes.Buffer
+			if err == nil && json.Indent(&buf, b, "", "  ") == nil {
+				route.Example = buf.String()
+			}
+		}
+		if ups.responseDescriptor != nil {
+			route.Response = string(ups.responseDescriptor.FullName())
+		}
+		explorerRoutes = append(explorerRoutes, route)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := explorerTemplate.Execute(w, explorerRoutes); err != nil {
+			http.Error(w, "", http.StatusInternalServerError)
+		}
+	})
+}
+
+var explorerTemplate = template.Must(template.New("explorer").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ups explorer</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+textarea, pre { font-family: monospace; width: 100%; box-sizing: border-box; }
+textarea { height: 16em; }
+pre { background: #f4f4f4; padding: 1em; min-height: 4em; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>ups explorer</h1>
+<p><select id="route">{{range .}}<option value="{{.Path}}">{{.Path}}</option>{{end}}</select>
+<span id="types"></span></p>
+<p><textarea id="request" spellcheck="false"></textarea></p>
+<p><button id="send">Send</button></p>
+<pre id="status"></pre>
+<pre id="response"></pre>
+<script>
+const routes = {{.}};
+const route = document.getElementById("route");
+const request = document.getElementById("request");
+function select() {
+  const r = routes[route.selectedIndex];
+  document.getElementById("types").textContent = r.request + " → " + r.response;
+  request.value = r.example;
+}
+route.addEventListener("change", select);
+document.getElementById("send").addEventListener("click", async () => {
+  const status = document.getElementById("status");
+  const response = document.getElementById("response");
+  status.textContent = "";
+  response.textContent = "";
+  try {
+    const resp = await fetch(route.value, {
+      method: "POST",
+      headers: {"Content-Type": "application/json", "Accept": "application/json"},
+      body: request.value,
+    });
+    status.textContent = resp.status + " " + resp.statusText;
+    const text = await resp.text();
+    try {
+      response.textContent = JSON.stringify(JSON.parse(text), null, 2);
+    } catch (e) {
+      response.textContent = text;
+    }
+  } catch (e) {
+    status.textContent = String(e);
+  }
+});
+if (routes && routes.length > 0) {
+  select();
+}
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,38 @@
+package ups
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestExplorer(t *testing.T) {
+	handler := ExplorerHandler(map[string]http.Handler{
+		"/hello": UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+			return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+		}),
+		"/other": http.NotFoundHandler(),
+	})
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/explorer", nil))
+	if resp.Code != http.StatusOK || resp.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Fatalf("unexpected response: %d %s", resp.Code, resp.Header().Get("Content-Type"))
+	}
+	body := resp.Body.String()
+	if !strings.Contains(body, `<option value="/hello">/hello</option>`) || strings.Contains(body, "/other") {
+		t.Errorf("unexpected routes: %s", body)
+	}
+	if !strings.Contains(body, `"request":"HelloRequest"`) || !strings.Contains(body, `{\n  \"name\": \"\"\n}`) {
+		t.Errorf("unexpected route data: %s", body)
+	}
+
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/explorer", nil))
+	if resp.Code != http.StatusMethodNotAllowed {
+		t.Errorf("unexpected status: %d", resp.Code)
+	}
+}
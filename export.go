@@ -0,0 +1,291 @@
+package ups
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The Content-Types of exported responses.
+const (
+	csvContentType  = "text/csv"
+	xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+var errNoExportField = errors.New("ups: response has no repeated message field to export")
+
+// Exporter exports responses with a repeated message field as CSV or as
+// Excel spreadsheets for requests that Accept text/csv or
+// application/vnd.openxmlformats-officedocument.spreadsheetml.sheet, for
+// reporting.  The elements of the field are the rows, and the columns
+// are their fields, named by their paths, such as "address.city", with
+// nested messages flattened.  Repeated scalar fields are joined with
+// semicolons, and repeated message and map fields are omitted.  CSV
+// text values that spreadsheets would take as formulas, starting with
+// =, +, -, @, tab or carriage return, are prefixed with '.
+//
+// Responses without the field get 406 responses.
+type Exporter struct {
+	// Field is the name of the repeated message field of the responses.
+	// If empty, it is the only repeated message field.
+	Field string
+}
+
+// contentType returns the export Content-Type the Accept header prefers,
+// or "" if it accepts neither.
+func (e *Exporter) contentType(accept string) string {
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		switch mediaType {
+		case csvContentType, xlsxContentType:
+			return mediaType
+		}
+	}
+	return ""
+}
+
+// export returns the rows of the response in the Content-Type.
+func (e *Exporter) export(msg proto.Message, contentType string) ([]byte, error) {
+	m := proto.MessageReflect(msg)
+	field, err := e.field(m.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	var columns []exportColumn
+	exportColumns(field.Message(), nil, "", map[protoreflect.FullName]bool{}, &columns)
+	list := m.Get(field).List()
+	rows := make([][]string, 0, list.Len()+1)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	rows = append(rows, header)
+	for i := 0; i < list.Len(); i++ {
+		row := make([]string, len(columns))
+		for j, column := range columns {
+			row[j] = column.value(list.Get(i).Message())
+		}
+		rows = append(rows, row)
+	}
+	if contentType == xlsxContentType {
+		return xlsx(rows, columns)
+	}
+	for _, row := range rows[1:] {
+		for j, value := range row {
+			if !columns[j].numeric() {
+				row[j] = csvText(value)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.WriteAll(rows)
+	return buf.Bytes(), w.Error()
+}
+
+func (e *Exporter) field(md protoreflect.MessageDescriptor) (protoreflect.FieldDescriptor, error) {
+	if e.Field != "" {
+		fd := md.Fields().ByName(protoreflect.Name(e.Field))
+		if fd == nil || !fd.IsList() || fd.Message() == nil {
+			return nil, errNoExportField
+		}
+		return fd, nil
+	}
+	var field protoreflect.FieldDescriptor
+	for i := 0; i < md.Fields().Len(); i++ {
+		if fd := md.Fields().Get(i); fd.IsList() && fd.Message() != nil {
+			if field != nil {
+				return nil, errNoExportField
+			}
+			field = fd
+		}
+	}
+	if field == nil {
+		return nil, errNoExportField
+	}
+	return field, nil
+}
+
+// exportColumn is a column of an export, with the path of fields from
+// the row.
+type exportColumn struct {
+	name string
+	path []protoreflect.FieldDescriptor
+}
+
+// exportColumns appends the columns of the fields of the message,
+// flattening nested messages other than well-known types, and skipping
+// recursive messages.
+func exportColumns(md protoreflect.MessageDescriptor, path []protoreflect.FieldDescriptor, prefix string, seen map[protoreflect.FullName]bool, columns *[]exportColumn) {
+	seen[md.FullName()] = true
+	defer delete(seen, md.FullName())
+	for i := 0; i < md.Fields().Len(); i++ {
+		fd := md.Fields().Get(i)
+		fieldPath := append(path[:len(path):len(path)], fd)
+		name := prefix + string(fd.Name())
+		switch {
+		case fd.IsMap() || (fd.IsList() && fd.Message() != nil):
+		case fd.Message() != nil && fd.Message().ParentFile().Package() != "google.protobuf":
+			if !seen[fd.Message().FullName()] {
+				exportColumns(fd.Message(), fieldPath, name+".", seen, columns)
+			}
+		default:
+			*columns = append(*columns, exportColumn{name: name, path: fieldPath})
+		}
+	}
+}
+
+// value returns the value of the column of the row.
+func (c exportColumn) value(m protoreflect.Message) string {
+	for _, fd := range c.path[:len(c.path)-1] {
+		if !m.Has(fd) {
+			return ""
+		}
+		m = m.Get(fd).Message()
+	}
+	fd := c.path[len(c.path)-1]
+	if fd.IsList() {
+		list := m.Get(fd).List()
+		values := make([]string, list.Len())
+		for i := range values {
+			values[i] = exportValue(fd, list.Get(i))
+		}
+		return strings.Join(values, ";")
+	}
+	if fd.Message() != nil && !m.Has(fd) {
+		return ""
+	}
+	return exportValue(fd, m.Get(fd))
+}
+
+func exportValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return v.String()
+	case protoreflect.BytesKind:
+		return base64.StdEncoding.EncodeToString(v.Bytes())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return strconv.Itoa(int(v.Enum()))
+	case protoreflect.FloatKind:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 32)
+	case protoreflect.DoubleKind:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		// Well-known types are in their JSON format, such as RFC 3339
+		// for timestamps.
+		b, err := protojson.Marshal(v.Message().Interface())
+		if err != nil {
+			return ""
+		}
+		var s string
+		if json.Unmarshal(b, &s) == nil {
+			return s
+		}
+		return string(b)
+	}
+	return v.String()
+}
+
+// csvText returns the text value with a ' prefix if spreadsheets would
+// otherwise interpret it as a formula.  The xlsx inlineStr cells are
+// never formulas.
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// xlsx returns a minimal Excel workbook with a sheet of the rows, with
+// numeric columns as numbers.
+func xlsx(rows [][]string, columns []exportColumn) ([]byte, error) {
+	var sheet bytes.Buffer
+	sheet.WriteString(xml.Header)
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range rows {
+		sheet.WriteString(`<row r="` + strconv.Itoa(i+1) + `">`)
+		for j, value := range row {
+			ref := xlsxColumn(j) + strconv.Itoa(i+1)
+			if f, err := strconv.ParseFloat(value, 64); i > 0 && err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) && columns[j].numeric() {
+				sheet.WriteString(`<c r="` + ref + `"><v>` + value + `</v></c>`)
+				continue
+			}
+			sheet.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+			xml.EscapeText(&sheet, []byte(value))
+			sheet.WriteString(`</t></is></c>`)
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	for _, file := range []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+		{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+	} {
+		f, err := z.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write([]byte(file.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := z.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// xlsxColumn returns the letters of the 0-based column, such as "AA".
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// numeric reports whether the column is a single number.  64-bit
+// integers are strings, as spreadsheets lose their precision.
+func (c exportColumn) numeric() bool {
+	fd := c.path[len(c.path)-1]
+	if fd.IsList() {
+		return false
+	}
+	switch fd.Kind() {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.FloatKind, protoreflect.DoubleKind:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package ups
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestExporter(t *testing.T) {
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("export.proto"),
+		Package: proto.String("export"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Report"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("title"), JsonName: proto.String("title"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: optional},
+				{Name: proto.String("rows"), JsonName: proto.String("rows"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(), TypeName: proto.String(".export.Row"), Label: repeated},
+			},
+		}, {
+			Name: proto.String("Row"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("name"), JsonName: proto.String("name"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: optional},
+				{Name: proto.String("count"), JsonName: proto.String("count"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(), Label: optional},
+				{Name: proto.String("tags"), JsonName: proto.String("tags"), Number: proto.Int32(3), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: repeated},
+				{Name: proto.String("parent"), JsonName: proto.String("parent"), Number: proto.Int32(4), Type: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(), TypeName: proto.String(".export.Parent"), Label: optional},
+			},
+		}, {
+			Name: proto.String("Parent"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("name"), JsonName: proto.String("name"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: optional},
+				{Name: proto.String("child"), JsonName: proto.String("child"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(), TypeName: proto.String(".export.Row"), Label: optional},
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := func(req *dynamicpb.Message) *dynamicpb.Message {
+		return req
+	}
+	config := DefaultConfig
+	config.Export = &Exporter{}
+	handler := UPSDynamicWithConfig(echo, fd.Messages().ByName("Report"), config)
+	body := `{"title":"report","rows":[{"name":"a, b","count":2,"tags":["x","y"],"parent":{"name":"p"}},{"name":"c'd"}]}`
+
+	for _, test := range []struct {
+		accept      string
+		statusCode  int
+		contentType string
+		expected    string
+	}{
+		{"", http.StatusOK, "application/json", body},
+		{"text/csv", http.StatusOK, "text/csv", "name,count,tags,parent.name\n\"a, b\",2,x;y,p\nc'd,0,,\n"},
+		{"text/csv;q=0, application/json", http.StatusOK, "application/json", body},
+		{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", `<row r="2"><c r="A2" t="inlineStr"><is><t xml:space="preserve">a, b</t></is></c><c r="B2"><v>2</v></c>`},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/report", bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Accept", test.accept)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, r)
+		if resp.Code != test.statusCode || resp.Header().Get("Content-Type") != test.contentType || resp.Header().Get("Vary") != "Accept" {
+			t.Errorf("%s: unexpected response: %d %s", test.accept, resp.Code, resp.Header().Get("Content-Type"))
+			continue
+		}
+		got := resp.Body.String()
+		if test.contentType == xlsxContentType {
+			z, err := zip.NewReader(bytes.NewReader(resp.Body.Bytes()), int64(resp.Body.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := z.Open("xl/worksheets/sheet1.xml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := io.ReadAll(f)
+			if got = string(b); strings.Contains(got, test.expected) && strings.Contains(got, "c&#39;d") {
+				continue
+			}
+		}
+		if got != test.expected {
+			t.Errorf("%s: unexpected body: %s", test.accept, got)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/report", bytes.NewBufferString(`{}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "text/csv")
+	resp := httptest.NewRecorder()
+	UPSDynamicWithConfig(echo, fd.Messages().ByName("Row"), config).ServeHTTP(resp, r)
+	if resp.Code != http.StatusNotAcceptable {
+		t.Errorf("unexpected status: %d", resp.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/report", bytes.NewBufferString(`{"rows":[{"name":"=1+2","count":-1,"tags":["@x","y"],"parent":{"name":"\tp"}},{"name":"-2"}]}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "text/csv")
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, r)
+	if expected := "name,count,tags,parent.name\n'=1+2,-1,'@x;y,'\tp\n'-2,0,,\n"; resp.Body.String() != expected {
+		t.Errorf("unexpected body: %q", resp.Body.String())
+	}
+
+	config.Cache = &CachePolicy{CacheControl: "public, max-age=60", Vary: []string{"accept", "Accept-Language"}}
+	r = httptest.NewRequest(http.MethodPost, "/report", bytes.NewBufferString(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "text/csv")
+	resp = httptest.NewRecorder()
+	UPSDynamicWithConfig(echo, fd.Messages().ByName("Report"), config).ServeHTTP(resp, r)
+	if vary := strings.Join(resp.Header().Values("Vary"), ", "); resp.Code != http.StatusOK || vary != "Accept, Accept-Language" {
+		t.Errorf("unexpected response: %d %s", resp.Code, vary)
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	for i, expected := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumn(i); got != expected {
+			t.Errorf("%d: expected %s, got %s", i, expected, got)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package ups
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Faults are the faults injected into the requests of a route by a
+// FaultInjector.  The rates are fractions of the requests.
+type Faults struct {
+	// Latency is the maximum delay added to the LatencyRate of
+	// requests, which are delayed by a random duration up to Latency.
+	Latency     time.Duration
+	LatencyRate float64
+
+	// ErrorRate of requests get ErrorStatus responses, which are 503
+	// responses if ErrorStatus is zero, without calling the handler.
+	ErrorRate   float64
+	ErrorStatus int
+
+	// DropRate of requests have their connections closed without
+	// responses.
+	DropRate float64
+}
+
+// FaultInjector injects faults into requests, for testing the
+// resilience of clients, such as in staging environments.  It is
+// disabled until enabled with Enable.  A FaultInjector may be shared by
+// the Configs of multiple handlers.
+type FaultInjector struct {
+	enabled atomic.Bool
+
+	mu     sync.RWMutex
+	routes map[string]Faults
+}
+
+// NewFaultInjector creates a disabled FaultInjector injecting the faults
+// into requests to all routes.
+func NewFaultInjector(faults Faults) *FaultInjector {
+	return &FaultInjector{routes: map[string]Faults{"": faults}}
+}
+
+// Enable enables or disables the injection of faults.
+func (f *FaultInjector) Enable(enabled bool) {
+	f.enabled.Store(enabled)
+}
+
+// Enabled returns true if faults are being injected.
+func (f *FaultInjector) Enabled() bool {
+	return f.enabled.Load()
+}
+
+// Set sets the faults injected into requests to the route, or into
+// requests to routes without faults if the route is "".
+func (f *FaultInjector) Set(route string, faults Faults) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.routes == nil {
+		f.routes = map[string]Faults{}
+	}
+	f.routes[route] = faults
+}
+
+func (f *FaultInjector) faults(route string) Faults {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if faults, ok := f.routes[route]; ok {
+		return faults
+	}
+	return f.routes[""]
+}
+
+// drop returns true if the connection of the request is to be dropped.
+func (f *FaultInjector) drop(route string) bool {
+	if !f.Enabled() {
+		return false
+	}
+	faults := f.faults(route)
+	return faults.DropRate > 0 && rand.Float64() < faults.DropRate
+}
+
+// inject delays the request, and returns the status code of its injected
+// error response, or 200.
+func (f *FaultInjector) inject(ctx context.Context, route string) int {
+	if !f.Enabled() {
+		return http.StatusOK
+	}
+	faults := f.faults(route)
+	if faults.Latency > 0 && rand.Float64() < faults.LatencyRate {
+		t := time.NewTimer(time.Duration(rand.Int63n(int64(faults.Latency))))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+		case <-t.C:
+		}
+	}
+	if faults.ErrorRate > 0 && rand.Float64() < faults.ErrorRate {
+		if faults.ErrorStatus == 0 {
+			return http.StatusServiceUnavailable
+		}
+		return faults.ErrorStatus
+	}
+	return http.StatusOK
+}
+
+// dropConnection closes the connection of the request without a
+// response.
+func dropConnection(w http.ResponseWriter) {
+	if conn, _, err := http.NewResponseController(w).Hijack(); err == nil {
+		conn.Close()
+		return
+	}
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,54 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestFaultInjector(t *testing.T) {
+	faults := NewFaultInjector(Faults{ErrorRate: 1, ErrorStatus: http.StatusBadGateway})
+	faults.Set("/slow", Faults{Latency: 20 * time.Millisecond, LatencyRate: 1})
+	faults.Set("/drop", Faults{DropRate: 1})
+	config := DefaultConfig
+	config.LogStartRequest = nil
+	config.LogEndRequest = nil
+	config.Faults = faults
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello " + req.Name}
+	}, config)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	post := func(path string) (int, error) {
+		resp, err := server.Client().Post(server.URL+path, "application/json", bytes.NewBufferString(`{"name":"World"}`))
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	for _, path := range []string{"/hello", "/slow", "/drop"} {
+		if code, err := post(path); code != http.StatusOK || err != nil {
+			t.Errorf("%s: unexpected response while disabled: %d %v", path, code, err)
+		}
+	}
+
+	faults.Enable(true)
+	if code, err := post("/hello"); code != http.StatusBadGateway || err != nil {
+		t.Errorf("unexpected response: %d %v", code, err)
+	}
+	start := time.Now()
+	if code, err := post("/slow"); code != http.StatusOK || err != nil {
+		t.Errorf("unexpected response: %d %v", code, err)
+	} else if time.Since(start) > time.Second {
+		t.Errorf("unexpected latency: %v", time.Since(start))
+	}
+	if _, err := post("/drop"); err == nil {
+		t.Errorf("expected dropped connection")
+	}
+}
@@ -0,0 +1,28 @@
+package ups
+
+import "context"
+
+// FeatureFlagProvider evaluates feature flags for requests, such as with
+// a feature flag service client.
+type FeatureFlagProvider interface {
+	// FeatureFlags returns the flags for a request to the route.  The
+	// principal is nil if the request is not authenticated.
+	FeatureFlags(ctx context.Context, route string, principal *Principal) (FeatureFlags, error)
+}
+
+// FeatureFlagProviderFunc implements FeatureFlagProvider with a func.
+type FeatureFlagProviderFunc func(ctx context.Context, route string, principal *Principal) (FeatureFlags, error)
+
+func (f FeatureFlagProviderFunc) FeatureFlags(ctx context.Context, route string, principal *Principal) (FeatureFlags, error) {
+	return f(ctx, route, principal)
+}
+
+// FeatureFlags are the feature flags of a request, by name.
+type FeatureFlags map[string]bool
+
+// FeatureFlag returns true if the flag is enabled for the request of the
+// context, and false if it is disabled or not set.
+func FeatureFlag(ctx context.Context, name string) bool {
+	flags, _ := Value(ctx, featureFlagsContextKey)
+	return flags[name]
+}
@@ -0,0 +1,50 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	config := DefaultConfig
+	config.LogError = nil
+	config.Route = "hello"
+	config.FeatureFlags = FeatureFlagProviderFunc(func(ctx context.Context, route string, principal *Principal) (FeatureFlags, error) {
+		if route != "hello" || principal != nil {
+			t.Errorf("unexpected route or principal: %s %+v", route, principal)
+		}
+		if summary := requestSummaryFromContext(ctx); summary.RequestID == "fail" {
+			return nil, errors.New("unavailable")
+		}
+		return FeatureFlags{"loud": true}, nil
+	})
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if FeatureFlag(ctx, "loud") {
+			return &testingups.HelloResponse{Text: "HELLO " + req.Name}, nil
+		}
+		return &testingups.HelloResponse{Text: "Hello " + req.Name}, nil
+	}, config)
+
+	for _, test := range []struct {
+		requestID string
+		expected  string
+	}{
+		{"ok", `{"text":"HELLO World"}`},
+		{"fail", `{"text":"Hello World"}`},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-Request-Id", test.requestID)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, r)
+		if resp.Code != http.StatusOK || resp.Body.String() != test.expected {
+			t.Errorf("%s: unexpected response: %d %s", test.requestID, resp.Code, resp.Body.String())
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package ups
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// unmarshalForm sets the fields of msg from the form values.  Form keys
+// are matched against the JSON names of the fields, falling back to the
+// proto field names.  Repeated fields take one element per value, with
+// repeated keys providing multiple elements.  Only scalar, enum, and
+// repeated scalar and enum fields can be set from form values.
+func unmarshalForm(values url.Values, msg proto.Message) error {
+	m := proto.MessageReflect(msg)
+	fields := m.Descriptor().Fields()
+	for key, vals := range values {
+		fd := formField(fields, key)
+		if fd == nil {
+			return errors.New("ups: unknown form field: " + key)
+		}
+		if fd.IsMap() || fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+			return errors.New("ups: unsupported form field: " + key)
+		}
+		if fd.IsList() {
+			list := m.Mutable(fd).List()
+			for _, val := range vals {
+				v, err := parseFormValue(fd, val)
+				if err != nil {
+					return err
+				}
+				list.Append(v)
+			}
+		} else {
+			if len(vals) != 1 {
+				return errors.New("ups: multiple values for form field: " + key)
+			}
+			v, err := parseFormValue(fd, vals[0])
+			if err != nil {
+				return err
+			}
+			m.Set(fd, v)
+		}
+	}
+	return nil
+}
+
+func parseFormValue(fd protoreflect.FieldDescriptor, val string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		if b, err := strconv.ParseBool(val); err != nil {
+			return protoreflect.Value{}, err
+		} else {
+			return protoreflect.ValueOfBool(b), nil
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if i, err := strconv.ParseInt(val, 10, 32); err != nil {
+			return protoreflect.Value{}, err
+		} else {
+			return protoreflect.ValueOfInt32(int32(i)), nil
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if i, err := strconv.ParseInt(val, 10, 64); err != nil {
+			return protoreflect.Value{}, err
+		} else {
+			return protoreflect.ValueOfInt64(i), nil
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if i, err := strconv.ParseUint(val, 10, 32); err != nil {
+			return protoreflect.Value{}, err
+		} else {
+			return protoreflect.ValueOfUint32(uint32(i)), nil
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if i, err := strconv.ParseUint(val, 10, 64); err != nil {
+			return protoreflect.Value{}, err
+		} else {
+			return protoreflect.ValueOfUint64(i), nil
+		}
+	case protoreflect.FloatKind:
+		if f, err := strconv.ParseFloat(val, 32); err != nil {
+			return protoreflect.Value{}, err
+		} else {
+			return protoreflect.ValueOfFloat32(float32(f)), nil
+		}
+	case protoreflect.DoubleKind:
+		if f, err := strconv.ParseFloat(val, 64); err != nil {
+			return protoreflect.Value{}, err
+		} else {
+			return protoreflect.ValueOfFloat64(f), nil
+		}
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(val), nil
+	case protoreflect.BytesKind:
+		if b, err := base64.StdEncoding.DecodeString(val); err != nil {
+			return protoreflect.Value{}, err
+		} else {
+			return protoreflect.ValueOfBytes(b), nil
+		}
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(val)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		} else if i, err := strconv.ParseInt(val, 10, 32); err != nil {
+			return protoreflect.Value{}, errors.New("ups: invalid enum value for form field: " + fd.JSONName())
+		} else {
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(i)), nil
+		}
+	default:
+		return protoreflect.Value{}, errors.New("ups: unsupported form field: " + fd.JSONName())
+	}
+}
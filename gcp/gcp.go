@@ -0,0 +1,80 @@
+// Package gcp adapts ups services to Cloud Run and Cloud Functions, with
+// the port and environment conventions of their containers, structured
+// logging in the format of Cloud Logging, and the trace context of Cloud
+// Trace.
+package gcp
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/qpliu/ups"
+)
+
+// ShutdownTimeout is the time allowed for Run to shut down the server
+// after SIGTERM, which is within the 10 seconds allowed by Cloud Run.
+var ShutdownTimeout = 8 * time.Second
+
+// Port returns the port the container must listen on, from the PORT
+// environment variable, or 8080 if it is not set.
+func Port() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return port
+	}
+	return "8080"
+}
+
+// ProjectID returns the project from the GOOGLE_CLOUD_PROJECT,
+// GCP_PROJECT, or GCLOUD_PROJECT environment variables, or "" if none is
+// set.
+func ProjectID() string {
+	for _, key := range []string{"GOOGLE_CLOUD_PROJECT", "GCP_PROJECT", "GCLOUD_PROJECT"} {
+		if project := os.Getenv(key); project != "" {
+			return project
+		}
+	}
+	return ""
+}
+
+// Service returns the name of the Cloud Run service or Cloud Function,
+// from the K_SERVICE environment variable.
+func Service() string {
+	return os.Getenv("K_SERVICE")
+}
+
+// Run serves the server on the Port, unless its Addr is set, with the
+// trace context of requests set by Handler, until SIGTERM or SIGINT,
+// then shuts it down gracefully.
+func Run(s *ups.Server) error {
+	if s.Addr == "" {
+		s.Addr = ":" + Port()
+	}
+	if s.Handler != nil {
+		s.Handler = Handler(s.Handler)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.ListenAndServe()
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	return s.Shutdown(ctx)
+}
+
+// Function returns the handler as a func for the entry point of a Cloud
+// Function, registered with functions.HTTP of the Functions Framework,
+// with the trace context of requests set by Handler.
+func Function(handler http.Handler) func(http.ResponseWriter, *http.Request) {
+	return Handler(handler).ServeHTTP
+}
@@ -0,0 +1,78 @@
+package gcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestPort(t *testing.T) {
+	t.Setenv("PORT", "")
+	if port := Port(); port != "8080" {
+		t.Errorf("expected 8080, got %s", port)
+	}
+	t.Setenv("PORT", "9090")
+	if port := Port(); port != "9090" {
+		t.Errorf("expected 9090, got %s", port)
+	}
+}
+
+func TestParseTrace(t *testing.T) {
+	for _, test := range []struct {
+		header, value string
+		expected      Trace
+		ok            bool
+	}{
+		{"X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1", Trace{"105445aa7843bc8bf206b12000100000", "0000000000000001", true}, true},
+		{"X-Cloud-Trace-Context", "105445AA7843BC8BF206B12000100000", Trace{"105445aa7843bc8bf206b12000100000", "", false}, true},
+		{"X-Cloud-Trace-Context", "invalid/1;o=1", Trace{}, false},
+		{"traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01", Trace{"0af7651916cd43dd8448eb211c80319c", "b7ad6b7169203331", true}, true},
+		{"traceparent", "00-00000000000000000000000000000000-b7ad6b7169203331-01", Trace{}, false},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set(test.header, test.value)
+		if trace, ok := ParseTrace(r); trace != test.expected || ok != test.ok {
+			t.Errorf("%s: expected %v %t, got %v %t", test.value, test.expected, test.ok, trace, ok)
+		}
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLoggerWithWriter(&buf, "project")
+	handler := Handler(ups.UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, logger.Config(ups.DefaultConfig)))
+
+	r := httptest.NewRequest(http.MethodPost, "/hello", strings.NewReader(`{"name":"World"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Cloud-Trace-Context", "105445aa7843bc8bf206b12000100000/1;o=1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d", w.Code)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var last map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &last); err != nil {
+		t.Fatal(err)
+	}
+	if last["severity"] != "INFO" || last["logging.googleapis.com/trace"] != "projects/project/traces/105445aa7843bc8bf206b12000100000" || last["logging.googleapis.com/spanId"] != "0000000000000001" {
+		t.Errorf("unexpected entry: %s", lines[len(lines)-1])
+	}
+	if req, _ := last["httpRequest"].(map[string]interface{}); req["status"] != float64(200) || req["requestMethod"] != "POST" {
+		t.Errorf("unexpected httpRequest: %v", last["httpRequest"])
+	}
+	for _, line := range lines[:len(lines)-1] {
+		if !strings.Contains(line, `"severity":"DEBUG"`) {
+			t.Errorf("unexpected entry: %s", line)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package gcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/qpliu/ups"
+)
+
+// Severities of log entries.
+const (
+	Debug    = "DEBUG"
+	Info     = "INFO"
+	Warning  = "WARNING"
+	Error    = "ERROR"
+	Critical = "CRITICAL"
+)
+
+// Logger writes log entries as JSON lines in the structured logging
+// format of Cloud Logging, which the logging agents of Cloud Run and
+// Cloud Functions read from stdout.  Entries are correlated with the
+// trace context set by Handler.
+type Logger struct {
+	// ProjectID is the project of the traces.  If empty, entries are
+	// not correlated with traces.
+	ProjectID string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLogger creates a Logger writing to stdout for the ProjectID.
+func NewLogger() *Logger {
+	return NewLoggerWithWriter(os.Stdout, ProjectID())
+}
+
+// NewLoggerWithWriter creates a Logger writing to w.
+func NewLoggerWithWriter(w io.Writer, projectID string) *Logger {
+	return &Logger{ProjectID: projectID, w: w}
+}
+
+type entry struct {
+	Severity     string       `json:"severity"`
+	Message      string       `json:"message"`
+	HTTPRequest  *httpRequest `json:"httpRequest,omitempty"`
+	Trace        string       `json:"logging.googleapis.com/trace,omitempty"`
+	SpanID       string       `json:"logging.googleapis.com/spanId,omitempty"`
+	TraceSampled bool         `json:"logging.googleapis.com/trace_sampled,omitempty"`
+}
+
+type httpRequest struct {
+	RequestMethod string `json:"requestMethod,omitempty"`
+	RequestURL    string `json:"requestUrl,omitempty"`
+	RequestSize   string `json:"requestSize,omitempty"`
+	Status        int    `json:"status,omitempty"`
+	ResponseSize  string `json:"responseSize,omitempty"`
+	Latency       string `json:"latency,omitempty"`
+}
+
+// Log writes an entry with the severity and message.
+func (l *Logger) Log(ctx context.Context, severity, message string) {
+	l.log(ctx, &entry{Severity: severity, Message: message})
+}
+
+func (l *Logger) log(ctx context.Context, e *entry) {
+	if t, ok := TraceFromContext(ctx); ok && l.ProjectID != "" {
+		e.Trace = "projects/" + l.ProjectID + "/traces/" + t.TraceID
+		e.SpanID = t.SpanID
+		e.TraceSampled = t.Sampled
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	b = append(b, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(b)
+}
+
+// Config returns a copy of config with the logging funcs writing to
+// the Logger.  LogEndRequest entries include the httpRequest of the
+// request, and LogPanic entries include the stack, so that they are
+// picked up by Error Reporting.  The logging of messages is replaced
+// with DEBUG entries, but only if enabled in config.
+func (l *Logger) Config(config ups.Config) ups.Config {
+	config.LogError = func(ctx context.Context, tag string, err error) {
+		l.Log(ctx, Error, tag+": "+err.Error())
+	}
+	config.LogPanic = func(ctx context.Context, err interface{}) {
+		l.Log(ctx, Critical, fmt.Sprintf("panic: %v\n\n%s", err, debug.Stack()))
+	}
+	config.LogStartRequest = nil
+	config.LogEndRequest = func(ctx context.Context, method string, url *url.URL, statusCode int) {
+		l.log(ctx, &entry{
+			Severity:    severity(statusCode),
+			Message:     method + " " + url.String() + " " + strconv.Itoa(statusCode),
+			HTTPRequest: &httpRequest{RequestMethod: method, RequestURL: url.String(), Status: statusCode},
+		})
+	}
+	debugMessage := func(prefix string) func(context.Context, proto.Message) {
+		return func(ctx context.Context, msg proto.Message) {
+			l.Log(ctx, Debug, prefix+msg.String())
+		}
+	}
+	debugString := func(prefix string) func(context.Context, string) {
+		return func(ctx context.Context, s string) {
+			l.Log(ctx, Debug, prefix+s)
+		}
+	}
+	debugBytes := func(prefix string) func(context.Context, []byte) {
+		return func(ctx context.Context, b []byte) {
+			l.Log(ctx, Debug, fmt.Sprintf("%s%x", prefix, b))
+		}
+	}
+	if config.LogRequestMessage != nil {
+		config.LogRequestMessage = debugMessage("REQ proto: ")
+	}
+	if config.LogResponseMessage != nil {
+		config.LogResponseMessage = debugMessage("RESP proto: ")
+	}
+	if config.LogRequestBytes != nil {
+		config.LogRequestBytes = debugBytes("REQ bytes: ")
+	}
+	if config.LogResponseBytes != nil {
+		config.LogResponseBytes = debugBytes("RESP bytes: ")
+	}
+	if config.LogRequestJSON != nil {
+		config.LogRequestJSON = debugString("REQ JSON: ")
+	}
+	if config.LogResponseJSON != nil {
+		config.LogResponseJSON = debugString("RESP JSON: ")
+	}
+	if config.LogRequestText != nil {
+		config.LogRequestText = debugString("REQ text: ")
+	}
+	if config.LogResponseText != nil {
+		config.LogResponseText = debugString("RESP text: ")
+	}
+	return config
+}
+
+// LogSummary writes an entry with the canonical log line and the
+// httpRequest of the request summary, for use as the LogSummary of a
+// Config instead of LogEndRequest.
+func (l *Logger) LogSummary(ctx context.Context, s *ups.RequestSummary) {
+	l.log(ctx, &entry{
+		Severity: severity(s.StatusCode),
+		Message:  s.String(),
+		HTTPRequest: &httpRequest{
+			RequestMethod: s.Method,
+			RequestURL:    s.Route,
+			RequestSize:   strconv.Itoa(s.RequestSize),
+			Status:        s.StatusCode,
+			ResponseSize:  strconv.Itoa(s.ResponseSize),
+			Latency:       strconv.FormatFloat(s.Duration.Seconds(), 'f', -1, 64) + "s",
+		},
+	})
+}
+
+func severity(statusCode int) string {
+	switch {
+	case statusCode >= 500:
+		return Error
+	case statusCode >= 400:
+		return Warning
+	default:
+		return Info
+	}
+}
@@ -0,0 +1,82 @@
+package gcp
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/qpliu/ups"
+)
+
+// Trace is the trace context of a request.
+type Trace struct {
+	// TraceID is the 32 character hex trace ID.
+	TraceID string
+
+	// SpanID is the 16 character hex span ID, if any.
+	SpanID string
+
+	Sampled bool
+}
+
+var traceKey = ups.NewContextKey[Trace]("trace")
+
+// ParseTrace returns the trace context of the request from the
+// X-Cloud-Trace-Context header, or from the W3C traceparent header.
+func ParseTrace(r *http.Request) (Trace, bool) {
+	if h := r.Header.Get("X-Cloud-Trace-Context"); h != "" {
+		// TRACE_ID/SPAN_ID;o=OPTIONS, with a decimal SPAN_ID.
+		var t Trace
+		h, options, _ := strings.Cut(h, ";")
+		traceID, spanID, _ := strings.Cut(h, "/")
+		if !isHex(traceID, 32) {
+			return Trace{}, false
+		}
+		t.TraceID = strings.ToLower(traceID)
+		if id, err := strconv.ParseUint(spanID, 10, 64); err == nil && id != 0 {
+			t.SpanID = strconv.FormatUint(id, 16)
+			t.SpanID = strings.Repeat("0", 16-len(t.SpanID)) + t.SpanID
+		}
+		t.Sampled = options == "o=1"
+		return t, true
+	}
+	if h := r.Header.Get("traceparent"); h != "" {
+		// VERSION-TRACE_ID-SPAN_ID-FLAGS
+		parts := strings.Split(h, "-")
+		if len(parts) < 4 || !isHex(parts[1], 32) || !isHex(parts[2], 16) || !isHex(parts[3], 2) {
+			return Trace{}, false
+		}
+		flags, _ := strconv.ParseUint(parts[3], 16, 8)
+		return Trace{TraceID: strings.ToLower(parts[1]), SpanID: strings.ToLower(parts[2]), Sampled: flags&1 != 0}, true
+	}
+	return Trace{}, false
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n || strings.Trim(s, "0") == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// TraceFromContext returns the trace context set by Handler.
+func TraceFromContext(ctx context.Context) (Trace, bool) {
+	return ups.Value(ctx, traceKey)
+}
+
+// Handler makes the trace context of requests available with
+// TraceFromContext, such as for the log entries of a Logger.
+func Handler(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t, ok := ParseTrace(r); ok {
+			r = r.WithContext(ups.WithValue(r.Context(), traceKey, t))
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,40 @@
+package ups
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// writeGetHeaders sets the ETag and Content-Length headers of the
+// response to a GET or HEAD request, returning 304 if the request has a
+// matching If-None-Match header, and the body to be written, which is
+// empty for HEAD requests.
+func writeGetHeaders(w http.ResponseWriter, r *http.Request, resp []byte) (int, []byte) {
+	sum := sha256.Sum256(resp)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		w.Header().Del("Content-Type")
+		return http.StatusNotModified, nil
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp)))
+	if r.Method == http.MethodHead {
+		return http.StatusOK, nil
+	}
+	return http.StatusOK, resp
+}
+
+// etagMatch reports whether the If-None-Match header matches the etag,
+// using the weak comparison.
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package ups
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestGET(t *testing.T) {
+	config := DefaultConfig
+	config.AllowGET = true
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+	body := `{"text":"Hello, World!"}`
+
+	req := httptest.NewRequest(http.MethodGet, "/hello?name=World", nil)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusOK, resp.Code)
+	}
+	if resp.Body.String() != body {
+		t.Errorf("response body, expected: %s, got: %s", body, resp.Body.String())
+	}
+	if contentType := resp.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("response Content-Type, expected: application/json, got: %s", contentType)
+	}
+	etag := resp.Header().Get("ETag")
+	if etag == "" {
+		t.Errorf("expected ETag")
+	}
+
+	req = httptest.NewRequest(http.MethodHead, "/hello?name=World", nil)
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK || resp.Body.Len() != 0 {
+		t.Errorf("HEAD: unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp.Header().Get("Content-Type") != "application/json" || resp.Header().Get("Content-Length") != strconv.Itoa(len(body)) || resp.Header().Get("ETag") != etag {
+		t.Errorf("HEAD: unexpected headers: %v", resp.Header())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/hello?name=World", nil)
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusNotModified || resp.Body.Len() != 0 {
+		t.Errorf("If-None-Match: unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/hello?name=Everyone", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp = httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK || resp.Body.String() != `{"text":"Hello, Everyone!"}` {
+		t.Errorf("If-None-Match: unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/hello?name=World", nil)
+	resp = httptest.NewRecorder()
+	UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{}
+	}).ServeHTTP(resp, req)
+	if resp.Code != http.StatusMethodNotAllowed {
+		t.Errorf("without AllowGET: expected: %d, got: %d", http.StatusMethodNotAllowed, resp.Code)
+	}
+}
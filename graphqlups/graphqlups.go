@@ -0,0 +1,582 @@
+// Package graphqlups serves the typed handler funcs used with ups as the
+// fields of a GraphQL schema derived from the descriptors of their
+// request and response messages.
+//
+// Each handler is a field of the Query or Mutation type, with arguments
+// for the fields of the request message, and with the type of the
+// response message.  Fields use the JSON names of the message fields,
+// enums are GraphQL enums, 64-bit integers and bytes are Strings and
+// unsigned 32-bit integers are Floats, as in the JSON mapping, and maps
+// and well-known types are of the JSON scalar type.
+//
+// Only a subset of GraphQL is supported: operations with variables,
+// aliases, and nested selections, but not fragments, directives,
+// subscriptions, or introspection.  The schema is available as SDL for
+// clients from Schema.SDL.
+package graphqlups
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/qpliu/ups"
+)
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	messageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+var marshaler = &jsonpb.Marshaler{EmitDefaults: true}
+
+// DefaultMaxRequestSize is the maximum size of request bodies of
+// Schemas without a MaxRequestSize.
+const DefaultMaxRequestSize = 1 << 20
+
+// Schema is an http.Handler serving GraphQL requests, as POST requests
+// with JSON bodies or as GET requests for queries, using the handlers
+// added with Query and Mutation.
+type Schema struct {
+	// LogError, if not nil, is called with the errors of handlers.
+	LogError func(context.Context, string, error)
+
+	// MaxRequestSize, if not zero, is the maximum size of request
+	// bodies.  Otherwise, it is DefaultMaxRequestSize.
+	MaxRequestSize int64
+
+	queries   map[string]*field
+	mutations map[string]*field
+}
+
+type field struct {
+	fn          reflect.Value
+	withContext bool
+	request     reflect.Type
+	response    protoreflect.MessageDescriptor
+}
+
+// NewSchema creates an empty Schema.
+func NewSchema() *Schema {
+	return &Schema{queries: map[string]*field{}, mutations: map[string]*field{}}
+}
+
+// Query adds the handler as a field of the Query type.  The handler must
+// take a proto.Message or a context.Context and a proto.Message, and
+// return a proto.Message or a (proto.Message, error), as with ups.UPS.
+//
+// Query will panic if the handler is not a valid func.
+func (s *Schema) Query(name string, handler interface{}) {
+	s.queries[name] = newField(handler)
+}
+
+// Mutation adds the handler as a field of the Mutation type, as with
+// Query.  Mutations are not allowed in GET requests, and the fields of a
+// mutation are executed serially.
+func (s *Schema) Mutation(name string, handler interface{}) {
+	s.mutations[name] = newField(handler)
+}
+
+func newField(handler interface{}) *field {
+	fn := reflect.ValueOf(handler)
+	ty := fn.Type()
+	if ty.Kind() != reflect.Func {
+		panic("graphqlups: invalid handler")
+	}
+	switch ty.NumOut() {
+	case 2:
+		if !ty.Out(1).Implements(errorType) {
+			panic("graphqlups: invalid handler error return type")
+		}
+		fallthrough
+	case 1:
+		if !ty.Out(0).Implements(messageType) || ty.Out(0).Kind() != reflect.Ptr {
+			panic("graphqlups: invalid handler message return type")
+		}
+	default:
+		panic("graphqlups: invalid handler return type")
+	}
+	f := &field{fn: fn}
+	switch ty.NumIn() {
+	case 1:
+	case 2:
+		if ty.In(0) != contextType {
+			panic("graphqlups: invalid handler parameter types")
+		}
+		f.withContext = true
+	default:
+		panic("graphqlups: invalid handler parameter types")
+	}
+	f.request = ty.In(ty.NumIn() - 1)
+	if !f.request.Implements(messageType) || f.request.Kind() != reflect.Ptr {
+		panic("graphqlups: invalid handler parameter type")
+	}
+	f.response = proto.MessageReflect(reflect.New(ty.Out(0).Elem()).Interface().(proto.Message)).Descriptor()
+	return f
+}
+
+func (f *field) requestDescriptor() protoreflect.MessageDescriptor {
+	return proto.MessageReflect(reflect.New(f.request.Elem()).Interface().(proto.Message)).Descriptor()
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// gqlError is an entry of the errors of a GraphQL response.
+type gqlError struct {
+	Message    string         `json:"message"`
+	Path       []string       `json:"path,omitempty"`
+	Extensions map[string]int `json:"extensions,omitempty"`
+}
+
+type response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []gqlError  `json:"errors,omitempty"`
+}
+
+func (s *Schema) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	switch r.Method {
+	case http.MethodPost:
+		maxRequestSize := s.MaxRequestSize
+		if maxRequestSize == 0 {
+			maxRequestSize = DefaultMaxRequestSize
+		}
+		d := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		d.UseNumber()
+		if err := d.Decode(&req); err != nil {
+			statusCode := http.StatusBadRequest
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) {
+				statusCode = http.StatusRequestEntityTooLarge
+			}
+			writeResponse(w, statusCode, &response{Errors: []gqlError{{Message: err.Error()}}})
+			return
+		}
+	case http.MethodGet:
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if v := r.URL.Query().Get("variables"); v != "" {
+			d := json.NewDecoder(strings.NewReader(v))
+			d.UseNumber()
+			if err := d.Decode(&req.Variables); err != nil {
+				writeResponse(w, http.StatusBadRequest, &response{Errors: []gqlError{{Message: err.Error()}}})
+				return
+			}
+		}
+	default:
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	op, err := parseDocument(req.Query, req.OperationName)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, &response{Errors: []gqlError{{Message: err.Error()}}})
+		return
+	}
+	if op.mutation && r.Method != http.MethodPost {
+		http.Error(w, "", http.StatusMethodNotAllowed)
+		return
+	}
+	variables := map[string]interface{}{}
+	for _, v := range op.variables {
+		if val, ok := req.Variables[v.name]; ok {
+			variables[v.name] = val
+		} else if v.isSet {
+			variables[v.name] = v.value
+		}
+	}
+	writeResponse(w, http.StatusOK, s.execute(r.Context(), op, variables))
+}
+
+func writeResponse(w http.ResponseWriter, statusCode int, resp *response) {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(body)
+}
+
+func (s *Schema) execute(ctx context.Context, op *operation, variables map[string]interface{}) *response {
+	fields, typeName := s.queries, "Query"
+	if op.mutation {
+		fields, typeName = s.mutations, "Mutation"
+	}
+	resp := &response{}
+	data := object{}
+	for _, sel := range op.selection {
+		if sel.name == "__typename" {
+			data = append(data, member{sel.key(), typeName})
+			continue
+		}
+		f, ok := fields[sel.name]
+		if !ok {
+			resp.Errors = append(resp.Errors, gqlError{Message: "unknown field: " + sel.name, Path: []string{sel.key()}})
+			data = append(data, member{sel.key(), nil})
+			continue
+		}
+		val, err := s.resolve(ctx, f, sel, variables)
+		if err != nil {
+			resp.Errors = append(resp.Errors, *err)
+		}
+		data = append(data, member{sel.key(), val})
+	}
+	resp.Data = data
+	return resp
+}
+
+func (s *Schema) resolve(ctx context.Context, f *field, sel *selection, variables map[string]interface{}) (result interface{}, gqlErr *gqlError) {
+	if sel.selection == nil {
+		return nil, &gqlError{Message: "selection required: " + sel.name, Path: []string{sel.key()}}
+	}
+	args, err := json.Marshal(substitute(sel.arguments, variables))
+	if err != nil {
+		return nil, &gqlError{Message: err.Error(), Path: []string{sel.key()}}
+	}
+	req := reflect.New(f.request.Elem())
+	if sel.arguments == nil {
+		args = []byte("{}")
+	}
+	if err := jsonpb.Unmarshal(bytes.NewReader(args), req.Interface().(proto.Message)); err != nil {
+		return nil, &gqlError{Message: err.Error(), Path: []string{sel.key()}}
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			s.logError(ctx, sel.name, fmt.Errorf("panic: %v", err))
+			result, gqlErr = nil, &gqlError{Message: http.StatusText(http.StatusInternalServerError), Path: []string{sel.key()}}
+		}
+	}()
+	in := []reflect.Value{req}
+	if f.withContext {
+		in = []reflect.Value{reflect.ValueOf(ctx), req}
+	}
+	results := f.fn.Call(in)
+	if len(results) > 1 && !results[1].IsNil() {
+		err := results[1].Interface().(error)
+		s.logError(ctx, sel.name, err)
+		gqlErr = &gqlError{Message: err.Error(), Path: []string{sel.key()}}
+		if sc, ok := err.(ups.StatusCoder); ok {
+			gqlErr.Extensions = map[string]int{"status": sc.StatusCode()}
+		}
+		return nil, gqlErr
+	}
+	js, err := marshaler.MarshalToString(results[0].Interface().(proto.Message))
+	if err != nil {
+		s.logError(ctx, "jsonpb.Marshal", err)
+		return nil, &gqlError{Message: http.StatusText(http.StatusInternalServerError), Path: []string{sel.key()}}
+	}
+	d := json.NewDecoder(strings.NewReader(js))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, &gqlError{Message: err.Error(), Path: []string{sel.key()}}
+	}
+	val, err := project(v, f.response, sel.selection)
+	if err != nil {
+		return nil, &gqlError{Message: err.Error(), Path: []string{sel.key()}}
+	}
+	return val, nil
+}
+
+func (s *Schema) logError(ctx context.Context, tag string, err error) {
+	if s.LogError != nil {
+		s.LogError(ctx, "graphqlups."+tag, err)
+	}
+}
+
+// substitute replaces the variable references in v with the values of
+// the variables.
+func substitute(v interface{}, variables map[string]interface{}) interface{} {
+	switch val := v.(type) {
+	case variableRef:
+		return variables[string(val)]
+	case enumValue:
+		return string(val)
+	case []interface{}:
+		list := make([]interface{}, len(val))
+		for i, elt := range val {
+			list[i] = substitute(elt, variables)
+		}
+		return list
+	case map[string]interface{}:
+		obj := make(map[string]interface{}, len(val))
+		for k, elt := range val {
+			obj[k] = substitute(elt, variables)
+		}
+		return obj
+	default:
+		return v
+	}
+}
+
+// project selects the fields of the JSON mapping of a message.
+func project(v interface{}, md protoreflect.MessageDescriptor, sels []*selection) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if list, ok := v.([]interface{}); ok {
+		result := make([]interface{}, len(list))
+		for i, elt := range list {
+			val, err := project(elt, md, sels)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = val
+		}
+		return result, nil
+	}
+	m, _ := v.(map[string]interface{})
+	result := object{}
+	for _, sel := range sels {
+		if sel.name == "__typename" {
+			result = append(result, member{sel.key(), typeName(md)})
+			continue
+		}
+		fd := md.Fields().ByJSONName(sel.name)
+		if fd == nil {
+			return nil, &fieldError{"unknown field: " + sel.name}
+		}
+		val := m[sel.name]
+		if sub := messageField(fd); sub != nil {
+			if sel.selection == nil {
+				return nil, &fieldError{"selection required: " + sel.name}
+			}
+			p, err := project(val, sub, sel.selection)
+			if err != nil {
+				return nil, err
+			}
+			val = p
+		} else if sel.selection != nil {
+			return nil, &fieldError{"selection not allowed: " + sel.name}
+		}
+		result = append(result, member{sel.key(), val})
+	}
+	return result, nil
+}
+
+type fieldError struct {
+	message string
+}
+
+func (err *fieldError) Error() string {
+	return err.message
+}
+
+// messageField returns the descriptor of the message type of the field if
+// it is an object type in the schema.
+func messageField(fd protoreflect.FieldDescriptor) protoreflect.MessageDescriptor {
+	if fd.IsMap() || fd.Message() == nil || isJSONScalar(fd.Message()) {
+		return nil
+	}
+	return fd.Message()
+}
+
+func isJSONScalar(md protoreflect.MessageDescriptor) bool {
+	return md.ParentFile() != nil && md.ParentFile().Package() == "google.protobuf"
+}
+
+func typeName(d protoreflect.Descriptor) string {
+	return strings.ReplaceAll(string(d.FullName()), ".", "_")
+}
+
+// object is a JSON object with its members in the order of the
+// selections.
+type object []member
+
+type member struct {
+	key   string
+	value interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(m.key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// SDL returns the schema in the GraphQL schema definition language.
+func (s *Schema) SDL() string {
+	g := &sdl{defined: map[string]bool{}}
+	g.root("Query", s.queries)
+	g.root("Mutation", s.mutations)
+	return g.buf.String()
+}
+
+type sdl struct {
+	buf     strings.Builder
+	pending []func()
+	defined map[string]bool
+	scalar  bool
+}
+
+func (g *sdl) root(name string, fields map[string]*field) {
+	if len(fields) == 0 {
+		return
+	}
+	names := make([]string, 0, len(fields))
+	for n := range fields {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var def strings.Builder
+	def.WriteString("type " + name + " {\n")
+	for _, n := range names {
+		f := fields[n]
+		def.WriteString("  " + n + g.arguments(f.requestDescriptor()) + ": " + g.outputType(f.response) + "\n")
+	}
+	def.WriteString("}\n")
+	g.write(def.String())
+	g.flush()
+}
+
+func (g *sdl) write(def string) {
+	if g.buf.Len() > 0 {
+		g.buf.WriteString("\n")
+	}
+	g.buf.WriteString(def)
+}
+
+func (g *sdl) flush() {
+	for len(g.pending) > 0 {
+		f := g.pending[0]
+		g.pending = g.pending[1:]
+		f()
+	}
+}
+
+func (g *sdl) arguments(md protoreflect.MessageDescriptor) string {
+	fields := md.Fields()
+	if fields.Len() == 0 {
+		return ""
+	}
+	args := make([]string, fields.Len())
+	for i := range args {
+		fd := fields.Get(i)
+		args[i] = fd.JSONName() + ": " + g.fieldType(fd, true)
+	}
+	return "(" + strings.Join(args, ", ") + ")"
+}
+
+func (g *sdl) outputType(md protoreflect.MessageDescriptor) string {
+	name := typeName(md)
+	if !g.defined[name] {
+		g.defined[name] = true
+		g.pending = append(g.pending, func() { g.message("type", name, md, false) })
+	}
+	return name
+}
+
+func (g *sdl) inputType(md protoreflect.MessageDescriptor) string {
+	name := typeName(md) + "Input"
+	if !g.defined[name] {
+		g.defined[name] = true
+		g.pending = append(g.pending, func() { g.message("input", name, md, true) })
+	}
+	return name
+}
+
+func (g *sdl) message(kind, name string, md protoreflect.MessageDescriptor, input bool) {
+	var def strings.Builder
+	def.WriteString(kind + " " + name + " {\n")
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		def.WriteString("  " + fd.JSONName() + ": " + g.fieldType(fd, input) + "\n")
+	}
+	if fields.Len() == 0 {
+		// Types must have fields.
+		def.WriteString("  _: Boolean\n")
+	}
+	def.WriteString("}\n")
+	g.write(def.String())
+}
+
+func (g *sdl) fieldType(fd protoreflect.FieldDescriptor, input bool) string {
+	var t string
+	switch {
+	case fd.IsMap():
+		t = g.jsonScalar()
+	case fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind:
+		if isJSONScalar(fd.Message()) {
+			t = g.jsonScalar()
+		} else if input {
+			t = g.inputType(fd.Message())
+		} else {
+			t = g.outputType(fd.Message())
+		}
+	case fd.Kind() == protoreflect.EnumKind:
+		t = g.enumType(fd.Enum())
+	case fd.Kind() == protoreflect.BoolKind:
+		t = "Boolean"
+	case fd.Kind() == protoreflect.Int32Kind || fd.Kind() == protoreflect.Sint32Kind || fd.Kind() == protoreflect.Sfixed32Kind:
+		t = "Int"
+	case fd.Kind() == protoreflect.FloatKind || fd.Kind() == protoreflect.DoubleKind:
+		t = "Float"
+	case fd.Kind() == protoreflect.Uint32Kind || fd.Kind() == protoreflect.Fixed32Kind:
+		// Unsigned integers do not fit in Int.
+		t = "Float"
+	default:
+		t = "String"
+	}
+	if fd.IsList() {
+		return "[" + t + "!]"
+	}
+	return t
+}
+
+func (g *sdl) jsonScalar() string {
+	if !g.scalar {
+		g.scalar = true
+		g.pending = append(g.pending, func() { g.write("scalar JSON\n") })
+	}
+	return "JSON"
+}
+
+func (g *sdl) enumType(ed protoreflect.EnumDescriptor) string {
+	name := typeName(ed)
+	if !g.defined[name] {
+		g.defined[name] = true
+		g.pending = append(g.pending, func() {
+			var def strings.Builder
+			def.WriteString("enum " + name + " {\n")
+			values := ed.Values()
+			for i := 0; i < values.Len(); i++ {
+				def.WriteString("  " + string(values.Get(i).Name()) + "\n")
+			}
+			def.WriteString("}\n")
+			g.write(def.String())
+		})
+	}
+	return name
+}
@@ -0,0 +1,146 @@
+package graphqlups
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+	"github.com/qpliu/ups/upspb"
+)
+
+type testError int
+
+func (err testError) Error() string {
+	return strconv.Itoa(int(err))
+}
+
+func (err testError) StatusCode() int {
+	return int(err)
+}
+
+func testSchema() *Schema {
+	s := NewSchema()
+	s.Query("hello", func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if req.Name == "" {
+			return nil, testError(http.StatusNotFound)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+	})
+	s.Query("operation", func(ctx context.Context, req *upspb.GetOperationRequest) *upspb.Operation {
+		return &upspb.Operation{Name: req.Name, Done: true, Error: &upspb.OperationError{Code: 404, Message: "not found"}}
+	})
+	s.Mutation("goodbye", func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Goodbye, " + req.Name + "!"}
+	})
+	return s
+}
+
+func TestSchema(t *testing.T) {
+	srv := httptest.NewServer(testSchema())
+	defer srv.Close()
+
+	for _, test := range []struct {
+		body       string
+		statusCode int
+		expected   string
+	}{
+		{`{"query":"{ hello(name: \"World\") { text } }"}`, http.StatusOK, `{"data":{"hello":{"text":"Hello, World!"}}}`},
+		{`{"query":"query Q($n: String!) { a: hello(name: $n) { __typename t: text } }","variables":{"n":"There"}}`, http.StatusOK, `{"data":{"a":{"__typename":"HelloResponse","t":"Hello, There!"}}}`},
+		{`{"query":"{ operation(name: \"op\") { name done error { code message } } }"}`, http.StatusOK, `{"data":{"operation":{"name":"op","done":true,"error":{"code":404,"message":"not found"}}}}`},
+		{`{"query":"mutation { goodbye(name: \"World\") { text } }"}`, http.StatusOK, `{"data":{"goodbye":{"text":"Goodbye, World!"}}}`},
+		{`{"query":"{ hello { text } }"}`, http.StatusOK, `{"data":{"hello":null},"errors":[{"message":"404","path":["hello"],"extensions":{"status":404}}]}`},
+		{`{"query":"{ hello(name: \"World\") { unknown } }"}`, http.StatusOK, `{"data":{"hello":null},"errors":[{"message":"unknown field: unknown","path":["hello"]}]}`},
+		{`{"query":"{ hello(name: \"World\") { ...F } }"}`, http.StatusBadRequest, `{"errors":[{"message":"graphqlups: unsupported \"...\" at 25"}]}`},
+	} {
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != test.statusCode {
+			t.Errorf("%s: expected status %d, got %d", test.body, test.statusCode, resp.StatusCode)
+		}
+		if string(body) != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.body, test.expected, body)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "?query=" + url.QueryEscape(`mutation { goodbye(name: "World") { text } }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected mutation in GET to get 405, got %d", resp.StatusCode)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	s := testSchema()
+	s.MaxRequestSize = 1000
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	for _, test := range []struct {
+		body       string
+		statusCode int
+		expected   string
+	}{
+		{`{"query":"{ hello` + strings.Repeat(" { a", 65) + `"}`, http.StatusBadRequest, `{"errors":[{"message":"graphqlups: nesting too deep at 260"}]}`},
+		{`{"query":"{ hello(name: ` + strings.Repeat("[", 65) + `"}`, http.StatusBadRequest, `{"errors":[{"message":"graphqlups: nesting too deep at 77"}]}`},
+		{`{"query":"{ hello(name: \"` + strings.Repeat("x", 1000) + `\") { text } }"}`, http.StatusRequestEntityTooLarge, `{"errors":[{"message":"http: request body too large"}]}`},
+	} {
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != test.statusCode {
+			t.Errorf("%.40s: expected status %d, got %d", test.body, test.statusCode, resp.StatusCode)
+		}
+		if string(body) != test.expected {
+			t.Errorf("%.40s: expected %s, got %s", test.body, test.expected, body)
+		}
+	}
+}
+
+func TestSDL(t *testing.T) {
+	expected := `type Query {
+  hello(name: String): HelloResponse
+  operation(name: String): ups_Operation
+}
+
+type HelloResponse {
+  text: String
+}
+
+type ups_Operation {
+  name: String
+  done: Boolean
+  error: ups_OperationError
+  response: JSON
+}
+
+type ups_OperationError {
+  code: Int
+  message: String
+}
+
+scalar JSON
+
+type Mutation {
+  goodbye(name: String): HelloResponse
+}
+`
+	if sdl := testSchema().SDL(); sdl != expected {
+		t.Errorf("unexpected SDL: %s", sdl)
+	}
+}
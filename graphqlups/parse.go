@@ -0,0 +1,437 @@
+package graphqlups
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// operation is a parsed GraphQL operation.  Fragments, directives, and
+// subscriptions are not supported.
+type operation struct {
+	mutation  bool
+	name      string
+	variables []variable
+	selection []*selection
+}
+
+type variable struct {
+	name  string
+	value interface{}
+	isSet bool
+}
+
+type selection struct {
+	alias     string
+	name      string
+	arguments map[string]interface{}
+	selection []*selection
+}
+
+// variableRef is an argument value referring to a variable.
+type variableRef string
+
+// enumValue is an argument value that is an enum name.
+type enumValue string
+
+func (s *selection) key() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+// maxDepth is the maximum nesting depth of selection sets and of list
+// and object values.
+const maxDepth = 64
+
+type parser struct {
+	src   string
+	pos   int
+	tok   string
+	depth int
+}
+
+func parseDocument(src string, operationName string) (*operation, error) {
+	p := &parser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var ops []*operation
+	for p.tok != "" {
+		op, err := p.operation()
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+	}
+	if len(ops) == 0 {
+		return nil, errors.New("graphqlups: no operation")
+	}
+	if operationName == "" {
+		if len(ops) > 1 {
+			return nil, errors.New("graphqlups: operationName required")
+		}
+		return ops[0], nil
+	}
+	for _, op := range ops {
+		if op.name == operationName {
+			return op, nil
+		}
+	}
+	return nil, errors.New("graphqlups: unknown operation: " + operationName)
+}
+
+func (p *parser) operation() (*operation, error) {
+	op := &operation{}
+	switch p.tok {
+	case "{":
+	case "query", "mutation":
+		op.mutation = p.tok == "mutation"
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if isName(p.tok) {
+			op.name = p.tok
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		if p.tok == "(" {
+			if err := p.variableDefinitions(op); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, p.unsupported()
+	}
+	sel, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selection = sel
+	return op, nil
+}
+
+func (p *parser) variableDefinitions(op *operation) error {
+	if err := p.next(); err != nil {
+		return err
+	}
+	for p.tok != ")" {
+		if err := p.expect("$"); err != nil {
+			return err
+		}
+		if !isName(p.tok) {
+			return p.unexpected()
+		}
+		v := variable{name: p.tok}
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		if p.tok == "=" {
+			if err := p.next(); err != nil {
+				return err
+			}
+			value, err := p.value(true)
+			if err != nil {
+				return err
+			}
+			v.value, v.isSet = value, true
+		}
+		op.variables = append(op.variables, v)
+	}
+	return p.next()
+}
+
+func (p *parser) typeRef() error {
+	if p.tok == "[" {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.typeRef(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if isName(p.tok) {
+		if err := p.next(); err != nil {
+			return err
+		}
+	} else {
+		return p.unexpected()
+	}
+	if p.tok == "!" {
+		return p.next()
+	}
+	return nil
+}
+
+func (p *parser) selectionSet() ([]*selection, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sels []*selection
+	for p.tok != "}" {
+		if !isName(p.tok) {
+			if p.tok == "..." {
+				return nil, p.unsupported()
+			}
+			return nil, p.unexpected()
+		}
+		sel := &selection{name: p.tok}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if p.tok == ":" {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if !isName(p.tok) {
+				return nil, p.unexpected()
+			}
+			sel.alias, sel.name = sel.name, p.tok
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+		}
+		if p.tok == "(" {
+			args, err := p.arguments()
+			if err != nil {
+				return nil, err
+			}
+			sel.arguments = args
+		}
+		if p.tok == "@" {
+			return nil, p.unsupported()
+		}
+		if p.tok == "{" {
+			s, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			sel.selection = s
+		}
+		sels = append(sels, sel)
+	}
+	if len(sels) == 0 {
+		return nil, p.unexpected()
+	}
+	return sels, p.next()
+}
+
+func (p *parser) arguments() (map[string]interface{}, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	args := map[string]interface{}{}
+	for p.tok != ")" {
+		if !isName(p.tok) {
+			return nil, p.unexpected()
+		}
+		name := p.tok
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		value, err := p.value(false)
+		if err != nil {
+			return nil, err
+		}
+		args[name] = value
+	}
+	return args, p.next()
+}
+
+func (p *parser) value(constant bool) (interface{}, error) {
+	tok := p.tok
+	switch {
+	case tok == "$" && !constant:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if !isName(p.tok) {
+			return nil, p.unexpected()
+		}
+		name := p.tok
+		return variableRef(name), p.next()
+	case tok == "[":
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		list := []interface{}{}
+		for p.tok != "]" {
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, p.next()
+	case tok == "{":
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		obj := map[string]interface{}{}
+		for p.tok != "}" {
+			if !isName(p.tok) {
+				return nil, p.unexpected()
+			}
+			name := p.tok
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			v, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = v
+		}
+		return obj, p.next()
+	case strings.HasPrefix(tok, `"`):
+		s, err := strconv.Unquote(strings.ReplaceAll(tok, `\/`, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("graphqlups: invalid string: %s", tok)
+		}
+		return s, p.next()
+	case tok == "true" || tok == "false":
+		return tok == "true", p.next()
+	case tok == "null":
+		return nil, p.next()
+	case isName(tok):
+		return enumValue(tok), p.next()
+	case tok != "" && (tok[0] == '-' || (tok[0] >= '0' && tok[0] <= '9')):
+		return json.Number(tok), p.next()
+	default:
+		return nil, p.unexpected()
+	}
+}
+
+func (p *parser) enter() error {
+	if p.depth >= maxDepth {
+		return fmt.Errorf("graphqlups: nesting too deep at %d", p.pos-len(p.tok))
+	}
+	p.depth++
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+func (p *parser) expect(tok string) error {
+	if p.tok != tok {
+		return p.unexpected()
+	}
+	return p.next()
+}
+
+func (p *parser) unexpected() error {
+	if p.tok == "" {
+		return errors.New("graphqlups: unexpected end of document")
+	}
+	return fmt.Errorf("graphqlups: unexpected %q at %d", p.tok, p.pos-len(p.tok))
+}
+
+func (p *parser) unsupported() error {
+	return fmt.Errorf("graphqlups: unsupported %q at %d", p.tok, p.pos-len(p.tok))
+}
+
+// next scans the next token into p.tok, which is empty at the end of
+// the document.  Commas are insignificant, as are whitespace and
+// comments.
+func (p *parser) next() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' && p.src[p.pos] != '\r' {
+				p.pos++
+			}
+		} else if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+		} else if strings.HasPrefix(p.src[p.pos:], "\uFEFF") {
+			p.pos += len("\uFEFF")
+		} else {
+			break
+		}
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = ""
+		return nil
+	}
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+	case strings.IndexByte("{}()[]:$!=@|&", c) >= 0:
+		p.pos++
+	case c == '"':
+		if strings.HasPrefix(p.src[p.pos:], `"""`) {
+			p.tok = `"""`
+			return p.unsupported()
+		}
+		p.pos++
+		for {
+			if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+				return errors.New("graphqlups: unterminated string")
+			}
+			if p.src[p.pos] == '"' {
+				p.pos++
+				break
+			}
+			if p.src[p.pos] == '\\' {
+				p.pos++
+			}
+			p.pos++
+		}
+	case c == '-' || (c >= '0' && c <= '9'):
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+	case c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		for p.pos < len(p.src) && isNameByte(p.src[p.pos]) {
+			p.pos++
+		}
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		return fmt.Errorf("graphqlups: unexpected character %q at %d", r, p.pos)
+	}
+	p.tok = p.src[start:p.pos]
+	return nil
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func isName(tok string) bool {
+	return tok != "" && !(tok[0] >= '0' && tok[0] <= '9') && isNameByte(tok[0]) && strings.IndexFunc(tok, func(r rune) bool { return r > 0x7f || !isNameByte(byte(r)) }) < 0
+}
@@ -0,0 +1,37 @@
+package grpcups
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+
+	"github.com/qpliu/ups"
+)
+
+// GatewayConfig returns the config with the JSON conventions of
+// grpc-gateway, so that clients of a grpc-gateway deployment can use ups
+// handlers unchanged.
+//
+// JSON responses use the lowerCamelCase JSON names of fields and include
+// fields with default values, unknown fields of JSON requests are
+// ignored, and error responses are google.rpc.Status messages, as in
+// {"code":5,"message":"not found","details":[]}, with the gRPC code
+// corresponding to the HTTP status and the message of the handler
+// error, if any.
+func GatewayConfig(config ups.Config) ups.Config {
+	config.JSONMarshaler = &jsonpb.Marshaler{EmitDefaults: true}
+	config.JSONUnmarshaler = &jsonpb.Unmarshaler{AllowUnknownFields: true}
+	config.ErrorMessage = gatewayErrorMessage
+	return config
+}
+
+func gatewayErrorMessage(ctx context.Context, statusCode int, err error) proto.Message {
+	message := http.StatusText(statusCode)
+	if err != nil {
+		message = err.Error()
+	}
+	return &spb.Status{Code: int32(Code(statusCode)), Message: message}
+}
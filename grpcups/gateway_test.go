@@ -0,0 +1,58 @@
+package grpcups
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestGatewayConfig(t *testing.T) {
+	config := GatewayConfig(ups.DefaultConfig)
+	srv := httptest.NewServer(ups.UPSWithConfig(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if req.Name == "" {
+			return nil, testError(http.StatusNotFound)
+		}
+		return &testingups.HelloResponse{}, nil
+	}, config))
+	defer srv.Close()
+
+	for _, test := range []struct {
+		body       string
+		statusCode int
+		expected   string
+	}{
+		{`{"name":"World","unknown":1}`, http.StatusOK, `{"text":""}`},
+		{`{}`, http.StatusNotFound, `{"code":5,"message":"404","details":[]}`},
+	} {
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != test.statusCode {
+			t.Errorf("%s: expected status %d, got %d", test.body, test.statusCode, resp.StatusCode)
+		}
+		if string(body) != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.body, test.expected, body)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: unexpected Content-Type %s", test.body, ct)
+		}
+	}
+
+	resp, err := http.Post(srv.URL, "text/csv", strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if expected := `{"code":3,"message":"Unsupported Media Type","details":[]}`; resp.StatusCode != http.StatusUnsupportedMediaType || string(body) != expected {
+		t.Errorf("unexpected response %d %s", resp.StatusCode, body)
+	}
+}
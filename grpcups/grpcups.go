@@ -0,0 +1,174 @@
+// Package grpcups serves the typed handler funcs used with ups as gRPC
+// unary methods, so that one implementation can be served over both ups
+// and gRPC.
+package grpcups
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/qpliu/ups"
+)
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	messageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+)
+
+// Register registers the handlers, keyed by method name, as the unary
+// methods of the service described by desc, such as the generated
+// _ServiceDesc of the service, with the registrar, such as a
+// *grpc.Server.  The methods of the service without handlers are
+// unimplemented.
+//
+// The handlers are funcs as taken by ups.UPS that take either a
+// proto.Message or a context.Context and a proto.Message, and return
+// either a proto.Message or a (proto.Message, error).  Errors that
+// implement ups.StatusCoder are mapped to the corresponding gRPC codes.
+//
+// Register will panic if a handler is not a valid func, or if desc has
+// no method for a handler.
+func Register(registrar grpc.ServiceRegistrar, desc *grpc.ServiceDesc, handlers map[string]interface{}) {
+	sd := &grpc.ServiceDesc{
+		ServiceName: desc.ServiceName,
+		HandlerType: (*interface{})(nil),
+		Streams:     desc.Streams,
+		Metadata:    desc.Metadata,
+	}
+	for name := range handlers {
+		found := false
+		for _, m := range desc.Methods {
+			found = found || m.MethodName == name
+		}
+		if !found {
+			panic("grpcups: unknown method: " + name)
+		}
+	}
+	for _, m := range desc.Methods {
+		if handler, ok := handlers[m.MethodName]; ok {
+			sd.Methods = append(sd.Methods, grpc.MethodDesc{
+				MethodName: m.MethodName,
+				Handler:    methodHandler("/"+desc.ServiceName+"/"+m.MethodName, handler),
+			})
+		}
+	}
+	registrar.RegisterService(sd, struct{}{})
+}
+
+func methodHandler(fullMethod string, handler interface{}) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	fn := reflect.ValueOf(handler)
+	ty := fn.Type()
+	if ty.Kind() != reflect.Func {
+		panic("grpcups: invalid handler")
+	}
+	switch ty.NumOut() {
+	case 2:
+		if !ty.Out(1).Implements(errorType) {
+			panic("grpcups: invalid handler error return type")
+		}
+		fallthrough
+	case 1:
+		if !ty.Out(0).Implements(messageType) {
+			panic("grpcups: invalid handler message return type")
+		}
+	default:
+		panic("grpcups: invalid handler return type")
+	}
+	withContext := false
+	switch ty.NumIn() {
+	case 1:
+	case 2:
+		if ty.In(0) != contextType {
+			panic("grpcups: invalid handler parameter types")
+		}
+		withContext = true
+	default:
+		panic("grpcups: invalid handler parameter types")
+	}
+	reqType := ty.In(ty.NumIn() - 1)
+	if !reqType.Implements(messageType) || reqType.Kind() != reflect.Ptr {
+		panic("grpcups: invalid handler parameter type")
+	}
+
+	call := func(ctx context.Context, req interface{}) (interface{}, error) {
+		args := []reflect.Value{reflect.ValueOf(req)}
+		if withContext {
+			args = []reflect.Value{reflect.ValueOf(ctx), args[0]}
+		}
+		results := fn.Call(args)
+		if len(results) > 1 && !results[1].IsNil() {
+			return nil, grpcError(results[1].Interface().(error))
+		}
+		return results[0].Interface(), nil
+	}
+
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		req := reflect.New(reqType.Elem()).Interface()
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return call(ctx, req)
+		}
+		return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod}, call)
+	}
+}
+
+// grpcError converts handler errors to gRPC status errors.
+func grpcError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	sc, ok := err.(ups.StatusCoder)
+	if !ok {
+		return status.Error(codes.Unknown, err.Error())
+	}
+	return status.Error(Code(sc.StatusCode()), err.Error())
+}
+
+// Code returns the gRPC code corresponding to an HTTP status code.
+func Code(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusRequestedRangeNotSatisfiable:
+		return codes.OutOfRange
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case 499:
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	switch {
+	case statusCode >= 400 && statusCode < 500:
+		return codes.InvalidArgument
+	case statusCode >= 500:
+		return codes.Internal
+	default:
+		return codes.Unknown
+	}
+}
@@ -0,0 +1,112 @@
+package grpcups
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+type testError int
+
+func (err testError) Error() string {
+	return strconv.Itoa(int(err))
+}
+
+func (err testError) StatusCode() int {
+	return int(err)
+}
+
+var helloServiceDesc = grpc.ServiceDesc{
+	ServiceName: "testingups.Hello",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Hello"},
+		{MethodName: "Hello2"},
+		{MethodName: "Unimplemented"},
+	},
+}
+
+func TestRegister(t *testing.T) {
+	hello := func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if req.Name == "" {
+			return nil, testError(http.StatusNotFound)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+	}
+	intercepted := ""
+	server := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		intercepted = info.FullMethod
+		return handler(ctx, req)
+	}))
+	Register(server, &helloServiceDesc, map[string]interface{}{
+		"Hello": hello,
+		"Hello2": func(ctx context.Context, req *testingups.HelloRequest) *testingups.HelloResponse {
+			return &testingups.HelloResponse{Text: "Context, " + req.Name + "!"}
+		},
+	})
+
+	l := bufconn.Listen(1 << 20)
+	go server.Serve(l)
+	defer server.Stop()
+	conn, err := grpc.NewClient("passthrough:///bufconn", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return l.DialContext(ctx)
+	}), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	resp := &testingups.HelloResponse{}
+	if err := conn.Invoke(ctx, "/testingups.Hello/Hello", &testingups.HelloRequest{Name: "World"}, resp); err != nil {
+		t.Fatal(err)
+	} else if resp.Text != "Hello, World!" || intercepted != "/testingups.Hello/Hello" {
+		t.Errorf("unexpected response: %v %s", resp, intercepted)
+	}
+	if err := conn.Invoke(ctx, "/testingups.Hello/Hello2", &testingups.HelloRequest{Name: "World"}, resp); err != nil {
+		t.Fatal(err)
+	} else if resp.Text != "Context, World!" {
+		t.Errorf("unexpected response: %v", resp)
+	}
+	if err := conn.Invoke(ctx, "/testingups.Hello/Hello", &testingups.HelloRequest{}, resp); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound, got: %v", err)
+	}
+	if err := conn.Invoke(ctx, "/testingups.Hello/Unimplemented", &testingups.HelloRequest{}, resp); status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented, got: %v", err)
+	}
+}
+
+func TestRegisterUnknownMethod(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected panic")
+		}
+	}()
+	Register(grpc.NewServer(), &helloServiceDesc, map[string]interface{}{
+		"Goodbye": func(req *testingups.HelloRequest) *testingups.HelloResponse { return nil },
+	})
+}
+
+func TestCode(t *testing.T) {
+	for statusCode, code := range map[int]codes.Code{
+		http.StatusOK:                  codes.OK,
+		http.StatusForbidden:           codes.PermissionDenied,
+		http.StatusTeapot:              codes.InvalidArgument,
+		http.StatusServiceUnavailable:  codes.Unavailable,
+		http.StatusInternalServerError: codes.Internal,
+	} {
+		if c := Code(statusCode); c != code {
+			t.Errorf("%d: expected: %s, got: %s", statusCode, code, c)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package ups
+
+import (
+	"net/http"
+	"time"
+)
+
+// HTTP2Options configure HTTP/2 for a Server.
+type HTTP2Options struct {
+	// H2C enables HTTP/2 without TLS, with prior knowledge, for use
+	// behind L4 load balancers and for grpc-web and Connect clients.
+	H2C bool
+
+	// DisableHTTP1 disables HTTP/1, so that only HTTP/2 is served.
+	DisableHTTP1 bool
+
+	// MaxConcurrentStreams is the maximum number of concurrent streams
+	// per connection.  If zero, the default of at least 100 is used.
+	MaxConcurrentStreams int
+
+	// MaxReadFrameSize is the largest frame the server reads, between
+	// 16KiB and 16MiB.  If zero, the default is used.
+	MaxReadFrameSize int
+
+	// MaxReceiveBufferPerConnection and MaxReceiveBufferPerStream are
+	// the flow control windows.  If zero, the defaults are used.
+	MaxReceiveBufferPerConnection int
+	MaxReceiveBufferPerStream     int
+
+	// PingTimeout is the timeout for health check pings, and
+	// SendPingTimeout is the idle time after which pings are sent.  If
+	// zero, the defaults are used.
+	PingTimeout     time.Duration
+	SendPingTimeout time.Duration
+}
+
+// ConfigureHTTP2 configures the protocols and the HTTP/2 settings of the
+// Server.  HTTP/2 over TLS is always enabled.
+func (s *Server) ConfigureHTTP2(opts HTTP2Options) {
+	protocols := &http.Protocols{}
+	protocols.SetHTTP1(!opts.DisableHTTP1)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(opts.H2C)
+	s.Protocols = protocols
+	s.HTTP2 = &http.HTTP2Config{
+		MaxConcurrentStreams:          opts.MaxConcurrentStreams,
+		MaxReadFrameSize:              opts.MaxReadFrameSize,
+		MaxReceiveBufferPerConnection: opts.MaxReceiveBufferPerConnection,
+		MaxReceiveBufferPerStream:     opts.MaxReceiveBufferPerStream,
+		PingTimeout:                   opts.PingTimeout,
+		SendPingTimeout:               opts.SendPingTimeout,
+	}
+}
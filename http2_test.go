@@ -0,0 +1,40 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestH2C(t *testing.T) {
+	server := &Server{}
+	server.ConfigureHTTP2(HTTP2Options{H2C: true, MaxConcurrentStreams: 10})
+	server.Handle("/hello", UPS(func(r *http.Request, req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + r.Proto + "!"}
+	}))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(l)
+	defer server.Shutdown(context.Background())
+
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	resp, err := client.Post("http://"+l.Addr().String()+"/hello", "application/json", bytes.NewBufferString(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+	if resp.ProtoMajor != 2 || body.String() != `{"text":"Hello, HTTP/2.0!"}` {
+		t.Errorf("unexpected response: %s %s", resp.Proto, body.String())
+	}
+}
@@ -0,0 +1,318 @@
+// Package protomap converts between proto messages and generic maps keyed
+// by the JSON names of the fields, for use by codecs for self-describing
+// encodings.
+package protomap
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// ToMap converts the populated fields of m to a map keyed by the JSON
+// names of the fields.
+//
+// Enums are converted to their names when known, nested messages to maps,
+// repeated fields to []interface{}, and map fields to
+// map[string]interface{} with the keys formatted as strings, as in the
+// JSON mapping.
+func ToMap(m protoreflect.Message) map[string]interface{} {
+	result := map[string]interface{}{}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsList():
+			list := v.List()
+			l := make([]interface{}, list.Len())
+			for i := range l {
+				l[i] = toValue(fd, list.Get(i))
+			}
+			result[fd.JSONName()] = l
+		case fd.IsMap():
+			mm := map[string]interface{}{}
+			v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+				mm[k.String()] = toValue(fd.MapValue(), v)
+				return true
+			})
+			result[fd.JSONName()] = mm
+		default:
+			result[fd.JSONName()] = toValue(fd, v)
+		}
+		return true
+	})
+	return result
+}
+
+func toValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return int32(v.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return ToMap(v.Message())
+	default:
+		return v.Interface()
+	}
+}
+
+// FromMap sets the fields of m from a map keyed by the JSON names or the
+// proto names of the fields.  The map, and any nested maps, may either be
+// map[string]interface{} or map[interface{}]interface{} with string keys.
+//
+// Numeric values may be of any Go integer or floating point type, as long
+// as they can be represented by the type of the field.
+func FromMap(v interface{}, m protoreflect.Message) error {
+	fields := m.Descriptor().Fields()
+	return rangeMap(v, func(key string, val interface{}) error {
+		fd := fields.ByJSONName(key)
+		if fd == nil {
+			fd = fields.ByName(protoreflect.Name(key))
+		}
+		if fd == nil {
+			return errors.New("protomap: unknown field: " + key)
+		}
+		if val == nil {
+			return nil
+		}
+		switch {
+		case fd.IsList():
+			l, ok := val.([]interface{})
+			if !ok {
+				return errors.New("protomap: expected list for field: " + key)
+			}
+			list := m.Mutable(fd).List()
+			for _, elt := range l {
+				if fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+					e := list.NewElement()
+					if err := FromMap(elt, e.Message()); err != nil {
+						return err
+					}
+					list.Append(e)
+				} else if e, err := fromValue(fd, elt); err != nil {
+					return err
+				} else {
+					list.Append(e)
+				}
+			}
+			return nil
+		case fd.IsMap():
+			mm := m.Mutable(fd).Map()
+			return rangeMap(val, func(k string, elt interface{}) error {
+				mk, err := mapKey(fd.MapKey(), k)
+				if err != nil {
+					return err
+				}
+				if fd.MapValue().Kind() == protoreflect.MessageKind {
+					e := mm.NewValue()
+					if err := FromMap(elt, e.Message()); err != nil {
+						return err
+					}
+					mm.Set(mk, e)
+				} else if e, err := fromValue(fd.MapValue(), elt); err != nil {
+					return err
+				} else {
+					mm.Set(mk, e)
+				}
+				return nil
+			})
+		case fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind:
+			return FromMap(val, m.Mutable(fd).Message())
+		default:
+			if e, err := fromValue(fd, val); err != nil {
+				return err
+			} else {
+				m.Set(fd, e)
+			}
+			return nil
+		}
+	})
+}
+
+func rangeMap(v interface{}, f func(string, interface{}) error) error {
+	switch mm := v.(type) {
+	case map[string]interface{}:
+		for k, val := range mm {
+			if err := f(k, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[interface{}]interface{}:
+		for k, val := range mm {
+			key, ok := k.(string)
+			if !ok {
+				return fmt.Errorf("protomap: invalid key: %v", k)
+			}
+			if err := f(key, val); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("protomap: expected map, got %T", v)
+	}
+}
+
+func mapKey(fd protoreflect.FieldDescriptor, k string) (protoreflect.MapKey, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(k).MapKey(), nil
+	case protoreflect.BoolKind:
+		if b, err := strconv.ParseBool(k); err != nil {
+			return protoreflect.MapKey{}, err
+		} else {
+			return protoreflect.ValueOfBool(b).MapKey(), nil
+		}
+	default:
+		if v, err := fromValue(fd, k); err != nil {
+			return protoreflect.MapKey{}, err
+		} else {
+			return v.MapKey(), nil
+		}
+	}
+}
+
+func fromValue(fd protoreflect.FieldDescriptor, v interface{}) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		if b, ok := v.(bool); ok {
+			return protoreflect.ValueOfBool(b), nil
+		}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		if i, ok := toInt(v); ok && i >= math.MinInt32 && i <= math.MaxInt32 {
+			return protoreflect.ValueOfInt32(int32(i)), nil
+		}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		if i, ok := toInt(v); ok {
+			return protoreflect.ValueOfInt64(i), nil
+		}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		if i, ok := toUint(v); ok && i <= math.MaxUint32 {
+			return protoreflect.ValueOfUint32(uint32(i)), nil
+		}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		if i, ok := toUint(v); ok {
+			return protoreflect.ValueOfUint64(i), nil
+		}
+	case protoreflect.FloatKind:
+		if f, ok := toFloat(v); ok {
+			return protoreflect.ValueOfFloat32(float32(f)), nil
+		}
+	case protoreflect.DoubleKind:
+		if f, ok := toFloat(v); ok {
+			return protoreflect.ValueOfFloat64(f), nil
+		}
+	case protoreflect.StringKind:
+		if s, ok := v.(string); ok {
+			return protoreflect.ValueOfString(s), nil
+		}
+	case protoreflect.BytesKind:
+		if b, ok := v.([]byte); ok {
+			return protoreflect.ValueOfBytes(b), nil
+		}
+	case protoreflect.EnumKind:
+		if s, ok := v.(string); ok {
+			if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+				return protoreflect.ValueOfEnum(ev.Number()), nil
+			}
+		} else if i, ok := toInt(v); ok && i >= math.MinInt32 && i <= math.MaxInt32 {
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(i)), nil
+		}
+	}
+	// Map keys arrive as strings.
+	if s, ok := v.(string); ok {
+		switch fd.Kind() {
+		case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+			if i, err := strconv.ParseInt(s, 10, 32); err == nil {
+				return protoreflect.ValueOfInt32(int32(i)), nil
+			}
+		case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return protoreflect.ValueOfInt64(i), nil
+			}
+		case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+			if i, err := strconv.ParseUint(s, 10, 32); err == nil {
+				return protoreflect.ValueOfUint32(uint32(i)), nil
+			}
+		case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+			if i, err := strconv.ParseUint(s, 10, 64); err == nil {
+				return protoreflect.ValueOfUint64(i), nil
+			}
+		}
+	}
+	return protoreflect.Value{}, fmt.Errorf("protomap: invalid value for field %s: %v", fd.JSONName(), v)
+}
+
+func toInt(v interface{}) (int64, bool) {
+	switch i := v.(type) {
+	case int:
+		return int64(i), true
+	case int8:
+		return int64(i), true
+	case int16:
+		return int64(i), true
+	case int32:
+		return int64(i), true
+	case int64:
+		return i, true
+	case uint:
+		return int64(i), uint64(i) <= math.MaxInt64
+	case uint8:
+		return int64(i), true
+	case uint16:
+		return int64(i), true
+	case uint32:
+		return int64(i), true
+	case uint64:
+		return int64(i), i <= math.MaxInt64
+	default:
+		return 0, false
+	}
+}
+
+func toUint(v interface{}) (uint64, bool) {
+	switch i := v.(type) {
+	case int:
+		return uint64(i), i >= 0
+	case int8:
+		return uint64(i), i >= 0
+	case int16:
+		return uint64(i), i >= 0
+	case int32:
+		return uint64(i), i >= 0
+	case int64:
+		return uint64(i), i >= 0
+	case uint:
+		return uint64(i), true
+	case uint8:
+		return uint64(i), true
+	case uint16:
+		return uint64(i), true
+	case uint32:
+		return uint64(i), true
+	case uint64:
+		return i, true
+	default:
+		return 0, false
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch f := v.(type) {
+	case float32:
+		return float64(f), true
+	case float64:
+		return f, true
+	}
+	if i, ok := toInt(v); ok {
+		return float64(i), true
+	}
+	if i, ok := toUint(v); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
@@ -0,0 +1,58 @@
+package protomap
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestRoundTrip(t *testing.T) {
+	msg := &descriptorpb.DescriptorProto{
+		Name: proto.String("Hello"),
+		Field: []*descriptorpb.FieldDescriptorProto{
+			{
+				Name:     proto.String("name"),
+				Number:   proto.Int32(1),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				JsonName: proto.String("name"),
+			},
+		},
+		ReservedName: []string{"a", "b"},
+	}
+
+	m := ToMap(msg.ProtoReflect())
+	if m["name"] != "Hello" {
+		t.Errorf("name, expected: Hello, got: %v", m["name"])
+	}
+	field := m["field"].([]interface{})[0].(map[string]interface{})
+	if field["type"] != "TYPE_STRING" {
+		t.Errorf("type, expected: TYPE_STRING, got: %v", field["type"])
+	}
+
+	// Simulate the generic types produced by decoders.
+	field["number"] = uint64(1)
+	m["field"] = []interface{}{map[interface{}]interface{}{
+		"name":     field["name"],
+		"number":   field["number"],
+		"label":    int64(1),
+		"type":     field["type"],
+		"jsonName": field["jsonName"],
+	}}
+
+	var result descriptorpb.DescriptorProto
+	if err := FromMap(m, result.ProtoReflect()); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(msg, &result) {
+		t.Errorf("expected: %v, got: %v", msg, &result)
+	}
+
+	if err := FromMap(map[string]interface{}{"unknown": 1}, result.ProtoReflect()); err == nil {
+		t.Errorf("expected unknown field error")
+	}
+	if err := FromMap(map[string]interface{}{"name": 1}, result.ProtoReflect()); err == nil {
+		t.Errorf("expected invalid value error")
+	}
+}
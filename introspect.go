@@ -0,0 +1,214 @@
+package ups
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	Subject  string
+	ClientID string
+	Username string
+	Scopes   []string
+	Roles    []string
+
+	// ExpiresAt is the expiration of the credentials, if known.
+	ExpiresAt time.Time
+}
+
+// HasScope reports whether the principal has the scope.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the principal has the role.
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticatedPrincipal returns the authenticated principal of the
+// request of the context.
+func AuthenticatedPrincipal(ctx context.Context) (*Principal, bool) {
+	principal, ok := Value(ctx, PrincipalKey)
+	return principal, ok
+}
+
+// Introspector validates OAuth2 bearer tokens using an RFC 7662 token
+// introspection endpoint.
+type Introspector struct {
+	// URL is the URL of the introspection endpoint.
+	URL string
+
+	// ClientID and ClientSecret, if not empty, authenticate the
+	// introspection requests using HTTP basic authentication.
+	ClientID     string
+	ClientSecret string
+
+	// Client is used for the introspection requests.  If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+
+	// CacheTTL is the maximum duration for which introspection results
+	// are cached.  Active tokens are not cached past their expiration.
+	// If zero, results are not cached.
+	CacheTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[[sha256.Size]byte]introspectionCacheEntry
+}
+
+type introspectionCacheEntry struct {
+	principal *Principal
+	expires   time.Time
+}
+
+const introspectionCacheMaxSize = 10000
+
+// ErrInactiveToken is returned by Introspect for tokens that are not
+// active.
+var ErrInactiveToken = errors.New("ups: inactive token")
+
+// Introspect returns the principal of an active token.
+func (in *Introspector) Introspect(ctx context.Context, token string) (*Principal, error) {
+	key := sha256.Sum256([]byte(token))
+	now := time.Now()
+	if in.CacheTTL > 0 {
+		in.mu.Lock()
+		entry, ok := in.cache[key]
+		in.mu.Unlock()
+		if ok && now.Before(entry.expires) {
+			if entry.principal == nil {
+				return nil, ErrInactiveToken
+			}
+			return entry.principal, nil
+		}
+	}
+
+	principal, err := in.introspect(ctx, token)
+	if err != nil && err != ErrInactiveToken {
+		return nil, err
+	}
+	if in.CacheTTL > 0 {
+		expires := now.Add(in.CacheTTL)
+		if principal != nil && !principal.ExpiresAt.IsZero() && principal.ExpiresAt.Before(expires) {
+			expires = principal.ExpiresAt
+		}
+		in.mu.Lock()
+		if in.cache == nil {
+			in.cache = map[[sha256.Size]byte]introspectionCacheEntry{}
+		}
+		if len(in.cache) >= introspectionCacheMaxSize {
+			for k, e := range in.cache {
+				if !now.Before(e.expires) {
+					delete(in.cache, k)
+				}
+			}
+		}
+		if len(in.cache) < introspectionCacheMaxSize {
+			in.cache[key] = introspectionCacheEntry{principal: principal, expires: expires}
+		}
+		in.mu.Unlock()
+	}
+	return principal, err
+}
+
+func (in *Introspector) introspect(ctx context.Context, token string) (*Principal, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, in.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if in.ClientID != "" || in.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(in.ClientID), url.QueryEscape(in.ClientSecret))
+	}
+	client := in.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("ups: introspection status " + strconv.Itoa(resp.StatusCode))
+	}
+	var result struct {
+		Active   bool   `json:"active"`
+		Scope    string `json:"scope"`
+		ClientID string `json:"client_id"`
+		Username string `json:"username"`
+		Subject  string `json:"sub"`
+		Exp      int64  `json:"exp"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if !result.Active {
+		return nil, ErrInactiveToken
+	}
+	principal := &Principal{
+		Subject:  result.Subject,
+		ClientID: result.ClientID,
+		Username: result.Username,
+		Scopes:   strings.Fields(result.Scope),
+	}
+	if result.Exp != 0 {
+		principal.ExpiresAt = time.Unix(result.Exp, 0)
+	}
+	return principal, nil
+}
+
+// bearerToken returns the bearer token of the Authorization header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// authenticate validates the bearer token of the request and checks the
+// RequiredScopes, returning the principal, or a status code and
+// WWW-Authenticate header value if the request is not authorized.
+func (ups *upsHandler) authenticate(ctx context.Context, r *http.Request) (*Principal, int, string) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return nil, http.StatusUnauthorized, "Bearer"
+	}
+	principal, err := ups.config.Introspector.Introspect(ctx, token)
+	if err == ErrInactiveToken {
+		return nil, http.StatusUnauthorized, `Bearer error="invalid_token"`
+	} else if err != nil {
+		ups.logError(ctx, "Introspector.Introspect", err)
+		return nil, http.StatusServiceUnavailable, ""
+	}
+	for _, scope := range ups.config.RequiredScopes {
+		if !principal.HasScope(scope) {
+			return nil, http.StatusForbidden, `Bearer error="insufficient_scope", scope="` + strings.Join(ups.config.RequiredScopes, " ") + `"`
+		}
+	}
+	return principal, http.StatusOK, ""
+}
@@ -0,0 +1,92 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestIntrospector(t *testing.T) {
+	var introspections int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&introspections, 1)
+		if id, secret, _ := r.BasicAuth(); id != "ups" || secret != "secret" {
+			http.Error(w, "", http.StatusUnauthorized)
+			return
+		}
+		result := map[string]interface{}{"active": false}
+		switch r.PostFormValue("token") {
+		case "reader":
+			result = map[string]interface{}{"active": true, "sub": "alice", "scope": "read", "exp": time.Now().Add(time.Hour).Unix()}
+		case "writer":
+			result = map[string]interface{}{"active": true, "sub": "bob", "scope": "read write"}
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	defer server.Close()
+
+	config := DefaultConfig
+	config.Introspector = &Introspector{
+		URL:          server.URL,
+		ClientID:     "ups",
+		ClientSecret: "secret",
+		CacheTTL:     time.Minute,
+	}
+	config.RequiredScopes = []string{"write"}
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) *testingups.HelloResponse {
+		principal, _ := AuthenticatedPrincipal(ctx)
+		return &testingups.HelloResponse{Text: "Hello, " + principal.Subject + "!"}
+	}, config)
+
+	call := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	for _, test := range []struct {
+		authorization string
+		code          int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Basic abc", http.StatusUnauthorized},
+		{"Bearer invalid", http.StatusUnauthorized},
+		{"Bearer reader", http.StatusForbidden},
+		{"Bearer writer", http.StatusOK},
+		{"bearer writer", http.StatusOK},
+	} {
+		resp := call(test.authorization)
+		if resp.Code != test.code {
+			t.Errorf("%s: response code: expected: %d, got: %d", test.authorization, test.code, resp.Code)
+		}
+		if test.code == http.StatusOK && resp.Body.String() != `{"text":"Hello, bob!"}` {
+			t.Errorf("%s: unexpected response body: %s", test.authorization, resp.Body.String())
+		}
+		if test.code != http.StatusOK && resp.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected WWW-Authenticate header", test.authorization)
+		}
+	}
+	if n := atomic.LoadInt32(&introspections); n != 3 {
+		t.Errorf("expected 3 introspections, got %d", n)
+	}
+
+	config.Introspector = &Introspector{URL: server.URL}
+	handler = UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{}
+	}, config)
+	if resp := call("Bearer writer"); resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusServiceUnavailable, resp.Code)
+	}
+}
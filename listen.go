@@ -0,0 +1,79 @@
+package ups
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+// SystemdListeners returns the listeners passed by systemd socket
+// activation, as described by sd_listen_fds(3), with their names from
+// LISTEN_FDNAMES.  It returns no listeners if the process was not socket
+// activated.  The environment variables are unset so that they are not
+// inherited by child processes.
+func SystemdListeners() ([]net.Listener, []string, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+	return systemdListeners(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"))
+}
+
+// ListenUnix listens on the unix domain socket at path, removing a stale
+// socket left at the path and setting the permissions of the socket to
+// mode.
+func ListenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, errors.New("ups: socket in use: " + path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// ListenAndServeUnix listens on the unix domain socket at path with the
+// permissions mode and calls Serve.
+func (s *Server) ListenAndServeUnix(path string, mode os.FileMode) error {
+	l, err := ListenUnix(path, mode)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// ServeSystemd calls Serve on each of the listeners passed by systemd
+// socket activation, returning the first error.  ServeSystemd returns an
+// error if the process was not socket activated.
+func (s *Server) ServeSystemd() error {
+	listeners, _, err := SystemdListeners()
+	if err != nil {
+		return err
+	}
+	return s.ServeListeners(listeners)
+}
+
+// ServeListeners calls Serve on each of the listeners, returning the
+// first error.
+func (s *Server) ServeListeners(listeners []net.Listener) error {
+	if len(listeners) == 0 {
+		return errors.New("ups: no listeners")
+	}
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			errs <- s.Serve(l)
+		}(l)
+	}
+	return <-errs
+}
@@ -0,0 +1,56 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ups.sock")
+	server := &Server{}
+	server.Handle("/hello", UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}))
+
+	l, err := ListenUnix(path, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("unexpected socket mode: %v %v", fi, err)
+	}
+	if _, err := ListenUnix(path, 0600); err == nil {
+		t.Errorf("expected error for socket in use")
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- server.ServeListeners([]net.Listener{l})
+	}()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Post("http://unix/hello", "application/json", bytes.NewBufferString(`{"name":"World"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusOK, resp.StatusCode)
+	}
+
+	server.Shutdown(context.Background())
+	if err := <-done; err != http.ErrServerClosed {
+		t.Errorf("expected ErrServerClosed, got: %v", err)
+	}
+}
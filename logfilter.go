@@ -0,0 +1,214 @@
+package ups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// LogLevel is the set of request and response payloads that are logged.
+type LogLevel int
+
+const (
+	LogMessages LogLevel = 1 << iota
+	LogBytes
+	LogJSON
+	LogText
+
+	LogNone LogLevel = 0
+	LogAll  LogLevel = LogMessages | LogBytes | LogJSON | LogText
+)
+
+var logLevelNames = []struct {
+	level LogLevel
+	name  string
+}{
+	{LogMessages, "messages"},
+	{LogBytes, "bytes"},
+	{LogJSON, "json"},
+	{LogText, "text"},
+}
+
+func (level LogLevel) String() string {
+	switch level {
+	case LogNone:
+		return "none"
+	case LogAll:
+		return "all"
+	}
+	var names []string
+	for _, n := range logLevelNames {
+		if level&n.level != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseLogLevel parses a comma separated list of messages, bytes, json,
+// and text, or none or all.
+func ParseLogLevel(s string) (LogLevel, error) {
+	level := LogNone
+	for _, name := range strings.Split(s, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "none", "":
+		case "all":
+			level |= LogAll
+		default:
+			found := false
+			for _, n := range logLevelNames {
+				if n.name == name {
+					level |= n.level
+					found = true
+				}
+			}
+			if !found {
+				return LogNone, errors.New("ups: invalid log level: " + name)
+			}
+		}
+	}
+	return level, nil
+}
+
+// LogFilter controls at runtime which request and response payloads are
+// logged, per route, so that payload logging can be turned on while
+// debugging without redeploying.  The routes are names chosen when the
+// Configs are created with Config, such as the patterns of the handlers.
+type LogFilter struct {
+	mu           sync.RWMutex
+	defaultLevel LogLevel
+	levels       map[string]LogLevel
+}
+
+// NewLogFilter creates a LogFilter with the level for routes that have
+// not been set.
+func NewLogFilter(defaultLevel LogLevel) *LogFilter {
+	return &LogFilter{defaultLevel: defaultLevel, levels: map[string]LogLevel{}}
+}
+
+// SetLevel sets the level of the route, or the default level if the
+// route is empty.
+func (f *LogFilter) SetLevel(route string, level LogLevel) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if route == "" {
+		f.defaultLevel = level
+	} else {
+		f.levels[route] = level
+	}
+}
+
+// ResetLevel resets the level of the route to the default level.
+func (f *LogFilter) ResetLevel(route string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.levels, route)
+}
+
+// Level returns the level of the route.
+func (f *LogFilter) Level(route string) LogLevel {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if level, ok := f.levels[route]; ok {
+		return level
+	}
+	return f.defaultLevel
+}
+
+func (f *LogFilter) enabled(route string, level LogLevel) bool {
+	return f.Level(route)&level != 0
+}
+
+// Config returns a copy of the config in which the payload logging
+// funcs are called only when enabled by the level of the route.
+func (f *LogFilter) Config(route string, config Config) Config {
+	if log := config.LogRequestMessage; log != nil {
+		config.LogRequestMessage = func(ctx context.Context, req proto.Message) {
+			if f.enabled(route, LogMessages) {
+				log(ctx, req)
+			}
+		}
+	}
+	if log := config.LogResponseMessage; log != nil {
+		config.LogResponseMessage = func(ctx context.Context, resp proto.Message) {
+			if f.enabled(route, LogMessages) {
+				log(ctx, resp)
+			}
+		}
+	}
+	config.LogRequestBytes = filterBytes(f, route, config.LogRequestBytes)
+	config.LogResponseBytes = filterBytes(f, route, config.LogResponseBytes)
+	config.LogRequestJSON = filterString(f, route, LogJSON, config.LogRequestJSON)
+	config.LogResponseJSON = filterString(f, route, LogJSON, config.LogResponseJSON)
+	config.LogRequestText = filterString(f, route, LogText, config.LogRequestText)
+	config.LogResponseText = filterString(f, route, LogText, config.LogResponseText)
+	return config
+}
+
+func filterBytes(f *LogFilter, route string, log func(context.Context, []byte)) func(context.Context, []byte) {
+	if log == nil {
+		return nil
+	}
+	return func(ctx context.Context, b []byte) {
+		if f.enabled(route, LogBytes) {
+			log(ctx, b)
+		}
+	}
+}
+
+func filterString(f *LogFilter, route string, level LogLevel, log func(context.Context, string)) func(context.Context, string) {
+	if log == nil {
+		return nil
+	}
+	return func(ctx context.Context, s string) {
+		if f.enabled(route, level) {
+			log(ctx, s)
+		}
+	}
+}
+
+// Handler returns an admin handler for the LogFilter.  GET requests list
+// the default level and the levels of the routes.  POST requests with
+// the form values route and level set the level of the route, or of the
+// default if route is empty, and with the form value reset, reset the
+// level of the route.
+func (f *LogFilter) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			route := r.FormValue("route")
+			if r.FormValue("reset") != "" {
+				f.ResetLevel(route)
+			} else if level, err := ParseLogLevel(r.FormValue("level")); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			} else {
+				f.SetLevel(route, level)
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+
+		f.mu.RLock()
+		defer f.mu.RUnlock()
+		routes := make([]string, 0, len(f.levels))
+		for route := range f.levels {
+			routes = append(routes, route)
+		}
+		sort.Strings(routes)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "default %s\n", f.defaultLevel)
+		for _, route := range routes {
+			fmt.Fprintf(w, "%s %s\n", route, f.levels[route])
+		}
+	})
+}
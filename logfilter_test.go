@@ -0,0 +1,104 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	for _, test := range []struct {
+		s     string
+		level LogLevel
+	}{
+		{"", LogNone},
+		{"none", LogNone},
+		{"all", LogAll},
+		{"json", LogJSON},
+		{"bytes, text", LogBytes | LogText},
+		{"messages,bytes,json,text", LogAll},
+	} {
+		if level, err := ParseLogLevel(test.s); err != nil {
+			t.Errorf("%q: unexpected error: %v", test.s, err)
+		} else if level != test.level {
+			t.Errorf("%q: expected: %s, got: %s", test.s, test.level, level)
+		}
+	}
+	if _, err := ParseLogLevel("verbose"); err == nil {
+		t.Errorf("expected error")
+	}
+	if s := (LogBytes | LogText).String(); s != "bytes,text" {
+		t.Errorf("unexpected String: %s", s)
+	}
+}
+
+func TestLogFilter(t *testing.T) {
+	var logged []string
+	config := DefaultConfig
+	config.LogRequestJSON = func(ctx context.Context, req string) {
+		logged = append(logged, "request "+req)
+	}
+	config.LogResponseJSON = func(ctx context.Context, resp string) {
+		logged = append(logged, "response "+resp)
+	}
+	filter := NewLogFilter(LogNone)
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, filter.Config("hello", config))
+	call := func() {
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+		r.Header.Set("Content-Type", "application/json")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	admin := filter.Handler()
+	post := func(values url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/loglevel", strings.NewReader(values.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, r)
+		return w
+	}
+
+	call()
+	if len(logged) != 0 {
+		t.Errorf("unexpected logs: %v", logged)
+	}
+
+	if w := post(url.Values{"route": {"hello"}, "level": {"json"}}); w.Code != http.StatusOK {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusOK, w.Code)
+	} else if body := w.Body.String(); body != "default none\nhello json\n" {
+		t.Errorf("unexpected body: %q", body)
+	}
+	call()
+	if len(logged) != 2 || logged[0] != `request {"name":"World"}` || logged[1] != `response {"text":"Hello, World!"}` {
+		t.Errorf("unexpected logs: %v", logged)
+	}
+
+	logged = nil
+	filter.SetLevel("hello", LogBytes)
+	call()
+	if len(logged) != 0 {
+		t.Errorf("unexpected logs: %v", logged)
+	}
+
+	if w := post(url.Values{"route": {"hello"}, "reset": {"1"}}); w.Body.String() != "default none\n" {
+		t.Errorf("unexpected body: %q", w.Body.String())
+	}
+	if w := post(url.Values{"level": {"all"}}); w.Body.String() != "default all\n" {
+		t.Errorf("unexpected body: %q", w.Body.String())
+	}
+	call()
+	if len(logged) != 2 {
+		t.Errorf("unexpected logs: %v", logged)
+	}
+
+	if w := post(url.Values{"level": {"verbose"}}); w.Code != http.StatusBadRequest {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusBadRequest, w.Code)
+	}
+}
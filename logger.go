@@ -0,0 +1,27 @@
+package ups
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+)
+
+// Logger returns the logger of the request of the context, from
+// Config.LoggerForRequest, or slog.Default() if none.
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := Value(ctx, loggerContextKey); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// logf logs with the logger of the request of the context, if any, and
+// with log.Printf otherwise.
+func logf(ctx context.Context, level slog.Level, format string, args ...interface{}) {
+	if logger, ok := Value(ctx, loggerContextKey); ok {
+		logger.Log(ctx, level, fmt.Sprintf(format, args...))
+	} else {
+		log.Printf(format, args...)
+	}
+}
@@ -0,0 +1,56 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestLoggerForRequest(t *testing.T) {
+	var buf bytes.Buffer
+	base := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	config := DefaultConfig
+	config.Route = "hello"
+	config.LogSummary = LogCanonicalLine
+	config.LoggerForRequest = func(ctx context.Context, r *http.Request) *slog.Logger {
+		requestID, _ := Value(ctx, RequestIDKey)
+		return base.With("request_id", requestID)
+	}
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		Logger(ctx).InfoContext(ctx, "handler")
+		return &testingups.HelloResponse{Text: "Hello " + req.Name}, nil
+	}, config)
+
+	r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Request-Id", "abc")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, r)
+	if resp.Code != http.StatusOK {
+		t.Errorf("unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) < 4 {
+		t.Fatalf("unexpected log: %s", buf.String())
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, "request_id=abc") {
+			t.Errorf("unexpected log line: %s", line)
+		}
+	}
+	if !strings.Contains(buf.String(), `msg="REQ JSON: {\"name\":\"World\"}"`) || !strings.Contains(buf.String(), "msg=handler") {
+		t.Errorf("unexpected log: %s", buf.String())
+	}
+}
+
+func TestLoggerDefault(t *testing.T) {
+	if Logger(context.Background()) != slog.Default() {
+		t.Errorf("expected default logger")
+	}
+}
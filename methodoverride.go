@@ -0,0 +1,43 @@
+package ups
+
+import (
+	"net/http"
+	"strings"
+)
+
+// MethodOverride returns a handler that sets the method of POST requests
+// with an X-HTTP-Method-Override header to its value before calling the
+// handler, for clients behind proxies that only allow POST, so that
+// routes of ServeMux patterns with methods, such as "DELETE /items/{id}",
+// are matched.  Only the methods, such as PUT and DELETE, can be
+// overrides, and requests with other overrides get 405 responses.
+// Overrides to GET and HEAD, which would not be handled like POST, get
+// 400 responses.
+//
+// ups handlers accept requests with overridden methods as they do POST
+// requests.
+func MethodOverride(methods []string, handler http.Handler) http.Handler {
+	allowed := map[string]bool{}
+	for _, method := range methods {
+		allowed[strings.ToUpper(method)] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		override := r.Header.Get("X-HTTP-Method-Override")
+		if override == "" || r.Method != http.MethodPost {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		override = strings.ToUpper(override)
+		if override == http.MethodGet || override == http.MethodHead {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		if !allowed[override] {
+			http.Error(w, "", http.StatusMethodNotAllowed)
+			return
+		}
+		r = r.WithContext(WithValue(r.Context(), methodOverrideContextKey, r.Method))
+		r.Method = override
+		handler.ServeHTTP(w, r)
+	})
+}
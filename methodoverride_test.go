@@ -0,0 +1,48 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestMethodOverride(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("DELETE /hello", UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Goodbye " + req.Name}
+	}))
+	mux.Handle("POST /hello", UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello " + req.Name}
+	}))
+	handler := MethodOverride([]string{"put", "DELETE", "HEAD"}, mux)
+
+	for _, test := range []struct {
+		method     string
+		override   string
+		statusCode int
+		expected   string
+	}{
+		{http.MethodPost, "", http.StatusOK, `{"text":"Hello World"}`},
+		{http.MethodPost, "delete", http.StatusOK, `{"text":"Goodbye World"}`},
+		{http.MethodPost, "PATCH", http.StatusMethodNotAllowed, "\n"},
+		{http.MethodPost, "head", http.StatusBadRequest, "\n"},
+		{http.MethodPost, "GET", http.StatusBadRequest, "\n"},
+		{http.MethodPost, "PUT", http.StatusMethodNotAllowed, "Method Not Allowed\n"},
+		{http.MethodDelete, "", http.StatusMethodNotAllowed, "\n"},
+		{http.MethodGet, "DELETE", http.StatusMethodNotAllowed, "Method Not Allowed\n"},
+	} {
+		r := httptest.NewRequest(test.method, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+		r.Header.Set("Content-Type", "application/json")
+		if test.override != "" {
+			r.Header.Set("X-HTTP-Method-Override", test.override)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, r)
+		if resp.Code != test.statusCode || resp.Body.String() != test.expected {
+			t.Errorf("%s %s: unexpected response: %d %q", test.method, test.override, resp.Code, resp.Body.String())
+		}
+	}
+}
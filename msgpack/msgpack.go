@@ -0,0 +1,53 @@
+// Package msgpack provides a ups.Codec for MessagePack, mapping messages to
+// MessagePack maps keyed by the JSON names of the fields.
+package msgpack
+
+import (
+	"bytes"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/internal/protomap"
+)
+
+// ContentType is the Content-Type for which Register registers the Codec.
+const ContentType = "application/msgpack"
+
+// Codec is a ups.Codec for MessagePack.
+type Codec struct{}
+
+// Marshal encodes msg as a MessagePack map keyed by the JSON names of its
+// populated fields.
+func (Codec) Marshal(msg proto.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetSortMapKeys(true)
+	if err := enc.Encode(protomap.ToMap(proto.MessageReflect(msg))); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes a MessagePack map keyed by the JSON names or proto
+// names of the fields into msg.
+func (Codec) Unmarshal(data []byte, msg proto.Message) error {
+	var v interface{}
+	if err := msgpack.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return protomap.FromMap(v, proto.MessageReflect(msg))
+}
+
+// Register returns a copy of config with the Codec registered for
+// application/msgpack.
+func Register(config ups.Config) ups.Config {
+	codecs := map[string]ups.Codec{}
+	for contentType, codec := range config.Codecs {
+		codecs[contentType] = codec
+	}
+	codecs[ContentType] = Codec{}
+	config.Codecs = codecs
+	return config
+}
@@ -0,0 +1,142 @@
+package ups
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// OneofDispatcher routes requests to handler funcs by which member of a
+// oneof of the request message is set, for APIs with a single request
+// message wrapping many commands.
+type OneofDispatcher struct {
+	reqType  reflect.Type
+	respType reflect.Type
+	oneof    protoreflect.OneofDescriptor
+	cases    map[protoreflect.FieldNumber]oneofCase
+}
+
+type oneofCase struct {
+	handler     reflect.Value
+	withContext bool
+	argType     reflect.Type
+}
+
+type oneofError string
+
+func (err oneofError) Error() string {
+	return string(err)
+}
+
+func (oneofError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+const errOneofNotHandled = oneofError("ups: oneof case not handled")
+
+// NewOneofDispatcher creates a OneofDispatcher for the named oneof of
+// the type of the request message.
+//
+// NewOneofDispatcher will panic if the message has no such oneof.
+func NewOneofDispatcher(req proto.Message, oneof string) *OneofDispatcher {
+	od := proto.MessageReflect(req).Descriptor().Oneofs().ByName(protoreflect.Name(oneof))
+	if od == nil {
+		panic("ups: unknown oneof: " + oneof)
+	}
+	return &OneofDispatcher{
+		reqType: reflect.TypeOf(req),
+		oneof:   od,
+		cases:   map[protoreflect.FieldNumber]oneofCase{},
+	}
+}
+
+// Case adds the handler func for the named member of the oneof.
+//
+// The func must take the value of the member, or a context.Context and
+// the value of the member, and return a proto.Message or a
+// (proto.Message, error), as with UPS.  The value is the message for
+// message members, and the Go type of the field otherwise.  All the
+// funcs must return the same message type.
+//
+// Case will panic if the func is not valid, if the oneof has no such
+// member, or if the member already has a func.
+func (d *OneofDispatcher) Case(field string, handler interface{}) *OneofDispatcher {
+	fd := d.oneof.Fields().ByName(protoreflect.Name(field))
+	if fd == nil {
+		panic("ups: unknown oneof field: " + field)
+	}
+	if _, ok := d.cases[fd.Number()]; ok {
+		panic("ups: duplicate oneof case: " + field)
+	}
+	h := reflect.ValueOf(handler)
+	ty := h.Type()
+	if ty.Kind() != reflect.Func || ty.NumOut() < 1 || ty.NumOut() > 2 || !ty.Out(0).Implements(messageType) || (ty.NumOut() == 2 && ty.Out(1) != errorType) {
+		panic("ups: invalid oneof handler")
+	}
+	c := oneofCase{handler: h}
+	switch {
+	case ty.NumIn() == 1:
+	case ty.NumIn() == 2 && ty.In(0) == contextType:
+		c.withContext = true
+	default:
+		panic("ups: invalid oneof handler parameter types")
+	}
+	c.argType = ty.In(ty.NumIn() - 1)
+	if fd.Message() != nil {
+		if !c.argType.Implements(messageType) || proto.MessageReflect(reflect.New(c.argType.Elem()).Interface().(proto.Message)).Descriptor().FullName() != fd.Message().FullName() {
+			panic("ups: oneof handler parameter type does not match " + field)
+		}
+	} else if !reflect.TypeOf(fd.Default().Interface()).ConvertibleTo(c.argType) {
+		panic("ups: oneof handler parameter type does not match " + field)
+	}
+	if d.respType == nil {
+		d.respType = ty.Out(0)
+	} else if d.respType != ty.Out(0) {
+		panic("ups: oneof handler response types do not match")
+	}
+	d.cases[fd.Number()] = c
+	return d
+}
+
+// Handler returns a handler func, taking a context.Context and the
+// request message and returning the response message and an error, that
+// calls the func of the member of the oneof that is set.  Requests
+// without a member set, or for which there is no func, get 400
+// responses.
+//
+// Handler will panic if there are no cases.
+func (d *OneofDispatcher) Handler() interface{} {
+	if d.respType == nil {
+		panic("ups: no oneof cases")
+	}
+	fnType := reflect.FuncOf([]reflect.Type{contextType, d.reqType}, []reflect.Type{d.respType, errorType}, false)
+	return reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		m := proto.MessageReflect(args[1].Interface().(proto.Message))
+		fd := m.WhichOneof(d.oneof)
+		var c oneofCase
+		ok := false
+		if fd != nil {
+			c, ok = d.cases[fd.Number()]
+		}
+		if !ok {
+			return []reflect.Value{reflect.Zero(d.respType), reflect.ValueOf(error(errOneofNotHandled))}
+		}
+		var arg reflect.Value
+		if v := m.Get(fd); fd.Message() != nil {
+			arg = reflect.ValueOf(proto.MessageV1(v.Message().Interface()))
+		} else {
+			arg = reflect.ValueOf(v.Interface()).Convert(c.argType)
+		}
+		in := []reflect.Value{arg}
+		if c.withContext {
+			in = []reflect.Value{args[0], arg}
+		}
+		results := c.handler.Call(in)
+		if len(results) > 1 {
+			return results
+		}
+		return []reflect.Value{results[0], reflect.Zero(errorType)}
+	}).Interface()
+}
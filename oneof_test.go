@@ -0,0 +1,77 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestOneofDispatcher(t *testing.T) {
+	handler := UPS(NewOneofDispatcher(&structpb.Value{}, "kind").
+		Case("string_value", func(s string) *testingups.HelloResponse {
+			return &testingups.HelloResponse{Text: "string " + s}
+		}).
+		Case("number_value", func(ctx context.Context, n float64) (*testingups.HelloResponse, error) {
+			if n < 0 {
+				return nil, testError(http.StatusTeapot)
+			}
+			return &testingups.HelloResponse{Text: "number " + strconv.FormatFloat(n, 'g', -1, 64)}, nil
+		}).
+		Case("list_value", func(list *structpb.ListValue) *testingups.HelloResponse {
+			return &testingups.HelloResponse{Text: "list " + strconv.Itoa(len(list.Values))}
+		}).
+		Handler())
+
+	for _, test := range []struct {
+		body       string
+		statusCode int
+		expected   string
+	}{
+		{`"World"`, http.StatusOK, `{"text":"string World"}`},
+		{`2`, http.StatusOK, `{"text":"number 2"}`},
+		{`-2`, http.StatusTeapot, "\n"},
+		{`[1,2,3]`, http.StatusOK, `{"text":"list 3"}`},
+		{`true`, http.StatusBadRequest, "\n"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/command", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != test.statusCode || resp.Body.String() != test.expected {
+			t.Errorf("%s: unexpected response %d %s", test.body, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func TestOneofDispatcherInvalid(t *testing.T) {
+	for name, f := range map[string]func(){
+		"oneof": func() { NewOneofDispatcher(&structpb.Value{}, "type") },
+		"field": func() {
+			NewOneofDispatcher(&structpb.Value{}, "kind").Case("int_value", func(int64) *testingups.HelloResponse { return nil })
+		},
+		"type": func() {
+			NewOneofDispatcher(&structpb.Value{}, "kind").Case("string_value", func(bool) *testingups.HelloResponse { return nil })
+		},
+		"response": func() {
+			NewOneofDispatcher(&structpb.Value{}, "kind").
+				Case("string_value", func(string) *testingups.HelloResponse { return nil }).
+				Case("bool_value", func(bool) *testingups.HelloRequest { return nil })
+		},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
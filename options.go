@@ -0,0 +1,149 @@
+package ups
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Discovery selects how OPTIONS requests are answered.
+type Discovery int
+
+const (
+	// NoDiscovery handles OPTIONS requests like other requests, which
+	// get 405 responses.
+	NoDiscovery Discovery = iota
+
+	// DiscoverMethods answers OPTIONS requests with 204 responses with
+	// the Allow header and the Accept-Post header listing the accepted
+	// Content-Types.
+	DiscoverMethods
+
+	// DiscoverSchemas also responds with a JSON description of the
+	// request and response messages, with their fields and the messages
+	// and enums they refer to.
+	DiscoverSchemas
+)
+
+// optionsSchema is the JSON description of the messages of a route.
+type optionsSchema struct {
+	Request  string                    `json:"request,omitempty"`
+	Response string                    `json:"response,omitempty"`
+	Messages map[string][]optionsField `json:"messages"`
+	Enums    map[string][]string       `json:"enums,omitempty"`
+	seen     map[protoreflect.FullName]bool
+}
+
+type optionsField struct {
+	Name     string `json:"name"`
+	JSONName string `json:"jsonName"`
+	Number   int    `json:"number"`
+	Type     string `json:"type"`
+	TypeName string `json:"typeName,omitempty"`
+	Repeated bool   `json:"repeated,omitempty"`
+	Map      bool   `json:"map,omitempty"`
+	Oneof    string `json:"oneof,omitempty"`
+}
+
+// serveOptions answers an OPTIONS request.
+func (ups *upsHandler) serveOptions(w http.ResponseWriter) {
+	allow := "OPTIONS, POST"
+	if ups.config.AllowGET {
+		allow = "GET, HEAD, OPTIONS, POST"
+	}
+	w.Header().Set("Allow", allow)
+	w.Header().Set("Accept-Post", strings.Join(ups.acceptedContentTypes(), ", "))
+	if ups.config.Discovery != DiscoverSchemas {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	schema := &optionsSchema{
+		Messages: map[string][]optionsField{},
+		Enums:    map[string][]string{},
+		seen:     map[protoreflect.FullName]bool{},
+	}
+	if ups.requestDescriptor != nil {
+		schema.Request = string(ups.requestDescriptor.FullName())
+		schema.addMessage(ups.requestDescriptor)
+	}
+	if ups.responseDescriptor != nil {
+		schema.Response = string(ups.responseDescriptor.FullName())
+		schema.addMessage(ups.responseDescriptor)
+	}
+	b, err := json.Marshal(schema)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// acceptedContentTypes returns the request Content-Types of the handler.
+func (ups *upsHandler) acceptedContentTypes() []string {
+	contentTypes := []string{"application/x-protobuf", "application/octet-stream", "text/x-protobuf"}
+	if ups.config.JSONMarshaler != nil {
+		contentTypes = append(contentTypes, "application/json", "application/x-www-form-urlencoded")
+	}
+	if ups.config.Streams {
+		contentTypes = append(contentTypes, "application/x-protobuf-stream")
+		if ups.config.JSONMarshaler != nil {
+			contentTypes = append(contentTypes, "application/x-ndjson")
+		}
+	}
+	codecs := make([]string, 0, len(ups.config.Codecs))
+	for contentType := range ups.config.Codecs {
+		codecs = append(codecs, contentType)
+	}
+	sort.Strings(codecs)
+	return append(contentTypes, codecs...)
+}
+
+func (s *optionsSchema) addMessage(md protoreflect.MessageDescriptor) {
+	if s.seen[md.FullName()] {
+		return
+	}
+	s.seen[md.FullName()] = true
+	fields := []optionsField{}
+	for i := 0; i < md.Fields().Len(); i++ {
+		fd := md.Fields().Get(i)
+		field := optionsField{
+			Name:     string(fd.Name()),
+			JSONName: fd.JSONName(),
+			Number:   int(fd.Number()),
+			Type:     fd.Kind().String(),
+			Repeated: fd.IsList(),
+			Map:      fd.IsMap(),
+		}
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			field.Oneof = string(oneof.Name())
+		}
+		if fd.IsMap() {
+			fd = fd.MapValue()
+		}
+		switch fd.Kind() {
+		case protoreflect.MessageKind, protoreflect.GroupKind:
+			field.TypeName = string(fd.Message().FullName())
+			s.addMessage(fd.Message())
+		case protoreflect.EnumKind:
+			field.TypeName = string(fd.Enum().FullName())
+			s.addEnum(fd.Enum())
+		}
+		fields = append(fields, field)
+	}
+	s.Messages[string(md.FullName())] = fields
+}
+
+func (s *optionsSchema) addEnum(ed protoreflect.EnumDescriptor) {
+	if _, ok := s.Enums[string(ed.FullName())]; ok {
+		return
+	}
+	values := make([]string, ed.Values().Len())
+	for i := range values {
+		values[i] = string(ed.Values().Get(i).Name())
+	}
+	s.Enums[string(ed.FullName())] = values
+}
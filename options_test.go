@@ -0,0 +1,63 @@
+package ups
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestDiscovery(t *testing.T) {
+	for _, test := range []struct {
+		discovery  Discovery
+		allowGET   bool
+		statusCode int
+		allow      string
+	}{
+		{NoDiscovery, false, http.StatusMethodNotAllowed, ""},
+		{DiscoverMethods, false, http.StatusNoContent, "OPTIONS, POST"},
+		{DiscoverMethods, true, http.StatusNoContent, "GET, HEAD, OPTIONS, POST"},
+		{DiscoverSchemas, false, http.StatusOK, "OPTIONS, POST"},
+	} {
+		config := DefaultConfig
+		config.Discovery = test.discovery
+		config.AllowGET = test.allowGET
+		handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+			return &testingups.HelloResponse{Text: "Hello " + req.Name}
+		}, config)
+		r := httptest.NewRequest(http.MethodOptions, "/hello", nil)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, r)
+		if resp.Code != test.statusCode || resp.Header().Get("Allow") != test.allow {
+			t.Errorf("%d: unexpected response: %d %s", test.discovery, resp.Code, resp.Header().Get("Allow"))
+		}
+		if test.discovery == NoDiscovery {
+			continue
+		}
+		if accept := resp.Header().Get("Accept-Post"); accept != "application/x-protobuf, application/octet-stream, text/x-protobuf, application/json, application/x-www-form-urlencoded" {
+			t.Errorf("%d: unexpected Accept-Post: %s", test.discovery, accept)
+		}
+		if test.discovery != DiscoverSchemas {
+			if resp.Body.Len() != 0 {
+				t.Errorf("%d: unexpected body: %s", test.discovery, resp.Body.String())
+			}
+			continue
+		}
+		var schema struct {
+			Request  string                    `json:"request"`
+			Response string                    `json:"response"`
+			Messages map[string][]optionsField `json:"messages"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &schema); err != nil {
+			t.Fatalf("unexpected body: %s: %v", resp.Body.String(), err)
+		}
+		if schema.Request != "HelloRequest" || schema.Response != "HelloResponse" {
+			t.Errorf("unexpected schema: %s", resp.Body.String())
+		}
+		if fields := schema.Messages["HelloRequest"]; len(fields) == 0 || fields[0] != (optionsField{Name: "name", JSONName: "name", Number: 1, Type: "string"}) {
+			t.Errorf("unexpected request fields: %+v", fields)
+		}
+	}
+}
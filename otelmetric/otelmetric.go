@@ -0,0 +1,97 @@
+// Package otelmetric records request metrics from the summaries of ups
+// requests with OpenTelemetry instruments, which can be exported with
+// OTLP.
+//
+// The measurements are recorded with the request context, so that when
+// the request has a sampled span, such as one started by tracing
+// middleware, the SDK can attach exemplars linking the latency histogram
+// buckets to the trace.
+package otelmetric
+
+import (
+	"context"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/qpliu/ups"
+)
+
+// Metrics records the metrics of requests:
+//
+//	http.server.request.duration    histogram, in seconds
+//	http.server.request.body.size   histogram, in bytes
+//	http.server.response.body.size  histogram, in bytes
+//	ups.server.requests             counter
+//
+// The metrics have the attributes http.route, http.request.method, and
+// http.response.status_code, error.type for requests with errors, and
+// ups.tenant for requests with tenants.
+type Metrics struct {
+	duration     metric.Float64Histogram
+	requestSize  metric.Int64Histogram
+	responseSize metric.Int64Histogram
+	requests     metric.Int64Counter
+}
+
+// New creates the instruments of the Metrics with the meter.
+func New(meter metric.Meter) (*Metrics, error) {
+	m := &Metrics{}
+	var err error
+	if m.duration, err = meter.Float64Histogram("http.server.request.duration",
+		metric.WithDescription("Duration of HTTP server requests."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10)); err != nil {
+		return nil, err
+	}
+	if m.requestSize, err = meter.Int64Histogram("http.server.request.body.size",
+		metric.WithDescription("Size of HTTP server request bodies."),
+		metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+	if m.responseSize, err = meter.Int64Histogram("http.server.response.body.size",
+		metric.WithDescription("Size of HTTP server response bodies."),
+		metric.WithUnit("By")); err != nil {
+		return nil, err
+	}
+	if m.requests, err = meter.Int64Counter("ups.server.requests",
+		metric.WithDescription("Number of requests."),
+		metric.WithUnit("{request}")); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Config returns a copy of config with LogSummary set to record the
+// metrics of each request, followed by the existing LogSummary, if any.
+func (m *Metrics) Config(config ups.Config) ups.Config {
+	logSummary := config.LogSummary
+	config.LogSummary = func(ctx context.Context, s *ups.RequestSummary) {
+		m.LogSummary(ctx, s)
+		if logSummary != nil {
+			logSummary(ctx, s)
+		}
+	}
+	return config
+}
+
+// LogSummary records the metrics of the request.
+func (m *Metrics) LogSummary(ctx context.Context, s *ups.RequestSummary) {
+	attrs := []attribute.KeyValue{
+		attribute.String("http.route", s.Route),
+		attribute.String("http.request.method", s.Method),
+		attribute.Int("http.response.status_code", s.StatusCode),
+	}
+	if s.StatusCode >= 500 {
+		attrs = append(attrs, attribute.String("error.type", strconv.Itoa(s.StatusCode)))
+	}
+	if s.Tenant != "" {
+		attrs = append(attrs, attribute.String("ups.tenant", s.Tenant))
+	}
+	opt := metric.WithAttributeSet(attribute.NewSet(attrs...))
+	m.duration.Record(ctx, s.Duration.Seconds(), opt)
+	m.requestSize.Record(ctx, int64(s.RequestSize), opt)
+	m.responseSize.Record(ctx, int64(s.ResponseSize), opt)
+	m.requests.Add(ctx, 1, opt)
+}
@@ -0,0 +1,83 @@
+package otelmetric
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	m, err := New(provider.Meter("ups"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ups.DefaultConfig
+	config.Route = "hello"
+	handler := ups.UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, m.Config(config))
+
+	traceID := trace.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		TraceFlags: trace.FlagsSampled,
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`)).WithContext(ctx)
+	r.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	if len(rm.ScopeMetrics) != 1 {
+		t.Fatalf("expected 1 scope, got: %d", len(rm.ScopeMetrics))
+	}
+	found := map[string]bool{}
+	for _, metric := range rm.ScopeMetrics[0].Metrics {
+		found[metric.Name] = true
+		switch data := metric.Data.(type) {
+		case metricdata.Histogram[float64]:
+			if len(data.DataPoints) != 1 || data.DataPoints[0].Count != 1 {
+				t.Errorf("%s: unexpected data points: %+v", metric.Name, data.DataPoints)
+				continue
+			}
+			dp := data.DataPoints[0]
+			if route, _ := dp.Attributes.Value("http.route"); route.AsString() != "hello" {
+				t.Errorf("%s: unexpected route: %v", metric.Name, route)
+			}
+			if len(dp.Exemplars) != 1 || !bytes.Equal(dp.Exemplars[0].TraceID, traceID[:]) {
+				t.Errorf("%s: unexpected exemplars: %+v", metric.Name, dp.Exemplars)
+			}
+		case metricdata.Histogram[int64]:
+			if len(data.DataPoints) != 1 || data.DataPoints[0].Count != 1 {
+				t.Errorf("%s: unexpected data points: %+v", metric.Name, data.DataPoints)
+			} else if metric.Name == "http.server.request.body.size" && data.DataPoints[0].Sum != 16 {
+				t.Errorf("%s: unexpected sum: %d", metric.Name, data.DataPoints[0].Sum)
+			}
+		case metricdata.Sum[int64]:
+			if len(data.DataPoints) != 1 || data.DataPoints[0].Value != 1 {
+				t.Errorf("%s: unexpected data points: %+v", metric.Name, data.DataPoints)
+			}
+		default:
+			t.Errorf("%s: unexpected data: %T", metric.Name, data)
+		}
+	}
+	for _, name := range []string{"http.server.request.duration", "http.server.request.body.size", "http.server.response.body.size", "ups.server.requests"} {
+		if !found[name] {
+			t.Errorf("missing metric: %s", name)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package ups
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+
+	"github.com/golang/protobuf/proto"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Paginator reads the page_size and page_token fields of list requests
+// and sets the next_page_token field of their responses, as described by
+// https://google.aip.dev/158.
+//
+// Page tokens are opaque to clients, and are signed with the Key, so
+// that handlers can trust the cursors, such as offsets or the keys of the
+// last items of pages, that they put in them.  Tokens are only valid
+// with the same request, other than the page_size, as the request of
+// the page that returned them.
+type Paginator struct {
+	// DefaultPageSize is the page size of requests without page sizes.
+	DefaultPageSize int
+
+	// MaxPageSize, if not zero, is the maximum page size, to which
+	// larger page sizes are reduced.
+	MaxPageSize int
+
+	key []byte
+}
+
+// Page is the page requested by a list request.
+type Page struct {
+	Size int
+
+	// Cursor is the cursor of the page token, or nil for the first
+	// page.
+	Cursor []byte
+}
+
+// Offset returns the offset of a Cursor created with OffsetCursor, or 0
+// for the first page.
+func (page Page) Offset() int {
+	if len(page.Cursor) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(page.Cursor))
+}
+
+// OffsetCursor returns a cursor for the offset of the next page.
+func OffsetCursor(offset int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(offset))
+}
+
+type paginationError string
+
+func (err paginationError) Error() string {
+	return string(err)
+}
+
+func (paginationError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+const (
+	errInvalidPageToken = paginationError("ups: invalid page_token")
+	errInvalidPageSize  = paginationError("ups: invalid page_size")
+)
+
+// pageTokenMACSize is the size of the truncated HMAC of page tokens.
+const pageTokenMACSize = 16
+
+// NewPaginator creates a Paginator signing page tokens with the key,
+// with a DefaultPageSize of 50 and a MaxPageSize of 1000.
+func NewPaginator(key []byte) *Paginator {
+	return &Paginator{DefaultPageSize: 50, MaxPageSize: 1000, key: key}
+}
+
+// Page returns the page requested by req.  Requests with negative page
+// sizes or invalid page tokens get errors that implement StatusCoder
+// with 400 statuses, so that handlers can return them.
+func (p *Paginator) Page(req proto.Message) (Page, error) {
+	m := proto.MessageReflect(req)
+	sizeField, tokenField, err := pageFields(m.Descriptor())
+	if err != nil {
+		return Page{}, err
+	}
+	page := Page{Size: int(m.Get(sizeField).Int())}
+	if page.Size < 0 {
+		return Page{}, errInvalidPageSize
+	}
+	if page.Size == 0 {
+		page.Size = p.DefaultPageSize
+	}
+	if p.MaxPageSize > 0 && page.Size > p.MaxPageSize {
+		page.Size = p.MaxPageSize
+	}
+	token := m.Get(tokenField).String()
+	if token == "" {
+		return page, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) < pageTokenMACSize {
+		return Page{}, errInvalidPageToken
+	}
+	cursor, mac := b[:len(b)-pageTokenMACSize], b[len(b)-pageTokenMACSize:]
+	expected, err := p.mac(req, cursor)
+	if err != nil {
+		return Page{}, err
+	}
+	if !hmac.Equal(mac, expected) {
+		return Page{}, errInvalidPageToken
+	}
+	page.Cursor = cursor
+	return page, nil
+}
+
+// SetNextPage sets the next_page_token field of resp to a token for the
+// cursor of the page after the page of req, or clears it if the cursor
+// is nil, for the last page.
+func (p *Paginator) SetNextPage(req, resp proto.Message, cursor []byte) error {
+	m := proto.MessageReflect(resp)
+	field := m.Descriptor().Fields().ByName("next_page_token")
+	if field == nil || field.Kind() != protoreflect.StringKind || field.Cardinality() == protoreflect.Repeated {
+		return errors.New("ups: no next_page_token field in " + string(m.Descriptor().FullName()))
+	}
+	if cursor == nil {
+		m.Clear(field)
+		return nil
+	}
+	mac, err := p.mac(req, cursor)
+	if err != nil {
+		return err
+	}
+	token := append(append([]byte{}, cursor...), mac...)
+	m.Set(field, protoreflect.ValueOfString(base64.RawURLEncoding.EncodeToString(token)))
+	return nil
+}
+
+// mac returns the truncated HMAC of the cursor and the request, other
+// than its page_size and page_token.
+func (p *Paginator) mac(req proto.Message, cursor []byte) ([]byte, error) {
+	m := proto.MessageReflect(proto.Clone(req))
+	sizeField, tokenField, err := pageFields(m.Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	m.Clear(sizeField)
+	m.Clear(tokenField)
+	b, err := protov2.MarshalOptions{Deterministic: true}.Marshal(m.Interface())
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	h := hmac.New(sha256.New, p.key)
+	h.Write(sum[:])
+	h.Write(cursor)
+	return h.Sum(nil)[:pageTokenMACSize], nil
+}
+
+func pageFields(md protoreflect.MessageDescriptor) (protoreflect.FieldDescriptor, protoreflect.FieldDescriptor, error) {
+	fields := md.Fields()
+	sizeField := fields.ByName("page_size")
+	tokenField := fields.ByName("page_token")
+	if sizeField == nil || sizeField.Kind() != protoreflect.Int32Kind || sizeField.Cardinality() == protoreflect.Repeated {
+		return nil, nil, errors.New("ups: no page_size field in " + string(md.FullName()))
+	}
+	if tokenField == nil || tokenField.Kind() != protoreflect.StringKind || tokenField.Cardinality() == protoreflect.Repeated {
+		return nil, nil, errors.New("ups: no page_token field in " + string(md.FullName()))
+	}
+	return sizeField, tokenField, nil
+}
@@ -0,0 +1,104 @@
+package ups
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func paginationMessages(t *testing.T) (protoreflect.MessageDescriptor, protoreflect.MessageDescriptor) {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: typ.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()}
+	}
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("pagination.proto"),
+		Package: proto.String("pagination"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("ListRequest"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("parent", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("page_size", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+				field("page_token", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			},
+		}, {
+			Name: proto.String("ListResponse"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("next_page_token", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd.Messages().ByName("ListRequest"), fd.Messages().ByName("ListResponse")
+}
+
+func TestPaginator(t *testing.T) {
+	reqDesc, respDesc := paginationMessages(t)
+	set := func(m *dynamicpb.Message, name string, v interface{}) {
+		m.Set(m.Descriptor().Fields().ByName(protoreflect.Name(name)), protoreflect.ValueOf(v))
+	}
+	get := func(m *dynamicpb.Message, name string) string {
+		return m.Get(m.Descriptor().Fields().ByName(protoreflect.Name(name))).String()
+	}
+	p := NewPaginator([]byte("secret"))
+	p.MaxPageSize = 100
+
+	req := dynamicpb.NewMessage(reqDesc)
+	set(req, "parent", "shelves/1")
+	if page, err := p.Page(req); err != nil || page.Size != 50 || page.Cursor != nil || page.Offset() != 0 {
+		t.Errorf("unexpected first page %v %v", page, err)
+	}
+	set(req, "page_size", int32(500))
+	if page, err := p.Page(req); err != nil || page.Size != 100 {
+		t.Errorf("unexpected page size %v %v", page, err)
+	}
+
+	resp := dynamicpb.NewMessage(respDesc)
+	if err := p.SetNextPage(req, resp, OffsetCursor(100)); err != nil {
+		t.Fatal(err)
+	}
+	token := get(resp, "next_page_token")
+	if token == "" {
+		t.Fatal("expected next_page_token")
+	}
+
+	next := dynamicpb.NewMessage(reqDesc)
+	set(next, "parent", "shelves/1")
+	set(next, "page_size", int32(10))
+	set(next, "page_token", token)
+	if page, err := p.Page(next); err != nil || page.Size != 10 || page.Offset() != 100 {
+		t.Errorf("unexpected next page %v %v", page, err)
+	}
+
+	// Tokens are bound to the request and to the key.
+	set(next, "parent", "shelves/2")
+	if _, err := p.Page(next); err != errInvalidPageToken {
+		t.Errorf("expected invalid page token, got %v", err)
+	}
+	set(next, "parent", "shelves/1")
+	if _, err := NewPaginator([]byte("other")).Page(next); err != errInvalidPageToken {
+		t.Errorf("expected invalid page token, got %v", err)
+	}
+	set(next, "page_token", "invalid")
+	if _, err := p.Page(next); err == nil || err.(StatusCoder).StatusCode() != 400 {
+		t.Errorf("expected 400 error, got %v", err)
+	}
+	set(next, "page_token", "")
+	set(next, "page_size", int32(-1))
+	if _, err := p.Page(next); err != errInvalidPageSize {
+		t.Errorf("expected invalid page size, got %v", err)
+	}
+
+	if err := p.SetNextPage(req, resp, nil); err != nil || get(resp, "next_page_token") != "" {
+		t.Errorf("expected cleared next_page_token, got %v", err)
+	}
+	if _, err := p.Page(resp); err == nil {
+		t.Errorf("expected error for message without page fields")
+	}
+}
@@ -0,0 +1,72 @@
+package ups
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// maxPanicRequestSize is the largest decoded request included in
+// PanicInfo.
+const maxPanicRequestSize = 4096
+
+// PanicInfo describes a handler panic, for the LogPanic of Configs with
+// PanicDump.
+type PanicInfo struct {
+	// RequestID is the value of the X-Request-Id request header.
+	RequestID string
+
+	// Request is the text format of the decoded request, truncated to
+	// 4KiB, if the handler panicked.  It is empty if the panic occurred
+	// before the handler was called.
+	Request string
+
+	// Goroutines is the dump of the stacks of all goroutines, truncated
+	// to the PanicDump of the Config.
+	Goroutines []byte
+}
+
+// PanicDetails returns the PanicInfo of the panic being logged, for
+// LogPanic.
+func PanicDetails(ctx context.Context) (*PanicInfo, bool) {
+	info, ok := Value(ctx, panicContextKey)
+	return info, ok
+}
+
+// panicRequest returns the truncated text format of the request.
+func panicRequest(msg proto.Message) string {
+	text := strings.TrimSpace(proto.CompactTextString(msg))
+	if len(text) > maxPanicRequestSize {
+		text = text[:maxPanicRequestSize]
+	}
+	return text
+}
+
+func newPanicInfo(requestID, request string, dumpSize int) *PanicInfo {
+	buf := make([]byte, dumpSize)
+	return &PanicInfo{
+		RequestID:  requestID,
+		Request:    request,
+		Goroutines: buf[:runtime.Stack(buf, true)],
+	}
+}
+
+// panicErrorBody returns the JSON body of the response to a panic for
+// Configs with DebugPanics.
+func panicErrorBody(err interface{}, stack []byte) []byte {
+	body := struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+		Stack   string `json:"stack"`
+	}{
+		Error:   "panic",
+		Message: fmt.Sprint(err),
+		Stack:   string(stack),
+	}
+	b, _ := json.Marshal(body)
+	return b
+}
@@ -0,0 +1,86 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestPanicDump(t *testing.T) {
+	var infos []*PanicInfo
+	config := DefaultConfig
+	config.PanicDump = 1024
+	config.LogPanic = func(ctx context.Context, err interface{}) {
+		info, ok := PanicDetails(ctx)
+		if !ok {
+			t.Errorf("missing PanicInfo for %v", err)
+		}
+		infos = append(infos, info)
+	}
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		panic("oops")
+	}, config)
+	r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Request-Id", "abc")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, r)
+
+	if resp.Code != http.StatusInternalServerError {
+		t.Errorf("unexpected status: %d", resp.Code)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("expected 1 panic, got: %d", len(infos))
+	}
+	info := infos[0]
+	if info.RequestID != "abc" || info.Request != `name:"World"` {
+		t.Errorf("unexpected PanicInfo: %+v", info)
+	}
+	if len(info.Goroutines) == 0 || len(info.Goroutines) > 1024 || !strings.HasPrefix(string(info.Goroutines), "goroutine ") {
+		t.Errorf("unexpected goroutine dump: %q", info.Goroutines)
+	}
+}
+
+func TestDebugPanics(t *testing.T) {
+	for _, debugPanics := range []bool{false, true} {
+		config := DefaultConfig
+		config.LogPanic = nil
+		config.DebugPanics = debugPanics
+		handler := UPSWithConfig(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+			panic("oops")
+		}, config)
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+		r.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, r)
+		if resp.Code != http.StatusInternalServerError {
+			t.Errorf("%t: unexpected status: %d", debugPanics, resp.Code)
+		}
+		if !debugPanics {
+			if resp.Body.String() != "\n" {
+				t.Errorf("unexpected body: %s", resp.Body.String())
+			}
+			continue
+		}
+		var body struct {
+			Error   string `json:"error"`
+			Message string `json:"message"`
+			Stack   string `json:"stack"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("unexpected body: %s: %v", resp.Body.String(), err)
+		}
+		if body.Error != "panic" || body.Message != "oops" || !strings.HasPrefix(body.Stack, "goroutine ") {
+			t.Errorf("unexpected body: %+v", body)
+		}
+		if resp.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected Content-Type: %s", resp.Header().Get("Content-Type"))
+		}
+	}
+}
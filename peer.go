@@ -0,0 +1,102 @@
+package ups
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// PeerIdentity is the identity of a client from its verified TLS client
+// certificate.
+type PeerIdentity struct {
+	Subject        pkix.Name
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+
+	// SPIFFEID is the spiffe:// URI SAN of the certificate, if any.
+	SPIFFEID string
+
+	// Chain is the verified certificate chain, starting with the client
+	// certificate.
+	Chain []*x509.Certificate
+}
+
+func peerIdentity(r *http.Request) *PeerIdentity {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	chain := r.TLS.VerifiedChains[0]
+	cert := chain[0]
+	peer := &PeerIdentity{
+		Subject:        cert.Subject,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		IPAddresses:    cert.IPAddresses,
+		URIs:           cert.URIs,
+		Chain:          chain,
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			peer.SPIFFEID = uri.String()
+			break
+		}
+	}
+	return peer
+}
+
+// Peer returns the identity from the verified TLS client certificate of
+// the request of the context.
+func Peer(ctx context.Context) (*PeerIdentity, bool) {
+	peer, ok := Value(ctx, peerContextKey)
+	return peer, ok
+}
+
+// AllowSPIFFEIDs returns an AuthorizePeer func that allows peers with
+// the SPIFFE IDs.
+func AllowSPIFFEIDs(ids ...string) func(context.Context, *PeerIdentity) bool {
+	allowed := map[string]bool{}
+	for _, id := range ids {
+		allowed[id] = true
+	}
+	return func(ctx context.Context, peer *PeerIdentity) bool {
+		return peer.SPIFFEID != "" && allowed[peer.SPIFFEID]
+	}
+}
+
+// AllowSANs returns an AuthorizePeer func that allows peers with any of
+// the DNS name, email address, IP address, or URI subject alternative
+// names.
+func AllowSANs(sans ...string) func(context.Context, *PeerIdentity) bool {
+	allowed := map[string]bool{}
+	for _, san := range sans {
+		allowed[san] = true
+	}
+	return func(ctx context.Context, peer *PeerIdentity) bool {
+		for _, name := range peer.DNSNames {
+			if allowed[name] {
+				return true
+			}
+		}
+		for _, email := range peer.EmailAddresses {
+			if allowed[email] {
+				return true
+			}
+		}
+		for _, ip := range peer.IPAddresses {
+			if allowed[ip.String()] {
+				return true
+			}
+		}
+		for _, uri := range peer.URIs {
+			if allowed[uri.String()] {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,55 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestPeer(t *testing.T) {
+	config := DefaultConfig
+	config.AuthorizePeer = AllowSPIFFEIDs("spiffe://example.org/client")
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) *testingups.HelloResponse {
+		peer, _ := Peer(ctx)
+		return &testingups.HelloResponse{Text: "Hello, " + peer.Subject.CommonName + "!"}
+	}, config)
+
+	call := func(state *tls.ConnectionState) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.TLS = state
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+	certState := func(uri string) *tls.ConnectionState {
+		u, _ := url.Parse(uri)
+		cert := &x509.Certificate{URIs: []*url.URL{u}}
+		cert.Subject.CommonName = "client"
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	if resp := call(certState("spiffe://example.org/client")); resp.Code != http.StatusOK || resp.Body.String() != `{"text":"Hello, client!"}` {
+		t.Errorf("unexpected response: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := call(certState("spiffe://example.org/other")); resp.Code != http.StatusForbidden {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusForbidden, resp.Code)
+	}
+	if resp := call(nil); resp.Code != http.StatusForbidden {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusForbidden, resp.Code)
+	}
+	if resp := call(&tls.ConnectionState{}); resp.Code != http.StatusForbidden {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusForbidden, resp.Code)
+	}
+
+	if !AllowSANs("spiffe://example.org/other")(context.Background(), peerIdentity(&http.Request{TLS: certState("spiffe://example.org/other")})) {
+		t.Errorf("expected URI SAN to be allowed")
+	}
+}
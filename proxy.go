@@ -0,0 +1,252 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+)
+
+// Proxy forwards requests to an upstream ups endpoint.
+//
+// As an http.Handler, Proxy forwards the raw request body and passes the
+// upstream response through.  Forward can be used in handler funcs to
+// forward decoded request messages.
+type Proxy struct {
+	// URL is the URL of the upstream endpoint.
+	URL string
+
+	// Client is used for the upstream requests.  If nil,
+	// http.DefaultClient is used.
+	Client *http.Client
+
+	// Headers are the request headers, other than Content-Type, that
+	// are forwarded to the upstream endpoint.
+	Headers []string
+
+	// ResponseHeaders are the response headers, other than
+	// Content-Type, that are passed through from the upstream endpoint.
+	ResponseHeaders []string
+
+	// Timeout is the timeout for each attempt of an upstream request.
+	// If zero, there is no timeout other than that of the request
+	// context.
+	Timeout time.Duration
+
+	// Retries is the number of times an upstream request is retried
+	// after a transport error or a 502, 503, or 504 status.
+	Retries int
+
+	// RetryDelay is the delay before each retry.
+	RetryDelay time.Duration
+
+	// Balancer, if not nil, selects the URL of each attempt from the
+	// replicas of the upstream endpoint instead of URL.
+	Balancer *Balancer
+
+	// Cache, if not nil, caches the upstream responses.
+	Cache *ClientCache
+
+	// Config provides the logging functions and the JSONMarshaler used
+	// by Forward.
+	Config Config
+}
+
+// NewProxy creates a Proxy for the upstream URL using the DefaultConfig.
+func NewProxy(url string) *Proxy {
+	return &Proxy{URL: url, Config: DefaultConfig}
+}
+
+// UpstreamError is returned by Forward when the upstream endpoint
+// responds with a status other than 200.  It implements StatusCoder, so
+// that the upstream status is passed through when returned by a handler.
+type UpstreamError struct {
+	Status int
+	Body   []byte
+}
+
+func (err *UpstreamError) Error() string {
+	return "ups: upstream status " + strconv.Itoa(err.Status)
+}
+
+func (err *UpstreamError) StatusCode() int {
+	return err.Status
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		p.logError(ctx, "req.ReadAll", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	statusCode, header, resp, err := p.do(ctx, r.Method, r.Header, r.Header.Get("Content-Type"), body)
+	if err != nil {
+		p.logError(ctx, "Proxy.do", err)
+		http.Error(w, "", http.StatusBadGateway)
+		return
+	}
+	if contentType := header.Get("Content-Type"); contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	for _, key := range p.ResponseHeaders {
+		for _, val := range header.Values(key) {
+			w.Header().Add(key, val)
+		}
+	}
+	w.WriteHeader(statusCode)
+	if _, err := w.Write(resp); err != nil {
+		p.logError(ctx, "w.Write", err)
+	}
+}
+
+// Forward sends req to the upstream endpoint, forwarding the Headers of
+// r, and unmarshals the upstream response into resp.  The request is
+// sent as JSON if r has a JSON Content-Type and the Config has a
+// JSONMarshaler, and as protobuf otherwise.
+func (p *Proxy) Forward(r *http.Request, req proto.Message, resp proto.Message) error {
+	ctx := r.Context()
+	contentType := "application/octet-stream"
+	var body []byte
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" && p.Config.JSONMarshaler != nil {
+		contentType = "application/json"
+		if s, err := p.Config.JSONMarshaler.MarshalToString(req); err != nil {
+			return err
+		} else {
+			body = []byte(s)
+		}
+	} else if b, err := proto.Marshal(req); err != nil {
+		return err
+	} else {
+		body = b
+	}
+
+	statusCode, header, respBody, err := p.do(ctx, http.MethodPost, r.Header, contentType, body)
+	if err != nil {
+		return err
+	}
+	if statusCode != http.StatusOK {
+		return &UpstreamError{Status: statusCode, Body: respBody}
+	}
+	if mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type")); mediaType == "application/json" {
+		return jsonpb.Unmarshal(bytes.NewReader(respBody), resp)
+	}
+	return proto.Unmarshal(respBody, resp)
+}
+
+func (p *Proxy) do(ctx context.Context, method string, reqHeader http.Header, contentType string, body []byte) (int, http.Header, []byte, error) {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var cacheKey clientCacheKey
+	var cached *clientCacheEntry
+	ifNoneMatch := ""
+	if p.Cache != nil {
+		cacheKey = p.Cache.key(method, p.URL, contentType, reqHeader, p.Headers, body)
+		entry, fresh := p.Cache.get(cacheKey)
+		if fresh {
+			return http.StatusOK, entry.header.Clone(), entry.body, nil
+		} else if entry != nil {
+			cached = entry
+			ifNoneMatch = entry.etag
+		}
+	}
+	var lastErr error
+	for attempt := 0; attempt <= p.Retries; attempt++ {
+		if attempt > 0 && p.RetryDelay > 0 {
+			select {
+			case <-ctx.Done():
+				return 0, nil, nil, ctx.Err()
+			case <-time.After(p.RetryDelay):
+			}
+		}
+		url := p.URL
+		var done func(bool)
+		if p.Balancer != nil {
+			var err error
+			if url, done, err = p.Balancer.pick(ctx); err != nil {
+				return 0, nil, nil, err
+			}
+		}
+		statusCode, header, resp, err := p.attempt(ctx, client, method, url, reqHeader, contentType, ifNoneMatch, body)
+		if done != nil {
+			done(err != nil || statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout)
+		}
+		if err != nil {
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		switch statusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			if attempt < p.Retries {
+				lastErr = &UpstreamError{Status: statusCode, Body: resp}
+				continue
+			}
+		case http.StatusNotModified:
+			if cached != nil {
+				p.Cache.revalidated(cached, header)
+				return http.StatusOK, cached.header.Clone(), cached.body, nil
+			}
+		case http.StatusOK:
+			if p.Cache != nil {
+				p.Cache.put(cacheKey, header, resp)
+			}
+		}
+		return statusCode, header, resp, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("ups: upstream request failed")
+	}
+	return 0, nil, nil, lastErr
+}
+
+func (p *Proxy) attempt(ctx context.Context, client *http.Client, method, url string, reqHeader http.Header, contentType, ifNoneMatch string, body []byte) (int, http.Header, []byte, error) {
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	for _, key := range p.Headers {
+		for _, val := range reqHeader.Values(key) {
+			req.Header.Add(key, val)
+		}
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return resp.StatusCode, resp.Header, respBody, nil
+}
+
+func (p *Proxy) logError(ctx context.Context, tag string, err error) {
+	if p.Config.LogError != nil {
+		p.Config.LogError(ctx, tag, err)
+	}
+}
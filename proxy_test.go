@@ -0,0 +1,63 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestProxy(t *testing.T) {
+	var failures int32
+	upstream := httptest.NewServer(UPS(func(r *http.Request, req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if req.Name == "Flaky" && atomic.AddInt32(&failures, 1) == 1 {
+			return nil, testError(http.StatusServiceUnavailable)
+		}
+		if req.Name == "Teapot" {
+			return nil, testError(http.StatusTeapot)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + " " + r.Header.Get("X-Test") + "!"}, nil
+	}))
+	defer upstream.Close()
+
+	proxy := NewProxy(upstream.URL)
+	proxy.Headers = []string{"X-Test"}
+	proxy.Retries = 1
+
+	forward := UPS(func(r *http.Request, req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		resp := &testingups.HelloResponse{}
+		if err := proxy.Forward(r, req, resp); err != nil {
+			return nil, err
+		}
+		resp.Text = "Forwarded " + resp.Text
+		return resp, nil
+	})
+
+	for _, test := range []struct {
+		handler  http.Handler
+		name     string
+		code     int
+		expected string
+	}{
+		{proxy, "World", http.StatusOK, `{"text":"Hello, World header!"}`},
+		{proxy, "Flaky", http.StatusOK, `{"text":"Hello, Flaky header!"}`},
+		{proxy, "Teapot", http.StatusTeapot, ""},
+		{forward, "World", http.StatusOK, `{"text":"Forwarded Hello, World header!"}`},
+		{forward, "Teapot", http.StatusTeapot, ""},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+test.name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test", "header")
+		resp := httptest.NewRecorder()
+		test.handler.ServeHTTP(resp, req)
+		if resp.Code != test.code {
+			t.Errorf("%s: response code: expected: %d, got: %d", test.name, test.code, resp.Code)
+		}
+		if test.code == http.StatusOK && resp.Body.String() != test.expected {
+			t.Errorf("%s: response body, expected: %s, got: %s", test.name, test.expected, resp.Body.String())
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package ups
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AdmissionQueue limits the number of handlers executing concurrently,
+// queueing a bounded number of requests when at the limit.  Requests
+// that find the queue full or that time out waiting get a 503 response
+// with a Retry-After header.  An AdmissionQueue may be shared by the
+// Configs of multiple handlers.
+//
+// Queued requests are admitted in order of priority, then in order of
+// arrival.  When the queue is full, a request with a higher priority
+// than the lowest priority queued request displaces it, so that low
+// priority requests are shed first under load.
+type AdmissionQueue struct {
+	// RetryAfter is the value of the Retry-After header of rejected
+	// requests, rounded up to seconds.
+	RetryAfter time.Duration
+
+	// Priority, if not nil, classifies requests.  Requests with higher
+	// priorities are admitted first.  If nil, all requests have
+	// priority 0.
+	Priority func(*http.Request) int
+
+	maxConcurrent int
+	maxQueue      int
+	timeout       time.Duration
+
+	mu        sync.Mutex
+	executing int
+	waiters   []*admissionWaiter
+	seq       uint64
+	stats     AdmissionStats
+}
+
+type admissionWaiter struct {
+	priority int
+	seq      uint64
+	result   chan error
+	queued   bool
+}
+
+// AdmissionStats are the metrics of an AdmissionQueue.
+type AdmissionStats struct {
+	// Executing and Queued are the current numbers of executing and
+	// queued requests.
+	Executing int
+	Queued    int
+
+	Admitted int64
+
+	// Rejected is the number of requests that found the queue full.
+	Rejected int64
+
+	// Shed is the number of queued requests displaced by requests with
+	// higher priorities.
+	Shed int64
+
+	// TimedOut is the number of requests that timed out waiting.
+	TimedOut int64
+
+	// WaitTime is the total time admitted requests waited.
+	WaitTime time.Duration
+}
+
+var (
+	errQueueFull    = errors.New("ups: admission queue full")
+	errQueueShed    = errors.New("ups: admission queue shed")
+	errQueueTimeout = errors.New("ups: admission queue timeout")
+)
+
+// NewAdmissionQueue creates an AdmissionQueue allowing maxConcurrent
+// executing handlers and maxQueue waiting requests, which wait at most
+// timeout, or until their context is done if timeout is zero.
+func NewAdmissionQueue(maxConcurrent, maxQueue int, timeout time.Duration) *AdmissionQueue {
+	return &AdmissionQueue{
+		RetryAfter:    time.Second,
+		maxConcurrent: maxConcurrent,
+		maxQueue:      maxQueue,
+		timeout:       timeout,
+	}
+}
+
+// HeaderPriority returns a Priority func that takes the priority of
+// requests from the integer value of the header, with requests without
+// valid values having priority 0.
+func HeaderPriority(header string) func(*http.Request) int {
+	return func(r *http.Request) int {
+		priority, _ := strconv.Atoi(r.Header.Get(header))
+		return priority
+	}
+}
+
+// acquire waits for the request to be admitted.  If acquire returns nil,
+// release must be called when the handler completes.
+func (q *AdmissionQueue) acquire(ctx context.Context, r *http.Request) error {
+	priority := 0
+	if q.Priority != nil {
+		priority = q.Priority(r)
+	}
+
+	q.mu.Lock()
+	if q.executing < q.maxConcurrent && len(q.waiters) == 0 {
+		q.executing++
+		q.stats.Admitted++
+		q.mu.Unlock()
+		return nil
+	}
+	if len(q.waiters) >= q.maxQueue {
+		if len(q.waiters) == 0 || q.waiters[len(q.waiters)-1].priority >= priority {
+			q.stats.Rejected++
+			q.mu.Unlock()
+			return errQueueFull
+		}
+		lowest := q.waiters[len(q.waiters)-1]
+		q.waiters = q.waiters[:len(q.waiters)-1]
+		lowest.queued = false
+		lowest.result <- errQueueShed
+		q.stats.Shed++
+	}
+	q.seq++
+	w := &admissionWaiter{priority: priority, seq: q.seq, result: make(chan error, 1), queued: true}
+	i := len(q.waiters)
+	for i > 0 && q.waiters[i-1].priority < priority {
+		i--
+	}
+	q.waiters = append(q.waiters, nil)
+	copy(q.waiters[i+1:], q.waiters[i:])
+	q.waiters[i] = w
+	q.mu.Unlock()
+
+	start := time.Now()
+	var timeout <-chan time.Time
+	if q.timeout > 0 {
+		timer := time.NewTimer(q.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var err error
+	select {
+	case err = <-w.result:
+	case <-timeout:
+		err = errQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if w.queued {
+		for i, waiter := range q.waiters {
+			if waiter == w {
+				q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+				break
+			}
+		}
+		q.stats.TimedOut++
+		return err
+	}
+	if err != nil && err != errQueueShed {
+		// Admitted or shed concurrently with the timeout.
+		err = <-w.result
+	}
+	if err == nil {
+		q.stats.WaitTime += time.Since(start)
+	}
+	return err
+}
+
+func (q *AdmissionQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.waiters) == 0 {
+		q.executing--
+		return
+	}
+	w := q.waiters[0]
+	q.waiters = q.waiters[1:]
+	w.queued = false
+	q.stats.Admitted++
+	w.result <- nil
+}
+
+func (q *AdmissionQueue) retryAfter() string {
+	return strconv.FormatInt(int64((q.RetryAfter+time.Second-1)/time.Second), 10)
+}
+
+// Stats returns the metrics of the queue.
+func (q *AdmissionQueue) Stats() AdmissionStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	stats := q.stats
+	stats.Executing = q.executing
+	stats.Queued = len(q.waiters)
+	return stats
+}
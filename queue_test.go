@@ -0,0 +1,135 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestAdmissionQueue(t *testing.T) {
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	queue := NewAdmissionQueue(1, 1, time.Second)
+	config := DefaultConfig
+	config.Queue = queue
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		started <- struct{}{}
+		<-release
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+
+	call := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	results := make(chan int, 2)
+	go func() { results <- call().Code }()
+	<-started
+	go func() { results <- call().Code }()
+	for queue.Stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	resp := call()
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusServiceUnavailable, resp.Code)
+	}
+	if resp.Header().Get("Retry-After") != "1" {
+		t.Errorf("Retry-After: expected: 1, got: %s", resp.Header().Get("Retry-After"))
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-results; code != http.StatusOK {
+			t.Errorf("response code: expected: %d, got: %d", http.StatusOK, code)
+		}
+	}
+	stats := queue.Stats()
+	if stats.Admitted != 2 || stats.Rejected != 1 || stats.Executing != 0 || stats.Queued != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	timeoutQueue := NewAdmissionQueue(0, 1, time.Millisecond)
+	config.Queue = timeoutQueue
+	handler = UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{}
+	}, config)
+	if resp := call(); resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusServiceUnavailable, resp.Code)
+	}
+	if stats := timeoutQueue.Stats(); stats.TimedOut != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestAdmissionQueuePriority(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	queue := NewAdmissionQueue(1, 2, time.Second)
+	queue.Priority = HeaderPriority("X-Priority")
+	config := DefaultConfig
+	config.Queue = queue
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		started <- req.Name
+		<-release
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+
+	results := make(chan *httptest.ResponseRecorder, 10)
+	call := func(name, priority string) {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Priority", priority)
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		results <- resp
+	}
+	waitQueued := func(n int) {
+		for queue.Stats().Queued != n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	go call("first", "0")
+	<-started
+	go call("low", "0")
+	waitQueued(1)
+	go call("medium", "5")
+	waitQueued(2)
+	go call("high", "10")
+	// The low priority request is shed.
+	if resp := <-results; resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusServiceUnavailable, resp.Code)
+	}
+	waitQueued(2)
+	go call("lowest", "-1")
+	if resp := <-results; resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusServiceUnavailable, resp.Code)
+	}
+
+	release <- struct{}{}
+	if name := <-started; name != "high" {
+		t.Errorf("expected high priority request to be admitted, got: %s", name)
+	}
+	release <- struct{}{}
+	if name := <-started; name != "medium" {
+		t.Errorf("expected medium priority request to be admitted, got: %s", name)
+	}
+	close(release)
+	for i := 0; i < 3; i++ {
+		if resp := <-results; resp.Code != http.StatusOK {
+			t.Errorf("response code: expected: %d, got: %d", http.StatusOK, resp.Code)
+		}
+	}
+	if stats := queue.Stats(); stats.Shed != 1 || stats.Rejected != 1 || stats.Admitted != 3 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,194 @@
+package ups
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// QuotaPeriod is the window of a Quota, in UTC.
+type QuotaPeriod int
+
+const (
+	// Daily quotas reset at midnight UTC.
+	Daily QuotaPeriod = iota
+
+	// Monthly quotas reset at the start of each month, UTC.
+	Monthly
+)
+
+// start returns the start of the period containing t and the start of
+// the next period.
+func (p QuotaPeriod) start(t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	if p == Monthly {
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// QuotaUsage is the usage of a quota in a period.
+type QuotaUsage struct {
+	Requests int64
+
+	// Bytes is the size of the request bodies.
+	Bytes int64
+}
+
+// QuotaStore stores the usage of quotas, such as in a database shared by
+// the replicas of a service.
+type QuotaStore interface {
+	// Add adds to the usage of the key in the period starting at start,
+	// returning the updated usage.
+	Add(ctx context.Context, key string, start time.Time, usage QuotaUsage) (QuotaUsage, error)
+}
+
+// MemoryQuotaStore is a QuotaStore in memory, for single replicas.  It
+// retains the usage of the current periods only.
+type MemoryQuotaStore struct {
+	mu    sync.Mutex
+	start time.Time
+	usage map[string]QuotaUsage
+}
+
+func (s *MemoryQuotaStore) Add(ctx context.Context, key string, start time.Time, usage QuotaUsage) (QuotaUsage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if start.After(s.start) || s.usage == nil {
+		s.start = start
+		s.usage = map[string]QuotaUsage{}
+	} else if start.Before(s.start) {
+		return usage, nil
+	}
+	total := s.usage[key]
+	total.Requests += usage.Requests
+	total.Bytes += usage.Bytes
+	s.usage[key] = total
+	return total, nil
+}
+
+// QuotaAnonymous is how a Quota handles requests without API keys or
+// authenticated principals.
+type QuotaAnonymous int
+
+const (
+	// AllowAnonymous requests are not limited.
+	AllowAnonymous QuotaAnonymous = iota
+
+	// LimitAnonymous requests share the quota of a single key.
+	LimitAnonymous
+
+	// RejectAnonymous requests get 401 responses.
+	RejectAnonymous
+)
+
+// Quota limits the requests of each authenticated principal or API key
+// in each period, responding with 429 responses when the quota is
+// exhausted.  Responses have X-RateLimit-Limit, X-RateLimit-Remaining,
+// and X-RateLimit-Reset headers, with the remaining requests and the
+// seconds until the quota resets.  A Quota may be shared by the Configs
+// of multiple handlers.
+//
+// The keys of the Store are "principal:" and the Subject, or the
+// ClientID, of the AuthenticatedPrincipal, "key:" and the API key, or
+// "anonymous".
+type Quota struct {
+	// Header is the request header with the API key, for requests
+	// without authenticated principals.
+	Header string
+
+	// Anonymous is how requests without API keys or authenticated
+	// principals are handled.
+	Anonymous QuotaAnonymous
+
+	Period QuotaPeriod
+
+	// Requests is the number of requests allowed in each period.
+	Requests int64
+
+	// Bytes, if not zero, is the total size of request bodies allowed
+	// in each period.
+	Bytes int64
+
+	// Store stores the usage.  If nil, usage is stored in memory.
+	Store QuotaStore
+
+	once  sync.Once
+	store QuotaStore
+}
+
+// NewQuota creates a Quota of requests per period for the X-Api-Key
+// header, stored in memory.
+func NewQuota(period QuotaPeriod, requests int64) *Quota {
+	return &Quota{
+		Header:   "X-Api-Key",
+		Period:   period,
+		Requests: requests,
+	}
+}
+
+func (q *Quota) getStore() QuotaStore {
+	q.once.Do(func() {
+		q.store = q.Store
+		if q.store == nil {
+			q.store = &MemoryQuotaStore{}
+		}
+	})
+	return q.store
+}
+
+// key returns the key of the usage of the request, or "" if the request
+// is not limited.
+func (q *Quota) key(ctx context.Context, r *http.Request) string {
+	if principal, ok := AuthenticatedPrincipal(ctx); ok {
+		if principal.Subject != "" {
+			return "principal:" + principal.Subject
+		}
+		if principal.ClientID != "" {
+			return "principal:" + principal.ClientID
+		}
+	}
+	if key := r.Header.Get(q.Header); key != "" {
+		return "key:" + key
+	}
+	if q.Anonymous == AllowAnonymous {
+		return ""
+	}
+	return "anonymous"
+}
+
+// add records the usage of the request, setting the quota headers, and
+// returns the status code of the response if the request is rejected, or
+// 0.  Failures of the Store are returned, and the request is allowed.
+func (q *Quota) add(ctx context.Context, w http.ResponseWriter, r *http.Request, usage QuotaUsage) (int, error) {
+	key := q.key(ctx, r)
+	if key == "" {
+		return 0, nil
+	}
+	if key == "anonymous" && q.Anonymous == RejectAnonymous {
+		return http.StatusUnauthorized, nil
+	}
+	now := time.Now()
+	start, reset := q.Period.start(now)
+	total, err := q.getStore().Add(ctx, key, start, usage)
+	if err != nil {
+		return 0, err
+	}
+	remaining := q.Requests - total.Requests
+	if remaining < 0 {
+		remaining = 0
+	}
+	resetSeconds := strconv.FormatInt(int64((reset.Sub(now)+time.Second-1)/time.Second), 10)
+	w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(q.Requests, 10))
+	w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+	w.Header().Set("X-RateLimit-Reset", resetSeconds)
+	if total.Requests > q.Requests || (q.Bytes > 0 && total.Bytes > q.Bytes) {
+		w.Header().Set("Retry-After", resetSeconds)
+		return http.StatusTooManyRequests, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,123 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestQuota(t *testing.T) {
+	config := DefaultConfig
+	config.Quota = NewQuota(Daily, 2)
+	config.Quota.Bytes = 40
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		return &testingups.HelloResponse{Text: "Hello " + req.Name}, nil
+	}, config)
+
+	for _, test := range []struct {
+		key        string
+		body       string
+		statusCode int
+		remaining  string
+	}{
+		{"a", `{"name":"World"}`, http.StatusOK, "1"},
+		{"a", `{"name":"World"}`, http.StatusOK, "0"},
+		{"a", `{"name":"World"}`, http.StatusTooManyRequests, "0"},
+		{"", `{"name":"World"}`, http.StatusOK, ""},
+		{"b", `{"name":"` + string(bytes.Repeat([]byte("x"), 40)) + `"}`, http.StatusTooManyRequests, "1"},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(test.body))
+		r.Header.Set("Content-Type", "application/json")
+		if test.key != "" {
+			r.Header.Set("X-Api-Key", test.key)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, r)
+		if resp.Code != test.statusCode || resp.Header().Get("X-RateLimit-Remaining") != test.remaining {
+			t.Errorf("%s: unexpected response: %d %v", test.key, resp.Code, resp.Header())
+		}
+		if test.key != "" && (resp.Header().Get("X-RateLimit-Limit") != "2" || resp.Header().Get("X-RateLimit-Reset") == "") {
+			t.Errorf("%s: unexpected headers: %v", test.key, resp.Header())
+		}
+		if test.statusCode == http.StatusTooManyRequests && resp.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: missing Retry-After", test.key)
+		}
+	}
+}
+
+func TestQuotaPeriod(t *testing.T) {
+	now := time.Date(2024, time.January, 31, 15, 4, 5, 0, time.UTC)
+	if start, reset := Daily.start(now); !start.Equal(time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC)) || !reset.Equal(time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected daily period: %v %v", start, reset)
+	}
+	if start, reset := Monthly.start(now); !start.Equal(time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)) || !reset.Equal(time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected monthly period: %v %v", start, reset)
+	}
+}
+
+func TestMemoryQuotaStore(t *testing.T) {
+	ctx := context.Background()
+	store := &MemoryQuotaStore{}
+	day := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	store.Add(ctx, "a", day, QuotaUsage{Requests: 1, Bytes: 10})
+	if usage, _ := store.Add(ctx, "a", day, QuotaUsage{Requests: 1, Bytes: 5}); usage != (QuotaUsage{Requests: 2, Bytes: 15}) {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+	if usage, _ := store.Add(ctx, "a", day.AddDate(0, 0, 1), QuotaUsage{Requests: 1}); usage != (QuotaUsage{Requests: 1}) {
+		t.Errorf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestQuotaPrincipal(t *testing.T) {
+	for _, anonymous := range []QuotaAnonymous{AllowAnonymous, LimitAnonymous, RejectAnonymous} {
+		config := DefaultConfig
+		config.Quota = NewQuota(Daily, 1)
+		config.Quota.Anonymous = anonymous
+		handler := UPSWithConfig(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+			return &testingups.HelloResponse{Text: "Hello " + req.Name}, nil
+		}, config)
+		serve := func(subject, key string) int {
+			r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+			r.Header.Set("Content-Type", "application/json")
+			if key != "" {
+				r.Header.Set("X-Api-Key", key)
+			}
+			if subject != "" {
+				r = r.WithContext(WithValue(r.Context(), PrincipalKey, &Principal{Subject: subject}))
+			}
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, r)
+			return resp.Code
+		}
+
+		// The API key of a principal does not change its quota.
+		if code := serve("alice", "a"); code != http.StatusOK {
+			t.Errorf("%d: unexpected status: %d", anonymous, code)
+		}
+		if code := serve("alice", "b"); code != http.StatusTooManyRequests {
+			t.Errorf("%d: unexpected status: %d", anonymous, code)
+		}
+		if code := serve("bob", "a"); code != http.StatusOK {
+			t.Errorf("%d: unexpected status: %d", anonymous, code)
+		}
+		if code := serve("", "a"); code != http.StatusOK {
+			t.Errorf("%d: unexpected status: %d", anonymous, code)
+		}
+
+		expected := map[QuotaAnonymous][]int{
+			AllowAnonymous:  {http.StatusOK, http.StatusOK},
+			LimitAnonymous:  {http.StatusOK, http.StatusTooManyRequests},
+			RejectAnonymous: {http.StatusUnauthorized, http.StatusUnauthorized},
+		}[anonymous]
+		for i, statusCode := range expected {
+			if code := serve("", ""); code != statusCode {
+				t.Errorf("%d: anonymous request %d: unexpected status: %d", anonymous, i, code)
+			}
+		}
+	}
+}
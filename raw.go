@@ -0,0 +1,63 @@
+package ups
+
+import (
+	"context"
+	"net/http"
+)
+
+// RawRequest is the body of a request as it was received, before any
+// charset transcoding, and the headers selected by RawRequestHeaders.
+// Handlers must not modify it.
+type RawRequest struct {
+	Body   []byte
+	Header http.Header
+}
+
+func newRawRequest(r *http.Request, body []byte, headers []string) *RawRequest {
+	raw := &RawRequest{Body: body, Header: http.Header{}}
+	for _, name := range headers {
+		if values := r.Header.Values(name); len(values) > 0 {
+			raw.Header[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+	return raw
+}
+
+// Raw returns the RawRequest of the request of the context, if the
+// Config has RawRequest set.
+func Raw(ctx context.Context) (*RawRequest, bool) {
+	raw, ok := Value(ctx, rawRequestContextKey)
+	return raw, ok
+}
+
+// RawResponse is the response of handlers that return *RawResponse
+// instead of a proto.Message, for responses that are not messages, such
+// as CSV exports or PDFs, while the request is still handled as with
+// other handlers.
+type RawResponse struct {
+	// StatusCode is the status of the response.  If zero, it is 200.
+	StatusCode int
+
+	// ContentType is the Content-Type of the response.
+	ContentType string
+
+	Body []byte
+}
+
+// rawResult is the error returned by callHandler with the RawResponse of
+// the handler.
+type rawResult struct {
+	response *RawResponse
+}
+
+func (result rawResult) Error() string {
+	return "ups: raw response"
+}
+
+// statusCode returns the status of the response.
+func (resp *RawResponse) statusCode() int {
+	if resp.StatusCode == 0 {
+		return http.StatusOK
+	}
+	return resp.StatusCode
+}
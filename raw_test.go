@@ -0,0 +1,67 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestRawRequest(t *testing.T) {
+	config := DefaultConfig
+	config.RawRequest = true
+	config.RawRequestHeaders = []string{"x-signature"}
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		raw, ok := Raw(ctx)
+		if !ok {
+			return nil, testError(http.StatusTeapot)
+		}
+		return &testingups.HelloResponse{Text: string(raw.Body) + " " + raw.Header.Get("X-Signature") + " " + raw.Header.Get("X-Other")}, nil
+	}, config)
+
+	req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name": "World"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature", "sig")
+	req.Header.Set("X-Other", "other")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if expected := `{"text":"{\"name\": \"World\"} sig "}`; resp.Code != http.StatusOK || resp.Body.String() != expected {
+		t.Errorf("unexpected response %d %s", resp.Code, resp.Body.String())
+	}
+}
+
+func TestRawResponse(t *testing.T) {
+	config := DefaultConfig
+	config.Envelope = &Envelope{}
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) (*RawResponse, error) {
+		switch req.Name {
+		case "fail":
+			return nil, testError(http.StatusTeapot)
+		case "missing":
+			return &RawResponse{StatusCode: http.StatusNotFound, ContentType: "text/plain", Body: []byte("no " + req.Name)}, nil
+		}
+		return &RawResponse{ContentType: "text/csv", Body: []byte("name\n" + req.Name + "\n")}, nil
+	}, config)
+
+	for _, test := range []struct {
+		name        string
+		statusCode  int
+		contentType string
+		expected    string
+	}{
+		{"World", http.StatusOK, "text/csv", "name\nWorld\n"},
+		{"missing", http.StatusNotFound, "text/plain", "no missing"},
+		{"fail", http.StatusTeapot, "application/json", `{"status":418,"error":"I'm a teapot","data":null}`},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+test.name+`"}`))
+		r.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, r)
+		if resp.Code != test.statusCode || resp.Header().Get("Content-Type") != test.contentType || resp.Body.String() != test.expected {
+			t.Errorf("%s: unexpected response: %d %s %q", test.name, resp.Code, resp.Header().Get("Content-Type"), resp.Body.String())
+		}
+	}
+}
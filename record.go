@@ -0,0 +1,166 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Recording is a recorded request and its response.  Recordings are
+// stored as JSON, one per line.
+type Recording struct {
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	Header         http.Header `json:"header,omitempty"`
+	Body           []byte      `json:"body,omitempty"`
+	StatusCode     int         `json:"status_code"`
+	ResponseHeader http.Header `json:"response_header,omitempty"`
+	ResponseBody   []byte      `json:"response_body,omitempty"`
+}
+
+// Recorder is an http.Handler that records the requests to and the
+// responses from the underlying handler to a writer in the format read
+// by ReadRecordings and Replay.
+type Recorder struct {
+	// LogError is called when a recording cannot be written.
+	LogError func(context.Context, string, error)
+
+	handler http.Handler
+	mu      sync.Mutex
+	enc     *json.Encoder
+}
+
+// NewRecorder creates a Recorder recording the requests to handler to w,
+// using the LogError of the DefaultConfig.
+func NewRecorder(handler http.Handler, w io.Writer) *Recorder {
+	return &Recorder{
+		LogError: DefaultConfig.LogError,
+		handler:  handler,
+		enc:      json.NewEncoder(w),
+	}
+}
+
+func (rec *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		rec.logError(ctx, "req.ReadAll", err)
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	tee := &teeResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	rec.handler.ServeHTTP(tee, r)
+
+	recording := &Recording{
+		Method:         r.Method,
+		URL:            r.URL.String(),
+		Header:         r.Header.Clone(),
+		Body:           body,
+		StatusCode:     tee.statusCode,
+		ResponseHeader: w.Header().Clone(),
+		ResponseBody:   tee.body.Bytes(),
+	}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if err := rec.enc.Encode(recording); err != nil {
+		rec.logError(ctx, "Recorder.Encode", err)
+	}
+}
+
+func (rec *Recorder) logError(ctx context.Context, tag string, err error) {
+	if rec.LogError != nil {
+		rec.LogError(ctx, tag, err)
+	}
+}
+
+type teeResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (tee *teeResponseWriter) WriteHeader(statusCode int) {
+	if !tee.wroteHeader {
+		tee.statusCode = statusCode
+		tee.wroteHeader = true
+	}
+	tee.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (tee *teeResponseWriter) Write(b []byte) (int, error) {
+	tee.wroteHeader = true
+	tee.body.Write(b)
+	return tee.ResponseWriter.Write(b)
+}
+
+func (tee *teeResponseWriter) Flush() {
+	http.NewResponseController(tee.ResponseWriter).Flush()
+}
+
+func (tee *teeResponseWriter) Unwrap() http.ResponseWriter {
+	return tee.ResponseWriter
+}
+
+// ReadRecordings reads the recordings written by a Recorder.
+func ReadRecordings(r io.Reader) ([]*Recording, error) {
+	var recordings []*Recording
+	dec := json.NewDecoder(r)
+	for {
+		recording := &Recording{}
+		if err := dec.Decode(recording); err == io.EOF {
+			return recordings, nil
+		} else if err != nil {
+			return recordings, err
+		}
+		recordings = append(recordings, recording)
+	}
+}
+
+// ReplayRecording sends the recorded request through handler and returns
+// the resulting Recording.
+func ReplayRecording(handler http.Handler, recording *Recording) *Recording {
+	req := httptest.NewRequest(recording.Method, recording.URL, bytes.NewReader(recording.Body))
+	for key, vals := range recording.Header {
+		req.Header[key] = vals
+	}
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return &Recording{
+		Method:         recording.Method,
+		URL:            recording.URL,
+		Header:         recording.Header,
+		Body:           recording.Body,
+		StatusCode:     resp.Code,
+		ResponseHeader: resp.Header(),
+		ResponseBody:   resp.Body.Bytes(),
+	}
+}
+
+// Replay reads the recordings written by a Recorder from r, sends them
+// through handler, and calls check with each recording and the result
+// of its replay.  Replay stops and returns the error if check returns an
+// error.
+func Replay(r io.Reader, handler http.Handler, check func(recorded, replayed *Recording) error) error {
+	dec := json.NewDecoder(r)
+	for {
+		recorded := &Recording{}
+		if err := dec.Decode(recorded); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		replayed := ReplayRecording(handler, recorded)
+		if check != nil {
+			if err := check(recorded, replayed); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package ups
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestRecordReplay(t *testing.T) {
+	var recordings bytes.Buffer
+	handler := NewRecorder(UPS(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if req.Name == "Teapot" {
+			return nil, testError(http.StatusTeapot)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+	}), &recordings)
+
+	for _, name := range []string{"World", "Teapot"} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	recorded, err := ReadRecordings(bytes.NewReader(recordings.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recorded) != 2 {
+		t.Fatalf("expected 2 recordings, got %d", len(recorded))
+	}
+	if recorded[0].StatusCode != http.StatusOK || string(recorded[0].ResponseBody) != `{"text":"Hello, World!"}` {
+		t.Errorf("unexpected recording: %v", recorded[0])
+	}
+	if recorded[1].StatusCode != http.StatusTeapot {
+		t.Errorf("unexpected recording: %v", recorded[1])
+	}
+
+	newHandler := UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	})
+	var mismatches int
+	if err := Replay(bytes.NewReader(recordings.Bytes()), newHandler, func(recorded, replayed *Recording) error {
+		if recorded.StatusCode != replayed.StatusCode || !bytes.Equal(recorded.ResponseBody, replayed.ResponseBody) {
+			mismatches++
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if mismatches != 1 {
+		t.Errorf("expected 1 mismatch, got %d", mismatches)
+	}
+
+	errStop := errors.New("stop")
+	if err := Replay(bytes.NewReader(recordings.Bytes()), newHandler, func(recorded, replayed *Recording) error {
+		return errStop
+	}); err != errStop {
+		t.Errorf("expected check error, got: %v", err)
+	}
+}
+
+func TestRecordFlush(t *testing.T) {
+	var recordings bytes.Buffer
+	handler := NewRecorder(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}), &recordings)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, httptest.NewRequest(http.MethodPost, "/stream", nil))
+	if !resp.Flushed {
+		t.Errorf("response not flushed")
+	}
+}
@@ -0,0 +1,78 @@
+package ups
+
+import (
+	"net/http"
+	"sort"
+
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/qpliu/ups/upspb"
+)
+
+// ReflectionHandler creates an http.Handler using the DefaultConfig that
+// responds to an upspb.ReflectionRequest with the routes and the
+// FileDescriptorSet describing their request and response messages, so
+// that tools can discover the schemas at runtime.
+//
+// The routes map paths to handlers.  Handlers that were not created by
+// this package are ignored.
+func ReflectionHandler(routes map[string]http.Handler) http.Handler {
+	return ReflectionHandlerWithConfig(routes, DefaultConfig)
+}
+
+// ReflectionHandlerWithConfig creates an http.Handler using the provided
+// Config that responds to an upspb.ReflectionRequest with the routes and
+// the FileDescriptorSet describing their request and response messages.
+//
+// The routes map paths to handlers.  Handlers that were not created by
+// this package are ignored.
+func ReflectionHandlerWithConfig(routes map[string]http.Handler, config Config) http.Handler {
+	resp := reflectionResponse(routes)
+	return UPSWithConfig(func(req *upspb.ReflectionRequest) *upspb.ReflectionResponse {
+		return resp
+	}, config)
+}
+
+func reflectionResponse(routes map[string]http.Handler) *upspb.ReflectionResponse {
+	resp := &upspb.ReflectionResponse{
+		FileDescriptorSet: &descriptorpb.FileDescriptorSet{},
+	}
+	seen := map[string]bool{}
+	var addFile func(protoreflect.FileDescriptor)
+	addFile = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			addFile(imports.Get(i).FileDescriptor)
+		}
+		resp.FileDescriptorSet.File = append(resp.FileDescriptorSet.File, protodesc.ToFileDescriptorProto(fd))
+	}
+
+	paths := make([]string, 0, len(routes))
+	for path := range routes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		ups, ok := routes[path].(*upsHandler)
+		if !ok {
+			continue
+		}
+		route := &upspb.Route{Path: path}
+		if ups.requestDescriptor != nil {
+			route.RequestType = string(ups.requestDescriptor.FullName())
+			addFile(ups.requestDescriptor.ParentFile())
+		}
+		if ups.responseDescriptor != nil {
+			route.ResponseType = string(ups.responseDescriptor.FullName())
+			addFile(ups.responseDescriptor.ParentFile())
+		}
+		resp.Routes = append(resp.Routes, route)
+	}
+	return resp
+}
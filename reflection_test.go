@@ -0,0 +1,45 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/qpliu/ups/testingups"
+	"github.com/qpliu/ups/upspb"
+)
+
+func TestReflection(t *testing.T) {
+	handler := ReflectionHandler(map[string]http.Handler{
+		"/hello": UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+			return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+		}),
+		"/other": http.NotFoundHandler(),
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/reflection", &bytes.Buffer{})
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("response code: expected: %d, got: %d", http.StatusOK, resp.Code)
+	}
+	var reflectionResp upspb.ReflectionResponse
+	if err := proto.Unmarshal(resp.Body.Bytes(), &reflectionResp); err != nil {
+		t.Fatal(err)
+	}
+	if len(reflectionResp.Routes) != 1 {
+		t.Fatalf("routes: expected 1, got: %d", len(reflectionResp.Routes))
+	}
+	route := reflectionResp.Routes[0]
+	if route.Path != "/hello" || route.RequestType != "HelloRequest" || route.ResponseType != "HelloResponse" {
+		t.Errorf("unexpected route: %v", route)
+	}
+	files := reflectionResp.FileDescriptorSet.GetFile()
+	if len(files) != 1 || files[0].GetName() != "testingups.proto" {
+		t.Errorf("unexpected files: %v", files)
+	}
+}
@@ -0,0 +1,35 @@
+package ups
+
+import "context"
+
+// Report describes a handler panic or a 5xx response, for forwarding to
+// an error reporting service.
+type Report struct {
+	// Panic is the value recovered from a panic, and Stack is the
+	// stack trace of the panic.  They are nil for 5xx responses
+	// without panics.
+	Panic interface{}
+	Stack []byte
+
+	// Error is the first error logged or returned by the handler, if
+	// any.
+	Error error
+
+	// Summary is the summary of the request.  It does not include the
+	// request or response payloads or headers.
+	Summary *RequestSummary
+}
+
+// Reporter reports handler panics and 5xx responses, such as to Sentry
+// with https://godoc.org/github.com/qpliu/ups/sentry.  Report is called
+// after the response has been written.
+type Reporter interface {
+	Report(context.Context, *Report)
+}
+
+// ReporterFunc implements Reporter with a func.
+type ReporterFunc func(context.Context, *Report)
+
+func (f ReporterFunc) Report(ctx context.Context, report *Report) {
+	f(ctx, report)
+}
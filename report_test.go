@@ -0,0 +1,48 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestReporter(t *testing.T) {
+	var reports []*Report
+	config := DefaultConfig
+	config.LogPanic = nil
+	config.Route = "hello"
+	config.Reporter = ReporterFunc(func(ctx context.Context, report *Report) {
+		reports = append(reports, report)
+	})
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		switch req.Name {
+		case "panic":
+			panic("oops")
+		case "unavailable":
+			return nil, testError(http.StatusServiceUnavailable)
+		case "bad":
+			return nil, testError(http.StatusBadRequest)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+	}, config)
+	for _, name := range []string{"World", "bad", "panic", "unavailable"} {
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-Request-Id", name)
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if len(reports) != 2 {
+		t.Fatalf("expected 2 reports, got: %d", len(reports))
+	}
+	if r := reports[0]; r.Panic != "oops" || len(r.Stack) == 0 || r.Summary.StatusCode != http.StatusInternalServerError || r.Summary.RequestID != "panic" || r.Summary.Route != "hello" {
+		t.Errorf("unexpected panic report: %+v", r)
+	}
+	if r := reports[1]; r.Panic != nil || r.Error != testError(http.StatusServiceUnavailable) || r.Summary.StatusCode != http.StatusServiceUnavailable || r.Summary.RequestID != "unavailable" {
+		t.Errorf("unexpected error report: %+v", r)
+	}
+}
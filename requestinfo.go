@@ -0,0 +1,71 @@
+package ups
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// RequestMetadata describes a request, so that interceptors and handlers
+// need not take the *http.Request.
+type RequestMetadata struct {
+	// Route is the name of the handler, as in the RequestSummary.
+	Route  string
+	Method string
+
+	// RequestType and ResponseType are the full names of the request
+	// and response messages.  ResponseType is empty if the handler
+	// returns an interface type.
+	RequestType  string
+	ResponseType string
+
+	// RequestContentType is the negotiated media type of the request,
+	// without parameters, and is empty for requests with query
+	// parameters.  ResponseContentType is the Content-Type of successful
+	// responses.
+	RequestContentType  string
+	ResponseContentType string
+
+	// RemoteAddr is the network address of the client, or of the last
+	// proxy.  The address of the client behind trusted proxies is
+	// available from the context with ClientIP.
+	RemoteAddr string
+}
+
+func (ups *upsHandler) newRequestMetadata(r *http.Request, route string) *RequestMetadata {
+	info := &RequestMetadata{
+		Route:      route,
+		Method:     r.Method,
+		RemoteAddr: r.RemoteAddr,
+	}
+	if ups.requestDescriptor != nil {
+		info.RequestType = string(ups.requestDescriptor.FullName())
+	}
+	if ups.responseDescriptor != nil {
+		info.ResponseType = string(ups.responseDescriptor.FullName())
+	}
+	return info
+}
+
+func (ups *upsHandler) responseContentType(respFormat format, codecContentType string) string {
+	switch respFormat {
+	case jsonFormat, formFormat:
+		return ups.jsonContentType()
+	case textFormat:
+		return "text/x-protobuf"
+	case codecFormat:
+		return codecContentType
+	}
+	var name protoreflect.FullName
+	if ups.responseDescriptor != nil {
+		name = ups.responseDescriptor.FullName()
+	}
+	return ups.protobufContentType(name)
+}
+
+// RequestInfo returns the RequestMetadata of the request of the context.
+func RequestInfo(ctx context.Context) (*RequestMetadata, bool) {
+	info, ok := Value(ctx, requestInfoContextKey)
+	return info, ok
+}
@@ -0,0 +1,43 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestRequestInfo(t *testing.T) {
+	var info RequestMetadata
+	config := DefaultConfig
+	config.Route = "hello"
+	config.ProtobufContentType = "application/x-protobuf"
+	config.ProtobufTypeParameter = true
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) *testingups.HelloResponse {
+		if i, ok := RequestInfo(ctx); ok {
+			info = *i
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+
+	req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	if expected := (RequestMetadata{Route: "hello", Method: http.MethodPost, RequestType: "HelloRequest", ResponseType: "HelloResponse", RequestContentType: "application/json", ResponseContentType: "application/json", RemoteAddr: "192.0.2.1:1234"}); info != expected {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	body, _ := proto.Marshal(&testingups.HelloRequest{Name: "World"})
+	req = httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if info.RequestContentType != "application/octet-stream" || info.ResponseContentType != resp.Header().Get("Content-Type") {
+		t.Errorf("unexpected info %+v", info)
+	}
+}
@@ -0,0 +1,47 @@
+package ups
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// responsePools maps the message types to the pools of NewResponse.
+var responsePools sync.Map
+
+// NewResponse returns a response message of type T, such as
+// *pb.HelloResponse, from a pool, for hot handlers that allocate large
+// responses.  The message is reset and returned to the pool after the
+// response of the request of the context is written, so the handler must
+// not retain it, and it must not be used outside of the response.  If
+// the context is not from a ups handler, a new message is returned.
+func NewResponse[T proto.Message](ctx context.Context) T {
+	ty := reflect.TypeOf((*T)(nil)).Elem().Elem()
+	state := responseStateFromContext(ctx)
+	if state == nil {
+		return reflect.New(ty).Interface().(T)
+	}
+	pool, ok := responsePools.Load(ty)
+	if !ok {
+		pool, _ = responsePools.LoadOrStore(ty, &sync.Pool{
+			New: func() interface{} {
+				return reflect.New(ty).Interface()
+			},
+		})
+	}
+	msg := pool.(*sync.Pool).Get().(T)
+	state.pooled = append(state.pooled, msg)
+	return msg
+}
+
+func releaseResponses(state *responseState) {
+	for _, msg := range state.pooled {
+		msg.Reset()
+		if pool, ok := responsePools.Load(reflect.TypeOf(msg).Elem()); ok {
+			pool.(*sync.Pool).Put(msg)
+		}
+	}
+	state.pooled = nil
+}
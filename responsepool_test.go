@@ -0,0 +1,43 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestNewResponse(t *testing.T) {
+	var responses []*testingups.HelloResponse
+	handler := UPS(func(ctx context.Context, req *testingups.HelloRequest) *testingups.HelloResponse {
+		resp := NewResponse[*testingups.HelloResponse](ctx)
+		if resp.Text != "" {
+			t.Errorf("pooled response not reset: %s", resp.Text)
+		}
+		resp.Text = "Hello, " + req.Name + "!"
+		responses = append(responses, resp)
+		return resp
+	})
+
+	for _, name := range []string{"World", "Everyone"} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if expected := `{"text":"Hello, ` + name + `!"}`; resp.Body.String() != expected {
+			t.Errorf("unexpected response %s", resp.Body.String())
+		}
+	}
+	for _, resp := range responses {
+		if resp.Text != "" {
+			t.Errorf("response not released: %s", resp.Text)
+		}
+	}
+
+	if resp := NewResponse[*testingups.HelloResponse](context.Background()); resp == nil {
+		t.Errorf("expected new response")
+	}
+}
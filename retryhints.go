@@ -0,0 +1,67 @@
+package ups
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryHints sets headers on error responses that tell generic client
+// retry policies whether and when requests can be retried, so that
+// clients do not need to know the semantics of each route.  Along with
+// a Quota, whose X-RateLimit headers describe the rate-limit state, the
+// headers are the retry metadata of the route.
+type RetryHints struct {
+	// Idempotent marks the requests of the route as safe to retry
+	// after 408, 429, 500, 502, 503, and 504 responses.  Otherwise,
+	// requests are safe to retry only after 408, 429, and 503 responses
+	// before the handler is called, such as from a Queue or a Quota.
+	Idempotent bool
+
+	// Header is set to "true" or "false" on error responses, reporting
+	// whether the request is safe to retry.
+	Header string
+
+	// IdempotentHeader, if not empty, is set to "true" or "false" on all
+	// responses, reporting whether the route is Idempotent.
+	IdempotentHeader string
+
+	// RetryAfter, if not zero, is the Retry-After, rounded up to
+	// seconds, of responses that are safe to retry and that do not have
+	// one.
+	RetryAfter time.Duration
+}
+
+// NewRetryHints creates RetryHints with the X-Retry-Safe and
+// X-Idempotent headers.
+func NewRetryHints(idempotent bool) *RetryHints {
+	return &RetryHints{
+		Idempotent:       idempotent,
+		Header:           "X-Retry-Safe",
+		IdempotentHeader: "X-Idempotent",
+	}
+}
+
+// setHeaders sets the headers of the response with the status code,
+// given whether the handler was called.
+func (h *RetryHints) setHeaders(header http.Header, statusCode int, handlerCalled bool) {
+	if h.IdempotentHeader != "" {
+		header.Set(h.IdempotentHeader, strconv.FormatBool(h.Idempotent))
+	}
+	if statusCode < 400 {
+		return
+	}
+	safe := false
+	switch statusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		safe = h.Idempotent || !handlerCalled
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		safe = h.Idempotent
+	}
+	if h.Header != "" {
+		header.Set(h.Header, strconv.FormatBool(safe))
+	}
+	if safe && h.RetryAfter > 0 && header.Get("Retry-After") == "" {
+		header.Set("Retry-After", strconv.FormatInt(int64((h.RetryAfter+time.Second-1)/time.Second), 10))
+	}
+}
@@ -0,0 +1,63 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestRetryHints(t *testing.T) {
+	for _, test := range []struct {
+		idempotent bool
+		name       string
+		statusCode int
+		retrySafe  string
+		retryAfter string
+	}{
+		{false, "World", http.StatusOK, "", ""},
+		{false, "fail", http.StatusServiceUnavailable, "false", ""},
+		{true, "fail", http.StatusServiceUnavailable, "true", "2"},
+		{false, "invalid", http.StatusBadRequest, "false", ""},
+		{true, "invalid", http.StatusBadRequest, "false", ""},
+		{false, "quota", http.StatusTooManyRequests, "true", "quota"},
+	} {
+		config := DefaultConfig
+		config.LogError = nil
+		config.RetryHints = NewRetryHints(test.idempotent)
+		config.RetryHints.RetryAfter = 1500 * time.Millisecond
+		if test.name == "quota" {
+			config.Quota = NewQuota(Daily, 0)
+		}
+		handler := UPSWithConfig(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+			switch req.Name {
+			case "fail":
+				return nil, testError(http.StatusServiceUnavailable)
+			case "invalid":
+				return nil, testError(http.StatusBadRequest)
+			}
+			return &testingups.HelloResponse{Text: "Hello " + req.Name}, nil
+		}, config)
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+test.name+`"}`))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-Api-Key", "key")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, r)
+		if resp.Code != test.statusCode {
+			t.Errorf("%t %s: unexpected status: %d", test.idempotent, test.name, resp.Code)
+		}
+		if got := resp.Header().Get("X-Idempotent"); got != map[bool]string{false: "false", true: "true"}[test.idempotent] {
+			t.Errorf("%t %s: unexpected X-Idempotent: %s", test.idempotent, test.name, got)
+		}
+		if got := resp.Header().Get("X-Retry-Safe"); got != test.retrySafe {
+			t.Errorf("%t %s: unexpected X-Retry-Safe: %s", test.idempotent, test.name, got)
+		}
+		// The Retry-After of the Quota is kept.
+		if got := resp.Header().Get("Retry-After"); got != test.retryAfter && (test.retryAfter != "quota" || got == "" || got == "2") {
+			t.Errorf("%t %s: unexpected Retry-After: %s", test.idempotent, test.name, got)
+		}
+	}
+}
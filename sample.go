@@ -0,0 +1,60 @@
+package ups
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+)
+
+// LogSampler limits the requests for which the request and response
+// payloads are logged with the LogRequestMessage, LogResponseMessage,
+// LogRequestBytes, LogResponseBytes, LogRequestJSON, LogResponseJSON,
+// LogRequestText, and LogResponseText funcs of the Config, for
+// services with high request rates.
+type LogSampler struct {
+	// Rate is the fraction of requests, between 0 and 1, for which
+	// payloads are logged.
+	Rate float64
+
+	// Errors, if true, logs the payloads of requests with error
+	// responses that are not sampled, which are held until the end of
+	// the request.
+	Errors bool
+}
+
+type logSample struct {
+	sampled  bool
+	deferred []func()
+}
+
+func (s *LogSampler) start() *logSample {
+	return &logSample{sampled: s.Rate > 0 && rand.Float64() < s.Rate}
+}
+
+// log calls the logging func if the request is sampled, or holds it
+// until the end of the request otherwise, if errors are logged.
+func (l *logSample) log(s *LogSampler, f func()) {
+	if l.sampled {
+		f()
+	} else if s.Errors {
+		l.deferred = append(l.deferred, f)
+	}
+}
+
+func (l *logSample) holding(s *LogSampler) bool {
+	return !l.sampled && s.Errors
+}
+
+func (l *logSample) end(statusCode int) {
+	if statusCode < http.StatusBadRequest {
+		return
+	}
+	for _, f := range l.deferred {
+		f()
+	}
+}
+
+func logSampleFromContext(ctx context.Context) *logSample {
+	sample, _ := Value(ctx, sampleContextKey)
+	return sample
+}
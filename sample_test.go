@@ -0,0 +1,79 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestLogSampler(t *testing.T) {
+	var logged []string
+	config := DefaultConfig
+	config.LogRequestMessage = func(ctx context.Context, req proto.Message) {
+		logged = append(logged, "request "+req.(*testingups.HelloRequest).Name)
+	}
+	config.LogResponseJSON = func(ctx context.Context, resp string) {
+		logged = append(logged, "response "+resp)
+	}
+	handler := func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if req.Name == "" {
+			return nil, testError(http.StatusBadRequest)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+	}
+	call := func(h http.Handler, body string) {
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(body))
+		r.Header.Set("Content-Type", "application/json")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	config.LogSampler = &LogSampler{Rate: 0, Errors: true}
+	h := UPSWithConfig(handler, config)
+	call(h, `{"name":"World"}`)
+	if len(logged) != 0 {
+		t.Errorf("unexpected logs: %v", logged)
+	}
+	call(h, `{"name":""}`)
+	if len(logged) != 1 || logged[0] != "request " {
+		t.Errorf("unexpected logs: %v", logged)
+	}
+
+	logged = nil
+	config.LogSampler = &LogSampler{Rate: 1}
+	h = UPSWithConfig(handler, config)
+	call(h, `{"name":"World"}`)
+	if len(logged) != 2 || logged[0] != "request World" || logged[1] != `response {"text":"Hello, World!"}` {
+		t.Errorf("unexpected logs: %v", logged)
+	}
+
+	logged = nil
+	config.LogSampler = &LogSampler{Rate: 0}
+	h = UPSWithConfig(handler, config)
+	call(h, `{"name":""}`)
+	if len(logged) != 0 {
+		t.Errorf("unexpected logs: %v", logged)
+	}
+}
+
+func TestLogSamplerHeldMessage(t *testing.T) {
+	var logged []string
+	config := DefaultConfig
+	config.LogSampler = &LogSampler{Errors: true}
+	config.LogRequestMessage = func(ctx context.Context, req proto.Message) {
+		logged = append(logged, req.(*testingups.HelloRequest).Name)
+	}
+	h := UPSWithConfig(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		return nil, testError(http.StatusInternalServerError)
+	}, config)
+	r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+	r.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if len(logged) != 1 || logged[0] != "World" {
+		t.Errorf("unexpected logs: %v", logged)
+	}
+}
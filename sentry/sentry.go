@@ -0,0 +1,62 @@
+// Package sentry provides a ups.Reporter that reports handler panics and
+// 5xx responses to Sentry.
+package sentry
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	sentrygo "github.com/getsentry/sentry-go"
+
+	"github.com/qpliu/ups"
+)
+
+// Reporter reports to Sentry.  The Hub from the context, such as one set
+// by the sentryhttp middleware, is used if there is one, then the Hub of
+// the Reporter, then the current Hub.
+type Reporter struct {
+	Hub *sentrygo.Hub
+}
+
+func (r *Reporter) hub(ctx context.Context) *sentrygo.Hub {
+	if hub := sentrygo.GetHubFromContext(ctx); hub != nil {
+		return hub
+	}
+	if r.Hub != nil {
+		return r.Hub
+	}
+	return sentrygo.CurrentHub()
+}
+
+// Report sends the report to Sentry, with the route, method, status,
+// and request ID as tags, and the rest of the summary as the ups
+// context.
+func (r *Reporter) Report(ctx context.Context, report *ups.Report) {
+	s := report.Summary
+	hub := r.hub(ctx)
+	hub.WithScope(func(scope *sentrygo.Scope) {
+		scope.SetTag("route", s.Route)
+		scope.SetTag("method", s.Method)
+		scope.SetTag("status", strconv.Itoa(s.StatusCode))
+		if s.RequestID != "" {
+			scope.SetTag("request_id", s.RequestID)
+		}
+		if s.Principal != "" {
+			scope.SetUser(sentrygo.User{ID: s.Principal})
+		}
+		scope.SetContext("ups", sentrygo.Context{
+			"duration":      s.Duration.String(),
+			"request_size":  s.RequestSize,
+			"response_size": s.ResponseSize,
+		})
+		switch {
+		case report.Panic != nil:
+			hub.RecoverWithContext(ctx, report.Panic)
+		case report.Error != nil:
+			hub.CaptureException(report.Error)
+		default:
+			hub.CaptureMessage(fmt.Sprintf("ups: %s %s: status %d", s.Method, s.Route, s.StatusCode))
+		}
+	})
+}
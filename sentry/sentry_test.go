@@ -0,0 +1,66 @@
+package sentry
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	sentrygo "github.com/getsentry/sentry-go"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/testingups"
+)
+
+type testTransport struct {
+	mu     sync.Mutex
+	events []*sentrygo.Event
+}
+
+func (t *testTransport) Flush(time.Duration) bool              { return true }
+func (t *testTransport) FlushWithContext(context.Context) bool { return true }
+func (t *testTransport) Configure(sentrygo.ClientOptions)      {}
+func (t *testTransport) Close()                                {}
+func (t *testTransport) SendEvent(event *sentrygo.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+}
+
+func TestReporter(t *testing.T) {
+	transport := &testTransport{}
+	client, err := sentrygo.NewClient(sentrygo.ClientOptions{Transport: transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := ups.DefaultConfig
+	config.LogPanic = nil
+	config.Route = "hello"
+	config.Reporter = &Reporter{Hub: sentrygo.NewHub(client, sentrygo.NewScope())}
+	handler := ups.UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		if req.Name == "panic" {
+			panic("oops")
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+	for _, name := range []string{"World", "panic"} {
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-Request-Id", "abc123")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if len(transport.events) != 1 {
+		t.Fatalf("expected 1 event, got: %d", len(transport.events))
+	}
+	event := transport.events[0]
+	if event.Tags["route"] != "hello" || event.Tags["request_id"] != "abc123" || event.Tags["status"] != "500" {
+		t.Errorf("unexpected tags: %v", event.Tags)
+	}
+	if event.Message != "oops" {
+		t.Errorf("unexpected message: %s", event.Message)
+	}
+}
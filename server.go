@@ -0,0 +1,173 @@
+package ups
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Lifecycle hooks are invoked by a Server, with OnStart called before the
+// server accepts requests, and OnStop called after it has shut down, in
+// the reverse order, for expensive initialization and ordered teardown.
+type Lifecycle interface {
+	OnStart(context.Context) error
+	OnStop(context.Context) error
+}
+
+// LifecycleFuncs implements Lifecycle with funcs, either of which may be
+// nil.
+type LifecycleFuncs struct {
+	Start func(context.Context) error
+	Stop  func(context.Context) error
+}
+
+func (l LifecycleFuncs) OnStart(ctx context.Context) error {
+	if l.Start == nil {
+		return nil
+	}
+	return l.Start(ctx)
+}
+
+func (l LifecycleFuncs) OnStop(ctx context.Context) error {
+	if l.Stop == nil {
+		return nil
+	}
+	return l.Stop(ctx)
+}
+
+// WithLifecycle attaches the Lifecycle to the handler, so that its hooks
+// are invoked by the Server with which the returned handler is
+// registered with Handle.
+func WithLifecycle(handler http.Handler, lifecycle Lifecycle) http.Handler {
+	return &lifecycleHandler{Handler: handler, Lifecycle: lifecycle}
+}
+
+type lifecycleHandler struct {
+	http.Handler
+	Lifecycle
+}
+
+// Server is an http.Server that invokes Lifecycle hooks.
+type Server struct {
+	http.Server
+
+	// Drainer, if not nil, is drained by Shutdown before the
+	// http.Server is shut down.
+	Drainer *Drainer
+
+	mu         sync.Mutex
+	mux        *http.ServeMux
+	lifecycles []Lifecycle
+	started    int
+}
+
+// Handle registers the handler for the pattern with the ServeMux of the
+// Server, which is created if the Server has no Handler.  If the handler
+// implements Lifecycle, such as those returned by WithLifecycle, its
+// hooks are invoked by the Server.
+//
+// Handle will panic if the Server has a Handler that is not its ServeMux.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mux == nil {
+		if s.Handler != nil {
+			panic("ups: Server.Handle with Handler")
+		}
+		s.mux = http.NewServeMux()
+		s.Handler = s.mux
+	}
+	s.mux.Handle(pattern, handler)
+	if lifecycle, ok := handler.(Lifecycle); ok {
+		s.lifecycles = append(s.lifecycles, lifecycle)
+	}
+}
+
+// AddLifecycle adds Lifecycle hooks to be invoked by the Server.
+func (s *Server) AddLifecycle(lifecycles ...Lifecycle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lifecycles = append(s.lifecycles, lifecycles...)
+}
+
+// Start calls the OnStart hooks in order.  If a hook fails, the OnStop
+// hooks of the hooks already started are called in reverse order and the
+// error is returned.  Start is called by ListenAndServe,
+// ListenAndServeTLS, Serve, and ServeTLS, and does nothing if the hooks
+// have already been started.
+func (s *Server) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.started < len(s.lifecycles) {
+		if err := s.lifecycles[s.started].OnStart(ctx); err != nil {
+			s.stop(ctx)
+			return err
+		}
+		s.started++
+	}
+	return nil
+}
+
+func (s *Server) stop(ctx context.Context) error {
+	var err error
+	for s.started > 0 {
+		s.started--
+		if e := s.lifecycles[s.started].OnStop(ctx); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// ListenAndServe starts the Lifecycle hooks and calls
+// http.Server.ListenAndServe.
+func (s *Server) ListenAndServe() error {
+	if err := s.Start(context.Background()); err != nil {
+		return err
+	}
+	return s.Server.ListenAndServe()
+}
+
+// ListenAndServeTLS starts the Lifecycle hooks and calls
+// http.Server.ListenAndServeTLS.
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	if err := s.Start(context.Background()); err != nil {
+		return err
+	}
+	return s.Server.ListenAndServeTLS(certFile, keyFile)
+}
+
+// Serve starts the Lifecycle hooks and calls http.Server.Serve.
+func (s *Server) Serve(l net.Listener) error {
+	if err := s.Start(context.Background()); err != nil {
+		return err
+	}
+	return s.Server.Serve(l)
+}
+
+// ServeTLS starts the Lifecycle hooks and calls http.Server.ServeTLS.
+func (s *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
+	if err := s.Start(context.Background()); err != nil {
+		return err
+	}
+	return s.Server.ServeTLS(l, certFile, keyFile)
+}
+
+// Shutdown drains the Drainer, if any, calls http.Server.Shutdown, then
+// calls the OnStop hooks in reverse order, returning the first error.
+func (s *Server) Shutdown(ctx context.Context) error {
+	var err error
+	if s.Drainer != nil {
+		err = s.Drainer.Drain(ctx)
+	}
+	if e := s.Server.Shutdown(ctx); e != nil && err == nil {
+		err = e
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.stop(ctx); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
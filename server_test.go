@@ -0,0 +1,76 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestServer(t *testing.T) {
+	var events []string
+	hook := func(name string) Lifecycle {
+		return LifecycleFuncs{
+			Start: func(ctx context.Context) error {
+				events = append(events, "start "+name)
+				return nil
+			},
+			Stop: func(ctx context.Context) error {
+				events = append(events, "stop "+name)
+				return nil
+			},
+		}
+	}
+
+	server := &Server{}
+	server.AddLifecycle(hook("cache"))
+	server.Handle("/hello", WithLifecycle(UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}), hook("hello")))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- server.Serve(l)
+	}()
+
+	resp, err := http.Post("http://"+l.Addr().String()+"/hello", "application/json", bytes.NewBufferString(`{"name":"World"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("response code: expected: %d, got: %d", http.StatusOK, resp.StatusCode)
+	}
+
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != http.ErrServerClosed {
+		t.Errorf("expected ErrServerClosed, got: %v", err)
+	}
+	expected := []string{"start cache", "start hello", "stop hello", "stop cache"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("events, expected: %v, got: %v", expected, events)
+	}
+
+	events = nil
+	errStart := errors.New("start failed")
+	failing := &Server{}
+	failing.AddLifecycle(hook("first"), LifecycleFuncs{Start: func(ctx context.Context) error { return errStart }}, hook("third"))
+	if err := failing.ListenAndServe(); err != errStart {
+		t.Errorf("expected start error, got: %v", err)
+	}
+	expected = []string{"start first", "stop first"}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("events, expected: %v, got: %v", expected, events)
+	}
+}
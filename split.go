@@ -0,0 +1,142 @@
+package ups
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// SplitVariant is one of the handlers of a SplitHandler.
+type SplitVariant struct {
+	// Name identifies the variant in the SplitStats.
+	Name string
+
+	// Weight is the relative share of requests sent to the variant.
+	Weight int
+
+	Handler http.Handler
+}
+
+// SplitStats are the metrics of a SplitVariant.
+type SplitStats struct {
+	Name     string
+	Requests int64
+
+	// Errors is the number of responses with 5xx statuses.
+	Errors int64
+
+	// Duration is the total duration of the requests.
+	Duration time.Duration
+}
+
+// SplitHandler is an http.Handler that routes requests to one of several
+// handlers in proportion to their weights, for gradual rollouts of new
+// implementations.
+type SplitHandler struct {
+	// StickyKey, if not nil, provides a key for each request that is
+	// hashed to select the variant, so that requests with the same key
+	// are routed to the same variant.  Otherwise, variants are selected
+	// randomly.
+	StickyKey func(*http.Request) string
+
+	variants []SplitVariant
+	total    int
+	stats    []splitStats
+}
+
+type splitStats struct {
+	requests int64
+	errors   int64
+	duration int64
+}
+
+// NewSplitHandler creates a SplitHandler routing to the variants.
+//
+// NewSplitHandler will panic if there are no variants with positive
+// weights.
+func NewSplitHandler(variants ...SplitVariant) *SplitHandler {
+	s := &SplitHandler{
+		variants: variants,
+		stats:    make([]splitStats, len(variants)),
+	}
+	for _, v := range variants {
+		if v.Weight > 0 {
+			s.total += v.Weight
+		}
+	}
+	if s.total == 0 {
+		panic("ups: no split variants with positive weight")
+	}
+	return s
+}
+
+func (s *SplitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var n int
+	if s.StickyKey != nil {
+		h := fnv.New32a()
+		h.Write([]byte(s.StickyKey(r)))
+		n = int(h.Sum32() % uint32(s.total))
+	} else {
+		n = rand.Intn(s.total)
+	}
+	i := 0
+	for ; i < len(s.variants)-1; i++ {
+		if s.variants[i].Weight <= 0 {
+			continue
+		}
+		if n < s.variants[i].Weight {
+			break
+		}
+		n -= s.variants[i].Weight
+	}
+
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+	s.variants[i].Handler.ServeHTTP(rec, r)
+	stats := &s.stats[i]
+	atomic.AddInt64(&stats.requests, 1)
+	atomic.AddInt64(&stats.duration, int64(time.Since(start)))
+	if rec.statusCode >= 500 {
+		atomic.AddInt64(&stats.errors, 1)
+	}
+}
+
+// Stats returns the metrics of the variants.
+func (s *SplitHandler) Stats() []SplitStats {
+	result := make([]SplitStats, len(s.variants))
+	for i, v := range s.variants {
+		result[i] = SplitStats{
+			Name:     v.Name,
+			Requests: atomic.LoadInt64(&s.stats[i].requests),
+			Errors:   atomic.LoadInt64(&s.stats[i].errors),
+			Duration: time.Duration(atomic.LoadInt64(&s.stats[i].duration)),
+		}
+	}
+	return result
+}
+
+// statusRecorder records the status code written to a ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(statusCode int) {
+	if !rec.wroteHeader {
+		rec.statusCode = statusCode
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
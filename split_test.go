@@ -0,0 +1,51 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestSplitHandler(t *testing.T) {
+	handler := NewSplitHandler(
+		SplitVariant{Name: "old", Weight: 1, Handler: UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+			return &testingups.HelloResponse{Text: "Old, " + req.Name + "!"}
+		})},
+		SplitVariant{Name: "off", Weight: 0, Handler: http.NotFoundHandler()},
+		SplitVariant{Name: "new", Weight: 3, Handler: UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+			return &testingups.HelloResponse{Text: "New, " + req.Name + "!"}
+		})},
+	)
+
+	call := func(name string) string {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp.Body.String()
+	}
+
+	for i := 0; i < 100; i++ {
+		call("World")
+	}
+	stats := handler.Stats()
+	if stats[0].Requests+stats[2].Requests != 100 || stats[1].Requests != 0 {
+		t.Errorf("unexpected stats: %v", stats)
+	}
+	if stats[0].Requests == 0 || stats[2].Requests < stats[0].Requests {
+		t.Errorf("unexpected split: %v", stats)
+	}
+
+	handler.StickyKey = func(r *http.Request) string {
+		return r.Header.Get("Content-Type")
+	}
+	first := call("Sticky")
+	for i := 0; i < 10; i++ {
+		if body := call("Sticky"); body != first {
+			t.Errorf("expected sticky response: %s, got: %s", first, body)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// Package statsd exports request metrics using the StatsD protocol, with
+// DogStatsD tags, from the summaries of ups requests.
+package statsd
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qpliu/ups"
+)
+
+// Exporter sends the metrics of each request to a StatsD server:
+//
+//	<prefix>requests            counter
+//	<prefix>request.duration    timer, in milliseconds
+//	<prefix>request.size        histogram, in bytes
+//	<prefix>response.size       histogram, in bytes
+//
+// With DogStatsD tags, the metrics are tagged with route, method, and
+// status, along with the Tags, with deprecated:true for handlers with a
+// ups.Deprecation, and with tenant for requests with tenants.
+type Exporter struct {
+	// Prefix is prepended to the metric names, such as "myservice.".
+	Prefix string
+
+	// Tags are added to all metrics, such as "env:prod".
+	Tags []string
+
+	// DisableTags disables DogStatsD tags, for plain StatsD servers.
+	DisableTags bool
+
+	// SampleRate, if between 0 and 1, is the fraction of requests for
+	// which metrics are sent.  Otherwise, metrics are sent for all
+	// requests.
+	SampleRate float64
+
+	w io.Writer
+}
+
+// New creates an Exporter that sends metrics over UDP to addr, such as
+// "127.0.0.1:8125".
+func New(addr string) (*Exporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithWriter(conn), nil
+}
+
+// NewWithWriter creates an Exporter that writes each packet of metrics
+// to w.
+func NewWithWriter(w io.Writer) *Exporter {
+	return &Exporter{w: w}
+}
+
+// Config returns a copy of config with LogSummary set to send the
+// metrics of each request, followed by the existing LogSummary, if any.
+func (e *Exporter) Config(config ups.Config) ups.Config {
+	logSummary := config.LogSummary
+	config.LogSummary = func(ctx context.Context, s *ups.RequestSummary) {
+		e.LogSummary(ctx, s)
+		if logSummary != nil {
+			logSummary(ctx, s)
+		}
+	}
+	return config
+}
+
+// LogSummary sends the metrics of the request.  Errors sending metrics
+// are ignored.
+func (e *Exporter) LogSummary(ctx context.Context, s *ups.RequestSummary) {
+	rate := ""
+	if e.SampleRate > 0 && e.SampleRate < 1 {
+		if rand.Float64() >= e.SampleRate {
+			return
+		}
+		rate = "|@" + strconv.FormatFloat(e.SampleRate, 'f', -1, 64)
+	}
+
+	tags := ""
+	if !e.DisableTags {
+		t := append([]string{}, e.Tags...)
+		t = append(t, "route:"+sanitize(s.Route), "method:"+sanitize(s.Method), "status:"+strconv.Itoa(s.StatusCode))
+		if s.Deprecated {
+			t = append(t, "deprecated:true")
+		}
+		if s.Tenant != "" {
+			t = append(t, "tenant:"+sanitize(s.Tenant))
+		}
+		tags = "|#" + strings.Join(t, ",")
+	}
+
+	var b strings.Builder
+	metric := func(name, value, typ string) {
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(e.Prefix)
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(value)
+		b.WriteByte('|')
+		b.WriteString(typ)
+		b.WriteString(rate)
+		b.WriteString(tags)
+	}
+	metric("requests", "1", "c")
+	metric("request.duration", strconv.FormatFloat(float64(s.Duration)/float64(time.Millisecond), 'f', -1, 64), "ms")
+	metric("request.size", strconv.Itoa(s.RequestSize), "h")
+	metric("response.size", strconv.Itoa(s.ResponseSize), "h")
+	e.w.Write([]byte(b.String()))
+}
+
+// sanitize replaces the characters that are reserved in the StatsD
+// protocol.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', ',', '@', '#', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
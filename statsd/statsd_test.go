@@ -0,0 +1,68 @@
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/testingups"
+)
+
+type packets struct {
+	packets []string
+}
+
+func (p *packets) Write(b []byte) (int, error) {
+	p.packets = append(p.packets, string(b))
+	return len(b), nil
+}
+
+func TestExporter(t *testing.T) {
+	var out packets
+	e := NewWithWriter(&out)
+	e.Prefix = "hello."
+	e.Tags = []string{"env:test"}
+	logged := false
+	config := ups.DefaultConfig
+	config.Route = "hello"
+	config.LogSummary = func(ctx context.Context, s *ups.RequestSummary) {
+		logged = true
+	}
+	handler := ups.UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, e.Config(config))
+	r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+	r.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if !logged {
+		t.Errorf("expected existing LogSummary to be called")
+	}
+	if len(out.packets) != 1 {
+		t.Fatalf("expected 1 packet, got: %d", len(out.packets))
+	}
+	lines := strings.Split(out.packets[0], "\n")
+	tags := "|#env:test,route:hello,method:POST,status:200"
+	if len(lines) != 4 || lines[0] != "hello.requests:1|c"+tags || !strings.HasPrefix(lines[1], "hello.request.duration:") || !strings.HasSuffix(lines[1], "|ms"+tags) || lines[2] != "hello.request.size:16|h"+tags || lines[3] != "hello.response.size:24|h"+tags {
+		t.Errorf("unexpected packet: %q", out.packets[0])
+	}
+}
+
+func TestExporterWithoutTags(t *testing.T) {
+	var out packets
+	e := NewWithWriter(&out)
+	e.DisableTags = true
+	e.LogSummary(context.Background(), &ups.RequestSummary{Route: "a|b", Duration: 1500 * time.Microsecond})
+	expected := "requests:1|c\nrequest.duration:1.5|ms\nrequest.size:0|h\nresponse.size:0|h"
+	if len(out.packets) != 1 || out.packets[0] != expected {
+		t.Errorf("unexpected packets: %q", out.packets)
+	}
+	if s := sanitize("a|b:c"); s != "a_b_c" {
+		t.Errorf("unexpected sanitize: %s", s)
+	}
+}
@@ -0,0 +1,303 @@
+package ups
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// maxStreamFrameSize is the largest message in request streams, unless
+// the MaxRequestSize is smaller.
+const maxStreamFrameSize = 64 << 20
+
+var (
+	errStreamFrameTooLarge = errors.New("ups: stream frame too large")
+	errStreamUnauthorized  = errors.New("ups: stream message not authorized")
+	errStreamRawResponse   = errors.New("ups: raw response in stream")
+)
+
+// StreamStatus is the outcome of a request stream, which is sent in the
+// Stream-Status, Stream-Error, and Stream-Count trailers of the response,
+// as the status of the response is sent before the stream is complete.
+type StreamStatus struct {
+	// StatusCode is the status of the response if it were not a
+	// stream.
+	StatusCode int
+
+	// Error is the error that ended the stream, if any.
+	Error error
+
+	// Count is the number of responses in the stream.
+	Count int
+}
+
+// serveStream calls the handler for each of the messages of the request
+// stream in the body, writing the stream of the responses.  It returns
+// the status code of the response and false if it fails before writing
+// the response, and true otherwise.
+func (ups *upsHandler) serveStream(ctx context.Context, w http.ResponseWriter, r *http.Request, body io.Reader, reqFormat format) (int, bool) {
+	summary := requestSummaryFromContext(ctx)
+	rc := http.NewResponseController(w)
+	br := bufio.NewReader(body)
+	var arg reflect.Value
+	var frame []byte
+	status := &StreamStatus{StatusCode: http.StatusOK}
+	written := false
+	write := func(resp []byte) error {
+		if !written {
+			w.Header().Set("Content-Type", streamContentType(reqFormat))
+			w.Header().Set("Trailer", "Stream-Status, Stream-Error, Stream-Count")
+			w.WriteHeader(http.StatusOK)
+			written = true
+		}
+		if summary != nil {
+			summary.ResponseSize += len(resp)
+		}
+		if _, err := w.Write(resp); err != nil {
+			ups.logError(ctx, "w.Write", err)
+			return err
+		}
+		// Not all ResponseWriters can flush, in which case the
+		// responses are sent when the buffer fills.
+		rc.Flush()
+		return nil
+	}
+	for status.StatusCode == http.StatusOK {
+		req, err := ups.readFrame(br, reqFormat, frame)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			ups.logError(ctx, "readFrame", err)
+			status.StatusCode, status.Error = http.StatusInternalServerError, err
+			var maxBytesError *http.MaxBytesError
+			if errors.As(err, &maxBytesError) || err == errStreamFrameTooLarge {
+				status.StatusCode = http.StatusRequestEntityTooLarge
+			}
+			break
+		}
+		// Held log lines refer to the frames, so they are not reused
+		// when sampling.
+		if logSampleFromContext(ctx) == nil {
+			frame = req[:0]
+		}
+		if summary != nil {
+			summary.RequestSize += len(req)
+		}
+		status.StatusCode, status.Error = ups.serveFrame(ctx, r, reqFormat, req, &arg, write)
+		if status.StatusCode == http.StatusOK {
+			status.Count++
+		}
+	}
+	if !written && status.StatusCode != http.StatusOK {
+		return status.StatusCode, false
+	}
+	if ups.config.StreamTerminal != nil {
+		if msg := ups.config.StreamTerminal(ctx, status); msg != nil {
+			if resp, err := ups.marshalFrame(ctx, reqFormat, msg); err == nil {
+				write(resp)
+			}
+		}
+	}
+	if !written {
+		write(nil)
+	}
+	w.Header().Set("Stream-Status", strconv.Itoa(status.StatusCode))
+	w.Header().Set("Stream-Count", strconv.Itoa(status.Count))
+	if status.StatusCode != http.StatusOK {
+		text := ups.errorResponse(ctx, status.StatusCode)
+		if text == "" {
+			text = http.StatusText(status.StatusCode)
+		}
+		w.Header().Set("Stream-Error", text)
+	}
+	return status.StatusCode, true
+}
+
+// serveFrame calls the handler for a message of the request stream and
+// writes its response.
+func (ups *upsHandler) serveFrame(ctx context.Context, r *http.Request, reqFormat format, req []byte, arg *reflect.Value, write func([]byte) error) (int, error) {
+	if !arg.IsValid() || ups.config.RetainRequests {
+		*arg = ups.requestObjectPool.New().(reflect.Value)
+	}
+	// The message is reused for the frames, and jsonpb merges into it.
+	msg := arg.Interface().(proto.Message)
+	msg.Reset()
+	if reqFormat == ndjsonFormat {
+		ups.logRequestJSON(ctx, string(req))
+		if ups.config.StrictJSON {
+			if err := checkStrictJSON(req, ups.requestDescriptor); err != nil {
+				ups.logError(ctx, "checkStrictJSON", err)
+				return http.StatusBadRequest, err
+			}
+		}
+		if err := ups.jsonUnmarshal(req, msg); err != nil {
+			ups.logError(ctx, "jsonpb.Unmarshal", err)
+			return http.StatusInternalServerError, err
+		}
+	} else {
+		ups.logRequestBytes(ctx, req)
+		if err := proto.Unmarshal(req, msg); err != nil {
+			ups.logError(ctx, "proto.Unmarshal", err)
+			return http.StatusInternalServerError, err
+		}
+	}
+	if statusCode, err := ups.prepareStreamRequest(ctx, r, msg); statusCode != http.StatusOK {
+		return statusCode, err
+	}
+
+	result, err := ups.callHandler(ctx, r, *arg)
+	if _, ok := err.(rawResult); ok {
+		ups.logError(ctx, "callHandler", errStreamRawResponse)
+		return http.StatusInternalServerError, errStreamRawResponse
+	}
+	if async, ok := err.(*AsyncResult); ok {
+		result, err = async.Operation, nil
+	}
+	if err != nil {
+		if summary := requestSummaryFromContext(ctx); summary != nil && summary.Error == nil {
+			summary.Error = err
+		}
+		if coder, ok := err.(StatusCoder); ok {
+			return coder.StatusCode(), err
+		}
+		return http.StatusInternalServerError, err
+	}
+	if ups.config.FieldVisibility != nil {
+		result = ups.config.FieldVisibility.filter(ctx, result)
+	}
+	if ups.config.AnyResolver != nil {
+		if err := ups.config.AnyResolver.check(proto.MessageReflect(result)); err != nil {
+			ups.logError(ctx, "AnyResolver.check", err)
+			return http.StatusInternalServerError, err
+		}
+	}
+	ups.logResponseMessage(ctx, result)
+	resp, err := ups.marshalFrame(ctx, reqFormat, result)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err := write(resp); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+func streamContentType(reqFormat format) string {
+	if reqFormat == ndjsonFormat {
+		return "application/x-ndjson"
+	}
+	return "application/x-protobuf-stream"
+}
+
+// marshalFrame marshals a message of the response stream, including
+// its length prefix or line terminator.
+func (ups *upsHandler) marshalFrame(ctx context.Context, reqFormat format, msg proto.Message) ([]byte, error) {
+	if reqFormat == ndjsonFormat {
+		resp, err := ups.config.JSONMarshaler.MarshalToString(msg)
+		if err != nil {
+			ups.logError(ctx, "JSONMarshaler.MarshalToString", err)
+			return nil, err
+		}
+		ups.logResponseJSON(ctx, resp)
+		return append([]byte(resp), '\n'), nil
+	}
+	resp, err := proto.Marshal(msg)
+	if err != nil {
+		ups.logError(ctx, "proto.Marshal", err)
+		return nil, err
+	}
+	ups.logResponseBytes(ctx, resp)
+	return append(binary.AppendUvarint(nil, uint64(len(resp))), resp...), nil
+}
+
+// readFrame reads the next message of the request stream, reusing buf.
+// It returns io.EOF at the end of the stream.
+func (ups *upsHandler) readFrame(br *bufio.Reader, reqFormat format, buf []byte) ([]byte, error) {
+	if reqFormat == ndjsonFormat {
+		return ups.readLine(br, buf)
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxStreamFrameSize || (ups.config.MaxRequestSize > 0 && n > uint64(ups.config.MaxRequestSize)) {
+		return nil, errStreamFrameTooLarge
+	}
+	if uint64(cap(buf)) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	if _, err := io.ReadFull(br, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readLine reads the next non-empty line of an NDJSON request stream,
+// reusing buf.  It returns io.EOF at the end of the stream.
+func (ups *upsHandler) readLine(br *bufio.Reader, buf []byte) ([]byte, error) {
+	limit := maxStreamFrameSize
+	if ups.config.MaxRequestSize > 0 && ups.config.MaxRequestSize < maxStreamFrameSize {
+		limit = int(ups.config.MaxRequestSize)
+	}
+	for {
+		line := buf[:0]
+		for {
+			chunk, err := br.ReadSlice('\n')
+			line = append(line, chunk...)
+			if len(line) > limit+1 {
+				return nil, errStreamFrameTooLarge
+			}
+			if err == bufio.ErrBufferFull {
+				continue
+			} else if err == io.EOF && len(line) > 0 {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			break
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			return line, nil
+		}
+	}
+}
+
+// prepareStreamRequest binds and checks a message of a request stream
+// as for requests that are not streams.
+func (ups *upsHandler) prepareStreamRequest(ctx context.Context, r *http.Request, msg proto.Message) (int, error) {
+	if err := bindPath(r, msg); err != nil {
+		ups.logError(ctx, "bindPath", err)
+		return http.StatusInternalServerError, err
+	}
+	if len(ups.config.HeaderFields) > 0 {
+		if err := bindHeaders(r.Header, ups.config.HeaderFields, msg); err != nil {
+			ups.logError(ctx, "bindHeaders", err)
+			return http.StatusInternalServerError, err
+		}
+	}
+	ups.logRequestMessage(ctx, msg)
+	if ups.config.AnyResolver != nil {
+		if err := ups.config.AnyResolver.check(proto.MessageReflect(msg)); err != nil {
+			ups.logError(ctx, "AnyResolver.check", err)
+			return http.StatusInternalServerError, err
+		}
+	}
+	if ups.config.Authorizer != nil {
+		if statusCode, _ := ups.authorize(ctx, msg); statusCode != http.StatusOK {
+			return statusCode, errStreamUnauthorized
+		}
+	}
+	return http.StatusOK, nil
+}
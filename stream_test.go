@@ -0,0 +1,173 @@
+package ups
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func writeFrames(msgs ...proto.Message) *bytes.Buffer {
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		b, _ := proto.Marshal(msg)
+		buf.Write(binary.AppendUvarint(nil, uint64(len(b))))
+		buf.Write(b)
+	}
+	return &buf
+}
+
+func readFrames(t *testing.T, body []byte) []string {
+	var texts []string
+	br := bufio.NewReader(bytes.NewReader(body))
+	for {
+		n, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return texts
+		} else if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(br, b); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		var resp testingups.HelloResponse
+		if err := proto.Unmarshal(b, &resp); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		texts = append(texts, resp.Text)
+	}
+}
+
+func TestProtobufStream(t *testing.T) {
+	config := DefaultConfig
+	config.Streams = true
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if req.Name == "" {
+			return nil, testError(http.StatusTeapot)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+	}, config)
+
+	call := func(body *bytes.Buffer) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/hello", body)
+		req.Header.Set("Content-Type", "application/x-protobuf-stream")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := call(writeFrames(&testingups.HelloRequest{Name: "World"}, &testingups.HelloRequest{Name: "Everyone"}))
+	if resp.Code != http.StatusOK || resp.Header().Get("Content-Type") != "application/x-protobuf-stream" {
+		t.Errorf("unexpected response %d %s", resp.Code, resp.Header().Get("Content-Type"))
+	}
+	if texts := readFrames(t, resp.Body.Bytes()); len(texts) != 2 || texts[0] != "Hello, World!" || texts[1] != "Hello, Everyone!" {
+		t.Errorf("unexpected responses %v", texts)
+	}
+
+	resp = call(writeFrames(&testingups.HelloRequest{}, &testingups.HelloRequest{Name: "World"}))
+	if resp.Code != http.StatusTeapot {
+		t.Errorf("unexpected response %d", resp.Code)
+	}
+
+	resp = call(writeFrames(&testingups.HelloRequest{Name: "World"}, &testingups.HelloRequest{}))
+	if texts := readFrames(t, resp.Body.Bytes()); resp.Code != http.StatusOK || len(texts) != 1 {
+		t.Errorf("unexpected response %d %v", resp.Code, texts)
+	}
+
+	body := writeFrames(&testingups.HelloRequest{Name: "World"})
+	body.Truncate(body.Len() - 1)
+	if resp := call(body); resp.Code != http.StatusInternalServerError {
+		t.Errorf("unexpected response %d", resp.Code)
+	}
+
+	config.Streams = false
+	handler = UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{}
+	}, config)
+	if resp := call(writeFrames(&testingups.HelloRequest{Name: "World"})); resp.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("unexpected response %d", resp.Code)
+	}
+}
+
+func TestNDJSONStream(t *testing.T) {
+	config := DefaultConfig
+	config.Streams = true
+	config.MaxRequestSize = 100
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+
+	for _, test := range []struct {
+		body       string
+		statusCode int
+		expected   string
+	}{
+		{"{\"name\":\"World\"}\n\n{\"name\":\"Everyone\"}\n", http.StatusOK, "{\"text\":\"Hello, World!\"}\n{\"text\":\"Hello, Everyone!\"}\n"},
+		{"{\"name\":\"World\"}\r\n{\"name\":\"Everyone\"}", http.StatusOK, "{\"text\":\"Hello, World!\"}\n{\"text\":\"Hello, Everyone!\"}\n"},
+		{"{\"name\":\"World\"}\n{}\n", http.StatusOK, "{\"text\":\"Hello, World!\"}\n{\"text\":\"Hello, !\"}\n"},
+		{"", http.StatusOK, ""},
+		{"{\"name\":\"World\"}\n{\"name\":", http.StatusOK, "{\"text\":\"Hello, World!\"}\n"},
+		{"{\"name\":\"" + string(bytes.Repeat([]byte("x"), 200)) + "\"}\n", http.StatusRequestEntityTooLarge, "\n"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		req.ContentLength = -1
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != test.statusCode || resp.Body.String() != test.expected {
+			t.Errorf("%q: unexpected response %d %q", test.body, resp.Code, resp.Body.String())
+		}
+		if test.statusCode == http.StatusOK && resp.Header().Get("Content-Type") != "application/x-ndjson" {
+			t.Errorf("%q: unexpected Content-Type %s", test.body, resp.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestStreamTrailers(t *testing.T) {
+	config := DefaultConfig
+	config.Streams = true
+	config.StreamTerminal = func(ctx context.Context, status *StreamStatus) proto.Message {
+		return &testingups.HelloResponse{Text: strconv.Itoa(status.StatusCode) + " " + strconv.Itoa(status.Count)}
+	}
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if req.Name == "" {
+			return nil, testError(http.StatusTeapot)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+	}, config)
+
+	for _, test := range []struct {
+		reqs     []proto.Message
+		status   string
+		count    string
+		errorMsg string
+		texts    []string
+	}{
+		{[]proto.Message{&testingups.HelloRequest{Name: "World"}, &testingups.HelloRequest{Name: "Everyone"}}, "200", "2", "", []string{"Hello, World!", "Hello, Everyone!", "200 2"}},
+		{[]proto.Message{&testingups.HelloRequest{Name: "World"}, &testingups.HelloRequest{}}, "418", "1", "I'm a teapot", []string{"Hello, World!", "418 1"}},
+		{nil, "200", "0", "", []string{"200 0"}},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", writeFrames(test.reqs...))
+		req.Header.Set("Content-Type", "application/x-protobuf-stream")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		trailer := resp.Result().Trailer
+		if resp.Code != http.StatusOK || trailer.Get("Stream-Status") != test.status || trailer.Get("Stream-Count") != test.count || trailer.Get("Stream-Error") != test.errorMsg {
+			t.Errorf("unexpected response %d %v", resp.Code, trailer)
+		}
+		if texts := readFrames(t, resp.Body.Bytes()); !reflect.DeepEqual(texts, test.texts) {
+			t.Errorf("unexpected responses %v", texts)
+		}
+	}
+}
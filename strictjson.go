@@ -0,0 +1,208 @@
+package ups
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// strictJSONError is the error of a JSON request rejected with
+// Config.StrictJSON.
+type strictJSONError struct {
+	message string
+	offset  int
+	field   string
+}
+
+func (err *strictJSONError) Error() string {
+	if err.field != "" {
+		return "ups: " + err.message + ": " + err.field
+	}
+	return "ups: " + err.message
+}
+
+// checkStrictJSON rejects JSON requests with duplicate object keys,
+// including keys naming the same field by its name and by its JSON name,
+// with data after the top-level value, or with values out of the range
+// of integer fields.  Malformed JSON is left to the unmarshaller.
+func checkStrictJSON(req []byte, md protoreflect.MessageDescriptor) *strictJSONError {
+	dec := json.NewDecoder(bytes.NewReader(req))
+	dec.UseNumber()
+	// The stack has the keys of objects and nil for arrays.
+	var stack []map[string]bool
+	expectKey := false
+	for {
+		start := int(dec.InputOffset())
+		for start < len(req) && strings.IndexByte(" \t\r\n,:", req[start]) >= 0 {
+			start++
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, map[string]bool{})
+			expectKey = true
+		case json.Delim('['):
+			stack = append(stack, nil)
+			expectKey = false
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			expectKey = len(stack) > 0 && stack[len(stack)-1] != nil
+		default:
+			if expectKey {
+				key, _ := tok.(string)
+				if stack[len(stack)-1][key] {
+					return &strictJSONError{message: "duplicate key", offset: start, field: jsonFieldPath(req, start)}
+				}
+				stack[len(stack)-1][key] = true
+				expectKey = false
+			} else {
+				expectKey = len(stack) > 0 && stack[len(stack)-1] != nil
+			}
+		}
+		if len(stack) == 0 {
+			break
+		}
+	}
+	if offset := int(dec.InputOffset()); len(bytes.TrimSpace(req[offset:])) > 0 {
+		for strings.IndexByte(" \t\r\n", req[offset]) >= 0 {
+			offset++
+		}
+		return &strictJSONError{message: "data after top-level value", offset: offset}
+	}
+	if md == nil {
+		return nil
+	}
+	var v interface{}
+	dec = json.NewDecoder(bytes.NewReader(req))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil
+	}
+	return checkStrictMessage(v, md, "")
+}
+
+// checkStrictMessage checks the JSON object of a message for keys naming
+// the same field and for integers out of range.
+func checkStrictMessage(v interface{}, md protoreflect.MessageDescriptor, path string) *strictJSONError {
+	if md.ParentFile().Package() == "google.protobuf" {
+		switch md.Name() {
+		case "Int32Value", "Int64Value", "UInt32Value", "UInt64Value":
+			return checkStrictValue(v, md.Fields().ByName("value"), path)
+		}
+		return nil
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	// The keys are checked in order for deterministic errors.
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fields := map[protoreflect.FieldNumber]bool{}
+	for _, key := range keys {
+		val := obj[key]
+		fd := md.Fields().ByJSONName(key)
+		if fd == nil {
+			fd = md.Fields().ByName(protoreflect.Name(key))
+		}
+		if fd == nil {
+			continue
+		}
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+		if fields[fd.Number()] {
+			return &strictJSONError{message: "duplicate field", offset: -1, field: fieldPath}
+		}
+		fields[fd.Number()] = true
+		switch {
+		case fd.IsMap():
+			m, _ := val.(map[string]interface{})
+			for k, elt := range m {
+				if err := checkStrictValue(k, fd.MapKey(), fieldPath+"["+strconv.Quote(k)+"]"); err != nil {
+					return err
+				}
+				if err := checkStrictValue(elt, fd.MapValue(), fieldPath+"["+strconv.Quote(k)+"]"); err != nil {
+					return err
+				}
+			}
+		case fd.IsList():
+			list, _ := val.([]interface{})
+			for i, elt := range list {
+				if err := checkStrictValue(elt, fd, fmt.Sprintf("%s[%d]", fieldPath, i)); err != nil {
+					return err
+				}
+			}
+		default:
+			if err := checkStrictValue(val, fd, fieldPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkStrictValue checks a value of the field for integers out of
+// range.
+func checkStrictValue(v interface{}, fd protoreflect.FieldDescriptor, path string) *strictJSONError {
+	if fd.Message() != nil {
+		return checkStrictMessage(v, fd.Message(), path)
+	}
+	var s string
+	switch v := v.(type) {
+	case json.Number:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return nil
+	}
+	var err error
+	switch fd.Kind() {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		_, err = strconv.ParseInt(s, 10, 32)
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		_, err = strconv.ParseInt(s, 10, 64)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		_, err = strconv.ParseUint(s, 10, 32)
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		_, err = strconv.ParseUint(s, 10, 64)
+	}
+	if errors.Is(err, strconv.ErrRange) {
+		return &strictJSONError{message: "integer out of range", offset: -1, field: path}
+	}
+	return nil
+}
+
+// strictJSONErrorBody returns the JSON body of the response to a request
+// rejected with Config.StrictJSON.
+func strictJSONErrorBody(err *strictJSONError) []byte {
+	body := struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+		Offset  *int   `json:"offset,omitempty"`
+		Field   string `json:"field,omitempty"`
+	}{
+		Error:   "invalid_request",
+		Message: err.message,
+		Field:   err.field,
+	}
+	if err.offset >= 0 {
+		body.Offset = &err.offset
+	}
+	b, _ := json.Marshal(body)
+	return b
+}
@@ -0,0 +1,64 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestStrictJSON(t *testing.T) {
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("strict.proto"),
+		Package: proto.String("strict"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Counter"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("small_count"), JsonName: proto.String("smallCount"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("totals"), JsonName: proto.String("totals"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_UINT64.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()},
+				{Name: proto.String("child"), JsonName: proto.String("child"), Number: proto.Int32(3), Type: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(), TypeName: proto.String(".strict.Counter"), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := func(req *dynamicpb.Message) *dynamicpb.Message {
+		return req
+	}
+
+	for _, test := range []struct {
+		strict     bool
+		body       string
+		statusCode int
+		expected   string
+	}{
+		{false, `{"small_count":1,"small_count":2} {}`, http.StatusOK, `{"small_count":2}`},
+		{true, `{"small_count":1,"totals":["18446744073709551615"]}` + "\n", http.StatusOK, `{"small_count":1,"totals":["18446744073709551615"]}`},
+		{true, `{"small_count":1, "small_count":2}`, http.StatusBadRequest, `{"error":"invalid_request","message":"duplicate key","offset":18,"field":"small_count"}`},
+		{true, `{"child":{"small_count":1,"smallCount":2}}`, http.StatusBadRequest, `{"error":"invalid_request","message":"duplicate field","field":"child.small_count"}`},
+		{true, `{"small_count":1} {}`, http.StatusBadRequest, `{"error":"invalid_request","message":"data after top-level value","offset":18}`},
+		{true, `{"small_count":1}x`, http.StatusBadRequest, `{"error":"invalid_request","message":"data after top-level value","offset":17}`},
+		{true, `{"totals":[1,"18446744073709551616"]}`, http.StatusBadRequest, `{"error":"invalid_request","message":"integer out of range","field":"totals[1]"}`},
+		{true, `{"child":{"small_count":2147483648}}`, http.StatusBadRequest, `{"error":"invalid_request","message":"integer out of range","field":"child.small_count"}`},
+		{true, `{"small_count":`, http.StatusInternalServerError, "\n"},
+	} {
+		config := DefaultConfig
+		config.LogError = nil
+		config.StrictJSON = test.strict
+		handler := UPSDynamicWithConfig(echo, fd.Messages().ByName("Counter"), config)
+		req := httptest.NewRequest(http.MethodPost, "/counter", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != test.statusCode || resp.Body.String() != test.expected {
+			t.Errorf("%s: unexpected response: %d %s", test.body, resp.Code, resp.Body.String())
+		}
+	}
+}
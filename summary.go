@@ -0,0 +1,166 @@
+package ups
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestSummary aggregates the details of a request, for emitting a
+// single canonical log line per request with Config.LogSummary, which
+// is called after the response has been written.
+type RequestSummary struct {
+	Method     string
+	Route      string
+	StatusCode int
+
+	// RequestID is the value of the X-Request-Id request header.
+	RequestID string
+
+	// Principal is the subject of the AuthenticatedPrincipal, if any.
+	Principal string
+
+	// Tenant is the ID of the tenant of the request, if any.
+	Tenant string
+
+	// Duration is the total duration of the request.  DecodeDuration
+	// includes reading and unmarshalling the request, and
+	// EncodeDuration includes marshalling the response.
+	Duration        time.Duration
+	DecodeDuration  time.Duration
+	HandlerDuration time.Duration
+	EncodeDuration  time.Duration
+
+	RequestSize  int
+	ResponseSize int
+
+	// Error is the first error logged or returned by the handler.
+	Error error
+
+	// Deprecated is true if the handler has a Deprecation.
+	Deprecated bool
+
+	// DeprecatedFields are the paths of the deprecated fields set in
+	// the request, if there is a Config.LogDeprecatedFields.
+	DeprecatedFields []string
+
+	// Phases are the timestamps of the phases of the request.
+	Phases PhaseTimings
+}
+
+// Timing is the start and end times of a phase of a request, which are
+// zero if the phase has not started or ended.
+type Timing struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Duration returns the duration of the phase, or zero if the phase has
+// not ended.
+func (t Timing) Duration() time.Duration {
+	if t.Start.IsZero() || t.End.IsZero() {
+		return 0
+	}
+	return t.End.Sub(t.Start)
+}
+
+// PhaseTimings are the timestamps of the phases of a request, for
+// attributing latency.  A handler can get the timings of the phases
+// completed before it was called with Phases.
+type PhaseTimings struct {
+	// Start is the time the request started.
+	Start time.Time
+
+	ReadBody  Timing
+	Unmarshal Timing
+	Handler   Timing
+	Marshal   Timing
+	Write     Timing
+}
+
+// Phases returns the PhaseTimings of the request of the context.
+func Phases(ctx context.Context) (*PhaseTimings, bool) {
+	if s := requestSummaryFromContext(ctx); s != nil {
+		return &s.Phases, true
+	}
+	return nil, false
+}
+
+// String formats the summary as logfmt key=value pairs.
+func (s *RequestSummary) String() string {
+	var b strings.Builder
+	field := func(key, val string) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		if val == "" || strings.ContainsAny(val, " \"=\t\n") {
+			val = strconv.Quote(val)
+		}
+		b.WriteString(val)
+	}
+	field("method", s.Method)
+	field("route", s.Route)
+	field("status", strconv.Itoa(s.StatusCode))
+	field("duration", s.Duration.String())
+	field("decode", s.DecodeDuration.String())
+	field("handler", s.HandlerDuration.String())
+	field("encode", s.EncodeDuration.String())
+	field("request_size", strconv.Itoa(s.RequestSize))
+	field("response_size", strconv.Itoa(s.ResponseSize))
+	if s.Principal != "" {
+		field("principal", s.Principal)
+	}
+	if s.Tenant != "" {
+		field("tenant", s.Tenant)
+	}
+	if s.RequestID != "" {
+		field("request_id", s.RequestID)
+	}
+	if s.Error != nil {
+		field("error", s.Error.Error())
+	}
+	if s.Deprecated {
+		field("deprecated", "true")
+	}
+	if len(s.DeprecatedFields) > 0 {
+		field("deprecated_fields", strings.Join(s.DeprecatedFields, ","))
+	}
+	return b.String()
+}
+
+// LogCanonicalLine logs the summary with the Logger of the request, if
+// any, or with log.Print otherwise, for use as Config.LogSummary.
+func LogCanonicalLine(ctx context.Context, s *RequestSummary) {
+	logf(ctx, slog.LevelInfo, "%s", s.String())
+}
+
+// serverTiming formats the durations of the summary as a Server-Timing
+// header value.
+func serverTiming(s *RequestSummary) string {
+	var b strings.Builder
+	for _, m := range []struct {
+		name string
+		dur  time.Duration
+	}{
+		{"decode", s.DecodeDuration},
+		{"handler", s.HandlerDuration},
+		{"encode", s.EncodeDuration},
+	} {
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(m.name)
+		b.WriteString(";dur=")
+		b.WriteString(strconv.FormatFloat(float64(m.dur)/float64(time.Millisecond), 'f', -1, 64))
+	}
+	return b.String()
+}
+
+func requestSummaryFromContext(ctx context.Context) *RequestSummary {
+	s, _ := Value(ctx, summaryContextKey)
+	return s
+}
@@ -0,0 +1,156 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestLogSummary(t *testing.T) {
+	var summaries []*RequestSummary
+	config := DefaultConfig
+	config.Route = "hello"
+	config.LogSummary = func(ctx context.Context, s *RequestSummary) {
+		summaries = append(summaries, s)
+	}
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if req.Name == "" {
+			return nil, testError(http.StatusBadRequest)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+	}, config)
+
+	r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Request-Id", "abc123")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	r = httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{}`))
+	r.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(summaries) != 2 {
+		t.Fatalf("expected 2 summaries, got: %d", len(summaries))
+	}
+	s := summaries[0]
+	if s.Method != http.MethodPost || s.Route != "hello" || s.StatusCode != http.StatusOK || s.RequestID != "abc123" || s.RequestSize != 16 || s.ResponseSize != 24 || s.Error != nil {
+		t.Errorf("unexpected summary: %s", s)
+	}
+	if s.Duration <= 0 || s.Duration < s.DecodeDuration+s.HandlerDuration+s.EncodeDuration {
+		t.Errorf("unexpected durations: %s", s)
+	}
+	if !strings.HasPrefix(s.String(), "method=POST route=hello status=200 duration=") || !strings.HasSuffix(s.String(), " request_size=16 response_size=24 request_id=abc123") {
+		t.Errorf("unexpected String: %s", s)
+	}
+	s = summaries[1]
+	var terr testError
+	if s.StatusCode != http.StatusBadRequest || !errors.As(s.Error, &terr) {
+		t.Errorf("unexpected summary: %s", s)
+	}
+}
+
+func TestRequestSummaryString(t *testing.T) {
+	s := &RequestSummary{
+		Method:     http.MethodPost,
+		Route:      "/hello",
+		StatusCode: http.StatusInternalServerError,
+		Duration:   time.Millisecond,
+		Principal:  "alice",
+		Error:      errors.New("bad thing"),
+	}
+	expected := `method=POST route=/hello status=500 duration=1ms decode=0s handler=0s encode=0s request_size=0 response_size=0 principal=alice error="bad thing"`
+	if s.String() != expected {
+		t.Errorf("expected: %s, got: %s", expected, s)
+	}
+}
+
+func TestServerTiming(t *testing.T) {
+	config := DefaultConfig
+	config.ServerTiming = true
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		time.Sleep(time.Millisecond)
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+	r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	header := w.Header().Get("Server-Timing")
+	metrics := strings.Split(header, ", ")
+	if len(metrics) != 3 || !strings.HasPrefix(metrics[0], "decode;dur=") || !strings.HasPrefix(metrics[1], "handler;dur=") || !strings.HasPrefix(metrics[2], "encode;dur=") || strings.HasPrefix(metrics[1], "handler;dur=0") {
+		t.Errorf("unexpected Server-Timing: %s", header)
+	}
+
+	s := &RequestSummary{DecodeDuration: 1500 * time.Microsecond, HandlerDuration: 2 * time.Millisecond}
+	if timing := serverTiming(s); timing != "decode;dur=1.5, handler;dur=2, encode;dur=0" {
+		t.Errorf("unexpected Server-Timing: %s", timing)
+	}
+}
+
+func TestPhases(t *testing.T) {
+	var inHandler PhaseTimings
+	var summary *RequestSummary
+	config := DefaultConfig
+	config.LogSummary = func(ctx context.Context, s *RequestSummary) {
+		summary = s
+	}
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) *testingups.HelloResponse {
+		if phases, ok := Phases(ctx); ok {
+			inHandler = *phases
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+	r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+	r.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if inHandler.Start.IsZero() || inHandler.Unmarshal.End.IsZero() || inHandler.Handler.Start.IsZero() || !inHandler.Handler.End.IsZero() || !inHandler.Write.Start.IsZero() {
+		t.Errorf("unexpected phases in handler: %+v", inHandler)
+	}
+	if summary == nil {
+		t.Fatal("expected summary")
+	}
+	p := summary.Phases
+	times := []time.Time{p.Start, p.ReadBody.Start, p.ReadBody.End, p.Unmarshal.Start, p.Unmarshal.End, p.Handler.Start, p.Handler.End, p.Marshal.Start, p.Marshal.End, p.Write.Start, p.Write.End}
+	for i, tm := range times {
+		if tm.IsZero() || (i > 0 && tm.Before(times[i-1])) {
+			t.Errorf("unexpected phases: %+v", p)
+			break
+		}
+	}
+	if summary.HandlerDuration != p.Handler.Duration() || summary.EncodeDuration != p.Marshal.Duration() {
+		t.Errorf("unexpected durations: %s", summary)
+	}
+
+	if _, ok := Phases(context.Background()); ok {
+		t.Errorf("unexpected phases without request")
+	}
+	if d := (Timing{Start: time.Now()}).Duration(); d != 0 {
+		t.Errorf("unexpected duration: %s", d)
+	}
+}
+
+func TestProfileLabels(t *testing.T) {
+	var route, method string
+	config := DefaultConfig
+	config.Route = "hello"
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) *testingups.HelloResponse {
+		route, _ = pprof.Label(ctx, "route")
+		method, _ = pprof.Label(ctx, "method")
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+	r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+	r.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	if route != "hello" || method != http.MethodPost {
+		t.Errorf("unexpected labels: route=%s method=%s", route, method)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package ups
+
+import (
+	"net"
+)
+
+func systemdListeners(listenPID, listenFDs, listenFDNames string) ([]net.Listener, []string, error) {
+	return nil, nil, nil
+}
@@ -0,0 +1,55 @@
+//go:build unix
+
+package ups
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// systemdListenFDsStart is the first file descriptor passed by systemd
+// socket activation.
+const systemdListenFDsStart = 3
+
+func systemdListeners(listenPID, listenFDs, listenFDNames string) ([]net.Listener, []string, error) {
+	if listenPID == "" || listenFDs == "" {
+		return nil, nil, nil
+	}
+	if pid, err := strconv.Atoi(listenPID); err != nil || pid != os.Getpid() {
+		return nil, nil, nil
+	}
+	n, err := strconv.Atoi(listenFDs)
+	if err != nil || n < 0 {
+		return nil, nil, errors.New("ups: invalid LISTEN_FDS: " + listenFDs)
+	}
+	var names []string
+	if listenFDNames != "" {
+		names = strings.Split(listenFDNames, ":")
+	}
+	listeners := make([]net.Listener, 0, n)
+	listenerNames := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		fd := systemdListenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, nil, err
+		}
+		listeners = append(listeners, l)
+		listenerNames = append(listenerNames, name)
+	}
+	return listeners, listenerNames, nil
+}
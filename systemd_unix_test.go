@@ -0,0 +1,24 @@
+//go:build unix
+
+package ups
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestSystemdListeners(t *testing.T) {
+	if listeners, _, err := systemdListeners("", "", ""); listeners != nil || err != nil {
+		t.Errorf("expected no listeners, got: %v %v", listeners, err)
+	}
+	if listeners, _, err := systemdListeners("1", "1", ""); listeners != nil || err != nil {
+		t.Errorf("expected no listeners for other pid, got: %v %v", listeners, err)
+	}
+	if _, _, err := systemdListeners(strconv.Itoa(os.Getpid()), "x", ""); err == nil {
+		t.Errorf("expected error for invalid LISTEN_FDS")
+	}
+	if err := (&Server{}).ServeListeners(nil); err == nil {
+		t.Errorf("expected error for no listeners")
+	}
+}
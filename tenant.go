@@ -0,0 +1,109 @@
+package ups
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Tenant is the tenant of a request.
+type Tenant struct {
+	ID string
+
+	// Value is the per-tenant value from the Lookup of the
+	// TenantResolver, such as the tenant's database, for handlers.
+	Value interface{}
+}
+
+// TenantResolver resolves the tenants of requests, from, in order, the
+// Claim of the AuthenticatedPrincipal, the Header, or the subdomain of
+// the Domain.  The tenant is available from the context with
+// TenantFromContext, and is the Tenant of the RequestSummary, so that
+// metrics can be partitioned by tenant.
+type TenantResolver struct {
+	// Claim, if not nil, returns the tenant ID of the authenticated
+	// principal, or "" if none.
+	Claim func(*Principal) string
+
+	// Header, if not empty, is the request header with the tenant ID,
+	// such as "X-Tenant-Id".
+	Header string
+
+	// Domain, if not empty, is the parent domain of the tenant
+	// subdomains, such as "example.com" for "acme.example.com".
+	Domain string
+
+	// Lookup, if not nil, returns the Tenant with the ID, or nil if
+	// there is no such tenant, in which case the request gets a 403
+	// response.  If nil, all tenant IDs are valid.
+	Lookup func(ctx context.Context, id string) (*Tenant, error)
+
+	// Required, if true, rejects requests without tenants with 400
+	// responses.
+	Required bool
+
+	// Parameter, if not nil, returns the parameter of handlers taking
+	// one, as with UPSWithParameter, for the tenant of the request, such
+	// as the tenant's database, or nil for the parameter of the handler.
+	// It is not called for requests without tenants.  The parameter
+	// must be assignable to the parameter type of the handler.
+	Parameter func(*Tenant) interface{}
+}
+
+var errUnknownTenant = errors.New("ups: unknown tenant")
+
+// TenantFromContext returns the tenant of the request of the context.
+func TenantFromContext(ctx context.Context) (*Tenant, bool) {
+	tenant, ok := Value(ctx, TenantKey)
+	return tenant, ok
+}
+
+// id returns the tenant ID of the request, or "" if none.
+func (t *TenantResolver) id(ctx context.Context, r *http.Request) string {
+	if t.Claim != nil {
+		if principal, ok := AuthenticatedPrincipal(ctx); ok {
+			if id := t.Claim(principal); id != "" {
+				return id
+			}
+		}
+	}
+	if t.Header != "" {
+		if id := r.Header.Get(t.Header); id != "" {
+			return id
+		}
+	}
+	if t.Domain != "" {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if sub, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(t.Domain)); ok && sub != "" && !strings.Contains(sub, ".") {
+			return sub
+		}
+	}
+	return ""
+}
+
+// resolve returns the tenant of the request, or nil and the status code
+// of the response if it is rejected.
+func (t *TenantResolver) resolve(ctx context.Context, r *http.Request) (*Tenant, int, error) {
+	id := t.id(ctx, r)
+	if id == "" {
+		if t.Required {
+			return nil, http.StatusBadRequest, nil
+		}
+		return nil, http.StatusOK, nil
+	}
+	if t.Lookup == nil {
+		return &Tenant{ID: id}, http.StatusOK, nil
+	}
+	tenant, err := t.Lookup(ctx, id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	} else if tenant == nil {
+		return nil, http.StatusForbidden, errUnknownTenant
+	}
+	return tenant, http.StatusOK, nil
+}
@@ -0,0 +1,123 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestTenantResolver(t *testing.T) {
+	var summaries []*RequestSummary
+	config := DefaultConfig
+	config.LogError = nil
+	config.LogSummary = func(ctx context.Context, s *RequestSummary) {
+		summaries = append(summaries, s)
+	}
+	config.Tenants = &TenantResolver{
+		Header: "X-Tenant-Id",
+		Domain: "example.com",
+		Lookup: func(ctx context.Context, id string) (*Tenant, error) {
+			if id == "unknown" {
+				return nil, nil
+			}
+			return &Tenant{ID: id, Value: "greeting for " + id}, nil
+		},
+		Required: true,
+	}
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		tenant, _ := TenantFromContext(ctx)
+		return &testingups.HelloResponse{Text: tenant.Value.(string)}, nil
+	}, config)
+
+	for _, test := range []struct {
+		host       string
+		header     string
+		statusCode int
+		expected   string
+	}{
+		{"acme.example.com", "", http.StatusOK, `{"text":"greeting for acme"}`},
+		{"acme.example.com:8080", "", http.StatusOK, `{"text":"greeting for acme"}`},
+		{"acme.example.com", "initech", http.StatusOK, `{"text":"greeting for initech"}`},
+		{"example.com", "", http.StatusBadRequest, ""},
+		{"a.b.example.com", "", http.StatusBadRequest, ""},
+		{"unknown.example.com", "", http.StatusForbidden, ""},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{}`))
+		r.Host = test.host
+		r.Header.Set("Content-Type", "application/json")
+		if test.header != "" {
+			r.Header.Set("X-Tenant-Id", test.header)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, r)
+		if resp.Code != test.statusCode || (test.expected != "" && resp.Body.String() != test.expected) {
+			t.Errorf("%s %s: unexpected response: %d %s", test.host, test.header, resp.Code, resp.Body.String())
+		}
+	}
+	if len(summaries) != 6 || summaries[0].Tenant != "acme" || summaries[2].Tenant != "initech" || summaries[3].Tenant != "" {
+		t.Errorf("unexpected summaries")
+	}
+}
+
+func TestTenantResolverClaim(t *testing.T) {
+	resolver := &TenantResolver{
+		Claim:  func(p *Principal) string { return p.ClientID },
+		Header: "X-Tenant-Id",
+	}
+	r := httptest.NewRequest(http.MethodPost, "/hello", nil)
+	r.Header.Set("X-Tenant-Id", "header")
+	ctx := WithValue(context.Background(), PrincipalKey, &Principal{ClientID: "claim"})
+	if tenant, code, err := resolver.resolve(ctx, r); tenant == nil || tenant.ID != "claim" || code != http.StatusOK || err != nil {
+		t.Errorf("unexpected tenant: %+v %d %v", tenant, code, err)
+	}
+	if tenant, code, err := resolver.resolve(context.Background(), r); tenant == nil || tenant.ID != "header" || code != http.StatusOK || err != nil {
+		t.Errorf("unexpected tenant: %+v %d %v", tenant, code, err)
+	}
+}
+
+func TestTenantResolverParameter(t *testing.T) {
+	config := DefaultConfig
+	config.LogError = nil
+	config.LogPanic = nil
+	config.Tenants = &TenantResolver{
+		Header: "X-Tenant-Id",
+		Parameter: func(tenant *Tenant) interface{} {
+			switch tenant.ID {
+			case "acme":
+				return "Welcome to Acme"
+			case "invalid":
+				return 1
+			}
+			return nil
+		},
+	}
+	handler := UPSWithParameterAndConfig(func(greeting string, req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: greeting + ", " + req.Name}
+	}, "Hello", config)
+
+	for _, test := range []struct {
+		tenant     string
+		statusCode int
+		expected   string
+	}{
+		{"acme", http.StatusOK, `{"text":"Welcome to Acme, World"}`},
+		{"initech", http.StatusOK, `{"text":"Hello, World"}`},
+		{"", http.StatusOK, `{"text":"Hello, World"}`},
+		{"invalid", http.StatusInternalServerError, ""},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+		r.Header.Set("Content-Type", "application/json")
+		if test.tenant != "" {
+			r.Header.Set("X-Tenant-Id", test.tenant)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, r)
+		if resp.Code != test.statusCode || (test.expected != "" && resp.Body.String() != test.expected) {
+			t.Errorf("%s: unexpected response: %d %s", test.tenant, resp.Code, resp.Body.String())
+		}
+	}
+}
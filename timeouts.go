@@ -0,0 +1,109 @@
+package ups
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Timeouts limits the phases of requests, so that slow clients cannot
+// occupy handlers indefinitely.  Zero durations are not limits.
+//
+// The limits of reading and writing are set with http.ResponseController,
+// and are not enforced with ResponseWriters that do not support them.
+// They do not apply to request streams.
+type Timeouts struct {
+	// ReadBody limits reading the request body.  Requests exceeding it
+	// get 408 responses.
+	ReadBody time.Duration
+
+	// Handler limits the handler, as the deadline of its context.
+	// Handlers returning the error of the context get 503 responses.
+	Handler time.Duration
+
+	// Write limits writing the response.
+	Write time.Duration
+
+	// Deadline limits the whole request, as the deadline of the context
+	// and of reading and writing.
+	Deadline time.Duration
+}
+
+// deadline returns the deadline of a phase with the limit that starts
+// now, which is also limited by the Deadline of the request that
+// started at start, or the zero time if there is no limit.
+func (t *Timeouts) deadline(start time.Time, limit time.Duration) time.Time {
+	var deadline time.Time
+	if limit > 0 {
+		deadline = time.Now().Add(limit)
+	}
+	if t.Deadline > 0 {
+		if d := start.Add(t.Deadline); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	return deadline
+}
+
+// withDeadline returns the context limited by the Deadline of the
+// request that started at start.
+func (t *Timeouts) withDeadline(ctx context.Context, start time.Time) (context.Context, context.CancelFunc) {
+	if t.Deadline <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithDeadline(ctx, start.Add(t.Deadline))
+}
+
+// withHandlerTimeout returns the context of the handler.
+func (t *Timeouts) withHandlerTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t.Handler <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, t.Handler)
+}
+
+// timedOut reports whether the error of the handler is the error of
+// its context.
+func (t *Timeouts) timedOut(ctx context.Context, err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil
+}
+
+// readTimedOut reports whether the error of reading the request body is
+// from the read deadline.
+func readTimedOut(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// setReadDeadline sets the deadline of reading the request body.
+func (t *Timeouts) setReadDeadline(w http.ResponseWriter, start time.Time) {
+	if deadline := t.deadline(start, t.ReadBody); !deadline.IsZero() {
+		http.NewResponseController(w).SetReadDeadline(deadline)
+	}
+}
+
+// clearReadDeadline removes the deadline of reading after the request
+// body is read, as the net/http server cancels the context of the
+// request if its background read of the connection fails.
+func (t *Timeouts) clearReadDeadline(w http.ResponseWriter) {
+	if t.ReadBody > 0 || t.Deadline > 0 {
+		http.NewResponseController(w).SetReadDeadline(time.Time{})
+	}
+}
+
+// setWriteDeadline sets the deadline of writing the response.
+func (t *Timeouts) setWriteDeadline(w http.ResponseWriter, start time.Time) {
+	if deadline := t.deadline(start, t.Write); !deadline.IsZero() {
+		http.NewResponseController(w).SetWriteDeadline(deadline)
+	}
+}
+
+// clearWriteDeadline removes the deadline of writing after the response
+// is written, as the net/http server does not reset it for the next
+// request of the connection unless it has a WriteTimeout.
+func (t *Timeouts) clearWriteDeadline(w http.ResponseWriter) {
+	if t.Write > 0 || t.Deadline > 0 {
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	}
+}
@@ -0,0 +1,78 @@
+package ups
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestTimeoutsReadBody(t *testing.T) {
+	config := DefaultConfig
+	config.LogError = nil
+	config.Timeouts = &Timeouts{ReadBody: 50 * time.Millisecond}
+	server := httptest.NewServer(UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello " + req.Name}
+	}, config))
+	defer server.Close()
+
+	for _, test := range []struct {
+		body       string
+		statusCode int
+	}{
+		{`{"name":"World"}`, http.StatusOK},
+		{`{"name":`, http.StatusRequestTimeout},
+	} {
+		conn, err := net.Dial("tcp", server.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte("POST /hello HTTP/1.1\r\nHost: test\r\nContent-Type: application/json\r\nContent-Length: 16\r\n\r\n" + test.body))
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != test.statusCode {
+			t.Errorf("%s: unexpected status: %d", test.body, resp.StatusCode)
+		}
+	}
+}
+
+func TestTimeoutsHandler(t *testing.T) {
+	config := DefaultConfig
+	config.LogError = nil
+	config.Timeouts = &Timeouts{Handler: 10 * time.Millisecond, Deadline: time.Minute}
+	handler := UPSWithConfig(func(ctx context.Context, req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Second {
+			t.Errorf("unexpected deadline: %v %t", deadline, ok)
+		}
+		if req.Name == "slow" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return &testingups.HelloResponse{Text: "Hello " + req.Name}, nil
+	}, config)
+
+	for _, test := range []struct {
+		name       string
+		statusCode int
+	}{
+		{"World", http.StatusOK},
+		{"slow", http.StatusServiceUnavailable},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+test.name+`"}`))
+		r.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, r)
+		if resp.Code != test.statusCode {
+			t.Errorf("%s: unexpected status: %d", test.name, resp.Code)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+)
+
+// TransportRequest is a request received by a Transport.  The Body is
+// the request message, in the format given by the Content-Type header,
+// with protobuf being the default.
+type TransportRequest struct {
+	// Route is the path of the request, such as the route of the
+	// handler.  If empty, it is "/".
+	Route  string
+	Header http.Header
+	Body   []byte
+
+	// Source is the request of the Transport implementation.
+	Source interface{}
+}
+
+// TransportResponse is the response to a TransportRequest.
+type TransportResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Transport carries requests to ups handlers and their responses back,
+// for transports other than HTTP, such as queues and functions, so that
+// they share the decoding, validation, encoding, and logging of HTTP
+// requests.
+type Transport interface {
+	// Receive waits for the next request.
+	Receive(context.Context) (*TransportRequest, error)
+
+	// Respond sends the response to the request.
+	Respond(context.Context, *TransportRequest, *TransportResponse) error
+}
+
+// ServeTransport invokes the handler, which is usually created with UPS,
+// for each of the requests received from the Transport, in order, until
+// the context is done or the Transport fails, returning the error.
+func ServeTransport(ctx context.Context, transport Transport, handler http.Handler) error {
+	for {
+		req, err := transport.Receive(ctx)
+		if err != nil {
+			return err
+		}
+		if err := transport.Respond(ctx, req, Invoke(ctx, handler, req)); err != nil {
+			return err
+		}
+	}
+}
+
+// Invoke sends the request to the handler as a POST request, returning
+// the response.
+func Invoke(ctx context.Context, handler http.Handler, req *TransportRequest) *TransportResponse {
+	route := req.Route
+	if route == "" {
+		route = "/"
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, route, bytes.NewReader(req.Body))
+	if err != nil {
+		return &TransportResponse{StatusCode: http.StatusBadRequest, Header: http.Header{}}
+	}
+	for key, values := range req.Header {
+		r.Header[key] = values
+	}
+	if r.Header.Get("Content-Type") == "" {
+		r.Header.Set("Content-Type", "application/octet-stream")
+	}
+	r.ContentLength = int64(len(req.Body))
+	r.RequestURI = route
+	w := &transportResponseWriter{header: http.Header{}}
+	handler.ServeHTTP(w, r)
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return &TransportResponse{StatusCode: w.statusCode, Header: w.header, Body: w.body.Bytes()}
+}
+
+// transportResponseWriter collects the response of Invoke.
+type transportResponseWriter struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (w *transportResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *transportResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
+	}
+}
+
+func (w *transportResponseWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
@@ -0,0 +1,71 @@
+package ups
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+type testTransport struct {
+	requests  []*TransportRequest
+	responses []*TransportResponse
+}
+
+var errTestTransportDone = errors.New("done")
+
+func (t *testTransport) Receive(ctx context.Context) (*TransportRequest, error) {
+	if len(t.requests) == 0 {
+		return nil, errTestTransportDone
+	}
+	req := t.requests[0]
+	t.requests = t.requests[1:]
+	return req, nil
+}
+
+func (t *testTransport) Respond(ctx context.Context, req *TransportRequest, resp *TransportResponse) error {
+	t.responses = append(t.responses, resp)
+	return nil
+}
+
+func TestServeTransport(t *testing.T) {
+	handler := UPS(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if req.Name == "" {
+			return nil, testError(http.StatusTeapot)
+		}
+		return &testingups.HelloResponse{Text: "Hello " + req.Name}, nil
+	})
+	body, _ := proto.Marshal(&testingups.HelloRequest{Name: "World"})
+	transport := &testTransport{requests: []*TransportRequest{
+		{Body: body},
+		{Route: "/hello", Header: http.Header{"Content-Type": {"application/json"}}, Body: []byte(`{"name":"JSON"}`)},
+		{Body: nil},
+	}}
+	if err := ServeTransport(context.Background(), transport, handler); err != errTestTransportDone {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if len(transport.responses) != 3 {
+		t.Fatalf("unexpected responses: %d", len(transport.responses))
+	}
+
+	resp := transport.responses[0]
+	var hello testingups.HelloResponse
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status: %d", resp.StatusCode)
+	} else if err := proto.Unmarshal(resp.Body, &hello); err != nil || hello.Text != "Hello World" {
+		t.Errorf("unexpected response: %v %v", &hello, err)
+	}
+
+	resp = transport.responses[1]
+	if resp.StatusCode != http.StatusOK || string(resp.Body) != `{"text":"Hello JSON"}` || resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected response: %d %s %v", resp.StatusCode, resp.Body, resp.Header)
+	}
+
+	if resp = transport.responses[2]; resp.StatusCode != http.StatusTeapot {
+		t.Errorf("unexpected status: %d", resp.StatusCode)
+	}
+}
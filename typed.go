@@ -0,0 +1,23 @@
+package ups
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// UPSFunc takes a func and creates an http.Handler using the provided
+// Config, as with UPSWithConfig, except that the func is called directly
+// instead of with reflection, which is faster for small messages.
+//
+// Req must be a pointer to a message type.
+//
+// UPSFunc will panic if Req is not a pointer to a message type.
+func UPSFunc[Req, Resp proto.Message](handler func(context.Context, Req) (Resp, error), config Config) http.Handler {
+	ups := UPSWithParameterAndConfig(handler, nil, config).(*upsHandler)
+	ups.call = func(ctx context.Context, req proto.Message) (proto.Message, error) {
+		return handler(ctx, req.(Req))
+	}
+	return ups
+}
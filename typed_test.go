@@ -0,0 +1,64 @@
+package ups
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/qpliu/ups/testingups"
+)
+
+func hello(ctx context.Context, req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+	if req.Name == "" {
+		return nil, testError(http.StatusNotFound)
+	}
+	return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+}
+
+func TestUPSFunc(t *testing.T) {
+	handler := UPSFunc(hello, DefaultConfig)
+	for _, test := range []struct {
+		body       string
+		statusCode int
+		expected   string
+	}{
+		{`{"name":"World"}`, http.StatusOK, `{"text":"Hello, World!"}`},
+		{`{}`, http.StatusNotFound, "\n"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != test.statusCode || resp.Body.String() != test.expected {
+			t.Errorf("%s: unexpected response %d %s", test.body, resp.Code, resp.Body.String())
+		}
+	}
+}
+
+func BenchmarkHandler(b *testing.B) {
+	config := DefaultConfig
+	config.LogStartRequest = nil
+	config.LogEndRequest = nil
+	config.LogRequestMessage = nil
+	config.LogResponseMessage = nil
+	config.LogRequestBytes = nil
+	config.LogResponseBytes = nil
+	body, _ := proto.Marshal(&testingups.HelloRequest{Name: "World"})
+	for name, handler := range map[string]http.Handler{
+		"reflect": UPSWithConfig(hello, config),
+		"func":    UPSFunc(hello, config),
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewReader(body))
+				req.Header.Set("Content-Type", "application/octet-stream")
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+			}
+		})
+	}
+}
@@ -4,16 +4,24 @@ package ups
 import (
 	"bytes"
 	"context"
-	"log"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
 	"mime"
 	"net/http"
 	"net/url"
 	"reflect"
 	"runtime/debug"
+	"runtime/pprof"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/golang/protobuf/jsonpb"
 	"github.com/golang/protobuf/proto"
+	"golang.org/x/text/encoding"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 var (
@@ -21,43 +29,57 @@ var (
 		JSONMarshaler: &jsonpb.Marshaler{OrigName: true},
 
 		LogError: func(ctx context.Context, tag string, err error) {
-			log.Printf("ERROR: %s: %s", tag, err.Error())
+			logf(ctx, slog.LevelError, "ERROR: %s: %s", tag, err.Error())
 		},
 		LogPanic: func(ctx context.Context, err interface{}) {
-			log.Printf("PANIC: %v: %s", err, debug.Stack())
+			logf(ctx, slog.LevelError, "PANIC: %v: %s", err, debug.Stack())
 		},
 		LogStartRequest: func(ctx context.Context, method string, url *url.URL) {
-			log.Printf("%s %s", method, url)
+			if addr, ok := ClientIP(ctx); ok {
+				logf(ctx, slog.LevelInfo, "%s %s %s", addr, method, url)
+			} else {
+				logf(ctx, slog.LevelInfo, "%s %s", method, url)
+			}
 		},
 		LogEndRequest: func(ctx context.Context, method string, url *url.URL, statusCode int) {
-			log.Printf("STATUS: %d %s", statusCode, url)
+			logf(ctx, slog.LevelInfo, "STATUS: %d %s", statusCode, url)
 		},
 		LogRequestMessage: func(ctx context.Context, req proto.Message) {
-			log.Printf("REQ proto: %s", req.String())
+			logf(ctx, slog.LevelDebug, "REQ proto: %s", req.String())
 		},
 		LogResponseMessage: func(ctx context.Context, resp proto.Message) {
-			log.Printf("RESP proto: %s", resp.String())
+			logf(ctx, slog.LevelDebug, "RESP proto: %s", resp.String())
 		},
 		LogRequestBytes: func(ctx context.Context, req []byte) {
-			log.Printf("REQ bytes: %x", req)
+			logf(ctx, slog.LevelDebug, "REQ bytes: %x", req)
 		},
 		LogResponseBytes: func(ctx context.Context, resp []byte) {
-			log.Printf("RESP bytes: %x", resp)
+			logf(ctx, slog.LevelDebug, "RESP bytes: %x", resp)
 		},
 		LogRequestJSON: func(ctx context.Context, req string) {
-			log.Printf("REQ JSON: %s", req)
+			logf(ctx, slog.LevelDebug, "REQ JSON: %s", req)
 		},
 		LogResponseJSON: func(ctx context.Context, resp string) {
-			log.Printf("RESP JSON: %s", resp)
+			logf(ctx, slog.LevelDebug, "RESP JSON: %s", resp)
+		},
+		LogRequestText: func(ctx context.Context, req string) {
+			logf(ctx, slog.LevelDebug, "REQ text: %s", req)
+		},
+		LogResponseText: func(ctx context.Context, resp string) {
+			logf(ctx, slog.LevelDebug, "RESP text: %s", resp)
 		},
 	}
 )
 
+var errResponseTooLarge = errors.New("ups: response exceeds MaxResponseSize")
+
 var (
 	errorType   = reflect.TypeOf((*error)(nil)).Elem()
 	messageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
 	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
 	requestType = reflect.TypeOf((*http.Request)(nil))
+
+	rawResponseType = reflect.TypeOf((*RawResponse)(nil))
 )
 
 type handlerType int
@@ -71,9 +93,41 @@ const (
 	requestParamHandlerType
 )
 
+// responseState holds the request of the context and the response
+// settings made by handlers with context helpers.
+type responseState struct {
+	request  *http.Request
+	cache    *CachePolicy
+	cacheSet bool
+	cookies  []*http.Cookie
+	pooled   []proto.Message
+}
+
+func responseStateFromContext(ctx context.Context) *responseState {
+	state, _ := Value(ctx, responseContextKey)
+	return state
+}
+
+type format int
+
+const (
+	protobufFormat format = iota
+	jsonFormat
+	formFormat
+	textFormat
+	codecFormat
+	queryFormat
+	protobufStreamFormat
+	ndjsonFormat
+)
+
 type Config struct {
 	JSONMarshaler *jsonpb.Marshaler
 
+	// JSONUnmarshaler, if not nil, unmarshals JSON requests, such as to
+	// allow unknown fields.
+	JSONUnmarshaler *jsonpb.Unmarshaler
+
 	LogError           func(context.Context, string, error)
 	LogPanic           func(context.Context, interface{})
 	LogStartRequest    func(ctx context.Context, method string, url *url.URL)
@@ -84,8 +138,263 @@ type Config struct {
 	LogResponseBytes   func(context.Context, []byte)
 	LogRequestJSON     func(context.Context, string)
 	LogResponseJSON    func(context.Context, string)
+	LogRequestText     func(context.Context, string)
+	LogResponseText    func(context.Context, string)
+
+	// LoggerForRequest, if not nil, returns the logger of each request,
+	// such as with the request ID, which is available from the context
+	// with Logger, and is used by the Log funcs of the DefaultConfig
+	// and by LogCanonicalLine.  It is called again after authentication,
+	// with the AuthenticatedPrincipal in the context.
+	LoggerForRequest func(context.Context, *http.Request) *slog.Logger
+
+	// LogSummary, if not nil, is called at the end of each request with
+	// the summary of the request, such as with LogCanonicalLine.
+	LogSummary func(context.Context, *RequestSummary)
+
+	// Reporter, if not nil, is called for handler panics and 5xx
+	// responses.
+	Reporter Reporter
+
+	// PanicDump, if not zero, is the size limit of a dump of the stacks
+	// of all goroutines that is captured when the handler panics.  The
+	// dump, along with the request ID and the decoded request, is
+	// available to LogPanic with PanicDetails.
+	PanicDump int
+
+	// DebugPanics, if true, responds to handler panics with a JSON body
+	// with the panic value and the stack trace instead of the opaque
+	// 500, for developing handlers.  It must not be set in production.
+	DebugPanics bool
+
+	// LogSampler, if not nil, limits the requests for which payloads
+	// are logged.
+	LogSampler *LogSampler
+
+	// HeaderFields maps request headers to the fields, by JSON name or
+	// proto name, that are set from them when not set by the request
+	// body, such as "Accept-Language" to "locale", so that handlers need
+	// not take the *http.Request.  The fields must be scalar or enum
+	// fields, or repeated scalar or enum fields, which are set from all
+	// the values of the header.
+	HeaderFields map[string]string
+
+	// Cache, if not nil, sets the caching headers of successful
+	// responses.  Handlers can override it with SetCachePolicy.
+	Cache *CachePolicy
+
+	// AllowGET, if true, also accepts GET and HEAD requests, with the
+	// request message set from the query parameters as with forms.  The
+	// responses are JSON if there is a JSONMarshaler, and protobuf
+	// otherwise, with ETag headers, and If-None-Match requests get 304
+	// responses when the response is unchanged.
+	AllowGET bool
+
+	// Timeouts, if not nil, limits reading the request body, the
+	// handler, writing the response, and the whole request.
+	Timeouts *Timeouts
+
+	// Discovery, if not NoDiscovery, answers OPTIONS requests with the
+	// allowed methods and accepted Content-Types and, with
+	// DiscoverSchemas, the request and response message schemas, for
+	// tooling.  The answers are not authenticated.
+	Discovery Discovery
+
+	// ProtobufContentType is the Content-Type of protobuf responses,
+	// such as application/x-protobuf or application/protobuf.  If
+	// empty, application/octet-stream is used.  ProtobufTypeParameter,
+	// if true, adds the proto parameter with the full name of the
+	// response message, as in
+	// application/x-protobuf; proto=package.Message.
+	ProtobufContentType   string
+	ProtobufTypeParameter bool
+
+	// JSONCharsets, if true, accepts JSON requests with charsets other
+	// than UTF-8, which are transcoded to UTF-8.  Otherwise, they get 415
+	// responses.  JSONResponseCharset, if true, makes the Content-Type
+	// of JSON responses application/json; charset=utf-8.
+	JSONCharsets        bool
+	JSONResponseCharset bool
+
+	// ContentTypeMode selects how request Content-Types are matched.
+	// With ContentTypePermissive, SniffContentType, if true, treats
+	// requests without a Content-Type as JSON if the body looks like a
+	// JSON object.
+	ContentTypeMode  ContentTypeMode
+	SniffContentType bool
+
+	// RawRequest, if true, makes the bodies of requests, as received,
+	// and the RawRequestHeaders available from the context with Raw,
+	// such as for verifying signatures.
+	RawRequest        bool
+	RawRequestHeaders []string
+
+	// Streams, if true, accepts application/x-protobuf-stream requests,
+	// whose bodies are request messages, each prefixed with its length
+	// as a varint, and, if there is a JSONMarshaler,
+	// application/x-ndjson requests, whose bodies are request messages
+	// in JSON, one per line.  The handler is called for each message,
+	// and the response is the stream of the responses, in the same
+	// format.  The stream ends at the first error, which gets an error
+	// response if no responses were written, and is reported in the
+	// trailers otherwise.
+	Streams bool
+
+	// StreamTerminal, if not nil, provides a message that is written at
+	// the end of response streams, for clients that cannot read the
+	// trailers with the StreamStatus.
+	StreamTerminal func(context.Context, *StreamStatus) proto.Message
+
+	// RetainRequests, if true, allocates a new request message for each
+	// request, so that handlers can retain the messages, such as for
+	// asynchronous processing.  Otherwise, request messages are reset
+	// and reused after the handlers return.
+	RetainRequests bool
+
+	// Dedup, if not nil, detects duplicate requests.
+	Dedup *Deduplicator
+
+	// Quota, if not nil, limits the requests of each principal or API
+	// key.
+	Quota *Quota
+
+	// Faults, if not nil, injects faults into requests.
+	Faults *FaultInjector
+
+	// ErrorBudget, if not nil, degrades the route when its error rate
+	// exceeds the budget.
+	ErrorBudget *ErrorBudget
+
+	// MaxRequestSize, if not zero, is the maximum size of request
+	// bodies.  Larger requests get a 413 response.
+	MaxRequestSize int64
+
+	// MaxResponseSize, if not zero, is the maximum size of marshalled
+	// responses.  Larger responses are logged as errors and replaced
+	// with a 500 response, as truncated responses cannot be decoded.
+	MaxResponseSize int
+
+	// ServerTiming, if true, adds a Server-Timing header with the
+	// decode, handler, and encode durations to responses.
+	ServerTiming bool
+
+	// Deprecation, if not nil, marks the handler as deprecated.
+	Deprecation *Deprecation
+
+	// LogDeprecatedFields, if not nil, is called with the caller and
+	// the paths of the fields marked deprecated that are set in
+	// requests, which are also listed in Warning headers of the
+	// responses.
+	LogDeprecatedFields func(ctx context.Context, caller string, fields []string)
+
+	// Route names the handler in summaries.  If empty, the ServeMux
+	// pattern is used, or the URL path if there is no pattern.
+	Route string
 
 	ErrorResponse func(ctx context.Context, statusCode int) string
+
+	// Catalog, if not nil, localizes the bodies of error responses.
+	Catalog *MessageCatalog
+
+	// AnyResolver, if not nil, restricts the types embedded in the
+	// google.protobuf.Any fields of requests and responses, and resolves
+	// them for JSON.
+	AnyResolver *AnyResolver
+
+	// Enums, if not nil, relaxes the JSON handling of enums.
+	Enums *EnumOptions
+
+	// WellKnownTypes, if not nil, relaxes the JSON handling of
+	// well-known types, such as Timestamps.
+	WellKnownTypes *WellKnownTypeOptions
+
+	// FieldVisibility, if not nil, strips fields from responses unless
+	// the caller has the scopes they require.
+	FieldVisibility *FieldVisibility
+
+	// Envelope, if not nil and there is a JSONMarshaler, wraps JSON
+	// responses, including error responses.
+	Envelope *Envelope
+
+	// ErrorMessage, if not nil and there is a JSONMarshaler, provides
+	// the message marshalled as the JSON body of error responses instead
+	// of ErrorResponse, given the error returned by the handler, if any.
+	ErrorMessage func(ctx context.Context, statusCode int, err error) proto.Message
+
+	// DecodeErrorDetails, if true, responds to requests that cannot be
+	// unmarshalled with a JSON body with the error, its line, column,
+	// and offset, if known, and, for JSON requests, the path of the
+	// offending field, for debugging clients.
+	DecodeErrorDetails bool
+
+	// StrictJSON, if true, responds with 400 and a JSON body with the
+	// details to JSON requests with duplicate object keys, including
+	// keys naming the same field by its name and by its JSON name, with
+	// data after the top-level value, or with values out of the range
+	// of integer fields, which lenient unmarshalling would ignore or
+	// resolve arbitrarily.
+	StrictJSON bool
+
+	// ClientIP, if not nil, resolves the client address, which is
+	// available from the context with ClientIP.
+	ClientIP *ClientIPResolver
+
+	// ACL, if not nil, restricts the clients that are allowed.
+	ACL *ACL
+
+	// AuthorizePeer, if not nil, is called with the identity from the
+	// verified TLS client certificate, and requests without verified
+	// client certificates or for which it returns false get a 403
+	// response.
+	AuthorizePeer func(context.Context, *PeerIdentity) bool
+
+	// Introspector, if not nil, validates the bearer tokens of
+	// requests, which must have all of the RequiredScopes.  The
+	// principal of the token is available from the context with
+	// AuthenticatedPrincipal.
+	Introspector   *Introspector
+	RequiredScopes []string
+
+	// Tenants, if not nil, resolves the tenants of requests.
+	Tenants *TenantResolver
+
+	// FeatureFlags, if not nil, evaluates the feature flags of each
+	// request, which are available from the context with FeatureFlag.
+	// Requests for which it fails have no flags set.
+	FeatureFlags FeatureFlagProvider
+
+	// CSRF, if not nil, protects requests from browsers authenticated
+	// with cookies from cross-site request forgery.
+	CSRF *CSRF
+
+	// Authorizer, if not nil, decides whether requests are authorized,
+	// given the RequiredScopes and RequiredRoles.
+	Authorizer    Authorizer
+	RequiredRoles []string
+
+	// Queue, if not nil, limits the number of handlers executing
+	// concurrently.
+	Queue *AdmissionQueue
+
+	// Export, if not nil, exports responses as CSV or as Excel
+	// spreadsheets for requests that Accept them.
+	Export *Exporter
+
+	// RetryHints, if not nil, sets headers on responses telling clients
+	// whether requests can be retried.
+	RetryHints *RetryHints
+
+	// Codecs maps additional request Content-Types to the Codecs used
+	// for them.  Responses to requests using a Codec have the same
+	// Content-Type as the request.
+	Codecs map[string]Codec
+}
+
+// Codec marshals and unmarshals messages for a Content-Type other than
+// the built-in protobuf, JSON, and text formats.
+type Codec interface {
+	Marshal(proto.Message) ([]byte, error)
+	Unmarshal([]byte, proto.Message) error
 }
 
 // StatusCoder can be implemented by the error returned by a handler,
@@ -105,6 +414,9 @@ type StatusCoder interface {
 // StatusCoder, in which case it will provide the HTTP status of the
 // response.
 //
+// The func may instead return a *RawResponse, or a (*RawResponse, error),
+// whose body is the response, as is.
+//
 // If the func takes one argument, it must be a proto.Message, which will
 // be unmarshalled from the request body.
 //
@@ -112,6 +424,9 @@ type StatusCoder interface {
 // context.Context or a *http.Request, and the second argument must be a
 // proto.Message.
 //
+// The request message is reset and reused after the func returns, so the
+// func must not retain it unless the Config has RetainRequests set.
+//
 // UPS will panic if the argument is not a valid func.
 func UPS(handler interface{}) http.Handler {
 	return UPSWithParameterAndConfig(handler, nil, DefaultConfig)
@@ -129,6 +444,9 @@ func UPS(handler interface{}) http.Handler {
 // StatusCoder, in which case it will provide the HTTP status of the
 // response.
 //
+// The func may instead return a *RawResponse, or a (*RawResponse, error),
+// whose body is the response, as is.
+//
 // If the func takes one argument, it must be a proto.Message, which will
 // be unmarshalled from the request body.
 //
@@ -153,6 +471,9 @@ func UPSWithConfig(handler interface{}, config Config) http.Handler {
 // StatusCoder, in which case it will provide the HTTP status of the
 // response.
 //
+// The func may instead return a *RawResponse, or a (*RawResponse, error),
+// whose body is the response, as is.
+//
 // If the func takes two arguments,  The first argument will be the parameter
 // passed to UPSWithParameter.  The second argument must be a proto.Message,
 // which will be unmarshalled from the request body.
@@ -179,6 +500,9 @@ func UPSWithParameter(handler interface{}, parameter interface{}) http.Handler {
 // StatusCoder, in which case it will provide the HTTP status of the
 // response.
 //
+// The func may instead return a *RawResponse, or a (*RawResponse, error),
+// whose body is the response, as is.
+//
 // If the func takes two arguments,  The first argument will be the parameter
 // passed to UPSWithParameterAndConfig.  The second argument must be a
 // proto.Message, which will be unmarshalled from the request body.
@@ -205,13 +529,14 @@ func UPSWithParameterAndConfig(handler interface{}, parameter interface{}, confi
 		}
 		fallthrough
 	case 1:
-		if !ty.Out(0).Implements(messageType) {
+		if !ty.Out(0).Implements(messageType) && ty.Out(0) != rawResponseType {
 			panic("ups: invalid handler message return type")
 		}
 	default:
 		panic("ups: invalid handler return type")
 	}
 
+	ups.numIn = ty.NumIn()
 	var reqType reflect.Type
 	var paramType reflect.Type
 	switch ty.NumIn() {
@@ -249,6 +574,25 @@ func UPSWithParameterAndConfig(handler interface{}, parameter interface{}, confi
 		panic("ups: invalid handler parameter type")
 	}
 
+	if config.Enums != nil && config.Enums.AsInts && config.JSONMarshaler != nil {
+		marshaler := *ups.config.JSONMarshaler
+		marshaler.EnumsAsInts = true
+		ups.config.JSONMarshaler = &marshaler
+	}
+	if config.AnyResolver != nil {
+		if config.JSONMarshaler != nil {
+			marshaler := *ups.config.JSONMarshaler
+			marshaler.AnyResolver = config.AnyResolver
+			ups.config.JSONMarshaler = &marshaler
+		}
+		unmarshaler := jsonpb.Unmarshaler{}
+		if config.JSONUnmarshaler != nil {
+			unmarshaler = *config.JSONUnmarshaler
+		}
+		unmarshaler.AnyResolver = config.AnyResolver
+		ups.config.JSONUnmarshaler = &unmarshaler
+	}
+
 	if paramType != nil && !reflect.TypeOf(parameter).AssignableTo(paramType) {
 		panic("ups: param does not match param parameter type")
 	}
@@ -257,160 +601,832 @@ func UPSWithParameterAndConfig(handler interface{}, parameter interface{}, confi
 		return reflect.New(reqType.Elem())
 	}
 
+	if reqType != dynamicMessageType {
+		ups.requestDescriptor = proto.MessageReflect(reflect.New(reqType.Elem()).Interface().(proto.Message)).Descriptor()
+		checkHeaderFields(config.HeaderFields, ups.requestDescriptor)
+	}
+	if respType := ty.Out(0); respType.Kind() == reflect.Ptr && respType != dynamicMessageType && respType != rawResponseType {
+		ups.responseDescriptor = proto.MessageReflect(reflect.New(respType.Elem()).Interface().(proto.Message)).Descriptor()
+	}
+
 	return ups
 }
 
 type upsHandler struct {
-	config            Config
-	handlerType       handlerType
-	handler           reflect.Value
-	parameter         reflect.Value
-	requestObjectPool sync.Pool
+	config             Config
+	handlerType        handlerType
+	handler            reflect.Value
+	parameter          reflect.Value
+	numIn              int
+	requestObjectPool  sync.Pool
+	requestDescriptor  protoreflect.MessageDescriptor
+	responseDescriptor protoreflect.MessageDescriptor
+
+	// call, if not nil, calls the handler without reflection.
+	call func(context.Context, proto.Message) (proto.Message, error)
 }
 
 func (ups *upsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	if r.Method == http.MethodOptions && ups.config.Discovery != NoDiscovery {
+		ups.serveOptions(w)
+		return
+	}
+	start := time.Now()
+	summary := &RequestSummary{
+		Method:    r.Method,
+		Route:     ups.config.Route,
+		RequestID: r.Header.Get("X-Request-Id"),
+	}
+	summary.Phases.Start = start
+	if summary.Route == "" {
+		summary.Route = r.Pattern
+	}
+	if summary.Route == "" {
+		summary.Route = r.URL.Path
+	}
+	if ups.config.Faults != nil && ups.config.Faults.drop(summary.Route) {
+		dropConnection(w)
+		return
+	}
+	ctx := WithValue(r.Context(), summaryContextKey, summary)
+	ctx = WithValue(ctx, RouteKey, summary.Route)
+	if summary.RequestID != "" {
+		ctx = WithValue(ctx, RequestIDKey, summary.RequestID)
+	}
+	state := &responseState{request: r}
+	ctx = WithValue(ctx, responseContextKey, state)
+	info := ups.newRequestMetadata(r, summary.Route)
+	ctx = WithValue(ctx, requestInfoContextKey, info)
+	if ups.config.LoggerForRequest != nil {
+		ctx = WithValue(ctx, loggerContextKey, ups.config.LoggerForRequest(ctx, r))
+	}
+	if ups.config.Timeouts != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = ups.config.Timeouts.withDeadline(ctx, start)
+		defer cancel()
+	}
+	var sample *logSample
+	if ups.config.LogSampler != nil {
+		sample = ups.config.LogSampler.start()
+		ctx = WithValue(ctx, sampleContextKey, sample)
+	}
+	degraded := false
+	if ups.config.ErrorBudget != nil && ups.config.ErrorBudget.degraded(summary.Route) {
+		degraded = true
+		ctx = WithValue(ctx, degradedContextKey, true)
+	}
+	r = r.WithContext(ctx)
+	if ups.config.ClientIP != nil {
+		if addr, ok := ups.config.ClientIP.ClientIP(r); ok {
+			ctx = WithValue(ctx, clientIPContextKey, addr)
+			r = r.WithContext(ctx)
+		}
+	}
 
 	statusCode := http.StatusOK
 	var resp []byte
+	var errorBody []byte
+	var report *Report
+	var dedup *dedupKey
+	var budgetKey *errorBudgetKey
+	var handlerErr error
+	var nonJSONResponse bool
+	var rawResp *RawResponse
+	var reqBuffer *bytes.Buffer
+	var streamed bool
+	var panicked string
 	func() {
 		defer func() {
 			if err := recover(); err != nil {
+				if ups.config.Reporter != nil {
+					report = &Report{Panic: err, Stack: debug.Stack()}
+				}
+				if ups.config.PanicDump > 0 {
+					ctx = WithValue(ctx, panicContextKey, newPanicInfo(summary.RequestID, panicked, ups.config.PanicDump))
+				}
 				ups.logPanic(ctx, err)
 				statusCode = http.StatusInternalServerError
+				if ups.config.DebugPanics {
+					errorBody = panicErrorBody(err, debug.Stack())
+				}
 			}
 		}()
 
 		ups.logStartRequest(ctx, r.Method, r.URL)
-		if r.Method != http.MethodPost {
-			statusCode = http.StatusMethodNotAllowed
+		if ups.config.Faults != nil {
+			if statusCode = ups.config.Faults.inject(ctx, summary.Route); statusCode != http.StatusOK {
+				return
+			}
+		}
+		if ups.config.Deprecation != nil {
+			ups.config.Deprecation.setHeaders(w.Header())
+		}
+		if ups.config.ACL != nil && !ups.config.ACL.Allowed(r) {
+			statusCode = http.StatusForbidden
 			return
 		}
-
-		var reqBuffer bytes.Buffer
-		if _, err := reqBuffer.ReadFrom(r.Body); err != nil {
-			ups.logError(ctx, "req.ReadFrom", err)
-			statusCode = http.StatusInternalServerError
+		if peer := peerIdentity(r); peer != nil {
+			ctx = WithValue(ctx, peerContextKey, peer)
+			r = r.WithContext(ctx)
+			if ups.config.AuthorizePeer != nil && !ups.config.AuthorizePeer(ctx, peer) {
+				statusCode = http.StatusForbidden
+				return
+			}
+		} else if ups.config.AuthorizePeer != nil {
+			statusCode = http.StatusForbidden
 			return
 		}
-		req := reqBuffer.Bytes()
-
-		json := false
-		if contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil {
-			ups.logError(ctx, "mime.ParseMediaType", err)
-			statusCode = http.StatusUnsupportedMediaType
+		if ups.config.CSRF != nil && !ups.config.CSRF.Check(r) {
+			statusCode = http.StatusForbidden
 			return
-		} else {
-			switch contentType {
-			case "application/json":
-				if ups.config.JSONMarshaler == nil {
-					statusCode = http.StatusUnsupportedMediaType
-					return
+		}
+		if ups.config.Introspector != nil {
+			principal, code, challenge := ups.authenticate(ctx, r)
+			if principal == nil {
+				if challenge != "" {
+					w.Header().Set("WWW-Authenticate", challenge)
 				}
-				json = true
-			case "application/octet-stream", "application/x-protobuf":
-				json = false
-			default:
+				statusCode = code
+				return
+			}
+			ctx = WithValue(ctx, PrincipalKey, principal)
+			if ups.config.LoggerForRequest != nil {
+				ctx = WithValue(ctx, loggerContextKey, ups.config.LoggerForRequest(ctx, r))
+			}
+			r = r.WithContext(ctx)
+		}
+		if ups.config.Tenants != nil {
+			tenant, code, err := ups.config.Tenants.resolve(ctx, r)
+			if err != nil {
+				ups.logError(ctx, "Tenants.resolve", err)
+			}
+			if code != http.StatusOK {
+				statusCode = code
+				return
+			}
+			if tenant != nil {
+				summary.Tenant = tenant.ID
+				ctx = WithValue(ctx, TenantKey, tenant)
+				r = r.WithContext(ctx)
+			}
+		}
+		if ups.config.FeatureFlags != nil {
+			principal, _ := AuthenticatedPrincipal(ctx)
+			if flags, err := ups.config.FeatureFlags.FeatureFlags(ctx, summary.Route, principal); err != nil {
+				ups.logError(ctx, "FeatureFlags.FeatureFlags", err)
+			} else {
+				ctx = WithValue(ctx, featureFlagsContextKey, flags)
+				r = r.WithContext(ctx)
+			}
+		}
+		if ups.config.Deprecation != nil {
+			summary.Deprecated = true
+			ups.config.Deprecation.record(ctx, r)
+		}
+		method := r.Method
+		if original, ok := Value(ctx, methodOverrideContextKey); ok {
+			method = original
+		}
+		query := method == http.MethodGet || method == http.MethodHead
+		if method != http.MethodPost && !(query && ups.config.AllowGET) {
+			statusCode = http.StatusMethodNotAllowed
+			return
+		}
+		if ups.config.Quota != nil {
+			if code, err := ups.config.Quota.add(ctx, w, r, QuotaUsage{Requests: 1}); err != nil {
+				ups.logError(ctx, "Quota.add", err)
+			} else if code != 0 {
+				statusCode = code
+				return
+			}
+		}
+
+		reqFormat := protobufFormat
+		var codec Codec
+		var codecContentType string
+		var req []byte
+		var sniff bool
+		var decoder *encoding.Decoder
+		if query {
+			reqFormat = queryFormat
+			summary.Phases.Unmarshal.Start = time.Now()
+		} else {
+			// The checks before reading the body are done before the
+			// net/http server sends 100 Continue to requests with
+			// Expect: 100-continue, so that rejected bodies are not sent.
+			header := r.Header.Get("Content-Type")
+			contentType, params, err := mime.ParseMediaType(header)
+			if header == "" && ups.config.ContentTypeMode == ContentTypePermissive {
+				contentType, err = "application/x-protobuf", nil
+				sniff = ups.config.SniffContentType
+			}
+			if err != nil {
+				ups.logError(ctx, "mime.ParseMediaType", err)
 				statusCode = http.StatusUnsupportedMediaType
 				return
+			} else if ups.config.ContentTypeMode == ContentTypeStrict && header != contentType {
+				statusCode = http.StatusUnsupportedMediaType
+				return
+			} else {
+				if ups.config.ContentTypeMode == ContentTypePermissive {
+					contentType = permissiveMediaType(contentType)
+				}
+				info.RequestContentType = contentType
+				switch contentType {
+				case "application/json":
+					if ups.config.JSONMarshaler == nil {
+						statusCode = http.StatusUnsupportedMediaType
+						return
+					}
+					reqFormat = jsonFormat
+					if d, ok := ups.charsetDecoder(params["charset"]); !ok {
+						statusCode = http.StatusUnsupportedMediaType
+						return
+					} else {
+						decoder = d
+					}
+				case "application/x-www-form-urlencoded":
+					if ups.config.JSONMarshaler == nil {
+						statusCode = http.StatusUnsupportedMediaType
+						return
+					}
+					reqFormat = formFormat
+				case "text/x-protobuf":
+					reqFormat = textFormat
+				case "application/octet-stream", "application/x-protobuf":
+					reqFormat = protobufFormat
+				case "application/x-protobuf-stream":
+					if !ups.config.Streams {
+						statusCode = http.StatusUnsupportedMediaType
+						return
+					}
+					reqFormat = protobufStreamFormat
+				case "application/x-ndjson":
+					if !ups.config.Streams || ups.config.JSONMarshaler == nil {
+						statusCode = http.StatusUnsupportedMediaType
+						return
+					}
+					reqFormat = ndjsonFormat
+				default:
+					if c, ok := ups.config.Codecs[contentType]; ok {
+						reqFormat = codecFormat
+						codec = c
+						codecContentType = contentType
+					} else {
+						statusCode = http.StatusUnsupportedMediaType
+						return
+					}
+				}
+			}
+
+			if ups.config.MaxRequestSize > 0 && r.ContentLength > ups.config.MaxRequestSize {
+				statusCode = http.StatusRequestEntityTooLarge
+				return
+			}
+
+			summary.Phases.ReadBody.Start = time.Now()
+			body := r.Body
+			if ups.config.MaxRequestSize > 0 {
+				body = http.MaxBytesReader(w, r.Body, ups.config.MaxRequestSize)
+			}
+			if reqFormat == protobufStreamFormat || reqFormat == ndjsonFormat {
+				statusCode, streamed = ups.serveStream(ctx, w, r, body, reqFormat)
+				return
+			}
+			if ups.config.Timeouts != nil {
+				ups.config.Timeouts.setReadDeadline(w, start)
+			}
+			reqBuffer = newRequestBuffer(r.ContentLength)
+			_, err = reqBuffer.ReadFrom(body)
+			if ups.config.Timeouts != nil {
+				ups.config.Timeouts.clearReadDeadline(w)
+			}
+			if err != nil {
+				ups.logError(ctx, "req.ReadFrom", err)
+				var maxBytesError *http.MaxBytesError
+				if errors.As(err, &maxBytesError) {
+					statusCode = http.StatusRequestEntityTooLarge
+				} else if readTimedOut(err) {
+					// The rest of the body is not read.
+					w.Header().Set("Connection", "close")
+					statusCode = http.StatusRequestTimeout
+				} else {
+					statusCode = http.StatusInternalServerError
+				}
+				return
+			}
+			req = reqBuffer.Bytes()
+			summary.RequestSize = len(req)
+			summary.Phases.ReadBody.End = time.Now()
+			summary.Phases.Unmarshal.Start = summary.Phases.ReadBody.End
+			if ups.config.RawRequest {
+				ctx = WithValue(ctx, rawRequestContextKey, newRawRequest(r, req, ups.config.RawRequestHeaders))
+				r = r.WithContext(ctx)
+			}
+			if ups.config.Dedup != nil {
+				if key, ok := ups.config.Dedup.key(r, summary.Route, req); ok {
+					if entry, duplicate := ups.config.Dedup.begin(key); !duplicate {
+						dedup = &key
+					} else if !entry.done {
+						statusCode = http.StatusConflict
+						return
+					} else {
+						w.Header().Set("Content-Type", entry.contentType)
+						resp = entry.body
+						return
+					}
+				}
+			}
+			if ups.config.Quota != nil && ups.config.Quota.Bytes > 0 {
+				if code, err := ups.config.Quota.add(ctx, w, r, QuotaUsage{Bytes: int64(len(req))}); err != nil {
+					ups.logError(ctx, "Quota.add", err)
+				} else if code != 0 {
+					statusCode = code
+					return
+				}
+			}
+			if ups.config.ErrorBudget != nil && ups.config.ErrorBudget.Fallback > 0 {
+				key := ups.config.ErrorBudget.key(ctx, r, req)
+				budgetKey = &key
+			}
+			if decoder != nil {
+				if req, err = decoder.Bytes(req); err != nil {
+					ups.logError(ctx, "Decoder.Bytes", err)
+					statusCode = http.StatusInternalServerError
+					return
+				}
+			}
+			if sniff && ups.config.JSONMarshaler != nil && sniffJSON(req) {
+				reqFormat = jsonFormat
+				info.RequestContentType = "application/json"
+			}
+		}
+		respFormat := reqFormat
+		if query {
+			respFormat = protobufFormat
+			if ups.config.JSONMarshaler != nil {
+				respFormat = jsonFormat
 			}
 		}
+		info.ResponseContentType = ups.responseContentType(respFormat, codecContentType)
+		nonJSONResponse = respFormat != jsonFormat && respFormat != formFormat
+		var exportContentType string
+		if ups.config.Export != nil {
+			if exportContentType = ups.config.Export.contentType(r.Header.Get("Accept")); exportContentType != "" {
+				info.ResponseContentType = exportContentType
+				nonJSONResponse = true
+			}
+			w.Header().Add("Vary", "Accept")
+		}
 
-		arg := ups.requestObjectPool.Get().(reflect.Value)
-		defer func() {
-			arg.Interface().(proto.Message).Reset()
-			ups.requestObjectPool.Put(arg)
-		}()
-		if json {
+		var arg reflect.Value
+		if ups.config.RetainRequests {
+			arg = ups.requestObjectPool.New().(reflect.Value)
+		} else {
+			arg = ups.requestObjectPool.Get().(reflect.Value)
+			defer func() {
+				arg.Interface().(proto.Message).Reset()
+				ups.requestObjectPool.Put(arg)
+			}()
+		}
+		if ups.config.PanicDump > 0 {
+			// The request is captured before it is reset.
+			defer func() {
+				if !summary.Phases.Handler.Start.IsZero() && summary.Phases.Handler.End.IsZero() {
+					panicked = panicRequest(arg.Interface().(proto.Message))
+				}
+			}()
+		}
+		switch reqFormat {
+		case jsonFormat:
 			ups.logRequestJSON(ctx, string(req))
-			if err := jsonpb.Unmarshal(bytes.NewReader(req), arg.Interface().(proto.Message)); err != nil {
+			if ups.config.StrictJSON {
+				if err := checkStrictJSON(req, ups.requestDescriptor); err != nil {
+					ups.logError(ctx, "checkStrictJSON", err)
+					statusCode = http.StatusBadRequest
+					errorBody = strictJSONErrorBody(err)
+					return
+				}
+			}
+			if err := ups.jsonUnmarshal(req, arg.Interface().(proto.Message)); err != nil {
 				ups.logError(ctx, "jsonpb.Unmarshal", err)
 				statusCode = http.StatusInternalServerError
+				errorBody = ups.decodeErrorBody(err, req, reqFormat)
 				return
 			}
-		} else {
+		case queryFormat:
+			if err := unmarshalForm(r.URL.Query(), arg.Interface().(proto.Message)); err != nil {
+				ups.logError(ctx, "unmarshalForm", err)
+				statusCode = http.StatusInternalServerError
+				errorBody = ups.decodeErrorBody(err, req, reqFormat)
+				return
+			}
+		case formFormat:
+			ups.logRequestBytes(ctx, req)
+			if values, err := url.ParseQuery(string(req)); err != nil {
+				ups.logError(ctx, "url.ParseQuery", err)
+				statusCode = http.StatusInternalServerError
+				return
+			} else if err := unmarshalForm(values, arg.Interface().(proto.Message)); err != nil {
+				ups.logError(ctx, "unmarshalForm", err)
+				statusCode = http.StatusInternalServerError
+				errorBody = ups.decodeErrorBody(err, req, reqFormat)
+				return
+			}
+		case textFormat:
+			ups.logRequestText(ctx, string(req))
+			if err := proto.UnmarshalText(string(req), arg.Interface().(proto.Message)); err != nil {
+				ups.logError(ctx, "proto.UnmarshalText", err)
+				statusCode = http.StatusInternalServerError
+				errorBody = ups.decodeErrorBody(err, req, reqFormat)
+				return
+			}
+		case codecFormat:
+			ups.logRequestBytes(ctx, req)
+			if err := codec.Unmarshal(req, arg.Interface().(proto.Message)); err != nil {
+				ups.logError(ctx, "Codec.Unmarshal", err)
+				statusCode = http.StatusInternalServerError
+				errorBody = ups.decodeErrorBody(err, req, reqFormat)
+				return
+			}
+		default:
 			ups.logRequestBytes(ctx, req)
 			if err := proto.Unmarshal(req, arg.Interface().(proto.Message)); err != nil {
 				ups.logError(ctx, "proto.Unmarshal", err)
 				statusCode = http.StatusInternalServerError
+				errorBody = ups.decodeErrorBody(err, req, reqFormat)
 				return
 			}
 		}
+		if err := bindPath(r, arg.Interface().(proto.Message)); err != nil {
+			ups.logError(ctx, "bindPath", err)
+			statusCode = http.StatusInternalServerError
+			return
+		}
+		if len(ups.config.HeaderFields) > 0 {
+			if err := bindHeaders(r.Header, ups.config.HeaderFields, arg.Interface().(proto.Message)); err != nil {
+				ups.logError(ctx, "bindHeaders", err)
+				statusCode = http.StatusInternalServerError
+				return
+			}
+		}
+		summary.Phases.Unmarshal.End = time.Now()
 		ups.logRequestMessage(ctx, arg.Interface().(proto.Message))
+		if ups.config.AnyResolver != nil {
+			if err := ups.config.AnyResolver.check(proto.MessageReflect(arg.Interface().(proto.Message))); err != nil {
+				ups.logError(ctx, "AnyResolver.check", err)
+				statusCode = http.StatusInternalServerError
+				return
+			}
+		}
+		if ups.config.LogDeprecatedFields != nil {
+			if fields := deprecatedFields(proto.MessageReflect(arg.Interface().(proto.Message)), "", nil); len(fields) > 0 {
+				summary.DeprecatedFields = fields
+				for _, field := range fields {
+					w.Header().Add("Warning", `299 - "Deprecated field: `+field+`"`)
+				}
+				ups.config.LogDeprecatedFields(ctx, callerOf(ctx, r), fields)
+			}
+		}
+
+		if ups.config.Authorizer != nil {
+			if statusCode, errorBody = ups.authorize(ctx, arg.Interface().(proto.Message)); statusCode != http.StatusOK {
+				return
+			}
+		}
 
-		var args []reflect.Value
-		switch ups.handlerType {
-		case messageHandlerType:
-			args = []reflect.Value{arg}
-		case contextHandlerType:
-			args = []reflect.Value{reflect.ValueOf(ctx), arg}
-		case requestHandlerType:
-			args = []reflect.Value{reflect.ValueOf(r), arg}
-		case paramHandlerType:
-			args = []reflect.Value{ups.parameter, arg}
-		case contextParamHandlerType:
-			args = []reflect.Value{reflect.ValueOf(ctx), ups.parameter, arg}
-		case requestParamHandlerType:
-			args = []reflect.Value{reflect.ValueOf(r), ups.parameter, arg}
-		}
-
-		results := ups.handler.Call(args)
-		if len(results) > 1 && !results[1].IsNil() {
-			if err, ok := results[1].Interface().(StatusCoder); ok {
-				statusCode = err.StatusCode()
+		// Label the handler in CPU and goroutine profiles.
+		defer pprof.SetGoroutineLabels(ctx)
+		ctx = pprof.WithLabels(ctx, pprof.Labels("route", summary.Route, "method", r.Method))
+		if ups.handlerType == requestHandlerType || ups.handlerType == requestParamHandlerType || ups.config.Queue != nil {
+			r = r.WithContext(ctx)
+		}
+		pprof.SetGoroutineLabels(ctx)
+
+		if ups.config.Queue != nil {
+			if err := ups.config.Queue.acquire(ctx, r); err != nil {
+				ups.logError(ctx, "AdmissionQueue.acquire", err)
+				w.Header().Set("Retry-After", ups.config.Queue.retryAfter())
+				statusCode = http.StatusServiceUnavailable
+				return
+			}
+			defer ups.config.Queue.release()
+		}
+
+		handlerCtx, handlerR := ctx, r
+		if ups.config.Timeouts != nil {
+			var cancel context.CancelFunc
+			handlerCtx, cancel = ups.config.Timeouts.withHandlerTimeout(ctx)
+			defer cancel()
+			handlerR = r.WithContext(handlerCtx)
+		}
+		summary.Phases.Handler.Start = time.Now()
+		result, err := ups.callHandler(handlerCtx, handlerR, arg)
+		summary.Phases.Handler.End = time.Now()
+		if raw, ok := err.(rawResult); ok {
+			rawResp = raw.response
+			nonJSONResponse = true
+			statusCode = rawResp.statusCode()
+			resp = rawResp.Body
+			if rawResp.ContentType != "" {
+				w.Header().Set("Content-Type", rawResp.ContentType)
+			}
+			return
+		}
+		if err != nil {
+			if async, ok := err.(*AsyncResult); ok {
+				if async.Location != "" {
+					w.Header().Set("Location", async.Location)
+				}
+				statusCode = http.StatusAccepted
+				result = async.Operation
 			} else {
+				handlerErr = err
+				if summary.Error == nil {
+					summary.Error = handlerErr
+				}
+				if err, ok := err.(StatusCoder); ok {
+					statusCode = err.StatusCode()
+				} else if ups.config.Timeouts != nil && ups.config.Timeouts.timedOut(handlerCtx, handlerErr) {
+					statusCode = http.StatusServiceUnavailable
+				} else {
+					statusCode = http.StatusInternalServerError
+				}
+				return
+			}
+		}
+		if ups.config.FieldVisibility != nil {
+			result = ups.config.FieldVisibility.filter(ctx, result)
+		}
+		if ups.config.AnyResolver != nil {
+			if err := ups.config.AnyResolver.check(proto.MessageReflect(result)); err != nil {
+				ups.logError(ctx, "AnyResolver.check", err)
 				statusCode = http.StatusInternalServerError
+				return
 			}
-			return
 		}
-		result := results[0].Interface().(proto.Message)
 		ups.logResponseMessage(ctx, result)
+		summary.Phases.Marshal.Start = time.Now()
+		defer func() {
+			summary.Phases.Marshal.End = time.Now()
+		}()
 
-		if json {
-			if response, err := ups.config.JSONMarshaler.MarshalToString(result); err != nil {
+		switch {
+		case exportContentType != "":
+			if response, err := ups.config.Export.export(result, exportContentType); err == errNoExportField {
+				statusCode = http.StatusNotAcceptable
+			} else if err != nil {
+				ups.logError(ctx, "Exporter.export", err)
+				statusCode = http.StatusInternalServerError
+			} else {
+				ups.logResponseBytes(ctx, response)
+				resp = response
+				w.Header().Set("Content-Type", exportContentType)
+			}
+		case respFormat == jsonFormat, respFormat == formFormat:
+			response, err := ups.config.JSONMarshaler.MarshalToString(result)
+			if err == nil && ups.config.WellKnownTypes != nil {
+				response, err = ups.config.WellKnownTypes.rewriteResponse(response, proto.MessageReflect(result).Descriptor())
+			}
+			if err != nil {
 				ups.logError(ctx, "JSONMarshaler.MarshalToString", err)
 				statusCode = http.StatusInternalServerError
 			} else {
 				ups.logResponseJSON(ctx, response)
 				resp = []byte(response)
-				w.Header().Set("Content-Type", "application/json")
+				if ups.config.Envelope != nil {
+					resp = ups.config.Envelope.wrap(statusCode, nil, resp)
+				}
+				w.Header().Set("Content-Type", ups.jsonContentType())
 			}
-		} else {
+		case respFormat == textFormat:
+			response := proto.MarshalTextString(result)
+			ups.logResponseText(ctx, response)
+			resp = []byte(response)
+			w.Header().Set("Content-Type", "text/x-protobuf")
+		case respFormat == codecFormat:
+			if response, err := codec.Marshal(result); err != nil {
+				ups.logError(ctx, "Codec.Marshal", err)
+				statusCode = http.StatusInternalServerError
+			} else {
+				ups.logResponseBytes(ctx, response)
+				resp = response
+				w.Header().Set("Content-Type", codecContentType)
+			}
+		default:
 			if response, err := proto.Marshal(result); err != nil {
 				ups.logError(ctx, "proto.Marshal", err)
 				statusCode = http.StatusInternalServerError
 			} else {
 				ups.logResponseBytes(ctx, response)
 				resp = response
-				w.Header().Set("Content-Type", "application/octet-stream")
+				w.Header().Set("Content-Type", ups.protobufContentType(proto.MessageReflect(result).Descriptor().FullName()))
 			}
 		}
+		if ups.config.MaxResponseSize > 0 && len(resp) > ups.config.MaxResponseSize {
+			ups.logError(ctx, "Config.MaxResponseSize", errResponseTooLarge)
+			statusCode = http.StatusInternalServerError
+			resp = nil
+		}
 	}()
 
+	summary.DecodeDuration = summary.Phases.ReadBody.Duration() + summary.Phases.Unmarshal.Duration()
+	summary.HandlerDuration = summary.Phases.Handler.Duration()
+	summary.EncodeDuration = summary.Phases.Marshal.Duration()
+	if ups.config.ServerTiming {
+		w.Header().Set("Server-Timing", serverTiming(summary))
+	}
+	if dedup != nil {
+		ups.config.Dedup.end(*dedup, statusCode, w.Header().Get("Content-Type"), resp)
+	}
+	if ups.config.ErrorBudget != nil && !streamed {
+		ups.config.ErrorBudget.record(summary.Route, statusCode, budgetKey, w.Header().Get("Content-Type"), resp)
+		if degraded && statusCode >= 500 && budgetKey != nil {
+			if fallback, ok := ups.config.ErrorBudget.fallback(summary.Route, *budgetKey); ok {
+				w.Header().Set("Content-Type", fallback.contentType)
+				w.Header().Set("Warning", `110 - "Response is Stale"`)
+				statusCode, resp, errorBody = http.StatusOK, fallback.body, nil
+			}
+		}
+	}
+	if ups.config.RetryHints != nil && !streamed {
+		ups.config.RetryHints.setHeaders(w.Header(), statusCode, !summary.Phases.Handler.Start.IsZero())
+	}
+	summary.Phases.Write.Start = time.Now()
+	if ups.config.Timeouts != nil && !streamed {
+		ups.config.Timeouts.setWriteDeadline(w, start)
+		defer ups.config.Timeouts.clearWriteDeadline(w)
+	}
+	for _, cookie := range state.cookies {
+		http.SetCookie(w, cookie)
+	}
 	if statusCode == http.StatusOK {
-		for {
-			if n, err := w.Write(resp); err != nil {
+		cache := ups.config.Cache
+		if state.cacheSet {
+			cache = state.cache
+		}
+		if cache != nil {
+			cache.setHeaders(w.Header())
+		}
+	}
+	if statusCode == http.StatusOK && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		statusCode, resp = writeGetHeaders(w, r, resp)
+	}
+	if !streamed && rawResp == nil && errorBody == nil && ups.config.ErrorMessage != nil && ups.config.JSONMarshaler != nil && statusCode != http.StatusOK && statusCode != http.StatusAccepted && statusCode != http.StatusNotModified {
+		if body, err := ups.config.JSONMarshaler.MarshalToString(ups.config.ErrorMessage(ctx, statusCode, handlerErr)); err != nil {
+			ups.logError(ctx, "JSONMarshaler.MarshalToString", err)
+		} else {
+			errorBody = []byte(body)
+		}
+	}
+	writeStatusCode := statusCode
+	if envelope := ups.config.Envelope; envelope != nil && ups.config.JSONMarshaler != nil && !nonJSONResponse && rawResp == nil && statusCode != http.StatusNotModified {
+		if statusCode != http.StatusOK && statusCode != http.StatusAccepted {
+			errorValue := errorBody
+			if errorValue == nil {
+				text := ups.errorText(ctx, w, statusCode)
+				if text == "" {
+					text = http.StatusText(statusCode)
+				}
+				errorValue, _ = json.Marshal(text)
+			}
+			errorBody = envelope.wrap(statusCode, errorValue, nil)
+		}
+		if envelope.AlwaysOK {
+			writeStatusCode = http.StatusOK
+		}
+	}
+	if streamed {
+		// The response was written by serveStream.
+	} else if statusCode == http.StatusNotModified {
+		w.WriteHeader(statusCode)
+	} else if statusCode == http.StatusOK || statusCode == http.StatusAccepted || rawResp != nil {
+		summary.ResponseSize = len(resp)
+		if r.Method != http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(resp)))
+		}
+		w.WriteHeader(writeStatusCode)
+		if len(resp) > 0 {
+			// http.ResponseWriter writes all of resp unless it fails.
+			if _, err := w.Write(resp); err != nil {
 				ups.logError(ctx, "w.Write", err)
-				break
-			} else if n >= len(resp) {
-				break
-			} else {
-				resp = resp[n:]
 			}
 		}
+	} else if errorBody != nil {
+		summary.ResponseSize = len(errorBody)
+		w.Header().Set("Content-Type", ups.jsonContentType())
+		w.WriteHeader(writeStatusCode)
+		if _, err := w.Write(errorBody); err != nil {
+			ups.logError(ctx, "w.Write", err)
+		}
 	} else {
-		http.Error(w, ups.errorResponse(ctx, statusCode), statusCode)
+		response := ups.errorText(ctx, w, statusCode)
+		summary.ResponseSize = len(response) + 1
+		http.Error(w, response, statusCode)
+	}
+	summary.Phases.Write.End = time.Now()
+	releaseResponses(state)
+	if sample != nil {
+		sample.end(statusCode)
 	}
 	ups.logEndRequest(ctx, r.Method, r.URL, statusCode)
+
+	if ups.config.LogSummary != nil || ups.config.Reporter != nil {
+		summary.StatusCode = statusCode
+		summary.Duration = time.Since(start)
+		if principal, ok := AuthenticatedPrincipal(ctx); ok {
+			summary.Principal = principal.Subject
+		}
+	}
+	if ups.config.LogSummary != nil {
+		ups.config.LogSummary(ctx, summary)
+	}
+	if ups.config.Reporter != nil && (report != nil || statusCode >= 500) {
+		if report == nil {
+			report = &Report{}
+		}
+		report.Error = summary.Error
+		report.Summary = summary
+		ups.config.Reporter.Report(ctx, report)
+	}
+	if reqBuffer != nil && !ups.config.RawRequest {
+		releaseRequestBuffer(reqBuffer)
+	}
+}
+
+// callHandler calls the handler with the request message.
+func (ups *upsHandler) callHandler(ctx context.Context, r *http.Request, arg reflect.Value) (proto.Message, error) {
+	if ups.call != nil {
+		return ups.call(ctx, arg.Interface().(proto.Message))
+	}
+	var in [3]reflect.Value
+	results := ups.handler.Call(ups.handlerArgs(&in, ctx, r, arg))
+	if len(results) > 1 && !results[1].IsNil() {
+		result, _ := results[0].Interface().(proto.Message)
+		return result, results[1].Interface().(error)
+	}
+	if raw, ok := results[0].Interface().(*RawResponse); ok {
+		if raw == nil {
+			raw = &RawResponse{}
+		}
+		return nil, rawResult{raw}
+	}
+	result, _ := results[0].Interface().(proto.Message)
+	return result, nil
+}
+
+// handlerArgs returns the arguments of the handler, using in to avoid
+// allocating.
+func (ups *upsHandler) handlerArgs(in *[3]reflect.Value, ctx context.Context, r *http.Request, arg reflect.Value) []reflect.Value {
+	args := in[:ups.numIn]
+	switch ups.handlerType {
+	case contextHandlerType, contextParamHandlerType:
+		args[0] = reflect.ValueOf(ctx)
+	case requestHandlerType, requestParamHandlerType:
+		args[0] = reflect.ValueOf(r)
+	}
+	switch ups.handlerType {
+	case paramHandlerType, contextParamHandlerType, requestParamHandlerType:
+		args[len(args)-2] = ups.tenantParameter(ctx)
+	}
+	args[len(args)-1] = arg
+	return args
+}
+
+// tenantParameter returns the parameter of the handler for the tenant of
+// the request, from the Parameter of the TenantResolver.
+func (ups *upsHandler) tenantParameter(ctx context.Context) reflect.Value {
+	if ups.config.Tenants == nil || ups.config.Tenants.Parameter == nil {
+		return ups.parameter
+	}
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return ups.parameter
+	}
+	parameter := ups.config.Tenants.Parameter(tenant)
+	if parameter == nil {
+		return ups.parameter
+	}
+	paramType := ups.handler.Type().In(ups.numIn - 2)
+	if !reflect.TypeOf(parameter).AssignableTo(paramType) {
+		panic("ups: tenant param does not match param parameter type")
+	}
+	return reflect.ValueOf(parameter)
 }
 
 func (ups *upsHandler) logError(ctx context.Context, tag string, err error) {
+	if summary := requestSummaryFromContext(ctx); summary != nil && summary.Error == nil {
+		summary.Error = err
+	}
 	if ups.config.LogError != nil {
 		ups.config.LogError(ctx, tag, err)
 	}
 }
 
 func (ups *upsHandler) logPanic(ctx context.Context, err interface{}) {
+	if summary := requestSummaryFromContext(ctx); summary != nil && summary.Error == nil {
+		summary.Error = fmt.Errorf("panic: %v", err)
+	}
 	if ups.config.LogPanic != nil {
 		ups.config.LogPanic(ctx, err)
 	}
@@ -430,40 +1446,151 @@ func (ups *upsHandler) logEndRequest(ctx context.Context, method string, url *ur
 
 func (ups *upsHandler) logRequestMessage(ctx context.Context, req proto.Message) {
 	if ups.config.LogRequestMessage != nil {
+		if sample := logSampleFromContext(ctx); sample != nil {
+			if sample.holding(ups.config.LogSampler) {
+				// The message may be reset before it is logged.
+				req = proto.Clone(req)
+			}
+			sample.log(ups.config.LogSampler, func() {
+				ups.config.LogRequestMessage(ctx, req)
+			})
+			return
+		}
 		ups.config.LogRequestMessage(ctx, req)
 	}
 }
 
 func (ups *upsHandler) logResponseMessage(ctx context.Context, resp proto.Message) {
 	if ups.config.LogResponseMessage != nil {
+		if sample := logSampleFromContext(ctx); sample != nil {
+			if sample.holding(ups.config.LogSampler) {
+				// The message may be reset before it is logged.
+				resp = proto.Clone(resp)
+			}
+			sample.log(ups.config.LogSampler, func() {
+				ups.config.LogResponseMessage(ctx, resp)
+			})
+			return
+		}
 		ups.config.LogResponseMessage(ctx, resp)
 	}
 }
 
 func (ups *upsHandler) logRequestBytes(ctx context.Context, req []byte) {
 	if ups.config.LogRequestBytes != nil {
+		if sample := logSampleFromContext(ctx); sample != nil {
+			sample.log(ups.config.LogSampler, func() {
+				ups.config.LogRequestBytes(ctx, req)
+			})
+			return
+		}
 		ups.config.LogRequestBytes(ctx, req)
 	}
 }
 
 func (ups *upsHandler) logResponseBytes(ctx context.Context, resp []byte) {
 	if ups.config.LogResponseBytes != nil {
+		if sample := logSampleFromContext(ctx); sample != nil {
+			sample.log(ups.config.LogSampler, func() {
+				ups.config.LogResponseBytes(ctx, resp)
+			})
+			return
+		}
 		ups.config.LogResponseBytes(ctx, resp)
 	}
 }
 
 func (ups *upsHandler) logRequestJSON(ctx context.Context, req string) {
 	if ups.config.LogRequestJSON != nil {
+		if sample := logSampleFromContext(ctx); sample != nil {
+			sample.log(ups.config.LogSampler, func() {
+				ups.config.LogRequestJSON(ctx, req)
+			})
+			return
+		}
 		ups.config.LogRequestJSON(ctx, req)
 	}
 }
 
 func (ups *upsHandler) logResponseJSON(ctx context.Context, resp string) {
 	if ups.config.LogResponseJSON != nil {
+		if sample := logSampleFromContext(ctx); sample != nil {
+			sample.log(ups.config.LogSampler, func() {
+				ups.config.LogResponseJSON(ctx, resp)
+			})
+			return
+		}
 		ups.config.LogResponseJSON(ctx, resp)
 	}
 }
 
+func (ups *upsHandler) logRequestText(ctx context.Context, req string) {
+	if ups.config.LogRequestText != nil {
+		if sample := logSampleFromContext(ctx); sample != nil {
+			sample.log(ups.config.LogSampler, func() {
+				ups.config.LogRequestText(ctx, req)
+			})
+			return
+		}
+		ups.config.LogRequestText(ctx, req)
+	}
+}
+
+func (ups *upsHandler) logResponseText(ctx context.Context, resp string) {
+	if ups.config.LogResponseText != nil {
+		if sample := logSampleFromContext(ctx); sample != nil {
+			sample.log(ups.config.LogSampler, func() {
+				ups.config.LogResponseText(ctx, resp)
+			})
+			return
+		}
+		ups.config.LogResponseText(ctx, resp)
+	}
+}
+
+func (ups *upsHandler) protobufContentType(name protoreflect.FullName) string {
+	contentType := ups.config.ProtobufContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if ups.config.ProtobufTypeParameter && name != "" {
+		contentType = mime.FormatMediaType(contentType, map[string]string{"proto": string(name)})
+	}
+	return contentType
+}
+
+func (ups *upsHandler) jsonUnmarshal(req []byte, msg proto.Message) error {
+	if ups.config.Enums != nil {
+		var err error
+		if req, err = ups.config.Enums.rewrite(req, proto.MessageReflect(msg).Descriptor()); err != nil {
+			return err
+		}
+	}
+	if ups.config.WellKnownTypes != nil {
+		var err error
+		if req, err = ups.config.WellKnownTypes.rewriteRequest(req, proto.MessageReflect(msg).Descriptor()); err != nil {
+			return err
+		}
+	}
+	if ups.config.JSONUnmarshaler != nil {
+		return ups.config.JSONUnmarshaler.Unmarshal(bytes.NewReader(req), msg)
+	}
+	return jsonpb.Unmarshal(bytes.NewReader(req), msg)
+}
+
+// errorText returns the body of error responses, localized by the
+// Catalog, if any.
+func (ups *upsHandler) errorText(ctx context.Context, w http.ResponseWriter, statusCode int) string {
+	response := ups.errorResponse(ctx, statusCode)
+	if ups.config.Catalog != nil {
+		var locale string
+		response, locale = ups.config.Catalog.localize(ctx, statusCode, response, ups.config.ErrorResponse != nil)
+		w.Header().Set("Content-Language", locale)
+		w.Header().Add("Vary", "Accept-Language")
+	}
+	return response
+}
+
 func (ups *upsHandler) errorResponse(ctx context.Context, statusCode int) string {
 	if ups.config.ErrorResponse != nil {
 		return ups.config.ErrorResponse(ctx, statusCode)
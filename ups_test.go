@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/qpliu/ups/testingups"
@@ -119,6 +120,54 @@ func TestHello(t *testing.T) {
 		}
 	})
 
+	t.Run("form", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString("name=World"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Errorf("response code: expected: %d, got: %d", http.StatusOK, resp.Code)
+		}
+		respContentType := resp.HeaderMap.Get("Content-Type")
+		if respContentType != "application/json" {
+			t.Errorf("response Content-Type, expected: application/json, got: %s", respContentType)
+		}
+		respBody := resp.Body.String()
+		respBodyExpected := `{"text":"Hello, World!"}`
+		if respBody != respBodyExpected {
+			t.Errorf("response body, expected: %s, got: %s", respBodyExpected, respBody)
+		}
+	})
+
+	t.Run("bad form", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString("name=World&name=Again"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != http.StatusInternalServerError {
+			t.Errorf("response code: expected: %d, got: %d", http.StatusInternalServerError, resp.Code)
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`name: "World"`))
+		req.Header.Set("Content-Type", "text/x-protobuf")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Errorf("response code: expected: %d, got: %d", http.StatusOK, resp.Code)
+		}
+		respContentType := resp.HeaderMap.Get("Content-Type")
+		if respContentType != "text/x-protobuf" {
+			t.Errorf("response Content-Type, expected: text/x-protobuf, got: %s", respContentType)
+		}
+		respBody := strings.TrimSpace(resp.Body.String())
+		respBodyExpected := `text: "Hello, World!"`
+		if respBody != respBodyExpected {
+			t.Errorf("response body, expected: %s, got: %s", respBodyExpected, respBody)
+		}
+	})
+
 	t.Run("bad content-type", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString("bad request"))
 		req.Header.Set("Content-Type", "text/plain")
@@ -376,3 +425,114 @@ func ExampleUPS() {
 		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
 	}))
 }
+
+func TestSizeLimits(t *testing.T) {
+	config := DefaultConfig
+	config.LogError = nil
+	config.MaxRequestSize = 20
+	config.MaxResponseSize = 25
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+
+	for _, test := range []struct {
+		name       string
+		body       string
+		unknownLen bool
+		statusCode int
+	}{
+		{"ok", `{"name":"World"}`, false, http.StatusOK},
+		{"large request", `{"name":"World and everyone"}`, false, http.StatusRequestEntityTooLarge},
+		{"large request without length", `{"name":"World and everyone"}`, true, http.StatusRequestEntityTooLarge},
+		{"large response", `{"name":"Everyone!"}`, false, http.StatusInternalServerError},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(test.body))
+			if test.unknownLen {
+				req.ContentLength = -1
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+			if resp.Code != test.statusCode {
+				t.Errorf("response code: expected: %d, got: %d", test.statusCode, resp.Code)
+			}
+		})
+	}
+}
+
+type unreadBody struct {
+	read bool
+}
+
+func (b *unreadBody) Read(p []byte) (int, error) {
+	b.read = true
+	return 0, errors.New("body read")
+}
+
+func TestExpectContinue(t *testing.T) {
+	config := DefaultConfig
+	config.MaxRequestSize = 100
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+
+	for _, test := range []struct {
+		name          string
+		contentType   string
+		contentLength int64
+		statusCode    int
+	}{
+		{"unsupported media type", "image/png", 10, http.StatusUnsupportedMediaType},
+		{"too large", "application/json", 1000, http.StatusRequestEntityTooLarge},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			body := &unreadBody{}
+			req := httptest.NewRequest(http.MethodPost, "/hello", body)
+			req.ContentLength = test.contentLength
+			req.Header.Set("Content-Type", test.contentType)
+			req.Header.Set("Expect", "100-continue")
+			resp := httptest.NewRecorder()
+			handler.ServeHTTP(resp, req)
+			if resp.Code != test.statusCode {
+				t.Errorf("response code: expected: %d, got: %d", test.statusCode, resp.Code)
+			}
+			if body.read {
+				t.Errorf("body was read")
+			}
+		})
+	}
+}
+
+func TestRetainRequests(t *testing.T) {
+	var retained []*testingups.HelloRequest
+	config := DefaultConfig
+	config.RetainRequests = true
+	handler := UPSWithConfig(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		retained = append(retained, req)
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}, config)
+
+	for _, name := range []string{"World", "Everyone"} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if len(retained) != 2 || retained[0] == retained[1] || retained[0].Name != "World" || retained[1].Name != "Everyone" {
+		t.Errorf("unexpected retained requests %v", retained)
+	}
+}
+
+func TestContentLength(t *testing.T) {
+	handler := UPS(func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK || resp.Header().Get("Content-Length") != strconv.Itoa(resp.Body.Len()) {
+		t.Errorf("unexpected response %d %s %s", resp.Code, resp.Header().Get("Content-Length"), resp.Body.String())
+	}
+}
@@ -0,0 +1,5 @@
+//go:generate protoc --go_out=. --go_opt=paths=source_relative reflection.proto operation.proto options.proto
+
+// Package upspb contains the messages used by the endpoints provided by
+// the ups package.
+package upspb
@@ -0,0 +1,141 @@
+// Package upstest provides utilities for testing ups services.
+package upstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Contract is a set of example requests and responses for the methods of
+// a service, which are run as table-driven tests against a handler.
+type Contract struct {
+	Service protoreflect.ServiceDescriptor
+
+	// Path returns the route of a method.  If nil, the route is
+	// /<full service name>/<method name>.
+	Path func(protoreflect.MethodDescriptor) string
+
+	Cases []Case `json:"cases"`
+}
+
+// Case is an example request and response.  The request and response
+// are in the JSON format of the input and output messages of the method.
+type Case struct {
+	Name     string          `json:"name"`
+	Method   string          `json:"method"`
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response,omitempty"`
+
+	// Status is the expected status.  If zero, 200 is expected.  The
+	// response is only checked for 200 statuses.
+	Status int `json:"status,omitempty"`
+}
+
+// LoadContract reads the cases of a Contract for the service from a JSON
+// fixture of the form {"cases": [...]}.
+func LoadContract(service protoreflect.ServiceDescriptor, r io.Reader) (*Contract, error) {
+	c := &Contract{Service: service}
+	if err := json.NewDecoder(r).Decode(c); err != nil {
+		return nil, err
+	}
+	for _, tc := range c.Cases {
+		if service.Methods().ByName(protoreflect.Name(tc.Method)) == nil {
+			return nil, fmt.Errorf("upstest: %s: unknown method: %s", tc.Name, tc.Method)
+		}
+	}
+	return c, nil
+}
+
+// Run runs each case against handler, with the request sent both as
+// protobuf and as JSON, checking the status, the Content-Type, and the
+// response.
+func (c *Contract) Run(t *testing.T, handler http.Handler) {
+	for _, tc := range c.Cases {
+		tc := tc
+		method := c.Service.Methods().ByName(protoreflect.Name(tc.Method))
+		for _, contentType := range []string{"application/octet-stream", "application/json"} {
+			contentType := contentType
+			t.Run(tc.Name+"/"+contentType, func(t *testing.T) {
+				if method == nil {
+					t.Fatalf("unknown method: %s", tc.Method)
+				}
+				c.runCase(t, handler, method, tc, contentType)
+			})
+		}
+	}
+}
+
+func (c *Contract) path(method protoreflect.MethodDescriptor) string {
+	if c.Path != nil {
+		return c.Path(method)
+	}
+	return "/" + string(c.Service.FullName()) + "/" + string(method.Name())
+}
+
+func (c *Contract) runCase(t *testing.T, handler http.Handler, method protoreflect.MethodDescriptor, tc Case, contentType string) {
+	reqMsg := dynamicpb.NewMessage(method.Input())
+	if len(tc.Request) > 0 {
+		if err := protojson.Unmarshal(tc.Request, reqMsg); err != nil {
+			t.Fatalf("request: %v", err)
+		}
+	}
+	var body []byte
+	var err error
+	if contentType == "application/json" {
+		body, err = protojson.Marshal(reqMsg)
+	} else {
+		body, err = proto.Marshal(reqMsg)
+	}
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, c.path(method), bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+
+	status := tc.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if resp.Code != status {
+		t.Fatalf("response code: expected: %d, got: %d", status, resp.Code)
+	}
+	if status != http.StatusOK {
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header().Get("Content-Type")); mediaType != contentType {
+		t.Errorf("response Content-Type: expected: %s, got: %s", contentType, resp.Header().Get("Content-Type"))
+	}
+
+	respMsg := dynamicpb.NewMessage(method.Output())
+	if contentType == "application/json" {
+		err = protojson.Unmarshal(resp.Body.Bytes(), respMsg)
+	} else {
+		err = proto.Unmarshal(resp.Body.Bytes(), respMsg)
+	}
+	if err != nil {
+		t.Fatalf("response: %v", err)
+	}
+	expected := dynamicpb.NewMessage(method.Output())
+	if len(tc.Response) > 0 {
+		if err := protojson.Unmarshal(tc.Response, expected); err != nil {
+			t.Fatalf("expected response: %v", err)
+		}
+	}
+	if !proto.Equal(expected, respMsg) {
+		t.Errorf("response: expected: %v, got: %v", expected, respMsg)
+	}
+}
@@ -0,0 +1,77 @@
+package upstest
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	legacyproto "github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/testingups"
+)
+
+type testError int
+
+func (err testError) Error() string {
+	return http.StatusText(int(err))
+}
+
+func (err testError) StatusCode() int {
+	return int(err)
+}
+
+func helloService(t *testing.T) protoreflect.ServiceDescriptor {
+	helloFile := legacyproto.MessageReflect(&testingups.HelloRequest{}).Descriptor().ParentFile()
+	files := &protoregistry.Files{}
+	if err := files.RegisterFile(helloFile); err != nil {
+		t.Fatal(err)
+	}
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("hello_service.proto"),
+		Package:    proto.String("test"),
+		Dependency: []string{helloFile.Path()},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("HelloService"),
+			Method: []*descriptorpb.MethodDescriptorProto{{
+				Name:       proto.String("Hello"),
+				InputType:  proto.String(".HelloRequest"),
+				OutputType: proto.String(".HelloResponse"),
+			}},
+		}},
+	}, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd.Services().Get(0)
+}
+
+func TestContract(t *testing.T) {
+	service := helloService(t)
+
+	contract, err := LoadContract(service, strings.NewReader(`{"cases": [
+		{"name": "hello", "method": "Hello", "request": {"name": "World"}, "response": {"text": "Hello, World!"}},
+		{"name": "teapot", "method": "Hello", "request": {"name": "Teapot"}, "status": 418}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/test.HelloService/Hello", ups.UPS(func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if req.Name == "Teapot" {
+			return nil, testError(http.StatusTeapot)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+	}))
+	contract.Run(t, mux)
+
+	if _, err := LoadContract(service, strings.NewReader(`{"cases": [{"name": "bad", "method": "Goodbye"}]}`)); err == nil {
+		t.Errorf("expected unknown method error")
+	}
+}
@@ -0,0 +1,190 @@
+package upstest
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/qpliu/ups"
+)
+
+// Differ replays recorded requests, such as from a ups.Recorder,
+// against two handlers, such as the implementations before and after a
+// refactor or a dependency upgrade, and compares their decoded
+// responses.
+type Differ struct {
+	// Response returns an empty response message for the recording,
+	// such as by its URL.  Responses for which it returns nil are
+	// compared byte for byte.
+	Response func(*ups.Recording) proto.Message
+
+	// Ignore are the paths of the fields that are not compared, such as
+	// "created_at" or "items.updated_at", with fields named by their
+	// proto names.
+	Ignore []string
+}
+
+// Diff is the differences between the responses to a recorded request.
+type Diff struct {
+	Recording *ups.Recording
+
+	// Differences describe the differences, such as
+	// `text: "Hello" != "Hi"`, by field path.
+	Differences []string
+}
+
+func (d *Diff) String() string {
+	return fmt.Sprintf("%s %s:\n\t%s", d.Recording.Method, d.Recording.URL, strings.Join(d.Differences, "\n\t"))
+}
+
+// Compare replays the recordings against both handlers, returning the
+// differences between their responses.
+func (d *Differ) Compare(recordings []*ups.Recording, before, after http.Handler) []*Diff {
+	var diffs []*Diff
+	for _, recording := range recordings {
+		if differences := d.compare(recording, ups.ReplayRecording(before, recording), ups.ReplayRecording(after, recording)); len(differences) > 0 {
+			diffs = append(diffs, &Diff{Recording: recording, Differences: differences})
+		}
+	}
+	return diffs
+}
+
+// Report replays the recordings against both handlers, reporting the
+// differences between their responses as test errors.
+func (d *Differ) Report(t testing.TB, recordings []*ups.Recording, before, after http.Handler) {
+	t.Helper()
+	for _, diff := range d.Compare(recordings, before, after) {
+		t.Error(diff)
+	}
+}
+
+func (d *Differ) compare(recording, a, b *ups.Recording) []string {
+	if a.StatusCode != b.StatusCode {
+		return []string{fmt.Sprintf("status: %d != %d", a.StatusCode, b.StatusCode)}
+	}
+	var resp proto.Message
+	if d.Response != nil && a.StatusCode == http.StatusOK {
+		resp = d.Response(recording)
+	}
+	if resp == nil {
+		if string(a.ResponseBody) != string(b.ResponseBody) {
+			return []string{fmt.Sprintf("body: %q != %q", a.ResponseBody, b.ResponseBody)}
+		}
+		return nil
+	}
+	msgA, msgB := resp.ProtoReflect().New().Interface(), resp.ProtoReflect().New().Interface()
+	if err := unmarshalResponse(a, msgA); err != nil {
+		return []string{"before: " + err.Error()}
+	}
+	if err := unmarshalResponse(b, msgB); err != nil {
+		return []string{"after: " + err.Error()}
+	}
+	var differences []string
+	d.compareMessages("", "", msgA.ProtoReflect(), msgB.ProtoReflect(), &differences)
+	return differences
+}
+
+func unmarshalResponse(recording *ups.Recording, msg proto.Message) error {
+	mediaType, _, _ := mime.ParseMediaType(recording.ResponseHeader.Get("Content-Type"))
+	if mediaType == "application/json" {
+		return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(recording.ResponseBody, msg)
+	}
+	return proto.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(recording.ResponseBody, msg)
+}
+
+func (d *Differ) ignored(name string) bool {
+	for _, ignore := range d.Ignore {
+		if ignore == name {
+			return true
+		}
+	}
+	return false
+}
+
+// compareMessages appends the differences between the messages, where
+// path is the path of the messages, with list indexes and map keys, and
+// name is the path of field names, for Ignore.
+func (d *Differ) compareMessages(path, name string, a, b protoreflect.Message, differences *[]string) {
+	fields := a.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		fieldPath, fieldName := join(path, string(fd.Name())), join(name, string(fd.Name()))
+		if d.ignored(fieldName) || (!a.Has(fd) && !b.Has(fd)) {
+			continue
+		}
+		switch {
+		case fd.IsList():
+			listA, listB := a.Get(fd).List(), b.Get(fd).List()
+			if listA.Len() != listB.Len() {
+				*differences = append(*differences, fmt.Sprintf("%s: %d != %d elements", fieldPath, listA.Len(), listB.Len()))
+				continue
+			}
+			for j := 0; j < listA.Len(); j++ {
+				d.compareValues(fmt.Sprintf("%s[%d]", fieldPath, j), fieldName, fd, listA.Get(j), listB.Get(j), differences)
+			}
+		case fd.IsMap():
+			mapA, mapB := a.Get(fd).Map(), b.Get(fd).Map()
+			keys := map[string]protoreflect.MapKey{}
+			var names []string
+			for _, m := range []protoreflect.Map{mapA, mapB} {
+				m.Range(func(key protoreflect.MapKey, _ protoreflect.Value) bool {
+					k := fmt.Sprint(key.Interface())
+					if _, ok := keys[k]; !ok {
+						keys[k] = key
+						names = append(names, k)
+					}
+					return true
+				})
+			}
+			sort.Strings(names)
+			for _, k := range names {
+				key, keyPath := keys[k], fmt.Sprintf("%s[%s]", fieldPath, k)
+				if !mapB.Has(key) {
+					*differences = append(*differences, keyPath+": missing after")
+				} else if !mapA.Has(key) {
+					*differences = append(*differences, keyPath+": missing before")
+				} else {
+					d.compareValues(keyPath, fieldName, fd.MapValue(), mapA.Get(key), mapB.Get(key), differences)
+				}
+			}
+		default:
+			d.compareValues(fieldPath, fieldName, fd, a.Get(fd), b.Get(fd), differences)
+		}
+	}
+}
+
+func (d *Differ) compareValues(path, name string, fd protoreflect.FieldDescriptor, a, b protoreflect.Value, differences *[]string) {
+	if fd.Message() != nil {
+		d.compareMessages(path, name, a.Message(), b.Message(), differences)
+	} else if !a.Equal(b) {
+		*differences = append(*differences, fmt.Sprintf("%s: %s != %s", path, formatValue(fd, a), formatValue(fd, b)))
+	}
+}
+
+func formatValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) string {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return fmt.Sprintf("%q", v.String())
+	case protoreflect.BytesKind:
+		return fmt.Sprintf("%q", v.Bytes())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,69 @@
+package upstest
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/testingups"
+)
+
+func TestDiffer(t *testing.T) {
+	before := ups.UPS(func(req *testingups.HelloRequest) (*structpb.Struct, error) {
+		if req.Name == "Teapot" {
+			return nil, testError(http.StatusTeapot)
+		}
+		return structpb.NewStruct(map[string]interface{}{"text": "Hello, " + req.Name, "time": 1, "items": []interface{}{1, 2}})
+	})
+	after := ups.UPS(func(req *testingups.HelloRequest) (*structpb.Struct, error) {
+		return structpb.NewStruct(map[string]interface{}{"text": "Hi, " + req.Name, "time": 2, "items": []interface{}{1, 3}})
+	})
+
+	var buf bytes.Buffer
+	recorder := ups.NewRecorder(before, &buf)
+	for _, body := range []string{`{"name":"World"}`, `{"name":"Teapot"}`} {
+		r, _ := http.NewRequest(http.MethodPost, "/hello", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		recorder.ServeHTTP(discardResponseWriter{http.Header{}}, r)
+	}
+	recordings, err := ups.ReadRecordings(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	differ := &Differ{
+		Response: func(*ups.Recording) proto.Message { return &structpb.Struct{} },
+		Ignore:   []string{"fields.list_value.values.number_value"},
+	}
+	diffs := differ.Compare(recordings, before, after)
+	if len(diffs) != 2 {
+		t.Fatalf("unexpected diffs: %v", diffs)
+	}
+	expected := []string{
+		`fields[text].string_value: "Hello, World" != "Hi, World"`,
+		`fields[time].number_value: 1 != 2`,
+	}
+	if d := diffs[0].Differences; len(d) != 2 || d[0] != expected[0] || d[1] != expected[1] {
+		t.Errorf("unexpected differences: %v", d)
+	}
+	if d := diffs[1].Differences; len(d) != 1 || d[0] != "status: 418 != 200" {
+		t.Errorf("unexpected differences: %v", d)
+	}
+
+	if diffs := differ.Compare(recordings, before, before); len(diffs) != 0 {
+		t.Errorf("unexpected diffs: %v", diffs)
+	}
+}
+
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w discardResponseWriter) Header() http.Header         { return w.header }
+func (w discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w discardResponseWriter) WriteHeader(int)             {}
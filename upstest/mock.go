@@ -0,0 +1,187 @@
+package upstest
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Mock is a fake of a ups service with expected requests and their
+// responses, for testing clients, such as ups.Proxy, without network
+// calls.  Requests are served in-process by the http.Client from Client,
+// or by Mock as an http.Handler.
+type Mock struct {
+	Service protoreflect.ServiceDescriptor
+
+	// Path returns the route of a method.  If nil, the route is
+	// /<full service name>/<method name>.
+	Path func(protoreflect.MethodDescriptor) string
+
+	mu           sync.Mutex
+	expectations []*Expectation
+	unexpected   []string
+}
+
+// Expectation is an expected request of a Mock.
+type Expectation struct {
+	method   protoreflect.MethodDescriptor
+	request  proto.Message
+	response proto.Message
+	status   int
+	times    int
+	calls    int
+}
+
+// NewMock creates a Mock of the service.
+func NewMock(service protoreflect.ServiceDescriptor) *Mock {
+	return &Mock{Service: service}
+}
+
+// Expect adds an expectation for requests to the method that are equal
+// to req, or for any requests to the method if req is nil.  The
+// expectation responds with an empty response message unless given a
+// response with Return or a status with ReturnStatus.  Expectations are
+// matched in the order they are added.
+//
+// Expect will panic if the service has no such method.
+func (m *Mock) Expect(method string, req proto.Message) *Expectation {
+	md := m.Service.Methods().ByName(protoreflect.Name(method))
+	if md == nil {
+		panic("upstest: unknown method: " + method)
+	}
+	e := &Expectation{method: md, request: req, status: http.StatusOK}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Return sets the response of the expectation.
+func (e *Expectation) Return(resp proto.Message) *Expectation {
+	e.response = resp
+	return e
+}
+
+// ReturnStatus makes the expectation respond with the error status.
+func (e *Expectation) ReturnStatus(status int) *Expectation {
+	e.status = status
+	return e
+}
+
+// Times limits the expectation to n requests, which must all be made.
+// Otherwise, it must be matched at least once.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Client returns an http.Client that sends requests to the Mock
+// without network calls.
+func (m *Mock) Client() *http.Client {
+	return &http.Client{Transport: mockTransport{m}}
+}
+
+type mockTransport struct {
+	m *Mock
+}
+
+func (t mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := httptest.NewRecorder()
+	t.m.ServeHTTP(resp, req)
+	result := resp.Result()
+	result.Request = req
+	return result, nil
+}
+
+func (m *Mock) path(method protoreflect.MethodDescriptor) string {
+	if m.Path != nil {
+		return m.Path(method)
+	}
+	return "/" + string(m.Service.FullName()) + "/" + string(method.Name())
+}
+
+func (m *Mock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	unmarshal := proto.Unmarshal
+	marshal := proto.Marshal
+	if mediaType == "application/json" {
+		unmarshal = protojson.Unmarshal
+		marshal = protojson.Marshal
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var match *Expectation
+	for _, e := range m.expectations {
+		if m.path(e.method) != r.URL.Path || (e.times > 0 && e.calls >= e.times) {
+			continue
+		}
+		req := dynamicpb.NewMessage(e.method.Input())
+		if err := unmarshal(body, req); err != nil {
+			continue
+		}
+		if e.request != nil {
+			expected := dynamicpb.NewMessage(e.method.Input())
+			if b, err := proto.Marshal(e.request); err != nil || proto.Unmarshal(b, expected) != nil || !proto.Equal(req, expected) {
+				continue
+			}
+		}
+		match = e
+		break
+	}
+	if match == nil {
+		m.unexpected = append(m.unexpected, fmt.Sprintf("%s %s", r.URL.Path, body))
+		http.Error(w, "", http.StatusNotImplemented)
+		return
+	}
+	match.calls++
+	if match.status != http.StatusOK {
+		http.Error(w, "", match.status)
+		return
+	}
+	resp := match.response
+	if resp == nil {
+		resp = dynamicpb.NewMessage(match.method.Output())
+	}
+	b, err := marshal(resp)
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+	if mediaType == "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+	}
+	w.Write(b)
+}
+
+// AssertExpectations reports the unexpected requests and the
+// expectations that were not met.
+func (m *Mock) AssertExpectations(t testing.TB) {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, req := range m.unexpected {
+		t.Errorf("unexpected request: %s", req)
+	}
+	for _, e := range m.expectations {
+		if (e.times > 0 && e.calls != e.times) || (e.times == 0 && e.calls == 0) {
+			t.Errorf("%s: expected %d requests, got %d", e.method.FullName(), max(e.times, 1), e.calls)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package upstest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	legacyproto "github.com/golang/protobuf/proto"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/testingups"
+)
+
+type recordingT struct {
+	testing.TB
+	errors int
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors++
+}
+
+func TestMock(t *testing.T) {
+	mock := NewMock(helloService(t))
+	mock.Expect("Hello", legacyproto.MessageV2(&testingups.HelloRequest{Name: "World"})).Return(legacyproto.MessageV2(&testingups.HelloResponse{Text: "Hello, World!"})).Times(2)
+	mock.Expect("Hello", legacyproto.MessageV2(&testingups.HelloRequest{Name: "Teapot"})).ReturnStatus(http.StatusTeapot)
+	unmet := mock.Expect("Hello", nil)
+
+	proxy := ups.NewProxy("http://hello.invalid/test.HelloService/Hello")
+	proxy.Client = mock.Client()
+	for _, test := range []struct {
+		name     string
+		code     int
+		expected string
+	}{
+		{"World", http.StatusOK, `{"text":"Hello, World!"}`},
+		{"World", http.StatusOK, `{"text":"Hello, World!"}`},
+		{"Teapot", http.StatusTeapot, ""},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"`+test.name+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		proxy.ServeHTTP(resp, req)
+		if resp.Code != test.code || (test.code == http.StatusOK && resp.Body.String() != test.expected) {
+			t.Errorf("%s: unexpected response %d %s", test.name, resp.Code, resp.Body.String())
+		}
+	}
+
+	rt := &recordingT{TB: t}
+	mock.AssertExpectations(rt)
+	if rt.errors != 1 {
+		t.Errorf("expected the unmet expectation to be reported, got %d errors", rt.errors)
+	}
+	unmet.Times(1)
+	mock.Expect("Hello", legacyproto.MessageV2(&testingups.HelloRequest{Name: "Other"}))
+	req, _ := http.NewRequest(http.MethodPost, "http://hello.invalid/test.HelloService/Hello", bytes.NewBufferString(`{"name":"Everyone"}`))
+	req.Header.Set("Content-Type", "application/json")
+	if resp, err := mock.Client().Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected response %v %v", resp, err)
+	}
+	rt = &recordingT{TB: t}
+	mock.AssertExpectations(rt)
+	if rt.errors != 1 {
+		t.Errorf("expected the unmet expectation to be reported, got %d errors", rt.errors)
+	}
+}
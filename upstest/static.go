@@ -0,0 +1,205 @@
+package upstest
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/qpliu/ups"
+)
+
+// maxFakeDepth is the depth of the nested messages of fake responses.
+const maxFakeDepth = 3
+
+// StaticServer serves all the methods of services with ups handlers
+// that respond with canned example responses, or with fake responses
+// generated from the descriptors, such as for frontend development
+// before the services exist.
+type StaticServer struct {
+	// Path returns the route of a method.  If nil, the route is
+	// /<full service name>/<method name>.
+	Path func(protoreflect.MethodDescriptor) string
+
+	// Random, if not nil, randomizes the fake responses.  Otherwise,
+	// the fake responses are the same for every request.
+	Random *rand.Rand
+
+	config   ups.Config
+	methods  []protoreflect.MethodDescriptor
+	handlers map[protoreflect.FullName]http.Handler
+
+	mu       sync.Mutex
+	examples map[protoreflect.FullName]proto.Message
+}
+
+// NewStaticServer creates a StaticServer of the services, serving each
+// method with a handler with the config.
+func NewStaticServer(config ups.Config, services ...protoreflect.ServiceDescriptor) *StaticServer {
+	s := &StaticServer{
+		config:   config,
+		handlers: map[protoreflect.FullName]http.Handler{},
+		examples: map[protoreflect.FullName]proto.Message{},
+	}
+	for _, service := range services {
+		methods := service.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			s.addMethod(methods.Get(i))
+		}
+	}
+	return s
+}
+
+func (s *StaticServer) addMethod(md protoreflect.MethodDescriptor) {
+	s.methods = append(s.methods, md)
+	s.handlers[md.FullName()] = ups.UPSDynamicWithConfig(func(req *dynamicpb.Message) *dynamicpb.Message {
+		return s.response(md)
+	}, md.Input(), s.config)
+}
+
+// Example sets the response of the method, by full name, such as
+// "example.HelloService.Hello".  The response must be the output message
+// of the method.
+//
+// Example will panic if there is no such method.
+func (s *StaticServer) Example(method string, resp proto.Message) {
+	md := s.method(method)
+	msg := dynamicpb.NewMessage(md.Output())
+	b, err := proto.Marshal(resp)
+	if err == nil {
+		err = proto.Unmarshal(b, msg)
+	}
+	if err != nil {
+		panic("upstest: invalid example: " + method + ": " + err.Error())
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.examples[md.FullName()] = msg
+}
+
+// ExampleJSON sets the response of the method, by full name, to the
+// output message in JSON.
+func (s *StaticServer) ExampleJSON(method string, data []byte) error {
+	md := s.method(method)
+	msg := dynamicpb.NewMessage(md.Output())
+	if err := protojson.Unmarshal(data, msg); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.examples[md.FullName()] = msg
+	return nil
+}
+
+func (s *StaticServer) method(name string) protoreflect.MethodDescriptor {
+	for _, md := range s.methods {
+		if string(md.FullName()) == name {
+			return md
+		}
+	}
+	panic("upstest: unknown method: " + name)
+}
+
+func (s *StaticServer) response(md protoreflect.MethodDescriptor) *dynamicpb.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if example, ok := s.examples[md.FullName()]; ok {
+		return example.(*dynamicpb.Message)
+	}
+	return Fake(md.Output(), s.Random)
+}
+
+func (s *StaticServer) path(md protoreflect.MethodDescriptor) string {
+	if s.Path != nil {
+		return s.Path(md)
+	}
+	return "/" + string(md.Parent().FullName()) + "/" + string(md.Name())
+}
+
+func (s *StaticServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, md := range s.methods {
+		if s.path(md) == r.URL.Path {
+			s.handlers[md.FullName()].ServeHTTP(w, r)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// Fake creates a message of the descriptor with fake values for its
+// fields, which are random if r is not nil.  Only the first field of
+// each oneof is set.
+func Fake(desc protoreflect.MessageDescriptor, r *rand.Rand) *dynamicpb.Message {
+	return fakeMessage(desc, r, 0)
+}
+
+func fakeMessage(desc protoreflect.MessageDescriptor, r *rand.Rand, depth int) *dynamicpb.Message {
+	msg := dynamicpb.NewMessage(desc)
+	// Anys are left empty, as they must contain resolvable types.
+	if depth >= maxFakeDepth || desc.FullName() == "google.protobuf.Any" {
+		return msg
+	}
+	fields := desc.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if oneof := fd.ContainingOneof(); oneof != nil && oneof.Fields().Get(0) != fd {
+			continue
+		}
+		switch {
+		case fd.IsMap():
+			msg.Mutable(fd).Map().Set(fakeValue(fd.MapKey(), r, depth).MapKey(), fakeValue(fd.MapValue(), r, depth))
+		case fd.IsList():
+			list := msg.Mutable(fd).List()
+			n := 1
+			if r != nil {
+				n = 1 + r.Intn(3)
+			}
+			for j := 0; j < n; j++ {
+				list.Append(fakeValue(fd, r, depth))
+			}
+		default:
+			msg.Set(fd, fakeValue(fd, r, depth))
+		}
+	}
+	return msg
+}
+
+func fakeValue(fd protoreflect.FieldDescriptor, r *rand.Rand, depth int) protoreflect.Value {
+	n := int64(1)
+	if r != nil {
+		n = r.Int63n(1000)
+	}
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(n%2 == 1)
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		return protoreflect.ValueOfEnum(values.Get(int(n) % values.Len()).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(int32(n))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(n)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(uint32(n))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(uint64(n))
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(float32(n) / 10)
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(float64(n) / 10)
+	case protoreflect.StringKind:
+		if r == nil {
+			return protoreflect.ValueOfString(string(fd.Name()))
+		}
+		return protoreflect.ValueOfString(string(fd.Name()) + strconv.FormatInt(n, 10))
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(fd.Name()))
+	default:
+		return protoreflect.ValueOfMessage(fakeMessage(fd.Message(), r, depth+1))
+	}
+}
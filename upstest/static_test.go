@@ -0,0 +1,56 @@
+package upstest
+
+import (
+	"bytes"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/qpliu/ups"
+)
+
+func TestStaticServer(t *testing.T) {
+	config := ups.DefaultConfig
+	config.LogStartRequest = nil
+	config.LogEndRequest = nil
+	server := NewStaticServer(config, helloService(t))
+	serve := func(path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(`{"name":"World"}`))
+		r.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		server.ServeHTTP(resp, r)
+		return resp
+	}
+
+	if resp := serve("/test.HelloService/Hello"); resp.Code != http.StatusOK || resp.Body.String() != `{"text":"text"}` {
+		t.Errorf("unexpected fake response: %d %s", resp.Code, resp.Body.String())
+	}
+	if err := server.ExampleJSON("test.HelloService.Hello", []byte(`{"text":"Hello, World!"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if resp := serve("/test.HelloService/Hello"); resp.Code != http.StatusOK || resp.Body.String() != `{"text":"Hello, World!"}` {
+		t.Errorf("unexpected example response: %d %s", resp.Code, resp.Body.String())
+	}
+	if resp := serve("/test.HelloService/Goodbye"); resp.Code != http.StatusNotFound {
+		t.Errorf("unexpected status: %d", resp.Code)
+	}
+	if err := server.ExampleJSON("test.HelloService.Hello", []byte(`{"unknown":1}`)); err == nil {
+		t.Errorf("expected invalid example error")
+	}
+}
+
+func TestFake(t *testing.T) {
+	desc := (&structpb.Struct{}).ProtoReflect().Descriptor()
+	msg := Fake(desc, nil)
+	if b, err := protojson.Marshal(msg); err != nil || string(b) != `{"key":null}` {
+		t.Errorf("unexpected fake: %s %v", b, err)
+	}
+	msg = Fake(desc, rand.New(rand.NewSource(1)))
+	if _, err := protojson.Marshal(msg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package ups
+
+import (
+	"net/http"
+	"reflect"
+)
+
+// APIVersion is one of the handlers of a VersionHandler.
+type APIVersion struct {
+	Version string
+	Handler http.Handler
+}
+
+// VersionHandler is an http.Handler that routes requests to the handler
+// for the API version requested by the client in the Header, so that
+// breaking changes to messages can be rolled out as new versions while
+// clients of old versions are migrated.  Handlers for old versions can
+// be adapted from the handlers of new versions with VersionAdapter.
+//
+// Requests without the header are routed to the Default version.
+// Requests for unknown versions get a 400 response.  The version of the
+// handler is set in the Header of responses.
+type VersionHandler struct {
+	// Header is the request and response header with the version.
+	Header string
+
+	// Default is the version for requests without the header.  If empty,
+	// such requests get 400 responses.
+	Default string
+
+	versions map[string]http.Handler
+}
+
+// NewVersionHandler creates a VersionHandler routing to the versions,
+// using the Api-Version header, with the last version being the
+// Default.
+//
+// NewVersionHandler will panic if there are no versions or if a version
+// is duplicated.
+func NewVersionHandler(versions ...APIVersion) *VersionHandler {
+	if len(versions) == 0 {
+		panic("ups: no versions")
+	}
+	v := &VersionHandler{
+		Header:   "Api-Version",
+		Default:  versions[len(versions)-1].Version,
+		versions: map[string]http.Handler{},
+	}
+	for _, version := range versions {
+		if _, ok := v.versions[version.Version]; ok {
+			panic("ups: duplicate version: " + version.Version)
+		}
+		v.versions[version.Version] = version.Handler
+	}
+	return v
+}
+
+func (v *VersionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	version := r.Header.Get(v.Header)
+	if version == "" {
+		version = v.Default
+	}
+	handler, ok := v.versions[version]
+	w.Header().Add("Vary", v.Header)
+	if !ok {
+		http.Error(w, "", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set(v.Header, version)
+	handler.ServeHTTP(w, r)
+}
+
+// VersionAdapter adapts a handler func to the messages of another
+// version, returning a handler func taking the request message of the
+// upgrade func and returning the response message of the downgrade func.
+// The upgrade func converts requests to the request message of the
+// handler, and the downgrade func converts the responses of the handler.
+// Adapters can be chained to adapt a handler to several old versions.
+//
+// The handler must take a proto.Message, or a context.Context and a
+// proto.Message, and return a proto.Message or a (proto.Message, error),
+// as with UPS.  The upgrade and downgrade funcs must take a
+// proto.Message and return a proto.Message or a (proto.Message, error).
+//
+// VersionAdapter will panic if the arguments are not valid funcs, or if
+// their messages do not match.
+func VersionAdapter(handler, upgrade, downgrade interface{}) interface{} {
+	h := reflect.ValueOf(handler)
+	up := reflect.ValueOf(upgrade)
+	down := reflect.ValueOf(downgrade)
+	checkConversion(up.Type())
+	checkConversion(down.Type())
+	ty := h.Type()
+	if ty.Kind() != reflect.Func || ty.NumOut() < 1 || ty.NumOut() > 2 || !ty.Out(0).Implements(messageType) || (ty.NumOut() == 2 && ty.Out(1) != errorType) {
+		panic("ups: invalid version handler")
+	}
+	withContext := false
+	switch {
+	case ty.NumIn() == 1:
+	case ty.NumIn() == 2 && ty.In(0) == contextType:
+		withContext = true
+	default:
+		panic("ups: invalid version handler parameter types")
+	}
+	if up.Type().Out(0) != ty.In(ty.NumIn()-1) || down.Type().In(0) != ty.Out(0) {
+		panic("ups: version adapter message types do not match")
+	}
+
+	fnType := reflect.FuncOf([]reflect.Type{contextType, up.Type().In(0)}, []reflect.Type{down.Type().Out(0), errorType}, false)
+	fail := func(err reflect.Value) []reflect.Value {
+		return []reflect.Value{reflect.Zero(down.Type().Out(0)), err}
+	}
+	return reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		results := up.Call(args[1:])
+		if len(results) > 1 && !results[1].IsNil() {
+			return fail(results[1])
+		}
+		in := []reflect.Value{results[0]}
+		if withContext {
+			in = []reflect.Value{args[0], results[0]}
+		}
+		results = h.Call(in)
+		if len(results) > 1 && !results[1].IsNil() {
+			return fail(results[1])
+		}
+		results = down.Call(results[:1])
+		if len(results) > 1 {
+			return results
+		}
+		return []reflect.Value{results[0], reflect.Zero(errorType)}
+	}).Interface()
+}
+
+func checkConversion(ty reflect.Type) {
+	if ty.Kind() != reflect.Func || ty.NumIn() != 1 || !ty.In(0).Implements(messageType) || ty.NumOut() < 1 || ty.NumOut() > 2 || !ty.Out(0).Implements(messageType) || (ty.NumOut() == 2 && ty.Out(1) != errorType) {
+		panic("ups: invalid version conversion")
+	}
+}
@@ -0,0 +1,77 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qpliu/ups/testingups"
+	"github.com/qpliu/ups/upspb"
+)
+
+func TestVersionHandler(t *testing.T) {
+	hello := func(req *testingups.HelloRequest) (*testingups.HelloResponse, error) {
+		if req.Name == "" {
+			return nil, testError(http.StatusNotFound)
+		}
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}, nil
+	}
+	v1 := VersionAdapter(hello, func(req *upspb.GetOperationRequest) *testingups.HelloRequest {
+		return &testingups.HelloRequest{Name: req.Name}
+	}, func(resp *testingups.HelloResponse) *upspb.Operation {
+		return &upspb.Operation{Name: resp.Text, Done: true}
+	})
+	handler := NewVersionHandler(
+		APIVersion{Version: "1", Handler: UPS(v1)},
+		APIVersion{Version: "2", Handler: UPS(hello)},
+	)
+
+	for _, test := range []struct {
+		version    string
+		body       string
+		statusCode int
+		expected   string
+	}{
+		{"", `{"name":"World"}`, http.StatusOK, `{"text":"Hello, World!"}`},
+		{"2", `{"name":"World"}`, http.StatusOK, `{"text":"Hello, World!"}`},
+		{"1", `{"name":"World"}`, http.StatusOK, `{"name":"Hello, World!","done":true}`},
+		{"1", `{}`, http.StatusNotFound, "\n"},
+		{"3", `{"name":"World"}`, http.StatusBadRequest, "\n"},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		if test.version != "" {
+			req.Header.Set("Api-Version", test.version)
+		}
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != test.statusCode || resp.Body.String() != test.expected {
+			t.Errorf("%s: unexpected response %d %s", test.version, resp.Code, resp.Body.String())
+		}
+		if resp.Header().Get("Vary") != "Api-Version" {
+			t.Errorf("%s: expected Vary header", test.version)
+		}
+		if test.statusCode != http.StatusBadRequest && (resp.Header().Get("Api-Version") != test.version && test.version != "") {
+			t.Errorf("%s: unexpected version header %s", test.version, resp.Header().Get("Api-Version"))
+		}
+	}
+}
+
+func TestVersionHandlerCachePolicy(t *testing.T) {
+	config := DefaultConfig
+	config.Cache = &CachePolicy{CacheControl: "public, max-age=60", Vary: []string{"Accept-Language", "api-version"}}
+	hello := func(req *testingups.HelloRequest) *testingups.HelloResponse {
+		return &testingups.HelloResponse{Text: "Hello, " + req.Name + "!"}
+	}
+	handler := NewVersionHandler(APIVersion{Version: "1", Handler: UPSWithConfig(hello, config)})
+
+	req := httptest.NewRequest(http.MethodPost, "/hello", bytes.NewBufferString(`{"name":"World"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	if vary := strings.Join(resp.Header().Values("Vary"), ", "); resp.Code != http.StatusOK || vary != "Api-Version, Accept-Language" {
+		t.Errorf("unexpected response: %d %s", resp.Code, vary)
+	}
+}
@@ -0,0 +1,97 @@
+package ups
+
+import (
+	"context"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/qpliu/ups/upspb"
+)
+
+// FieldVisibility strips fields from responses unless the
+// AuthenticatedPrincipal has the scopes they require, so that one
+// message can serve both public and privileged callers.  The scopes of
+// fields are given by the ups.required_scope option of upspb, as in
+//
+//	string internal_notes = 5 [(ups.required_scope) = "admin"];
+//
+// or by the Scopes.
+type FieldVisibility struct {
+	// Scopes maps the full names of fields, such as
+	// "package.Message.field", to the scopes they require, overriding
+	// their options.
+	Scopes map[protoreflect.FullName]string
+
+	// scopes caches the required scope, or "", of each field.
+	scopes sync.Map
+}
+
+func (v *FieldVisibility) scope(fd protoreflect.FieldDescriptor) string {
+	if scope, ok := v.Scopes[fd.FullName()]; ok {
+		return scope
+	}
+	if scope, ok := v.scopes.Load(fd); ok {
+		return scope.(string)
+	}
+	scope := ""
+	if opts, ok := fd.Options().(*descriptorpb.FieldOptions); ok && opts != nil {
+		scope = protov2.GetExtension(opts, upspb.E_RequiredScope).(string)
+	}
+	v.scopes.Store(fd, scope)
+	return scope
+}
+
+// filter returns the response with the fields that the principal of the
+// context may not see cleared.  The response is cloned before clearing
+// fields, as it may be shared by the handler.
+func (v *FieldVisibility) filter(ctx context.Context, resp proto.Message) proto.Message {
+	principal, _ := AuthenticatedPrincipal(ctx)
+	allowed := func(fd protoreflect.FieldDescriptor) bool {
+		scope := v.scope(fd)
+		return scope == "" || (principal != nil && principal.HasScope(scope))
+	}
+	if !v.strip(proto.MessageReflect(resp), allowed, false) {
+		return resp
+	}
+	resp = proto.Clone(resp)
+	v.strip(proto.MessageReflect(resp), allowed, true)
+	return resp
+}
+
+// strip reports whether m has fields that are not allowed, clearing them
+// if clear is true.
+func (v *FieldVisibility) strip(m protoreflect.Message, allowed func(protoreflect.FieldDescriptor) bool, clear bool) bool {
+	found := false
+	m.Range(func(fd protoreflect.FieldDescriptor, val protoreflect.Value) bool {
+		if !allowed(fd) {
+			found = true
+			if clear {
+				m.Clear(fd)
+			}
+			return clear
+		}
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				val.Map().Range(func(_ protoreflect.MapKey, val protoreflect.Value) bool {
+					found = v.strip(val.Message(), allowed, clear) || found
+					return clear || !found
+				})
+			}
+		case fd.Message() == nil:
+		case fd.IsList():
+			list := val.List()
+			for i := 0; i < list.Len() && (clear || !found); i++ {
+				found = v.strip(list.Get(i).Message(), allowed, clear) || found
+			}
+		default:
+			found = v.strip(val.Message(), allowed, clear) || found
+		}
+		return clear || !found
+	})
+	return found
+}
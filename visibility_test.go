@@ -0,0 +1,79 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	protov2 "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/qpliu/ups/testingups"
+	"github.com/qpliu/ups/upspb"
+)
+
+func TestFieldVisibility(t *testing.T) {
+	call := func(config Config, handler interface{}, principal *Principal) string {
+		req := httptest.NewRequest(http.MethodPost, "/op", bytes.NewBufferString(`{"name":"op"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if principal != nil {
+			req = req.WithContext(WithValue(req.Context(), PrincipalKey, principal))
+		}
+		resp := httptest.NewRecorder()
+		UPSWithConfig(handler, config).ServeHTTP(resp, req)
+		return resp.Body.String()
+	}
+
+	shared := &upspb.Operation{Name: "op", Done: true, Error: &upspb.OperationError{Code: 5, Message: "internal detail"}}
+	config := DefaultConfig
+	config.FieldVisibility = &FieldVisibility{Scopes: map[protoreflect.FullName]string{"ups.OperationError.message": "admin"}}
+	op := func(req *testingups.HelloRequest) *upspb.Operation {
+		return shared
+	}
+	if body := call(config, op, nil); body != `{"name":"op","done":true,"error":{"code":5}}` {
+		t.Errorf("unexpected public response %s", body)
+	}
+	if body := call(config, op, &Principal{Scopes: []string{"admin"}}); body != `{"name":"op","done":true,"error":{"code":5,"message":"internal detail"}}` {
+		t.Errorf("unexpected admin response %s", body)
+	}
+	if shared.Error.Message != "internal detail" {
+		t.Errorf("shared response was modified")
+	}
+
+	opts := &descriptorpb.FieldOptions{}
+	protov2.SetExtension(opts, upspb.E_RequiredScope, "admin")
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:    proto.String("visibility.proto"),
+		Package: proto.String("visibility"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Response"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("name"), JsonName: proto.String("name"), Number: proto.Int32(1), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()},
+				{Name: proto.String("secret"), JsonName: proto.String("secret"), Number: proto.Int32(2), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(), Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(), Options: opts},
+			},
+		}},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := fd.Messages().ByName("Response")
+	config.FieldVisibility = &FieldVisibility{}
+	dynamic := func(req *testingups.HelloRequest) *dynamicpb.Message {
+		m := dynamicpb.NewMessage(md)
+		m.Set(md.Fields().ByName("name"), protoreflect.ValueOfString("op"))
+		m.Set(md.Fields().ByName("secret"), protoreflect.ValueOfString("s3cret"))
+		return m
+	}
+	if body := call(config, dynamic, &Principal{Scopes: []string{"read"}}); body != `{"name":"op"}` {
+		t.Errorf("unexpected public response %s", body)
+	}
+	if body := call(config, dynamic, &Principal{Scopes: []string{"admin"}}); body != `{"name":"op","secret":"s3cret"}` {
+		t.Errorf("unexpected admin response %s", body)
+	}
+}
@@ -0,0 +1,256 @@
+// Package webhook sends messages to the URLs of webhook subscribers,
+// signed, with retries and dead-lettering, as the sending counterpart of
+// ups handlers, which can receive them.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+
+	"github.com/qpliu/ups"
+	"github.com/qpliu/ups/consumer"
+)
+
+// Subscriber is a webhook subscriber.
+type Subscriber struct {
+	URL string
+
+	// Secret, if not empty, signs the requests with the
+	// Webhook-Signature header, which is verified with Verify.
+	Secret []byte
+
+	// JSON, if true, sends JSON requests.  Otherwise, requests are
+	// protobuf.
+	JSON bool
+}
+
+// Dispatcher sends messages to subscribers as POST requests with the
+// Webhook-Event, Webhook-Delivery, and Webhook-Signature headers.
+//
+// Requests with 2xx responses are delivered.  Requests with 408, 429,
+// or 5xx responses, or that fail, are retried, and are sent to the
+// DeadLetter Sink, if any, when the retries are exhausted.  Requests
+// with other responses are sent to the DeadLetter Sink without being
+// retried.
+type Dispatcher struct {
+	// Client sends the requests.  If nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// JSONMarshaler marshals JSON requests.  If nil, the JSONMarshaler
+	// of ups.DefaultConfig is used.
+	JSONMarshaler *jsonpb.Marshaler
+
+	// Retries is the number of times a request is retried.
+	Retries int
+
+	// RetryDelay is the delay before the first retry, which doubles
+	// for each subsequent retry.
+	RetryDelay time.Duration
+
+	// DeadLetter, if not nil, is sent the requests that fail, with the
+	// request headers and with the Ups-Status header set to the status
+	// of the last attempt, or 0 if it failed without a response, and
+	// the Webhook-Url header set to the URL of the subscriber.
+	DeadLetter consumer.Sink
+
+	LogError func(context.Context, string, error)
+}
+
+// New creates a Dispatcher that retries requests 3 times, starting after
+// a second, logging errors like ups.DefaultConfig.
+func New() *Dispatcher {
+	return &Dispatcher{
+		Retries:    3,
+		RetryDelay: time.Second,
+		LogError:   ups.DefaultConfig.LogError,
+	}
+}
+
+// StatusError is logged for requests that fail.
+type StatusError struct {
+	Status int
+}
+
+func (err *StatusError) Error() string {
+	return "webhook: status " + strconv.Itoa(err.Status)
+}
+
+func (err *StatusError) StatusCode() int {
+	return err.Status
+}
+
+// Send sends the message for the event to the subscriber, returning the
+// error of the last attempt if it is not delivered.  If the DeadLetter
+// Sink accepts the failed request, Send returns nil.
+func (d *Dispatcher) Send(ctx context.Context, sub *Subscriber, event string, msg proto.Message) error {
+	body, contentType, err := d.marshal(sub, msg)
+	if err != nil {
+		d.logError(ctx, "webhook.marshal", err)
+		return err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	header.Set("Webhook-Event", event)
+	header.Set("Webhook-Delivery", deliveryID())
+
+	delay := d.RetryDelay
+	var statusCode int
+	for attempt := 0; ; attempt++ {
+		statusCode, err = d.post(ctx, sub, header, body)
+		if err == nil {
+			return nil
+		}
+		d.logError(ctx, "webhook.post", err)
+		if !retryable(statusCode) || attempt >= d.Retries || ctx.Err() != nil {
+			break
+		}
+		if delay > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			case <-t.C:
+			}
+			delay *= 2
+		}
+	}
+	if d.DeadLetter == nil {
+		return err
+	}
+	dead := &consumer.Message{
+		Key:     []byte(header.Get("Webhook-Delivery")),
+		Value:   body,
+		Headers: header.Clone(),
+	}
+	dead.Headers.Set("Ups-Status", strconv.Itoa(statusCode))
+	dead.Headers.Set("Webhook-Url", sub.URL)
+	if err := d.DeadLetter.Send(ctx, dead); err != nil {
+		d.logError(ctx, "Sink.Send", err)
+		return err
+	}
+	return nil
+}
+
+func (d *Dispatcher) marshal(sub *Subscriber, msg proto.Message) ([]byte, string, error) {
+	if !sub.JSON {
+		body, err := proto.Marshal(msg)
+		return body, "application/octet-stream", err
+	}
+	marshaler := d.JSONMarshaler
+	if marshaler == nil {
+		marshaler = ups.DefaultConfig.JSONMarshaler
+	}
+	body, err := marshaler.MarshalToString(msg)
+	return []byte(body), "application/json", err
+}
+
+// post sends a request, returning the status code, which is 0 if there
+// is no response, and an error if it is not delivered.
+func (d *Dispatcher) post(ctx context.Context, sub *Subscriber, header http.Header, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	req.Header = header.Clone()
+	if len(sub.Secret) > 0 {
+		req.Header.Set("Webhook-Signature", Sign(sub.Secret, time.Now(), body))
+	}
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, &StatusError{Status: resp.StatusCode}
+	}
+	return resp.StatusCode, nil
+}
+
+func retryable(statusCode int) bool {
+	return statusCode == 0 || statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+func deliveryID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func (d *Dispatcher) logError(ctx context.Context, tag string, err error) {
+	if d.LogError != nil {
+		d.LogError(ctx, tag, err)
+	}
+}
+
+var (
+	errSignature        = errors.New("webhook: invalid signature")
+	errSignatureExpired = errors.New("webhook: signature expired")
+)
+
+// Sign returns the Webhook-Signature header value of the body sent at
+// t, which is t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">.
+func Sign(secret []byte, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(signature(secret, timestamp, body))
+}
+
+func signature(secret []byte, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'.'})
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// Verify verifies the Webhook-Signature header value of the body, which
+// must have been signed within the tolerance, if not zero, of now.
+func Verify(secret []byte, header string, body []byte, tolerance time.Duration) error {
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			if sig, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errSignature
+	}
+	expected := signature(secret, timestamp, body)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			if tolerance > 0 {
+				if age := time.Since(time.Unix(unix, 0)); age > tolerance || age < -tolerance {
+					return errSignatureExpired
+				}
+			}
+			return nil
+		}
+	}
+	return errSignature
+}
@@ -0,0 +1,98 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/qpliu/ups/consumer"
+	"github.com/qpliu/ups/testingups"
+)
+
+type testSink []*consumer.Message
+
+func (s *testSink) Send(ctx context.Context, msg *consumer.Message) error {
+	*s = append(*s, msg)
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	secret := []byte("secret")
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := Verify(secret, r.Header.Get("Webhook-Signature"), body, time.Minute); err != nil {
+			t.Errorf("%s: %v", r.URL.Path, err)
+		}
+		if r.Header.Get("Webhook-Event") != "hello" || r.Header.Get("Webhook-Delivery") == "" {
+			t.Errorf("%s: unexpected headers: %v", r.URL.Path, r.Header)
+		}
+		calls[r.URL.Path]++
+		switch r.URL.Path {
+		case "/json":
+			if r.Header.Get("Content-Type") != "application/json" || string(body) != `{"text":"Hello"}` {
+				t.Errorf("unexpected JSON request: %s", body)
+			}
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/invalid":
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			var msg testingups.HelloResponse
+			if err := proto.Unmarshal(body, &msg); err != nil || msg.Text != "Hello" {
+				t.Errorf("unexpected request: %v %v", &msg, err)
+			}
+		}
+	}))
+	defer server.Close()
+
+	var dead testSink
+	d := New()
+	d.LogError = nil
+	d.RetryDelay = 0
+	d.DeadLetter = &dead
+	msg := &testingups.HelloResponse{Text: "Hello"}
+	for _, sub := range []*Subscriber{
+		{URL: server.URL + "/proto", Secret: secret},
+		{URL: server.URL + "/json", Secret: secret, JSON: true},
+		{URL: server.URL + "/unavailable", Secret: secret},
+		{URL: server.URL + "/invalid", Secret: secret},
+	} {
+		if err := d.Send(context.Background(), sub, "hello", msg); err != nil {
+			t.Errorf("%s: %v", sub.URL, err)
+		}
+	}
+
+	if calls["/proto"] != 1 || calls["/json"] != 1 || calls["/unavailable"] != 4 || calls["/invalid"] != 1 {
+		t.Errorf("unexpected calls: %v", calls)
+	}
+	if len(dead) != 2 {
+		t.Fatalf("unexpected dead letters: %d", len(dead))
+	}
+	if dead[0].Headers.Get("Ups-Status") != "503" || dead[0].Headers.Get("Webhook-Url") != server.URL+"/unavailable" || dead[1].Headers.Get("Ups-Status") != "400" {
+		t.Errorf("unexpected dead letters: %v %v", dead[0].Headers, dead[1].Headers)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte("body")
+	header := Sign(secret, time.Now().Add(-time.Hour), body)
+	if err := Verify(secret, header, body, 0); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := Verify(secret, header, body, time.Minute); err != errSignatureExpired {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := Verify([]byte("other"), header, body, 0); err != errSignature {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := Verify(secret, header, []byte("other"), 0); err != errSignature {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package ups
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// WellKnownTypeOptions relaxes the JSON handling of well-known types,
+// for clients that do not follow the canonical JSON mapping of
+// Timestamp, Duration, wrapper, and Struct messages.
+type WellKnownTypeOptions struct {
+	// AcceptEpochMillis, if true, unmarshals numbers in JSON requests
+	// as Timestamps in milliseconds since the Unix epoch, in addition
+	// to RFC 3339 strings.
+	AcceptEpochMillis bool
+
+	// TimestampsAsEpochMillis, if true, marshals Timestamps in JSON
+	// responses as numbers of milliseconds since the Unix epoch.
+	TimestampsAsEpochMillis bool
+
+	// AcceptSeconds, if true, unmarshals numbers in JSON requests as
+	// Durations in seconds, in addition to strings such as "1.5s".
+	AcceptSeconds bool
+
+	// DurationsAsSeconds, if true, marshals Durations in JSON responses
+	// as numbers of seconds.
+	DurationsAsSeconds bool
+
+	// AcceptWrapperObjects, if true, unmarshals objects with a single
+	// "value" field in JSON requests as wrappers, such as
+	// google.protobuf.StringValue, in addition to their values.
+	AcceptWrapperObjects bool
+
+	// AcceptStructStrings, if true, unmarshals strings with JSON objects
+	// in JSON requests as Structs.
+	AcceptStructStrings bool
+}
+
+// rewriteRequest returns the JSON request with the well-known types
+// rewritten in their canonical JSON form.
+func (opts *WellKnownTypeOptions) rewriteRequest(req []byte, md protoreflect.MessageDescriptor) ([]byte, error) {
+	return rewriteWellKnownTypes(req, md, opts.canonical)
+}
+
+// rewriteResponse returns the JSON response with the well-known types
+// rewritten in the forms of the options.
+func (opts *WellKnownTypeOptions) rewriteResponse(resp string, md protoreflect.MessageDescriptor) (string, error) {
+	if !opts.TimestampsAsEpochMillis && !opts.DurationsAsSeconds {
+		return resp, nil
+	}
+	b, err := rewriteWellKnownTypes([]byte(resp), md, opts.relaxed)
+	return string(b), err
+}
+
+func (opts *WellKnownTypeOptions) canonical(md protoreflect.MessageDescriptor, v interface{}) (interface{}, bool) {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		if n, ok := v.(json.Number); ok && opts.AcceptEpochMillis {
+			if ms, err := n.Int64(); err == nil {
+				return time.UnixMilli(ms).UTC().Format(time.RFC3339Nano), true
+			}
+		}
+	case "google.protobuf.Duration":
+		if n, ok := v.(json.Number); ok && opts.AcceptSeconds {
+			if s, err := n.Float64(); err == nil {
+				return strconv.FormatFloat(s, 'f', -1, 64) + "s", true
+			}
+		}
+	case "google.protobuf.Struct":
+		if s, ok := v.(string); ok && opts.AcceptStructStrings {
+			var obj map[string]interface{}
+			if json.Unmarshal([]byte(s), &obj) == nil {
+				return obj, true
+			}
+		}
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue",
+		"google.protobuf.BytesValue":
+		if obj, ok := v.(map[string]interface{}); ok && len(obj) == 1 && opts.AcceptWrapperObjects {
+			if value, ok := obj["value"]; ok {
+				return value, true
+			}
+		}
+	}
+	return v, false
+}
+
+func (opts *WellKnownTypeOptions) relaxed(md protoreflect.MessageDescriptor, v interface{}) (interface{}, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return v, false
+	}
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil && opts.TimestampsAsEpochMillis {
+			return json.Number(strconv.FormatInt(t.UnixMilli(), 10)), true
+		}
+	case "google.protobuf.Duration":
+		if d, err := strconv.ParseFloat(strings.TrimSuffix(s, "s"), 64); err == nil && opts.DurationsAsSeconds {
+			return json.Number(strconv.FormatFloat(d, 'f', -1, 64)), true
+		}
+	}
+	return v, false
+}
+
+// rewriteWellKnownTypes returns the JSON of a message with the values of
+// the well-known types rewritten by f, which reports whether it
+// rewrote the value.
+func rewriteWellKnownTypes(data []byte, md protoreflect.MessageDescriptor, f func(protoreflect.MessageDescriptor, interface{}) (interface{}, bool)) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	v, changed := rewriteWellKnownValue(v, md, f)
+	if !changed {
+		return data, nil
+	}
+	return json.Marshal(v)
+}
+
+func rewriteWellKnownValue(v interface{}, md protoreflect.MessageDescriptor, f func(protoreflect.MessageDescriptor, interface{}) (interface{}, bool)) (interface{}, bool) {
+	if md.ParentFile().Package() == "google.protobuf" {
+		return f(md, v)
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return v, false
+	}
+	changed := false
+	for key, val := range obj {
+		fd := md.Fields().ByJSONName(key)
+		if fd == nil {
+			fd = md.Fields().ByName(protoreflect.Name(key))
+		}
+		if fd == nil {
+			continue
+		}
+		if fd.IsMap() {
+			fd = fd.MapValue()
+			if m, ok := val.(map[string]interface{}); ok && fd.Message() != nil {
+				for k, elt := range m {
+					if rewritten, ok := rewriteWellKnownValue(elt, fd.Message(), f); ok {
+						m[k] = rewritten
+						changed = true
+					}
+				}
+			}
+		} else if fd.Message() == nil {
+			continue
+		} else if list, ok := val.([]interface{}); ok && fd.IsList() {
+			for i, elt := range list {
+				if rewritten, ok := rewriteWellKnownValue(elt, fd.Message(), f); ok {
+					list[i] = rewritten
+					changed = true
+				}
+			}
+		} else if rewritten, ok := rewriteWellKnownValue(val, fd.Message(), f); ok {
+			obj[key] = rewritten
+			changed = true
+		}
+	}
+	return obj, changed
+}
@@ -0,0 +1,74 @@
+package ups
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestWellKnownTypeOptions(t *testing.T) {
+	field := func(name string, number int32, typeName string, label descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{Name: proto.String(name), JsonName: proto.String(name), Number: proto.Int32(number), Type: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(), TypeName: proto.String(typeName), Label: label.Enum()}
+	}
+	optional, repeated := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	fd, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("wkt.proto"),
+		Package:    proto.String("wkt"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/timestamp.proto", "google/protobuf/duration.proto", "google/protobuf/wrappers.proto", "google/protobuf/struct.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{{
+			Name: proto.String("Event"),
+			Field: []*descriptorpb.FieldDescriptorProto{
+				field("time", 1, ".google.protobuf.Timestamp", optional),
+				field("times", 2, ".google.protobuf.Timestamp", repeated),
+				field("timeout", 3, ".google.protobuf.Duration", optional),
+				field("name", 4, ".google.protobuf.StringValue", optional),
+				field("data", 5, ".google.protobuf.Struct", optional),
+				field("child", 6, ".wkt.Event", optional),
+			},
+		}},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := func(req *dynamicpb.Message) *dynamicpb.Message {
+		return req
+	}
+
+	relaxed := &WellKnownTypeOptions{AcceptEpochMillis: true, AcceptSeconds: true, AcceptWrapperObjects: true, AcceptStructStrings: true}
+	for _, test := range []struct {
+		wkt        *WellKnownTypeOptions
+		body       string
+		statusCode int
+		expected   string
+	}{
+		{nil, `{"time":"2024-01-02T03:04:05Z","timeout":"1.5s"}`, http.StatusOK, `{"time":"2024-01-02T03:04:05Z","timeout":"1.500s"}`},
+		{nil, `{"time":1704164645000}`, http.StatusInternalServerError, "\n"},
+		{relaxed, `{"time":1704164645000,"times":[1704164645500],"child":{"timeout":1.5}}`, http.StatusOK, `{"time":"2024-01-02T03:04:05Z","times":["2024-01-02T03:04:05.500Z"],"child":{"timeout":"1.500s"}}`},
+		{relaxed, `{"name":{"value":"World"},"data":"{\"a\":1}"}`, http.StatusOK, `{"name":"World","data":{"a":1}}`},
+		{&WellKnownTypeOptions{TimestampsAsEpochMillis: true, DurationsAsSeconds: true}, `{"time":"2024-01-02T03:04:05Z","child":{"timeout":"1.5s"}}`, http.StatusOK, `{"child":{"timeout":1.5},"time":1704164645000}`},
+	} {
+		config := DefaultConfig
+		config.LogError = nil
+		config.WellKnownTypes = test.wkt
+		handler := UPSDynamicWithConfig(echo, fd.Messages().ByName("Event"), config)
+		req := httptest.NewRequest(http.MethodPost, "/event", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, req)
+		if resp.Code != test.statusCode || resp.Body.String() != test.expected {
+			t.Errorf("%+v %s: unexpected response %d %s", test.wkt, test.body, resp.Code, resp.Body.String())
+		}
+	}
+}